@@ -256,3 +256,13 @@ func getIndexesPostgres(pool *db.DBPool, ctx context.Context, schema, tableName
 
     return indexes, nil
 }
+
+func storeMetricsSnapshotPostgres(pool *db.DBPool, ctx context.Context, metrics *RealTimeMetrics, data []byte) error {
+    _, err := pool.PgxPool.Exec(ctx,
+        `INSERT INTO admin_metrics_snapshots (taken_at, metrics) VALUES ($1, $2)`,
+        metrics.Timestamp, data)
+    if err != nil {
+        return fmt.Errorf("failed to store metrics snapshot: %w", err)
+    }
+    return nil
+}
@@ -0,0 +1,41 @@
+package admin
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+
+    "gooner/db"
+    "gooner/jobs"
+)
+
+// MetricsSnapshotJobType is the job that stores the current real-time
+// metrics in admin_metrics_snapshots, so they can be looked at over time.
+const MetricsSnapshotJobType = "metrics_snapshot"
+
+func StoreMetricsSnapshot(pool *db.DBPool, ctx context.Context) error {
+    metrics, err := CollectRealTimeMetrics(pool, ctx)
+    if err != nil {
+        return fmt.Errorf("failed to collect real-time metrics: %w", err)
+    }
+
+    data, err := json.Marshal(metrics)
+    if err != nil {
+        return fmt.Errorf("failed to encode metrics: %w", err)
+    }
+
+    switch pool.Type {
+    case "postgres":
+        return storeMetricsSnapshotPostgres(pool, ctx, metrics, data)
+    case "sqlite3":
+        return storeMetricsSnapshotSQLite(pool, ctx, metrics, data)
+    default:
+        return fmt.Errorf("unsupported database type: %s", pool.Type)
+    }
+}
+
+func NewMetricsSnapshotJob(pool *db.DBPool) jobs.HandlerFunc {
+    return func(ctx context.Context, job *db.Job) ([]byte, error) {
+        return nil, StoreMetricsSnapshot(pool, ctx)
+    }
+}
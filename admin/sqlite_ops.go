@@ -209,3 +209,20 @@ func collectRealTimeMetricsSQLite(pool *db.DBPool, ctx context.Context) (*RealTi
         App:       ApplicationHealth{}, // Populate as needed
     }, nil
 }
+
+func storeMetricsSnapshotSQLite(pool *db.DBPool, ctx context.Context, metrics *RealTimeMetrics, data []byte) error {
+    writeTx, err := pool.GetWriteTx(ctx)
+    if err != nil {
+        return fmt.Errorf("failed to begin transaction: %w", err)
+    }
+    defer writeTx.Rollback()
+
+    _, err = writeTx.ExecContext(ctx,
+        `INSERT INTO admin_metrics_snapshots (taken_at, metrics) VALUES (?, ?)`,
+        metrics.Timestamp.UTC(), string(data))
+    if err != nil {
+        return fmt.Errorf("failed to store metrics snapshot: %w", err)
+    }
+
+    return writeTx.Commit()
+}
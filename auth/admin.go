@@ -0,0 +1,18 @@
+package auth
+
+// admins are the users the admin endpoints are open to. There are no
+// roles yet, so they come from the config.
+var admins = map[string]bool{}
+
+// SetAdmins replaces the admin users. It is meant to be called once at
+// startup, before requests are served.
+func SetAdmins(userIDs []string) {
+    admins = make(map[string]bool, len(userIDs))
+    for _, id := range userIDs {
+        admins[id] = true
+    }
+}
+
+func IsAdmin(userID string) bool {
+    return admins[userID]
+}
@@ -0,0 +1,68 @@
+package blob
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "io"
+    "sort"
+    "sync"
+)
+
+var ErrNotFound = errors.New("blob not found")
+
+// Store keeps opaque blobs under slash-separated keys chosen by the
+// caller, such as "general/<uuid>". Get returns an io.ReadSeeker when the
+// store can seek, so HTTP handlers can serve ranges.
+type Store interface {
+    Put(ctx context.Context, key string, r io.Reader, contentType string) error
+    Get(ctx context.Context, key string) (io.ReadCloser, error)
+    Delete(ctx context.Context, key string) error
+}
+
+// Config describes the store from config.yaml. Fields that do not apply to
+// a kind are ignored.
+type Config struct {
+    Kind string // "local"
+    Dir  string // local
+}
+
+type StoreFactory func(cfg Config) (Store, error)
+
+var (
+    factoriesMu sync.RWMutex
+    factories   = map[string]StoreFactory{
+        "local": newLocalStoreFromConfig,
+    }
+)
+
+// RegisterStoreKind makes a store kind available to config.yaml, e.g. an
+// S3-compatible one.
+func RegisterStoreKind(kind string, factory StoreFactory) {
+    factoriesMu.Lock()
+    defer factoriesMu.Unlock()
+    factories[kind] = factory
+}
+
+func StoreKinds() []string {
+    factoriesMu.RLock()
+    defer factoriesMu.RUnlock()
+
+    kinds := make([]string, 0, len(factories))
+    for kind := range factories {
+        kinds = append(kinds, kind)
+    }
+    sort.Strings(kinds)
+    return kinds
+}
+
+func NewStore(cfg Config) (Store, error) {
+    factoriesMu.RLock()
+    factory, ok := factories[cfg.Kind]
+    factoriesMu.RUnlock()
+
+    if !ok {
+        return nil, fmt.Errorf("unknown blob store %q (available: %v)", cfg.Kind, StoreKinds())
+    }
+    return factory(cfg)
+}
@@ -0,0 +1,97 @@
+package blob
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "io"
+    "io/fs"
+    "os"
+    "path/filepath"
+)
+
+// LocalStore keeps blobs as files under Dir, one per key.
+type LocalStore struct {
+    Dir string
+}
+
+func NewLocalStore(dir string) (*LocalStore, error) {
+    if dir == "" {
+        return nil, errors.New("local blob store needs a dir")
+    }
+    if err := os.MkdirAll(dir, 0o750); err != nil {
+        return nil, fmt.Errorf("failed to create blob directory: %w", err)
+    }
+    return &LocalStore{Dir: dir}, nil
+}
+
+func newLocalStoreFromConfig(cfg Config) (Store, error) {
+    return NewLocalStore(cfg.Dir)
+}
+
+// path maps a key to its file. Keys must be relative slash-separated paths
+// without "." or ".." elements, so they cannot leave Dir.
+func (s *LocalStore) path(key string) (string, error) {
+    if !fs.ValidPath(key) || key == "." {
+        return "", fmt.Errorf("invalid blob key %q", key)
+    }
+    return filepath.Join(s.Dir, filepath.FromSlash(key)), nil
+}
+
+// Put writes the blob to a temporary file first, so readers never see a
+// partial one.
+func (s *LocalStore) Put(ctx context.Context, key string, r io.Reader, contentType string) error {
+    path, err := s.path(key)
+    if err != nil {
+        return err
+    }
+    if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+        return fmt.Errorf("failed to create blob directory: %w", err)
+    }
+
+    tmp, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+    if err != nil {
+        return fmt.Errorf("failed to create blob: %w", err)
+    }
+    defer os.Remove(tmp.Name())
+    defer tmp.Close()
+
+    if _, err := io.Copy(tmp, r); err != nil {
+        return fmt.Errorf("failed to write blob: %w", err)
+    }
+    if err := tmp.Close(); err != nil {
+        return fmt.Errorf("failed to write blob: %w", err)
+    }
+    if err := os.Rename(tmp.Name(), path); err != nil {
+        return fmt.Errorf("failed to store blob: %w", err)
+    }
+    return nil
+}
+
+// Get returns the blob's *os.File.
+func (s *LocalStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+    path, err := s.path(key)
+    if err != nil {
+        return nil, err
+    }
+    file, err := os.Open(path)
+    if errors.Is(err, fs.ErrNotExist) {
+        return nil, ErrNotFound
+    }
+    if err != nil {
+        return nil, fmt.Errorf("failed to open blob: %w", err)
+    }
+    return file, nil
+}
+
+// Delete removes the blob. Deleting a missing one is not an error.
+func (s *LocalStore) Delete(ctx context.Context, key string) error {
+    path, err := s.path(key)
+    if err != nil {
+        return err
+    }
+    if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+        return fmt.Errorf("failed to delete blob: %w", err)
+    }
+    return nil
+}
@@ -2,4 +2,5 @@
 
 set -xe
 
-time go build main.go
+# chat search uses SQLite's FTS5 extension and falls back to LIKE without it
+time go build -tags sqlite_fts5 main.go
@@ -0,0 +1,468 @@
+package chat
+
+import (
+    "bytes"
+    "context"
+    "errors"
+    "fmt"
+    "image"
+    _ "image/gif"
+    "image/jpeg"
+    "image/png"
+    "io"
+    "mime"
+    "mime/multipart"
+    "net/http"
+    "path"
+    "strconv"
+    "strings"
+    "time"
+    "unicode"
+    "unicode/utf8"
+
+    "gooner/appcontext"
+    "gooner/blob"
+    "gooner/db"
+
+    "golang.org/x/image/draw"
+)
+
+const (
+    DefaultMaxAttachmentSize = 10 << 20
+    DefaultMaxAttachments    = 10
+
+    thumbnailSize  = 320        // longest side, in pixels
+    maxImagePixels = 25_000_000 // larger images are stored without a thumbnail
+)
+
+var ErrAttachmentNotFound = errors.New("attachment not found")
+
+// thumbnailTypes are the sniffed types the standard library decodes.
+var thumbnailTypes = map[string]bool{
+    "image/png":  true,
+    "image/jpeg": true,
+    "image/gif":  true,
+}
+
+// inlineTypes are shown by browsers. Anything else is served as a download,
+// so an uploaded HTML page never runs in our origin.
+var inlineTypes = map[string]bool{
+    "image/png":  true,
+    "image/jpeg": true,
+    "image/gif":  true,
+    "image/webp": true,
+}
+
+// attachmentRow is one row of chat_attachments.
+type attachmentRow struct {
+    messageID int
+    Attachment
+}
+
+// attachAttachments adds rows, ordered by position, to their messages.
+// Deleted messages get none.
+func attachAttachments(messages []Message, rows []attachmentRow) {
+    byID := make(map[int]*Message, len(messages))
+    for i := range messages {
+        if messages[i].DeletedAt == nil {
+            byID[messages[i].ID] = &messages[i]
+        }
+    }
+
+    for _, row := range rows {
+        if msg, ok := byID[row.messageID]; ok {
+            msg.Attachments = append(msg.Attachments, row.withURLs())
+        }
+    }
+}
+
+func (a Attachment) withURLs() Attachment {
+    a.URL = "/api/chat/attachments/" + a.ID
+    if a.thumbnailKey != "" {
+        a.ThumbnailURL = a.URL + "/thumbnail"
+    }
+    return a
+}
+
+func withURLs(attachments []Attachment) []Attachment {
+    if len(attachments) == 0 {
+        return nil
+    }
+    stored := make([]Attachment, len(attachments))
+    for i, a := range attachments {
+        stored[i] = a.withURLs()
+    }
+    return stored
+}
+
+// canDownload tells whether the caller whose view of room this is may
+// download its attachments: only members, not everyone who can read a
+// public room.
+func canDownload(room *Room) bool {
+    return room.Role != ""
+}
+
+// hideAttachments drops the attachments of messages the caller read in a
+// room they cannot download them from, rather than list URLs that 404.
+func hideAttachments(room *Room, messages []Message) {
+    if canDownload(room) {
+        return
+    }
+    for i := range messages {
+        messages[i].Attachments = nil
+    }
+}
+
+func nullInt(n int) *int {
+    if n == 0 {
+        return nil
+    }
+    return &n
+}
+
+func nullString(s string) *string {
+    if s == "" {
+        return nil
+    }
+    return &s
+}
+
+// GetAttachment returns an attachment of a message that is not deleted,
+// and the room it was posted in.
+func GetAttachment(pool *db.DBPool, ctx context.Context, id string) (*Attachment, string, error) {
+    switch pool.Type {
+    case "postgres":
+        return getAttachmentPostgres(pool, ctx, id)
+    case "sqlite3":
+        return getAttachmentSQLite(pool, ctx, id)
+    default:
+        return nil, "", fmt.Errorf("unsupported database type: %s", pool.Type)
+    }
+}
+
+// UploadAttachmentsHandler sends a message with files. It takes a
+// multipart form with room_id, one or more file parts, and optionally
+// content and reply_to.
+func (h *Handler) UploadAttachmentsHandler(ctx *appcontext.AppContext) {
+    userID, ok := ctx.Context.Value("userID").(string)
+    if !ok {
+        http.Error(ctx.Writer, "Unauthorized", http.StatusUnauthorized)
+        return
+    }
+
+    maxSize, maxFiles := h.MaxAttachmentSize, h.MaxAttachments
+    if maxSize <= 0 {
+        maxSize = DefaultMaxAttachmentSize
+    }
+    if maxFiles <= 0 {
+        maxFiles = DefaultMaxAttachments
+    }
+
+    // room for every file at the limit, plus the other fields
+    ctx.Request.Body = http.MaxBytesReader(ctx.Writer, ctx.Request.Body, maxSize*int64(maxFiles)+1<<20)
+    if err := ctx.Request.ParseMultipartForm(8 << 20); err != nil {
+        var tooLarge *http.MaxBytesError
+        if errors.As(err, &tooLarge) {
+            http.Error(ctx.Writer, "Upload is too large", http.StatusRequestEntityTooLarge)
+            return
+        }
+        http.Error(ctx.Writer, "Invalid multipart form", http.StatusBadRequest)
+        return
+    }
+    defer ctx.Request.MultipartForm.RemoveAll()
+
+    roomID := ctx.Request.FormValue("room_id")
+    if roomID == "" {
+        http.Error(ctx.Writer, "room_id is required", http.StatusBadRequest)
+        return
+    }
+    var replyTo int
+    if value := ctx.Request.FormValue("reply_to"); value != "" {
+        n, err := strconv.Atoi(value)
+        if err != nil || n < 0 {
+            http.Error(ctx.Writer, "reply_to must be a message id", http.StatusBadRequest)
+            return
+        }
+        replyTo = n
+    }
+
+    files := ctx.Request.MultipartForm.File["file"]
+    if len(files) == 0 {
+        http.Error(ctx.Writer, "file is required", http.StatusBadRequest)
+        return
+    }
+    if len(files) > maxFiles {
+        http.Error(ctx.Writer, fmt.Sprintf("at most %d files can be sent at once", maxFiles), http.StatusBadRequest)
+        return
+    }
+    for _, fh := range files {
+        if fh.Size > maxSize {
+            http.Error(ctx.Writer, fmt.Sprintf("files must not be larger than %d bytes", maxSize), http.StatusRequestEntityTooLarge)
+            return
+        }
+    }
+
+    // check the room before anything is written to the blob store
+    room, err := visibleRoom(h.Pool, ctx.Context, roomID, userID)
+    if err != nil {
+        h.sendError(ctx, err)
+        return
+    }
+    if room.ArchivedAt != nil {
+        h.sendError(ctx, ErrRoomArchived)
+        return
+    }
+
+    attachments := make([]Attachment, 0, len(files))
+    for _, fh := range files {
+        a, err := h.storeAttachment(ctx.Context, roomID, fh)
+        if err != nil {
+            h.deleteBlobs(ctx.Context, attachments)
+            ctx.Logger.Printf("Failed to store attachment: %v", err)
+            http.Error(ctx.Writer, "Failed to store attachment", http.StatusInternalServerError)
+            return
+        }
+        attachments = append(attachments, *a)
+    }
+
+    message, err := h.send(ctx.Context, userID, roomID, ctx.Request.FormValue("content"), replyTo, attachments)
+    if err != nil {
+        h.deleteBlobs(ctx.Context, attachments)
+        h.sendError(ctx, err)
+        return
+    }
+
+    writeJSON(ctx, http.StatusCreated, message)
+}
+
+// storeAttachment writes an uploaded file, and a thumbnail if it is an
+// image, to the blob store.
+func (h *Handler) storeAttachment(ctx context.Context, roomID string, fh *multipart.FileHeader) (*Attachment, error) {
+    file, err := fh.Open()
+    if err != nil {
+        return nil, fmt.Errorf("failed to open upload: %w", err)
+    }
+    defer file.Close()
+
+    head := make([]byte, 512)
+    n, err := io.ReadFull(file, head)
+    if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+        return nil, fmt.Errorf("failed to read upload: %w", err)
+    }
+    if _, err := file.Seek(0, io.SeekStart); err != nil {
+        return nil, fmt.Errorf("failed to read upload: %w", err)
+    }
+
+    id, err := db.GenUUID()
+    if err != nil {
+        return nil, fmt.Errorf("failed to generate attachment id: %w", err)
+    }
+
+    a := &Attachment{
+        ID:          id,
+        Filename:    cleanFilename(fh.Filename),
+        ContentType: http.DetectContentType(head[:n]),
+        Size:        fh.Size,
+        CreatedAt:   time.Now(),
+        blobKey:     roomID + "/" + id,
+    }
+    if err := h.Blobs.Put(ctx, a.blobKey, file, a.ContentType); err != nil {
+        return nil, err
+    }
+
+    if !thumbnailTypes[a.ContentType] {
+        return a, nil
+    }
+    if _, err := file.Seek(0, io.SeekStart); err != nil {
+        return a, nil
+    }
+
+    // an image that does not decode is still stored, without a thumbnail
+    var thumb []byte
+    a.Width, a.Height, thumb, err = thumbnail(file, a.ContentType)
+    if err != nil || thumb == nil {
+        return a, nil
+    }
+    a.thumbnailKey = a.blobKey + "_thumb"
+    if err := h.Blobs.Put(ctx, a.thumbnailKey, bytes.NewReader(thumb), thumbnailType(a.ContentType)); err != nil {
+        h.Blobs.Delete(ctx, a.blobKey)
+        return nil, err
+    }
+    return a, nil
+}
+
+// deleteBlobs removes the blobs of attachments that will not be stored
+// after all.
+func (h *Handler) deleteBlobs(ctx context.Context, attachments []Attachment) {
+    for _, a := range attachments {
+        for _, key := range []string{a.blobKey, a.thumbnailKey} {
+            if key == "" {
+                continue
+            }
+            if err := h.Blobs.Delete(ctx, key); err != nil {
+                h.Logger.Printf("Failed to delete blob %s: %v", key, err)
+            }
+        }
+    }
+}
+
+// DownloadAttachmentHandler serves an attachment to members of its room.
+func (h *Handler) DownloadAttachmentHandler(ctx *appcontext.AppContext) {
+    h.serveAttachment(ctx, false)
+}
+
+// AttachmentThumbnailHandler serves the thumbnail of an image attachment.
+func (h *Handler) AttachmentThumbnailHandler(ctx *appcontext.AppContext) {
+    h.serveAttachment(ctx, true)
+}
+
+func (h *Handler) serveAttachment(ctx *appcontext.AppContext, thumb bool) {
+    userID, ok := ctx.Context.Value("userID").(string)
+    if !ok {
+        http.Error(ctx.Writer, "Unauthorized", http.StatusUnauthorized)
+        return
+    }
+
+    a, roomID, err := GetAttachment(h.Pool, ctx.Context, ctx.Request.PathValue("id"))
+    if err == nil {
+        var room *Room
+        room, err = GetRoom(h.Pool, ctx.Context, roomID, userID)
+        if err == nil && !canDownload(room) {
+            err = ErrAttachmentNotFound
+        }
+    }
+    if errors.Is(err, ErrAttachmentNotFound) || errors.Is(err, ErrRoomNotFound) {
+        http.Error(ctx.Writer, "Attachment not found", http.StatusNotFound)
+        return
+    }
+    if err != nil {
+        ctx.Logger.Printf("Failed to get attachment: %v", err)
+        http.Error(ctx.Writer, "Failed to get attachment", http.StatusInternalServerError)
+        return
+    }
+
+    key, contentType := a.blobKey, a.ContentType
+    if thumb {
+        if a.thumbnailKey == "" {
+            http.Error(ctx.Writer, "Attachment has no thumbnail", http.StatusNotFound)
+            return
+        }
+        key, contentType = a.thumbnailKey, thumbnailType(a.ContentType)
+    }
+
+    body, err := h.Blobs.Get(ctx.Context, key)
+    if err != nil {
+        if errors.Is(err, blob.ErrNotFound) {
+            http.Error(ctx.Writer, "Attachment not found", http.StatusNotFound)
+            return
+        }
+        ctx.Logger.Printf("Failed to read attachment %s: %v", a.ID, err)
+        http.Error(ctx.Writer, "Failed to get attachment", http.StatusInternalServerError)
+        return
+    }
+    defer body.Close()
+
+    disposition := "attachment"
+    if inlineTypes[contentType] {
+        disposition = "inline"
+    }
+
+    header := ctx.Writer.Header()
+    header.Set("Content-Type", contentType)
+    header.Set("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": a.Filename}))
+    header.Set("X-Content-Type-Options", "nosniff")
+    header.Set("Content-Security-Policy", "default-src 'none'; sandbox")
+    header.Set("Cache-Control", "private, max-age=86400")
+
+    if seeker, ok := body.(io.ReadSeeker); ok {
+        http.ServeContent(ctx.Writer, ctx.Request, "", a.CreatedAt, seeker)
+        return
+    }
+    if !thumb {
+        header.Set("Content-Length", strconv.FormatInt(a.Size, 10))
+    }
+    io.Copy(ctx.Writer, body)
+}
+
+// cleanFilename keeps the last element of an uploaded file's name, without
+// control characters and at most 255 bytes long.
+func cleanFilename(name string) string {
+    name = path.Base(strings.ReplaceAll(name, `\`, "/"))
+    name = strings.TrimSpace(strings.Map(func(r rune) rune {
+        if unicode.IsControl(r) {
+            return -1
+        }
+        return r
+    }, name))
+    for len(name) > 255 {
+        _, size := utf8.DecodeLastRuneInString(name)
+        name = name[:len(name)-size]
+    }
+    if name == "" || name == "." || name == "/" {
+        return "file"
+    }
+    return name
+}
+
+// thumbnailType is the type thumbnails of contentType are encoded in.
+func thumbnailType(contentType string) string {
+    if contentType == "image/jpeg" {
+        return "image/jpeg"
+    }
+    return "image/png"
+}
+
+// thumbnail returns the size of an image and a thumbnail of it that fits in
+// thumbnailSize. Images over maxImagePixels get no thumbnail.
+func thumbnail(file io.ReadSeeker, contentType string) (int, int, []byte, error) {
+    config, _, err := image.DecodeConfig(file)
+    if err != nil {
+        return 0, 0, nil, err
+    }
+    if config.Width*config.Height > maxImagePixels {
+        return config.Width, config.Height, nil, nil
+    }
+
+    if _, err := file.Seek(0, io.SeekStart); err != nil {
+        return config.Width, config.Height, nil, err
+    }
+    img, _, err := image.Decode(file)
+    if err != nil {
+        return config.Width, config.Height, nil, err
+    }
+
+    var buf bytes.Buffer
+    small := scaleDown(img, thumbnailSize)
+    if thumbnailType(contentType) == "image/jpeg" {
+        err = jpeg.Encode(&buf, small, &jpeg.Options{Quality: 80})
+    } else {
+        err = png.Encode(&buf, small)
+    }
+    if err != nil {
+        return config.Width, config.Height, nil, err
+    }
+    return config.Width, config.Height, buf.Bytes(), nil
+}
+
+// scaleDown shrinks img to fit in a size by size square. Smaller images
+// are returned as they are.
+func scaleDown(img image.Image, size int) image.Image {
+    bounds := img.Bounds()
+    w, h := bounds.Dx(), bounds.Dy()
+    if w <= size && h <= size {
+        return img
+    }
+
+    tw, th := size, size
+    if w > h {
+        th = max(1, h*size/w)
+    } else {
+        tw = max(1, w*size/h)
+    }
+
+    // BiLinear filters over all source pixels when shrinking, and has fast
+    // paths for the image types the decoders return
+    dst := image.NewRGBA(image.Rect(0, 0, tw, th))
+    draw.BiLinear.Scale(dst, dst.Bounds(), img, bounds, draw.Src, nil)
+    return dst
+}
@@ -0,0 +1,118 @@
+package chat
+
+import (
+    "context"
+    "errors"
+    "fmt"
+
+    "github.com/jackc/pgx/v5"
+    "gooner/db"
+)
+
+func scanAttachmentPostgres(row pgx.Row) (*attachmentRow, error) {
+    var a attachmentRow
+    var width, height *int
+    var thumbnailKey *string
+    err := row.Scan(
+        &a.messageID,
+        &a.ID,
+        &a.Filename,
+        &a.ContentType,
+        &a.Size,
+        &width,
+        &height,
+        &a.blobKey,
+        &thumbnailKey,
+        &a.CreatedAt,
+    )
+    if err != nil {
+        return nil, err
+    }
+    if width != nil && height != nil {
+        a.Width, a.Height = *width, *height
+    }
+    if thumbnailKey != nil {
+        a.thumbnailKey = *thumbnailKey
+    }
+    return &a, nil
+}
+
+func loadAttachmentsPostgres(ctx context.Context, q pgxQuerier, messages []Message) error {
+    if len(messages) == 0 {
+        return nil
+    }
+
+    ids := make([]int, len(messages))
+    for i, msg := range messages {
+        ids[i] = msg.ID
+    }
+
+    rows, err := q.Query(ctx, `SELECT `+attachmentColumns+` FROM chat_attachments a
+              WHERE a.message_id = ANY($1)
+              ORDER BY a.message_id, a.position`, ids)
+    if err != nil {
+        return fmt.Errorf("failed to query attachments: %w", err)
+    }
+    defer rows.Close()
+
+    var attachments []attachmentRow
+    for rows.Next() {
+        a, err := scanAttachmentPostgres(rows)
+        if err != nil {
+            return fmt.Errorf("failed to scan attachment: %w", err)
+        }
+        attachments = append(attachments, *a)
+    }
+    if err := rows.Err(); err != nil {
+        return fmt.Errorf("error iterating attachments: %w", err)
+    }
+
+    attachAttachments(messages, attachments)
+    return nil
+}
+
+// attachmentKeysPostgres returns the blob keys of the attachments of
+// messages, deleted or not.
+func attachmentKeysPostgres(ctx context.Context, q pgxQuerier, ids []int) ([]string, error) {
+    rows, err := q.Query(ctx, `SELECT blob_key, COALESCE(thumbnail_key, '') FROM chat_attachments
+              WHERE message_id = ANY($1)`, ids)
+    if err != nil {
+        return nil, fmt.Errorf("failed to query attachments: %w", err)
+    }
+    defer rows.Close()
+
+    var keys []string
+    for rows.Next() {
+        var key, thumbnailKey string
+        if err := rows.Scan(&key, &thumbnailKey); err != nil {
+            return nil, fmt.Errorf("failed to scan attachment: %w", err)
+        }
+        keys = append(keys, key)
+        if thumbnailKey != "" {
+            keys = append(keys, thumbnailKey)
+        }
+    }
+    if err := rows.Err(); err != nil {
+        return nil, fmt.Errorf("error iterating attachments: %w", err)
+    }
+    return keys, nil
+}
+
+func getAttachmentPostgres(pool *db.DBPool, ctx context.Context, id string) (*Attachment, string, error) {
+    query := `SELECT ` + attachmentColumns + `, m.room_id
+              FROM chat_attachments a
+              JOIN chat_messages m ON m.id = a.message_id
+              WHERE a.id = $1 AND m.deleted_at IS NULL`
+
+    var roomID string
+    a, err := scanAttachmentPostgres(scanFunc(func(dest ...any) error {
+        return pool.PgxPool.QueryRow(ctx, query, id).Scan(append(dest, &roomID)...)
+    }))
+    if errors.Is(err, pgx.ErrNoRows) {
+        return nil, "", ErrAttachmentNotFound
+    }
+    if err != nil {
+        return nil, "", fmt.Errorf("failed to get attachment: %w", err)
+    }
+    return &a.Attachment, roomID, nil
+}
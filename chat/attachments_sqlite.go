@@ -0,0 +1,127 @@
+package chat
+
+import (
+    "context"
+    "database/sql"
+    "errors"
+    "fmt"
+    "strings"
+
+    "gooner/db"
+)
+
+const attachmentColumns = `a.message_id, a.id, a.filename, a.content_type, a.size, a.width, a.height,
+                 a.blob_key, a.thumbnail_key, a.created_at`
+
+func scanAttachmentSQLite(row rowScanner) (*attachmentRow, error) {
+    var a attachmentRow
+    var width, height sql.NullInt64
+    var thumbnailKey sql.NullString
+    err := row.Scan(
+        &a.messageID,
+        &a.ID,
+        &a.Filename,
+        &a.ContentType,
+        &a.Size,
+        &width,
+        &height,
+        &a.blobKey,
+        &thumbnailKey,
+        &a.CreatedAt,
+    )
+    if err != nil {
+        return nil, err
+    }
+    a.Width, a.Height = int(width.Int64), int(height.Int64)
+    a.thumbnailKey = thumbnailKey.String
+    return &a, nil
+}
+
+func loadAttachmentsSQLite(ctx context.Context, tx *db.RequestDB, messages []Message) error {
+    if len(messages) == 0 {
+        return nil
+    }
+
+    args := make([]any, len(messages))
+    for i, msg := range messages {
+        args[i] = msg.ID
+    }
+    query := `SELECT ` + attachmentColumns + ` FROM chat_attachments a
+              WHERE a.message_id IN (?` + strings.Repeat(", ?", len(messages)-1) + `)
+              ORDER BY a.message_id, a.position`
+
+    rows, err := tx.QueryContext(ctx, query, args...)
+    if err != nil {
+        return fmt.Errorf("failed to query attachments: %w", err)
+    }
+    defer rows.Close()
+
+    var attachments []attachmentRow
+    for rows.Next() {
+        a, err := scanAttachmentSQLite(rows)
+        if err != nil {
+            return fmt.Errorf("failed to scan attachment: %w", err)
+        }
+        attachments = append(attachments, *a)
+    }
+    if err := rows.Err(); err != nil {
+        return fmt.Errorf("error iterating attachments: %w", err)
+    }
+
+    attachAttachments(messages, attachments)
+    return nil
+}
+
+// attachmentKeysSQLite returns the blob keys of the attachments of the
+// messages of a room up to lastID, deleted or not.
+func attachmentKeysSQLite(ctx context.Context, tx *db.RequestDB, roomID string, lastID int) ([]string, error) {
+    rows, err := tx.QueryContext(ctx, `SELECT a.blob_key, COALESCE(a.thumbnail_key, '')
+              FROM chat_attachments a
+              JOIN chat_messages m ON m.id = a.message_id
+              WHERE m.room_id = ? AND m.id <= ?`, roomID, lastID)
+    if err != nil {
+        return nil, fmt.Errorf("failed to query attachments: %w", err)
+    }
+    defer rows.Close()
+
+    var keys []string
+    for rows.Next() {
+        var key, thumbnailKey string
+        if err := rows.Scan(&key, &thumbnailKey); err != nil {
+            return nil, fmt.Errorf("failed to scan attachment: %w", err)
+        }
+        keys = append(keys, key)
+        if thumbnailKey != "" {
+            keys = append(keys, thumbnailKey)
+        }
+    }
+    if err := rows.Err(); err != nil {
+        return nil, fmt.Errorf("error iterating attachments: %w", err)
+    }
+    return keys, nil
+}
+
+func getAttachmentSQLite(pool *db.DBPool, ctx context.Context, id string) (*Attachment, string, error) {
+    readTx, err := pool.GetReadTx(ctx)
+    if err != nil {
+        return nil, "", fmt.Errorf("failed to begin read transaction: %w", err)
+    }
+    defer readTx.Rollback()
+
+    query := `SELECT ` + attachmentColumns + `, m.room_id
+              FROM chat_attachments a
+              JOIN chat_messages m ON m.id = a.message_id
+              WHERE a.id = ? AND m.deleted_at IS NULL`
+
+    var roomID string
+    a, err := scanAttachmentSQLite(scanFunc(func(dest ...any) error {
+        return readTx.QueryRowContext(ctx, query, id).Scan(append(dest, &roomID)...)
+    }))
+    if errors.Is(err, sql.ErrNoRows) {
+        return nil, "", ErrAttachmentNotFound
+    }
+    if err != nil {
+        return nil, "", fmt.Errorf("failed to get attachment: %w", err)
+    }
+    return &a.Attachment, roomID, readTx.Commit()
+}
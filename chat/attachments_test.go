@@ -0,0 +1,209 @@
+package chat
+
+import (
+    "bytes"
+    "encoding/binary"
+    "hash/crc32"
+    "image"
+    "image/color"
+    "image/gif"
+    "image/jpeg"
+    "image/png"
+    "strings"
+    "testing"
+)
+
+func TestCleanFilename(t *testing.T) {
+    tests := []struct {
+        name string
+        want string
+    }{
+        {"report.pdf", "report.pdf"},
+        {"../../etc/passwd", "passwd"},
+        {`C:\Users\me\Desktop\photo.jpg`, "photo.jpg"},
+        {"/abs/path/", "path"},
+        {"  spaced name.txt  ", "spaced name.txt"},
+        {"bad\x00na\nme\r.txt", "badname.txt"},
+        {"émoji 🎉.png", "émoji 🎉.png"},
+        {"", "file"},
+        {".", "file"},
+        {"/", "file"},
+        {"..", ".."},
+        {"\x07\x08", "file"},
+    }
+
+    for _, tt := range tests {
+        if got := cleanFilename(tt.name); got != tt.want {
+            t.Errorf("cleanFilename(%q) = %q, want %q", tt.name, got, tt.want)
+        }
+    }
+}
+
+func TestCleanFilenameLength(t *testing.T) {
+    // a multi-byte rune straddling the limit is dropped, not cut in half
+    name := strings.Repeat("a", 254) + "é.txt"
+    got := cleanFilename(name)
+    if got != strings.Repeat("a", 254) {
+        t.Fatalf("got %d bytes: %q", len(got), got[250:])
+    }
+
+    if got := cleanFilename(strings.Repeat("ü", 200)); len(got) != 254 {
+        t.Fatalf("got %d bytes, want 254", len(got))
+    }
+}
+
+func solid(w, h int, c color.RGBA) *image.RGBA {
+    img := image.NewRGBA(image.Rect(0, 0, w, h))
+    for i := 0; i < len(img.Pix); i += 4 {
+        img.Pix[i], img.Pix[i+1], img.Pix[i+2], img.Pix[i+3] = c.R, c.G, c.B, c.A
+    }
+    return img
+}
+
+func TestScaleDown(t *testing.T) {
+    tests := []struct {
+        w, h   int
+        tw, th int
+    }{
+        {100, 50, 100, 50}, // already fits
+        {320, 320, 320, 320},
+        {640, 480, 320, 240},
+        {480, 640, 240, 320},
+        {3200, 10, 320, 1},
+        {5000, 1, 320, 1},
+        {1, 5000, 1, 320},
+    }
+
+    for _, tt := range tests {
+        img := solid(tt.w, tt.h, color.RGBA{R: 200, G: 100, B: 50, A: 255})
+        small := scaleDown(img, thumbnailSize)
+
+        if b := small.Bounds(); b.Dx() != tt.tw || b.Dy() != tt.th {
+            t.Errorf("%dx%d: got %dx%d, want %dx%d", tt.w, tt.h, b.Dx(), b.Dy(), tt.tw, tt.th)
+            continue
+        }
+        if tt.w <= thumbnailSize && tt.h <= thumbnailSize && small != image.Image(img) {
+            t.Errorf("%dx%d: small image was copied", tt.w, tt.h)
+        }
+
+        // a solid image stays that colour
+        b := small.Bounds()
+        if got := color.RGBAModel.Convert(small.At(b.Min.X+b.Dx()/2, b.Min.Y+b.Dy()/2)).(color.RGBA); got != (color.RGBA{R: 200, G: 100, B: 50, A: 255}) {
+            t.Errorf("%dx%d: centre pixel is %v", tt.w, tt.h, got)
+        }
+    }
+}
+
+func TestScaleDownAverages(t *testing.T) {
+    // black and white columns shrink to grey rather than to one of them
+    img := image.NewGray(image.Rect(0, 0, 1000, 1000))
+    for y := 0; y < 1000; y++ {
+        for x := 0; x < 1000; x += 2 {
+            img.Pix[y*img.Stride+x] = 255
+        }
+    }
+
+    small := scaleDown(img, 100)
+    c := color.GrayModel.Convert(small.At(50, 50)).(color.Gray)
+    if c.Y < 100 || c.Y > 155 {
+        t.Fatalf("got grey level %d, want about 128", c.Y)
+    }
+}
+
+func TestScaleDownImageTypes(t *testing.T) {
+    rect := image.Rect(0, 0, 800, 600)
+    images := map[string]image.Image{
+        "rgba":     image.NewRGBA(rect),
+        "nrgba":    image.NewNRGBA(rect),
+        "gray":     image.NewGray(rect),
+        "ycbcr":    image.NewYCbCr(rect, image.YCbCrSubsampleRatio420),
+        "paletted": image.NewPaletted(rect, color.Palette{color.Black, color.White}),
+        "cmyk":     image.NewCMYK(rect),
+        // bounds that do not start at the origin
+        "subimage": solid(1000, 1000, color.RGBA{A: 255}).SubImage(image.Rect(100, 200, 900, 800)),
+    }
+
+    for name, img := range images {
+        b := scaleDown(img, thumbnailSize).Bounds()
+        if b.Dx() != 320 || b.Dy() != 240 {
+            t.Errorf("%s: got %dx%d, want 320x240", name, b.Dx(), b.Dy())
+        }
+    }
+}
+
+func TestThumbnail(t *testing.T) {
+    img := solid(800, 400, color.RGBA{R: 10, G: 20, B: 30, A: 255})
+
+    encoders := map[string]func(*bytes.Buffer) error{
+        "image/png":  func(buf *bytes.Buffer) error { return png.Encode(buf, img) },
+        "image/jpeg": func(buf *bytes.Buffer) error { return jpeg.Encode(buf, img, nil) },
+        "image/gif":  func(buf *bytes.Buffer) error { return gif.Encode(buf, img, nil) },
+    }
+
+    for contentType, encode := range encoders {
+        var buf bytes.Buffer
+        if err := encode(&buf); err != nil {
+            t.Fatal(err)
+        }
+
+        w, h, thumb, err := thumbnail(bytes.NewReader(buf.Bytes()), contentType)
+        if err != nil {
+            t.Errorf("%s: %v", contentType, err)
+            continue
+        }
+        if w != 800 || h != 400 {
+            t.Errorf("%s: got size %dx%d, want 800x400", contentType, w, h)
+        }
+
+        small, format, err := image.Decode(bytes.NewReader(thumb))
+        if err != nil {
+            t.Errorf("%s: thumbnail does not decode: %v", contentType, err)
+            continue
+        }
+        if want := strings.TrimPrefix(thumbnailType(contentType), "image/"); format != want {
+            t.Errorf("%s: thumbnail is %s, want %s", contentType, format, want)
+        }
+        if b := small.Bounds(); b.Dx() != 320 || b.Dy() != 160 {
+            t.Errorf("%s: thumbnail is %dx%d, want 320x160", contentType, b.Dx(), b.Dy())
+        }
+    }
+}
+
+// pngHeader is the start of a PNG of the given size, enough for
+// image.DecodeConfig but not for decoding the image.
+func pngHeader(w, h uint32) []byte {
+    var ihdr [13]byte
+    binary.BigEndian.PutUint32(ihdr[0:], w)
+    binary.BigEndian.PutUint32(ihdr[4:], h)
+    ihdr[8] = 8 // bit depth, grayscale
+
+    var buf bytes.Buffer
+    buf.WriteString("\x89PNG\r\n\x1a\n")
+    binary.Write(&buf, binary.BigEndian, uint32(len(ihdr)))
+    chunk := append([]byte("IHDR"), ihdr[:]...)
+    buf.Write(chunk)
+    binary.Write(&buf, binary.BigEndian, crc32.ChecksumIEEE(chunk))
+    return buf.Bytes()
+}
+
+func TestThumbnailTooLarge(t *testing.T) {
+    w, h, thumb, err := thumbnail(bytes.NewReader(pngHeader(10000, 5000)), "image/png")
+    if err != nil {
+        t.Fatal(err)
+    }
+    if w != 10000 || h != 5000 || thumb != nil {
+        t.Fatalf("got %dx%d with a %d byte thumbnail, want 10000x5000 without one", w, h, len(thumb))
+    }
+}
+
+func TestThumbnailInvalid(t *testing.T) {
+    inputs := map[string][]byte{
+        "not an image": []byte("just some text"),
+        "header only":  pngHeader(100, 100),
+    }
+    for name, data := range inputs {
+        if _, _, thumb, err := thumbnail(bytes.NewReader(data), "image/png"); err == nil || thumb != nil {
+            t.Errorf("%s: expected an error and no thumbnail, got %v", name, err)
+        }
+    }
+}
@@ -2,35 +2,36 @@ package chat
 
 import (
     "context"
+    "database/sql"
+    "errors"
     "fmt"
     "time"
 
+    "github.com/jackc/pgx/v5"
     "gooner/db"
 )
 
-func StoreMessage(pool *db.DBPool, ctx context.Context, userID, roomID, content string) (*Message, error) {
-    writeTx, err := pool.GetWriteTx(ctx)
-    if err != nil {
-        return nil, fmt.Errorf("failed to begin transaction: %w", err)
+// StoreMessage stores a message, as a reply in the thread of replyTo if it
+// is not 0, with attachments whose blobs are already stored.
+func StoreMessage(pool *db.DBPool, ctx context.Context, userID, roomID, content string, replyTo int, attachments []Attachment) (*Message, error) {
+    var thread *int
+    if replyTo != 0 {
+        thread = &replyTo
     }
-    defer writeTx.Rollback()
 
-    query := `INSERT INTO chat_messages (user_id, room_id, content, created_at) 
-              VALUES (?, ?, ?, ?)`
-    
     now := time.Now()
-    result, err := writeTx.ExecContext(ctx, query, userID, roomID, content, now)
-    if err != nil {
-        return nil, fmt.Errorf("failed to store message: %w", err)
+    var messageID int
+    var err error
+    switch pool.Type {
+    case "postgres":
+        messageID, err = storeMessagePostgres(pool, ctx, userID, roomID, content, thread, attachments, now)
+    case "sqlite3":
+        messageID, err = storeMessageSQLite(pool, ctx, userID, roomID, content, thread, attachments, now)
+    default:
+        return nil, fmt.Errorf("unsupported database type: %s", pool.Type)
     }
-
-    messageID, err := result.LastInsertId()
     if err != nil {
-        return nil, fmt.Errorf("failed to get message ID: %w", err)
-    }
-
-    if err = writeTx.Commit(); err != nil {
-        return nil, fmt.Errorf("failed to commit transaction: %w", err)
+        return nil, err
     }
 
     // Get username for response
@@ -40,73 +41,205 @@ func StoreMessage(pool *db.DBPool, ctx context.Context, userID, roomID, content
     }
 
     return &Message{
-        ID:        int(messageID),
-        UserID:    userID,
-        Username:  username,
-        Content:   content,
-        RoomID:    roomID,
-        CreatedAt: now,
+        ID:          messageID,
+        UserID:      userID,
+        Username:    username,
+        Content:     content,
+        RoomID:      roomID,
+        ReplyTo:     thread,
+        CreatedAt:   now,
+        Attachments: withURLs(attachments),
     }, nil
 }
 
-func GetMessages(pool *db.DBPool, ctx context.Context, roomID string, limit, offset int) ([]Message, error) {
-    readTx, err := pool.GetReadTx(ctx)
-    if err != nil {
-        return nil, fmt.Errorf("failed to begin read transaction: %w", err)
+// GetMessages returns the page of a room's history selected by query,
+// newest first unless query.Oldest is set.
+func GetMessages(pool *db.DBPool, ctx context.Context, roomID string, query MessageQuery) (*MessagePage, error) {
+    switch pool.Type {
+    case "postgres":
+        return getMessagesPostgres(pool, ctx, roomID, query)
+    case "sqlite3":
+        return getMessagesSQLite(pool, ctx, roomID, query)
+    default:
+        return nil, fmt.Errorf("unsupported database type: %s", pool.Type)
     }
-    defer readTx.Rollback()
+}
 
-    query := `SELECT m.id, m.user_id, u.username, m.content, m.room_id, m.created_at
-              FROM chat_messages m
-              JOIN users u ON m.user_id = u.user_id
-              WHERE m.room_id = ?
-              ORDER BY m.created_at DESC
-              LIMIT ? OFFSET ?`
+// GetMessage returns one message with its reactions, including deleted
+// ones so callers can tell them apart from missing ones.
+func GetMessage(pool *db.DBPool, ctx context.Context, messageID int) (*Message, error) {
+    switch pool.Type {
+    case "postgres":
+        return getMessagePostgres(pool, ctx, messageID)
+    case "sqlite3":
+        return getMessageSQLite(pool, ctx, messageID)
+    default:
+        return nil, fmt.Errorf("unsupported database type: %s", pool.Type)
+    }
+}
 
-    rows, err := readTx.QueryContext(ctx, query, roomID, limit, offset)
-    if err != nil {
-        return nil, fmt.Errorf("failed to query messages: %w", err)
-    }
-    defer rows.Close()
-
-    var messages []Message
-    for rows.Next() {
-        var msg Message
-        err := rows.Scan(
-            &msg.ID,
-            &msg.UserID,
-            &msg.Username,
-            &msg.Content,
-            &msg.RoomID,
-            &msg.CreatedAt,
-        )
-        if err != nil {
-            return nil, fmt.Errorf("failed to scan message: %w", err)
+// EditMessage replaces the content of a message that is not deleted and
+// keeps the previous content in its history.
+func EditMessage(pool *db.DBPool, ctx context.Context, messageID int, content string, at time.Time) error {
+    switch pool.Type {
+    case "postgres":
+        return editMessagePostgres(pool, ctx, messageID, content, at)
+    case "sqlite3":
+        return editMessageSQLite(pool, ctx, messageID, content, at)
+    default:
+        return fmt.Errorf("unsupported database type: %s", pool.Type)
+    }
+}
+
+// DeleteMessage soft-deletes a message. It stays in the history as a
+// tombstone without content.
+func DeleteMessage(pool *db.DBPool, ctx context.Context, messageID int, deletedBy string, at time.Time) error {
+    switch pool.Type {
+    case "postgres":
+        return deleteMessagePostgres(pool, ctx, messageID, deletedBy, at)
+    case "sqlite3":
+        return deleteMessageSQLite(pool, ctx, messageID, deletedBy, at)
+    default:
+        return fmt.Errorf("unsupported database type: %s", pool.Type)
+    }
+}
+
+// GetMessageEdits returns the previous versions of a message, oldest
+// first.
+func GetMessageEdits(pool *db.DBPool, ctx context.Context, messageID int) ([]MessageEdit, error) {
+    switch pool.Type {
+    case "postgres":
+        return getMessageEditsPostgres(pool, ctx, messageID)
+    case "sqlite3":
+        return getMessageEditsSQLite(pool, ctx, messageID)
+    default:
+        return nil, fmt.Errorf("unsupported database type: %s", pool.Type)
+    }
+}
+
+// AddReaction reports whether userID had not reacted with emoji yet.
+func AddReaction(pool *db.DBPool, ctx context.Context, messageID int, userID, emoji string) (bool, error) {
+    switch pool.Type {
+    case "postgres":
+        return addReactionPostgres(pool, ctx, messageID, userID, emoji)
+    case "sqlite3":
+        return addReactionSQLite(pool, ctx, messageID, userID, emoji)
+    default:
+        return false, fmt.Errorf("unsupported database type: %s", pool.Type)
+    }
+}
+
+// RemoveReaction reports whether userID had reacted with emoji.
+func RemoveReaction(pool *db.DBPool, ctx context.Context, messageID int, userID, emoji string) (bool, error) {
+    switch pool.Type {
+    case "postgres":
+        return removeReactionPostgres(pool, ctx, messageID, userID, emoji)
+    case "sqlite3":
+        return removeReactionSQLite(pool, ctx, messageID, userID, emoji)
+    default:
+        return false, fmt.Errorf("unsupported database type: %s", pool.Type)
+    }
+}
+
+// messageColumns are the columns scanned into a Message, for a query over
+// chat_messages m joined with users u.
+const messageColumns = `m.id, m.user_id, u.username,
+                 CASE WHEN m.deleted_at IS NULL THEN m.content ELSE '' END,
+                 m.room_id, m.reply_to, (SELECT COUNT(*) FROM chat_messages r WHERE r.reply_to = m.id),
+                 m.created_at, m.edited_at, m.deleted_at`
+
+// scanFunc lets a query that selects more than messageColumns use the
+// message scanners, which only see the message's columns.
+type scanFunc func(dest ...any) error
+
+func (f scanFunc) Scan(dest ...any) error {
+    return f(dest...)
+}
+
+// reactionRow is one row of chat_message_reactions.
+type reactionRow struct {
+    messageID int
+    emoji     string
+    userID    string
+}
+
+// attachReactions groups rows, ordered by when they were added, into the
+// reactions of messages. Deleted messages get none.
+func attachReactions(messages []Message, rows []reactionRow) {
+    byID := make(map[int]*Message, len(messages))
+    for i := range messages {
+        if messages[i].DeletedAt == nil {
+            byID[messages[i].ID] = &messages[i]
         }
-        messages = append(messages, msg)
     }
 
-    if err = rows.Err(); err != nil {
-        return nil, fmt.Errorf("error iterating messages: %w", err)
+    for _, row := range rows {
+        msg, ok := byID[row.messageID]
+        if !ok {
+            continue
+        }
+        i := 0
+        for i < len(msg.Reactions) && msg.Reactions[i].Emoji != row.emoji {
+            i++
+        }
+        if i == len(msg.Reactions) {
+            msg.Reactions = append(msg.Reactions, Reaction{Emoji: row.emoji})
+        }
+        msg.Reactions[i].Count++
+        msg.Reactions[i].Users = append(msg.Reactions[i].Users, row.userID)
     }
+}
 
-    return messages, readTx.Commit()
+// trimPage cuts the extra row fetched to tell whether there are more
+// messages past the page.
+func trimPage(page *MessagePage, limit int) *MessagePage {
+    if len(page.Messages) > limit {
+        page.Messages = page.Messages[:limit]
+        page.HasMore = true
+    }
+    return page
 }
 
 func getUsernameByID(pool *db.DBPool, ctx context.Context, userID string) (string, error) {
-    readTx, err := pool.GetReadTx(ctx)
-    if err != nil {
-        return "", err
+    switch pool.Type {
+    case "postgres":
+        return getUsernameByIDPostgres(pool, ctx, userID)
+    case "sqlite3":
+        return getUsernameByIDSQLite(pool, ctx, userID)
+    default:
+        return "", fmt.Errorf("unsupported database type: %s", pool.Type)
     }
-    defer readTx.Rollback()
+}
 
-    var username string
-    query := `SELECT username FROM users WHERE user_id = ?`
-    err = readTx.QueryRowContext(ctx, query, userID).Scan(&username)
-    if err != nil {
-        return "", err
+func userExists(pool *db.DBPool, ctx context.Context, userID string) (bool, error) {
+    _, err := getUsernameByID(pool, ctx, userID)
+    if errors.Is(err, sql.ErrNoRows) || errors.Is(err, pgx.ErrNoRows) {
+        return false, nil
     }
+    return err == nil, err
+}
+
+func RoomExists(pool *db.DBPool, ctx context.Context, roomID string) (bool, error) {
+    var count int
+    switch pool.Type {
+    case "postgres":
+        err := pool.PgxPool.QueryRow(ctx, `SELECT COUNT(*) FROM chat_rooms WHERE id = $1`, roomID).Scan(&count)
+        if err != nil {
+            return false, fmt.Errorf("failed to look up room: %w", err)
+        }
+    case "sqlite3":
+        readTx, err := pool.GetReadTx(ctx)
+        if err != nil {
+            return false, fmt.Errorf("failed to begin read transaction: %w", err)
+        }
+        defer readTx.Rollback()
 
-    readTx.Commit()
-    return username, nil
+        err = readTx.QueryRowContext(ctx, `SELECT COUNT(*) FROM chat_rooms WHERE id = ?`, roomID).Scan(&count)
+        if err != nil {
+            return false, fmt.Errorf("failed to look up room: %w", err)
+        }
+    default:
+        return false, fmt.Errorf("unsupported database type: %s", pool.Type)
+    }
+    return count > 0, nil
 }
@@ -0,0 +1,222 @@
+package chat
+
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "net/http"
+    "slices"
+    "strings"
+    "time"
+
+    "gooner/appcontext"
+    "gooner/db"
+)
+
+// maxConversationSize caps how many people, the creator included, a
+// direct conversation can have.
+const maxConversationSize = 9
+
+// OpenConversation returns the direct conversation between userIDs,
+// creating it with roomID if there is none yet, and reports whether it was
+// created. userIDs must be sorted and unique.
+func OpenConversation(pool *db.DBPool, ctx context.Context, roomID string, userIDs []string, at time.Time) (string, bool, error) {
+    switch pool.Type {
+    case "postgres":
+        return openConversationPostgres(pool, ctx, roomID, userIDs, at)
+    case "sqlite3":
+        return openConversationSQLite(pool, ctx, roomID, userIDs, at)
+    default:
+        return "", false, fmt.Errorf("unsupported database type: %s", pool.Type)
+    }
+}
+
+// ListConversations returns the direct conversations of userID, the most
+// recently active first.
+func ListConversations(pool *db.DBPool, ctx context.Context, userID string) ([]Conversation, error) {
+    return listConversations(pool, ctx, userID, "")
+}
+
+// GetConversation returns one direct conversation of userID.
+func GetConversation(pool *db.DBPool, ctx context.Context, roomID, userID string) (*Conversation, error) {
+    conversations, err := listConversations(pool, ctx, userID, roomID)
+    if err != nil {
+        return nil, err
+    }
+    if len(conversations) == 0 {
+        return nil, ErrRoomNotFound
+    }
+    return &conversations[0], nil
+}
+
+func listConversations(pool *db.DBPool, ctx context.Context, userID, roomID string) ([]Conversation, error) {
+    switch pool.Type {
+    case "postgres":
+        return listConversationsPostgres(pool, ctx, userID, roomID)
+    case "sqlite3":
+        return listConversationsSQLite(pool, ctx, userID, roomID)
+    default:
+        return nil, fmt.Errorf("unsupported database type: %s", pool.Type)
+    }
+}
+
+// MarkRead moves userID's read position in a room forward to messageID,
+// or to the room's latest message if messageID is 0.
+func MarkRead(pool *db.DBPool, ctx context.Context, roomID, userID string, messageID int) error {
+    switch pool.Type {
+    case "postgres":
+        return markReadPostgres(pool, ctx, roomID, userID, messageID)
+    case "sqlite3":
+        return markReadSQLite(pool, ctx, roomID, userID, messageID)
+    default:
+        return fmt.Errorf("unsupported database type: %s", pool.Type)
+    }
+}
+
+// attachConversations fills in the participants and last messages of
+// conversations.
+func attachConversations(conversations []Conversation, members []Member, lastMessages []Message) {
+    byID := make(map[string]*Conversation, len(conversations))
+    for i := range conversations {
+        byID[conversations[i].ID] = &conversations[i]
+    }
+    for _, member := range members {
+        if c, ok := byID[member.RoomID]; ok {
+            c.Participants = append(c.Participants, member)
+        }
+    }
+    for i := range lastMessages {
+        if c, ok := byID[lastMessages[i].RoomID]; ok {
+            c.LastMessage = &lastMessages[i]
+        }
+    }
+}
+
+// CreateConversationHandler opens a direct conversation between the
+// caller and user_ids. Asking again for the same people returns the
+// existing conversation.
+func (h *Handler) CreateConversationHandler(ctx *appcontext.AppContext) {
+    userID, ok := ctx.Context.Value("userID").(string)
+    if !ok {
+        http.Error(ctx.Writer, "Unauthorized", http.StatusUnauthorized)
+        return
+    }
+
+    var req CreateConversationRequest
+    if err := json.NewDecoder(ctx.Request.Body).Decode(&req); err != nil {
+        http.Error(ctx.Writer, "Invalid JSON", http.StatusBadRequest)
+        return
+    }
+
+    userIDs := append([]string{userID}, req.UserIDs...)
+    slices.Sort(userIDs)
+    userIDs = slices.Compact(userIDs)
+    if len(userIDs) < 2 {
+        http.Error(ctx.Writer, "user_ids must name at least one other user", http.StatusBadRequest)
+        return
+    }
+    if len(userIDs) > maxConversationSize {
+        http.Error(ctx.Writer, fmt.Sprintf("a conversation can have at most %d people", maxConversationSize), http.StatusBadRequest)
+        return
+    }
+
+    for _, id := range userIDs {
+        exists, err := userExists(h.Pool, ctx.Context, id)
+        if err != nil {
+            ctx.Logger.Printf("Failed to look up user %s: %v", id, err)
+            http.Error(ctx.Writer, "Failed to create conversation", http.StatusInternalServerError)
+            return
+        }
+        if !exists {
+            http.Error(ctx.Writer, "User not found", http.StatusNotFound)
+            return
+        }
+    }
+
+    roomID, err := db.GenUUID()
+    if err != nil {
+        ctx.Logger.Printf("Failed to generate conversation id: %v", err)
+        http.Error(ctx.Writer, "Failed to create conversation", http.StatusInternalServerError)
+        return
+    }
+
+    roomID, created, err := OpenConversation(h.Pool, ctx.Context, roomID, userIDs, time.Now())
+    if err != nil {
+        ctx.Logger.Printf("Failed to open conversation between %s: %v", strings.Join(userIDs, ", "), err)
+        http.Error(ctx.Writer, "Failed to create conversation", http.StatusInternalServerError)
+        return
+    }
+
+    conversation, err := GetConversation(h.Pool, ctx.Context, roomID, userID)
+    if err != nil {
+        ctx.Logger.Printf("Failed to get conversation %s: %v", roomID, err)
+        http.Error(ctx.Writer, "Failed to create conversation", http.StatusInternalServerError)
+        return
+    }
+
+    status := http.StatusOK
+    if created {
+        status = http.StatusCreated
+    }
+    writeJSON(ctx, status, conversation)
+}
+
+// ListConversationsHandler returns the caller's direct conversations with
+// their last message and unread count.
+func (h *Handler) ListConversationsHandler(ctx *appcontext.AppContext) {
+    userID, ok := ctx.Context.Value("userID").(string)
+    if !ok {
+        http.Error(ctx.Writer, "Unauthorized", http.StatusUnauthorized)
+        return
+    }
+
+    conversations, err := ListConversations(h.Pool, ctx.Context, userID)
+    if err != nil {
+        ctx.Logger.Printf("Failed to list conversations: %v", err)
+        http.Error(ctx.Writer, "Failed to list conversations", http.StatusInternalServerError)
+        return
+    }
+    if conversations == nil {
+        conversations = []Conversation{}
+    }
+
+    writeJSON(ctx, http.StatusOK, ListConversationsResponse{Conversations: conversations, Count: len(conversations)})
+}
+
+// MarkConversationReadHandler marks a direct conversation read for the
+// caller.
+func (h *Handler) MarkConversationReadHandler(ctx *appcontext.AppContext) {
+    userID, ok := ctx.Context.Value("userID").(string)
+    if !ok {
+        http.Error(ctx.Writer, "Unauthorized", http.StatusUnauthorized)
+        return
+    }
+
+    var req MarkConversationReadRequest
+    if err := json.NewDecoder(ctx.Request.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+        http.Error(ctx.Writer, "Invalid JSON", http.StatusBadRequest)
+        return
+    }
+
+    roomID := ctx.Request.PathValue("id")
+    room, err := visibleRoom(h.Pool, ctx.Context, roomID, userID)
+    if err == nil && room.Kind != RoomKindDirect {
+        err = ErrRoomNotFound
+    }
+    if err == nil {
+        err = MarkRead(h.Pool, ctx.Context, roomID, userID, req.MessageID)
+    }
+    if err != nil {
+        if errors.Is(err, ErrRoomNotFound) || errors.Is(err, ErrMemberNotFound) {
+            http.Error(ctx.Writer, "Conversation not found", http.StatusNotFound)
+            return
+        }
+        ctx.Logger.Printf("Failed to mark conversation %s read: %v", roomID, err)
+        http.Error(ctx.Writer, "Failed to mark conversation read", http.StatusInternalServerError)
+        return
+    }
+
+    ctx.Writer.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,156 @@
+package chat
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "strings"
+    "time"
+
+    "github.com/jackc/pgx/v5"
+    "gooner/db"
+)
+
+func openConversationPostgres(pool *db.DBPool, ctx context.Context, roomID string, userIDs []string, at time.Time) (string, bool, error) {
+    tx, err := pool.PgxPool.Begin(ctx)
+    if err != nil {
+        return "", false, fmt.Errorf("failed to begin transaction: %w", err)
+    }
+    defer tx.Rollback(ctx)
+
+    key := strings.Join(userIDs, ",")
+
+    err = tx.QueryRow(ctx, `INSERT INTO chat_rooms (id, name, description, kind, is_private, dm_key, created_at)
+        VALUES ($1, '', '', $2, TRUE, $3, $4)
+        ON CONFLICT (dm_key) WHERE dm_key IS NOT NULL DO NOTHING
+        RETURNING id`, roomID, RoomKindDirect, key, at).Scan(&roomID)
+    if errors.Is(err, pgx.ErrNoRows) {
+        var existing string
+        if err := tx.QueryRow(ctx, `SELECT id FROM chat_rooms WHERE dm_key = $1`, key).Scan(&existing); err != nil {
+            return "", false, fmt.Errorf("failed to look up conversation: %w", err)
+        }
+        return existing, false, nil
+    }
+    if err != nil {
+        return "", false, fmt.Errorf("failed to create conversation: %w", err)
+    }
+
+    _, err = tx.Exec(ctx, `INSERT INTO chat_room_members (room_id, user_id, role, joined_at)
+        SELECT $1, unnest($2::text[]), $3, $4`, roomID, userIDs, RoleMember, at)
+    if err != nil {
+        return "", false, fmt.Errorf("failed to add participants: %w", err)
+    }
+
+    if err := tx.Commit(ctx); err != nil {
+        return "", false, fmt.Errorf("failed to commit transaction: %w", err)
+    }
+    return roomID, true, nil
+}
+
+func listConversationsPostgres(pool *db.DBPool, ctx context.Context, userID, roomID string) ([]Conversation, error) {
+    tx, err := pool.PgxPool.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.RepeatableRead, AccessMode: pgx.ReadOnly})
+    if err != nil {
+        return nil, fmt.Errorf("failed to begin read transaction: %w", err)
+    }
+    defer tx.Rollback(ctx)
+
+    query := `SELECT r.id, r.created_at,
+                     (SELECT COUNT(*) FROM chat_messages m
+                      WHERE m.room_id = r.id AND m.id > me.last_read_id AND m.user_id != me.user_id AND m.deleted_at IS NULL),
+                     COALESCE((SELECT MAX(m.id) FROM chat_messages m WHERE m.room_id = r.id), 0) AS last_id
+              FROM chat_rooms r
+              JOIN chat_room_members me ON me.room_id = r.id AND me.user_id = $1
+              WHERE r.kind = 'dm' AND ($2 = '' OR r.id = $2)
+              ORDER BY last_id DESC, r.created_at DESC`
+
+    rows, err := tx.Query(ctx, query, userID, roomID)
+    if err != nil {
+        return nil, fmt.Errorf("failed to query conversations: %w", err)
+    }
+    defer rows.Close()
+
+    var conversations []Conversation
+    var roomIDs []string
+    var lastIDs []int
+    for rows.Next() {
+        var c Conversation
+        var lastID int
+        if err := rows.Scan(&c.ID, &c.CreatedAt, &c.Unread, &lastID); err != nil {
+            return nil, fmt.Errorf("failed to scan conversation: %w", err)
+        }
+        conversations = append(conversations, c)
+        roomIDs = append(roomIDs, c.ID)
+        if lastID > 0 {
+            lastIDs = append(lastIDs, lastID)
+        }
+    }
+    if err := rows.Err(); err != nil {
+        return nil, fmt.Errorf("error iterating conversations: %w", err)
+    }
+    if len(conversations) == 0 {
+        return nil, nil
+    }
+
+    rows, err = tx.Query(ctx, `SELECT m.room_id, m.user_id, u.username, m.role, m.joined_at
+              FROM chat_room_members m
+              JOIN users u ON u.user_id = m.user_id
+              WHERE m.room_id = ANY($1)
+              ORDER BY u.username`, roomIDs)
+    if err != nil {
+        return nil, fmt.Errorf("failed to query participants: %w", err)
+    }
+    var members []Member
+    for rows.Next() {
+        var m Member
+        if err := rows.Scan(&m.RoomID, &m.UserID, &m.Username, &m.Role, &m.JoinedAt); err != nil {
+            rows.Close()
+            return nil, fmt.Errorf("failed to scan participant: %w", err)
+        }
+        members = append(members, m)
+    }
+    rows.Close()
+    if err := rows.Err(); err != nil {
+        return nil, fmt.Errorf("error iterating participants: %w", err)
+    }
+
+    rows, err = tx.Query(ctx, `SELECT `+messageColumns+`
+              FROM chat_messages m
+              JOIN users u ON m.user_id = u.user_id
+              WHERE m.id = ANY($1)`, lastIDs)
+    if err != nil {
+        return nil, fmt.Errorf("failed to query last messages: %w", err)
+    }
+    var lastMessages []Message
+    for rows.Next() {
+        msg, err := scanMessagePostgres(rows)
+        if err != nil {
+            rows.Close()
+            return nil, fmt.Errorf("failed to scan message: %w", err)
+        }
+        lastMessages = append(lastMessages, *msg)
+    }
+    rows.Close()
+    if err := rows.Err(); err != nil {
+        return nil, fmt.Errorf("error iterating messages: %w", err)
+    }
+
+    if err := tx.Commit(ctx); err != nil {
+        return nil, fmt.Errorf("failed to commit transaction: %w", err)
+    }
+    attachConversations(conversations, members, lastMessages)
+    return conversations, nil
+}
+
+func markReadPostgres(pool *db.DBPool, ctx context.Context, roomID, userID string, messageID int) error {
+    tag, err := pool.PgxPool.Exec(ctx, `UPDATE chat_room_members
+        SET last_read_id = GREATEST(last_read_id, CASE WHEN $3 > 0 THEN $3
+            ELSE (SELECT COALESCE(MAX(id), 0) FROM chat_messages WHERE room_id = $1) END)
+        WHERE room_id = $1 AND user_id = $2`, roomID, userID, messageID)
+    if err != nil {
+        return fmt.Errorf("failed to mark room read: %w", err)
+    }
+    if tag.RowsAffected() == 0 {
+        return ErrMemberNotFound
+    }
+    return nil
+}
@@ -0,0 +1,177 @@
+package chat
+
+import (
+    "context"
+    "database/sql"
+    "errors"
+    "fmt"
+    "strings"
+    "time"
+
+    "gooner/db"
+)
+
+func openConversationSQLite(pool *db.DBPool, ctx context.Context, roomID string, userIDs []string, at time.Time) (string, bool, error) {
+    writeTx, err := pool.GetWriteTx(ctx)
+    if err != nil {
+        return "", false, fmt.Errorf("failed to begin transaction: %w", err)
+    }
+    defer writeTx.Rollback()
+
+    key := strings.Join(userIDs, ",")
+
+    var existing string
+    err = writeTx.QueryRowContext(ctx, `SELECT id FROM chat_rooms WHERE dm_key = ?`, key).Scan(&existing)
+    if err == nil {
+        return existing, false, writeTx.Commit()
+    }
+    if !errors.Is(err, sql.ErrNoRows) {
+        return "", false, fmt.Errorf("failed to look up conversation: %w", err)
+    }
+
+    _, err = writeTx.ExecContext(ctx, `INSERT INTO chat_rooms (id, name, description, kind, is_private, dm_key, created_at)
+        VALUES (?, '', '', ?, 1, ?, ?)`, roomID, RoomKindDirect, key, at)
+    if err != nil {
+        return "", false, fmt.Errorf("failed to create conversation: %w", err)
+    }
+
+    for _, userID := range userIDs {
+        _, err = writeTx.ExecContext(ctx, `INSERT INTO chat_room_members (room_id, user_id, role, joined_at) VALUES (?, ?, ?, ?)`,
+            roomID, userID, RoleMember, at)
+        if err != nil {
+            return "", false, fmt.Errorf("failed to add participant: %w", err)
+        }
+    }
+
+    return roomID, true, writeTx.Commit()
+}
+
+func listConversationsSQLite(pool *db.DBPool, ctx context.Context, userID, roomID string) ([]Conversation, error) {
+    readTx, err := pool.GetReadTx(ctx)
+    if err != nil {
+        return nil, fmt.Errorf("failed to begin read transaction: %w", err)
+    }
+    defer readTx.Rollback()
+
+    query := `SELECT r.id, r.created_at,
+                     (SELECT COUNT(*) FROM chat_messages m
+                      WHERE m.room_id = r.id AND m.id > me.last_read_id AND m.user_id != me.user_id AND m.deleted_at IS NULL),
+                     COALESCE((SELECT MAX(m.id) FROM chat_messages m WHERE m.room_id = r.id), 0) AS last_id
+              FROM chat_rooms r
+              JOIN chat_room_members me ON me.room_id = r.id AND me.user_id = ?
+              WHERE r.kind = 'dm'`
+    args := []any{userID}
+    if roomID != "" {
+        query += ` AND r.id = ?`
+        args = append(args, roomID)
+    }
+    query += ` ORDER BY last_id DESC, r.created_at DESC`
+
+    rows, err := readTx.QueryContext(ctx, query, args...)
+    if err != nil {
+        return nil, fmt.Errorf("failed to query conversations: %w", err)
+    }
+    defer rows.Close()
+
+    var conversations []Conversation
+    var roomIDs, lastIDs []any
+    for rows.Next() {
+        var c Conversation
+        var lastID int
+        if err := rows.Scan(&c.ID, &c.CreatedAt, &c.Unread, &lastID); err != nil {
+            return nil, fmt.Errorf("failed to scan conversation: %w", err)
+        }
+        conversations = append(conversations, c)
+        roomIDs = append(roomIDs, c.ID)
+        if lastID > 0 {
+            lastIDs = append(lastIDs, lastID)
+        }
+    }
+    if err := rows.Err(); err != nil {
+        return nil, fmt.Errorf("error iterating conversations: %w", err)
+    }
+    if len(conversations) == 0 {
+        return nil, readTx.Commit()
+    }
+
+    members, err := conversationMembersSQLite(ctx, readTx, roomIDs)
+    if err != nil {
+        return nil, err
+    }
+
+    var lastMessages []Message
+    if len(lastIDs) > 0 {
+        rows, err := readTx.QueryContext(ctx, `SELECT `+messageColumns+`
+              FROM chat_messages m
+              JOIN users u ON m.user_id = u.user_id
+              WHERE m.id IN (?`+strings.Repeat(", ?", len(lastIDs)-1)+`)`, lastIDs...)
+        if err != nil {
+            return nil, fmt.Errorf("failed to query last messages: %w", err)
+        }
+        defer rows.Close()
+        for rows.Next() {
+            msg, err := scanMessageSQLite(rows)
+            if err != nil {
+                return nil, fmt.Errorf("failed to scan message: %w", err)
+            }
+            lastMessages = append(lastMessages, *msg)
+        }
+        if err := rows.Err(); err != nil {
+            return nil, fmt.Errorf("error iterating messages: %w", err)
+        }
+    }
+
+    attachConversations(conversations, members, lastMessages)
+    return conversations, readTx.Commit()
+}
+
+func conversationMembersSQLite(ctx context.Context, readTx *db.RequestDB, roomIDs []any) ([]Member, error) {
+    rows, err := readTx.QueryContext(ctx, `SELECT m.room_id, m.user_id, u.username, m.role, m.joined_at
+              FROM chat_room_members m
+              JOIN users u ON u.user_id = m.user_id
+              WHERE m.room_id IN (?`+strings.Repeat(", ?", len(roomIDs)-1)+`)
+              ORDER BY u.username`, roomIDs...)
+    if err != nil {
+        return nil, fmt.Errorf("failed to query participants: %w", err)
+    }
+    defer rows.Close()
+
+    var members []Member
+    for rows.Next() {
+        var m Member
+        if err := rows.Scan(&m.RoomID, &m.UserID, &m.Username, &m.Role, &m.JoinedAt); err != nil {
+            return nil, fmt.Errorf("failed to scan participant: %w", err)
+        }
+        members = append(members, m)
+    }
+    if err := rows.Err(); err != nil {
+        return nil, fmt.Errorf("error iterating participants: %w", err)
+    }
+    return members, nil
+}
+
+func markReadSQLite(pool *db.DBPool, ctx context.Context, roomID, userID string, messageID int) error {
+    writeTx, err := pool.GetWriteTx(ctx)
+    if err != nil {
+        return fmt.Errorf("failed to begin transaction: %w", err)
+    }
+    defer writeTx.Rollback()
+
+    query := `UPDATE chat_room_members SET last_read_id = MAX(last_read_id, ?) WHERE room_id = ? AND user_id = ?`
+    var target any = messageID
+    if messageID == 0 {
+        query = `UPDATE chat_room_members
+                 SET last_read_id = MAX(last_read_id, (SELECT COALESCE(MAX(id), 0) FROM chat_messages WHERE room_id = ?))
+                 WHERE room_id = ? AND user_id = ?`
+        target = roomID
+    }
+
+    result, err := writeTx.ExecContext(ctx, query, target, roomID, userID)
+    if err != nil {
+        return fmt.Errorf("failed to mark room read: %w", err)
+    }
+    if updated, _ := result.RowsAffected(); updated == 0 {
+        return ErrMemberNotFound
+    }
+    return writeTx.Commit()
+}
@@ -1,17 +1,57 @@
 package chat
 
 import (
+    "context"
     "encoding/json"
+    "errors"
+    "log"
     "net/http"
     "strconv"
+    "strings"
 	"sync"
 	"time"
 	"fmt"
     
     "gooner/appcontext"
+    "gooner/blob"
+    "gooner/db"
+    "gooner/websocket"
 )
 
-func SendMessageHandler(ctx *appcontext.AppContext) {
+const maxMessageLength = 4000
+
+var (
+    ErrEmptyMessage    = errors.New("content and room_id are required")
+    ErrMessageTooLong  = fmt.Errorf("message is longer than %d characters", maxMessageLength)
+    ErrRoomNotFound    = errors.New("room not found")
+    ErrMessageNotFound = errors.New("message not found")
+    ErrMessageDeleted  = errors.New("message is deleted")
+    ErrInvalidReply    = errors.New("reply_to is not a message in this room")
+)
+
+// Handler serves the chat endpoints that publish to the WebSocket hub.
+// Messages sent over HTTP and over the socket go through the same
+// validation and storage, and are pushed to the room's subscribers.
+type Handler struct {
+    Pool   *db.DBPool
+    Hub    *websocket.Hub
+    Logger *log.Logger
+
+    // attachments; zero limits use the defaults
+    Blobs             blob.Store
+    MaxAttachmentSize int64
+    MaxAttachments    int
+}
+
+func NewHandler(pool *db.DBPool, hub *websocket.Hub, logger *log.Logger) *Handler {
+    return &Handler{
+        Pool:   pool,
+        Hub:    hub,
+        Logger: logger,
+    }
+}
+
+func (h *Handler) SendMessageHandler(ctx *appcontext.AppContext) {
     userID, ok := ctx.Context.Value("userID").(string)
     if !ok {
         http.Error(ctx.Writer, "Unauthorized", http.StatusUnauthorized)
@@ -24,60 +64,271 @@ func SendMessageHandler(ctx *appcontext.AppContext) {
         return
     }
 
-    if req.Content == "" || req.RoomID == "" {
-        http.Error(ctx.Writer, "Content and room_id are required", http.StatusBadRequest)
+    message, err := h.send(ctx.Context, userID, req.RoomID, req.Content, req.ReplyTo, nil)
+    if err != nil {
+        h.sendError(ctx, err)
         return
     }
 
-    message, err := StoreMessage(ctx.Pool, ctx.Context, userID, req.RoomID, req.Content)
-    if err != nil {
+    ctx.Writer.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(ctx.Writer).Encode(message)
+}
+
+// sendError writes the response for an error from send.
+func (h *Handler) sendError(ctx *appcontext.AppContext, err error) {
+    switch {
+    case errors.Is(err, ErrEmptyMessage), errors.Is(err, ErrMessageTooLong), errors.Is(err, ErrInvalidReply):
+        http.Error(ctx.Writer, err.Error(), http.StatusBadRequest)
+    case errors.Is(err, ErrRoomNotFound):
+        http.Error(ctx.Writer, "Room not found", http.StatusNotFound)
+    case errors.Is(err, ErrRoomArchived):
+        http.Error(ctx.Writer, "Room is archived", http.StatusConflict)
+    default:
         ctx.Logger.Printf("Failed to store message: %v", err)
         http.Error(ctx.Writer, "Failed to send message", http.StatusInternalServerError)
-        return
     }
+}
 
-    ctx.Writer.Header().Set("Content-Type", "application/json")
-    json.NewEncoder(ctx.Writer).Encode(message)
+// SocketSendMessage is the websocket.ActionHandler for
+// {"action": "send", "topic": "chat:<room>", "data": {"content": "..."}},
+// with an optional "reply_to" in data. The stored message is returned in
+// the ack.
+func (h *Handler) SocketSendMessage(ctx context.Context, userID string, msg websocket.ClientMessage) (any, error) {
+    roomID, ok := strings.CutPrefix(msg.Topic, "chat:")
+    if !ok {
+        return nil, websocket.ErrUnknownTopic
+    }
+
+    var req SendMessageRequest
+    if len(msg.Data) > 0 {
+        if err := json.Unmarshal(msg.Data, &req); err != nil {
+            return nil, errors.New("invalid data")
+        }
+    }
+
+    message, err := h.send(ctx, userID, roomID, req.Content, req.ReplyTo, nil)
+    if err != nil {
+        if errors.Is(err, ErrEmptyMessage) || errors.Is(err, ErrMessageTooLong) || errors.Is(err, ErrInvalidReply) || errors.Is(err, ErrRoomNotFound) || errors.Is(err, ErrRoomArchived) {
+            return nil, err
+        }
+        h.Logger.Printf("Failed to store message: %v", err)
+        return nil, errors.New("failed to send message")
+    }
+
+    return message, nil
 }
 
-func GetMessagesHandler(ctx *appcontext.AppContext) {
-    roomID := ctx.Request.URL.Query().Get("room_id")
-    if roomID == "" {
-        roomID = "general" // Default room
+// send stores and publishes a message. Messages with attachments may have
+// no content.
+func (h *Handler) send(ctx context.Context, userID, roomID, content string, replyTo int, attachments []Attachment) (*Message, error) {
+    if (strings.TrimSpace(content) == "" && len(attachments) == 0) || roomID == "" {
+        return nil, ErrEmptyMessage
+    }
+    if len([]rune(content)) > maxMessageLength {
+        return nil, ErrMessageTooLong
     }
 
-    limitStr := ctx.Request.URL.Query().Get("limit")
-    limit := 50 // Default
-    if limitStr != "" {
-        if l, err := strconv.Atoi(limitStr); err == nil && l > 0 && l <= 100 {
-            limit = l
+    room, err := visibleRoom(h.Pool, ctx, roomID, userID)
+    if err != nil {
+        return nil, err
+    }
+    if room.ArchivedAt != nil {
+        return nil, ErrRoomArchived
+    }
+    if room.Role == "" {
+        // writing in a public room joins it
+        if _, err := AddMember(h.Pool, ctx, roomID, userID, RoleMember); err != nil {
+            return nil, err
         }
     }
 
-    offsetStr := ctx.Request.URL.Query().Get("offset")
-    offset := 0
-    if offsetStr != "" {
-        if o, err := strconv.Atoi(offsetStr); err == nil && o >= 0 {
-            offset = o
+    if replyTo != 0 {
+        parent, err := GetMessage(h.Pool, ctx, replyTo)
+        if errors.Is(err, ErrMessageNotFound) || (err == nil && parent.RoomID != roomID) {
+            return nil, ErrInvalidReply
         }
+        if err != nil {
+            return nil, err
+        }
+        // replies to a reply go to the thread it is in
+        if parent.ReplyTo != nil {
+            replyTo = *parent.ReplyTo
+        }
+    }
+
+    message, err := StoreMessage(h.Pool, ctx, userID, roomID, content, replyTo, attachments)
+    if err != nil {
+        return nil, err
+    }
+
+    h.publish(ctx, room, "chat_message", message)
+    h.notifyMentions(ctx, room, message)
+    return message, nil
+}
+
+func (h *Handler) publish(ctx context.Context, room *Room, eventType string, message *Message) {
+    if h.Hub == nil {
+        return
+    }
+
+    data, err := json.Marshal(MessageEvent{Type: eventType, Message: message})
+    if err != nil {
+        h.Logger.Printf("Failed to encode message %d: %v", message.ID, err)
+        return
+    }
+    h.publishTo(ctx, room, data)
+}
+
+// publishTo sends an event to the subscribers of a room's topic. Direct
+// conversations go to every connection of their participants instead, so
+// a new conversation reaches them without subscribing first.
+func (h *Handler) publishTo(ctx context.Context, room *Room, data []byte) {
+    if room.Kind != RoomKindDirect {
+        h.Hub.Publish(websocket.RoomTopic(room.ID), data)
+        return
+    }
+
+    members, err := ListMembers(h.Pool, ctx, room.ID)
+    if err != nil {
+        h.Logger.Printf("Failed to list participants of %s: %v", room.ID, err)
+        return
+    }
+    for _, member := range members {
+        h.Hub.SendToUser(member.UserID, data)
+    }
+}
+
+// GetMessagesHandler returns a page of the history of a public room or of
+// a private room the caller is a member of. Without cursors it is the
+// latest messages; ?before=<id> pages back from there and ?after=<id>
+// forward, oldest first.
+func GetMessagesHandler(ctx *appcontext.AppContext) {
+    room, ok := historyRoom(ctx)
+    if !ok {
+        return
     }
 
-    messages, err := GetMessages(ctx.Pool, ctx.Context, roomID, limit, offset)
+    var query MessageQuery
+    if query.Limit, ok = queryInt(ctx, "limit", 50, 100); !ok {
+        return
+    }
+    if query.Before, ok = queryInt(ctx, "before", 0, 0); !ok {
+        return
+    }
+    if query.After, ok = queryInt(ctx, "after", 0, 0); !ok {
+        return
+    }
+    query.Oldest = query.After > 0
+
+    page, err := GetMessages(ctx.Pool, ctx.Context, room.ID, query)
     if err != nil {
         ctx.Logger.Printf("Failed to get messages: %v", err)
         http.Error(ctx.Writer, "Failed to get messages", http.StatusInternalServerError)
         return
     }
+    hideAttachments(room, page.Messages)
 
     response := GetMessagesResponse{
-        Messages: messages,
-        Total:    len(messages),
+        Messages: page.Messages,
+        Total:    page.Total,
+        HasMore:  page.HasMore,
+    }
+
+    ctx.Writer.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(ctx.Writer).Encode(response)
+}
+
+// SyncMessagesHandler returns the messages of a room newer than
+// ?since_id=<id>, oldest first, for clients catching up after a
+// reconnect. They call it again with latest_id while has_more is set.
+func SyncMessagesHandler(ctx *appcontext.AppContext) {
+    room, ok := historyRoom(ctx)
+    if !ok {
+        return
+    }
+
+    if ctx.Request.URL.Query().Get("since_id") == "" {
+        http.Error(ctx.Writer, "since_id is required", http.StatusBadRequest)
+        return
+    }
+    sinceID, ok := queryInt(ctx, "since_id", 0, 0)
+    if !ok {
+        return
+    }
+    limit, ok := queryInt(ctx, "limit", 100, 500)
+    if !ok {
+        return
+    }
+
+    page, err := GetMessages(ctx.Pool, ctx.Context, room.ID, MessageQuery{After: sinceID, Oldest: true, Limit: limit})
+    if err != nil {
+        ctx.Logger.Printf("Failed to sync messages: %v", err)
+        http.Error(ctx.Writer, "Failed to sync messages", http.StatusInternalServerError)
+        return
+    }
+    hideAttachments(room, page.Messages)
+
+    response := SyncMessagesResponse{
+        Messages: page.Messages,
+        HasMore:  page.HasMore,
+        LatestID: sinceID,
+    }
+    if len(page.Messages) > 0 {
+        response.LatestID = page.Messages[len(page.Messages)-1].ID
     }
 
     ctx.Writer.Header().Set("Content-Type", "application/json")
     json.NewEncoder(ctx.Writer).Encode(response)
 }
 
+// historyRoom returns the ?room_id= room of a history request if the
+// caller can read it, writing the error response otherwise.
+func historyRoom(ctx *appcontext.AppContext) (*Room, bool) {
+    userID, ok := ctx.Context.Value("userID").(string)
+    if !ok {
+        http.Error(ctx.Writer, "Unauthorized", http.StatusUnauthorized)
+        return nil, false
+    }
+
+    roomID := ctx.Request.URL.Query().Get("room_id")
+    if roomID == "" {
+        roomID = "general" // Default room
+    }
+
+    room, err := visibleRoom(ctx.Pool, ctx.Context, roomID, userID)
+    if err != nil {
+        if errors.Is(err, ErrRoomNotFound) {
+            http.Error(ctx.Writer, "Room not found", http.StatusNotFound)
+            return nil, false
+        }
+        ctx.Logger.Printf("Failed to get room %s: %v", roomID, err)
+        http.Error(ctx.Writer, "Failed to get messages", http.StatusInternalServerError)
+        return nil, false
+    }
+    return room, true
+}
+
+// queryInt parses a non-negative query parameter, capped at max if max is
+// not 0. A missing or zero parameter is def.
+func queryInt(ctx *appcontext.AppContext, name string, def, max int) (int, bool) {
+    value := ctx.Request.URL.Query().Get(name)
+    if value == "" {
+        return def, true
+    }
+    n, err := strconv.Atoi(value)
+    if err != nil || n < 0 {
+        http.Error(ctx.Writer, fmt.Sprintf("%s must be a non-negative integer", name), http.StatusBadRequest)
+        return 0, false
+    }
+    if n == 0 {
+        return def, true
+    }
+    if max > 0 && n > max {
+        n = max
+    }
+    return n, true
+}
+
 func StressTestHandler(ctx *appcontext.AppContext) {
     userID, ok := ctx.Context.Value("userID").(string)
     if !ok {
@@ -102,7 +353,7 @@ func StressTestHandler(ctx *appcontext.AppContext) {
             for j := 0; j < messagesPerUser; j++ {
                 content := fmt.Sprintf("Stress test message %d from user %d. We are transmitting a lot of data here. I apparently have a lot to say and this is how I say it. Lucy is a good cat.", j, userNum)
 
-                _, err := StoreMessage(ctx.Pool, ctx.Context, userID, "general", content)
+                _, err := StoreMessage(ctx.Pool, ctx.Context, userID, "general", content, 0, nil)
 
                 mu.Lock()
                 if err != nil {
@@ -0,0 +1,298 @@
+package chat
+
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    "net/http"
+    "strconv"
+    "strings"
+    "time"
+    "unicode"
+    "unicode/utf8"
+
+    "gooner/appcontext"
+)
+
+const maxEmojiLength = 32
+
+// EditMessageHandler replaces the content of one of the caller's messages.
+func (h *Handler) EditMessageHandler(ctx *appcontext.AppContext) {
+    message, room, userID, ok := h.messageFromPath(ctx)
+    if !ok {
+        return
+    }
+
+    var req EditMessageRequest
+    if err := json.NewDecoder(ctx.Request.Body).Decode(&req); err != nil {
+        http.Error(ctx.Writer, "Invalid JSON", http.StatusBadRequest)
+        return
+    }
+    if strings.TrimSpace(req.Content) == "" {
+        http.Error(ctx.Writer, "content is required", http.StatusBadRequest)
+        return
+    }
+    if len([]rune(req.Content)) > maxMessageLength {
+        http.Error(ctx.Writer, ErrMessageTooLong.Error(), http.StatusBadRequest)
+        return
+    }
+
+    if message.UserID != userID {
+        http.Error(ctx.Writer, "Forbidden", http.StatusForbidden)
+        return
+    }
+    if !writable(ctx, room, message) {
+        return
+    }
+
+    if err := EditMessage(h.Pool, ctx.Context, message.ID, req.Content, time.Now()); err != nil {
+        h.messageError(ctx, "edit", message.ID, err)
+        return
+    }
+
+    edited, err := GetMessage(h.Pool, ctx.Context, message.ID)
+    if err != nil {
+        h.messageError(ctx, "edit", message.ID, err)
+        return
+    }
+
+    h.publish(ctx.Context, room, "message_edited", edited)
+    h.notifyMentions(ctx.Context, room, edited)
+    writeJSON(ctx, http.StatusOK, edited)
+}
+
+// DeleteMessageHandler soft-deletes a message. Authors can delete their
+// own messages and the room's owner and moderators anyone's.
+func (h *Handler) DeleteMessageHandler(ctx *appcontext.AppContext) {
+    message, room, userID, ok := h.messageFromPath(ctx)
+    if !ok {
+        return
+    }
+
+    if message.UserID != userID && !canModerate(room.Role) {
+        http.Error(ctx.Writer, "Forbidden", http.StatusForbidden)
+        return
+    }
+    if !writable(ctx, room, message) {
+        return
+    }
+
+    if err := DeleteMessage(h.Pool, ctx.Context, message.ID, userID, time.Now()); err != nil {
+        h.messageError(ctx, "delete", message.ID, err)
+        return
+    }
+
+    deleted, err := GetMessage(h.Pool, ctx.Context, message.ID)
+    if err != nil {
+        h.messageError(ctx, "delete", message.ID, err)
+        return
+    }
+
+    h.publish(ctx.Context, room, "message_deleted", deleted)
+    ctx.Writer.WriteHeader(http.StatusNoContent)
+}
+
+// MessageHistoryHandler returns a message with its previous versions. The
+// history of a deleted message is only shown to its author and the room's
+// owner and moderators.
+func (h *Handler) MessageHistoryHandler(ctx *appcontext.AppContext) {
+    message, room, userID, ok := h.messageFromPath(ctx)
+    if !ok {
+        return
+    }
+
+    if message.DeletedAt != nil && message.UserID != userID && !canModerate(room.Role) {
+        http.Error(ctx.Writer, "Message not found", http.StatusNotFound)
+        return
+    }
+
+    edits, err := GetMessageEdits(h.Pool, ctx.Context, message.ID)
+    if err != nil {
+        h.messageError(ctx, "get history of", message.ID, err)
+        return
+    }
+
+    if !canDownload(room) {
+        message.Attachments = nil
+    }
+    writeJSON(ctx, http.StatusOK, MessageHistoryResponse{Message: message, Edits: edits})
+}
+
+// ThreadHandler returns the thread a message is in: its first message and
+// the replies after ?after=<id>, oldest first.
+func (h *Handler) ThreadHandler(ctx *appcontext.AppContext) {
+    message, room, _, ok := h.messageFromPath(ctx)
+    if !ok {
+        return
+    }
+
+    query := MessageQuery{Oldest: true}
+    if query.Limit, ok = queryInt(ctx, "limit", 50, 100); !ok {
+        return
+    }
+    if query.After, ok = queryInt(ctx, "after", 0, 0); !ok {
+        return
+    }
+
+    root := message
+    if message.ReplyTo != nil {
+        var err error
+        if root, err = GetMessage(h.Pool, ctx.Context, *message.ReplyTo); err != nil {
+            h.messageError(ctx, "get thread of", message.ID, err)
+            return
+        }
+    }
+    query.Thread = root.ID
+
+    page, err := GetMessages(h.Pool, ctx.Context, room.ID, query)
+    if err != nil {
+        h.messageError(ctx, "get thread of", message.ID, err)
+        return
+    }
+    if page.Messages == nil {
+        page.Messages = []Message{}
+    }
+    hideAttachments(room, page.Messages)
+    if !canDownload(room) {
+        root.Attachments = nil
+    }
+
+    writeJSON(ctx, http.StatusOK, ThreadResponse{Message: root, Replies: page.Messages, HasMore: page.HasMore})
+}
+
+// AddReactionHandler reacts to a message with the {emoji} path value. A
+// user can use each emoji once per message.
+func (h *Handler) AddReactionHandler(ctx *appcontext.AppContext) {
+    h.react(ctx, true)
+}
+
+// RemoveReactionHandler takes back the caller's {emoji} reaction.
+func (h *Handler) RemoveReactionHandler(ctx *appcontext.AppContext) {
+    h.react(ctx, false)
+}
+
+func (h *Handler) react(ctx *appcontext.AppContext, add bool) {
+    message, room, userID, ok := h.messageFromPath(ctx)
+    if !ok {
+        return
+    }
+
+    emoji := ctx.Request.PathValue("emoji")
+    if !validEmoji(emoji) {
+        http.Error(ctx.Writer, "Invalid emoji", http.StatusBadRequest)
+        return
+    }
+    if !writable(ctx, room, message) {
+        return
+    }
+
+    var changed bool
+    var err error
+    eventType := "reaction_added"
+    if add {
+        changed, err = AddReaction(h.Pool, ctx.Context, message.ID, userID, emoji)
+    } else {
+        eventType = "reaction_removed"
+        changed, err = RemoveReaction(h.Pool, ctx.Context, message.ID, userID, emoji)
+    }
+    if err != nil {
+        h.messageError(ctx, "react to", message.ID, err)
+        return
+    }
+
+    if changed {
+        h.publishReactionEvent(ctx.Context, room, ReactionEvent{
+            Type:      eventType,
+            RoomID:    message.RoomID,
+            MessageID: message.ID,
+            UserID:    userID,
+            Emoji:     emoji,
+        })
+    }
+    ctx.Writer.WriteHeader(http.StatusNoContent)
+}
+
+// messageFromPath loads the message named by the {id} path value and its
+// room as the caller sees it, writing the error response if that fails.
+// Messages in rooms the caller cannot see are not found.
+func (h *Handler) messageFromPath(ctx *appcontext.AppContext) (*Message, *Room, string, bool) {
+    userID, ok := ctx.Context.Value("userID").(string)
+    if !ok {
+        http.Error(ctx.Writer, "Unauthorized", http.StatusUnauthorized)
+        return nil, nil, "", false
+    }
+
+    messageID, err := strconv.Atoi(ctx.Request.PathValue("id"))
+    if err != nil {
+        http.Error(ctx.Writer, "Message not found", http.StatusNotFound)
+        return nil, nil, "", false
+    }
+
+    message, err := GetMessage(h.Pool, ctx.Context, messageID)
+    if err != nil {
+        h.messageError(ctx, "get", messageID, err)
+        return nil, nil, "", false
+    }
+
+    room, err := visibleRoom(h.Pool, ctx.Context, message.RoomID, userID)
+    if err != nil {
+        if errors.Is(err, ErrRoomNotFound) {
+            err = ErrMessageNotFound
+        }
+        h.messageError(ctx, "get", messageID, err)
+        return nil, nil, "", false
+    }
+    return message, room, userID, true
+}
+
+// writable writes the error response if message can no longer be changed.
+func writable(ctx *appcontext.AppContext, room *Room, message *Message) bool {
+    switch {
+    case room.ArchivedAt != nil:
+        http.Error(ctx.Writer, "Room is archived", http.StatusConflict)
+    case message.DeletedAt != nil:
+        http.Error(ctx.Writer, "Message is deleted", http.StatusConflict)
+    default:
+        return true
+    }
+    return false
+}
+
+func (h *Handler) messageError(ctx *appcontext.AppContext, action string, messageID int, err error) {
+    switch {
+    case errors.Is(err, ErrMessageNotFound):
+        http.Error(ctx.Writer, "Message not found", http.StatusNotFound)
+    case errors.Is(err, ErrMessageDeleted):
+        http.Error(ctx.Writer, "Message is deleted", http.StatusConflict)
+    default:
+        ctx.Logger.Printf("Failed to %s message %d: %v", action, messageID, err)
+        http.Error(ctx.Writer, "Failed to "+action+" message", http.StatusInternalServerError)
+    }
+}
+
+func (h *Handler) publishReactionEvent(ctx context.Context, room *Room, event ReactionEvent) {
+    if h.Hub == nil {
+        return
+    }
+
+    data, err := json.Marshal(event)
+    if err != nil {
+        h.Logger.Printf("Failed to encode %s event: %v", event.Type, err)
+        return
+    }
+    h.publishTo(ctx, room, data)
+}
+
+// validEmoji accepts a short token such as an emoji sequence or a
+// :shortcode:, without spaces or control characters.
+func validEmoji(emoji string) bool {
+    if emoji == "" || len(emoji) > maxEmojiLength || !utf8.ValidString(emoji) {
+        return false
+    }
+    for _, r := range emoji {
+        if unicode.IsSpace(r) || unicode.IsControl(r) {
+            return false
+        }
+    }
+    return true
+}
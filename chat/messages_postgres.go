@@ -0,0 +1,296 @@
+package chat
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "time"
+
+    "github.com/jackc/pgx/v5"
+    "gooner/db"
+)
+
+func scanMessagePostgres(row pgx.Row) (*Message, error) {
+    var msg Message
+    err := row.Scan(
+        &msg.ID,
+        &msg.UserID,
+        &msg.Username,
+        &msg.Content,
+        &msg.RoomID,
+        &msg.ReplyTo,
+        &msg.ReplyCount,
+        &msg.CreatedAt,
+        &msg.EditedAt,
+        &msg.DeletedAt,
+    )
+    if err != nil {
+        return nil, err
+    }
+    return &msg, nil
+}
+
+func storeMessagePostgres(pool *db.DBPool, ctx context.Context, userID, roomID, content string, replyTo *int, attachments []Attachment, at time.Time) (int, error) {
+    tx, err := pool.PgxPool.Begin(ctx)
+    if err != nil {
+        return 0, fmt.Errorf("failed to begin transaction: %w", err)
+    }
+    defer tx.Rollback(ctx)
+
+    query := `INSERT INTO chat_messages (user_id, room_id, content, reply_to, created_at)
+              VALUES ($1, $2, $3, $4, $5)
+              RETURNING id`
+
+    var messageID int
+    if err := tx.QueryRow(ctx, query, userID, roomID, content, replyTo, at).Scan(&messageID); err != nil {
+        return 0, fmt.Errorf("failed to store message: %w", err)
+    }
+
+    for i, a := range attachments {
+        _, err = tx.Exec(ctx, `INSERT INTO chat_attachments
+            (id, message_id, position, filename, content_type, size, width, height, blob_key, thumbnail_key, created_at)
+            VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`,
+            a.ID, messageID, i, a.Filename, a.ContentType, a.Size, nullInt(a.Width), nullInt(a.Height),
+            a.blobKey, nullString(a.thumbnailKey), a.CreatedAt)
+        if err != nil {
+            return 0, fmt.Errorf("failed to store attachment: %w", err)
+        }
+    }
+
+    if err := tx.Commit(ctx); err != nil {
+        return 0, fmt.Errorf("failed to commit transaction: %w", err)
+    }
+    return messageID, nil
+}
+
+func getMessagesPostgres(pool *db.DBPool, ctx context.Context, roomID string, q MessageQuery) (*MessagePage, error) {
+    // the count and the page come from one snapshot, so Total agrees with
+    // the messages even while new ones arrive
+    tx, err := pool.PgxPool.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.RepeatableRead, AccessMode: pgx.ReadOnly})
+    if err != nil {
+        return nil, fmt.Errorf("failed to begin read transaction: %w", err)
+    }
+    defer tx.Rollback(ctx)
+
+    where := `m.room_id = $1`
+    args := []any{roomID}
+    if q.Thread > 0 {
+        args = append(args, q.Thread)
+        where += fmt.Sprintf(` AND m.reply_to = $%d`, len(args))
+    }
+
+    var page MessagePage
+    err = tx.QueryRow(ctx, `SELECT COUNT(*) FROM chat_messages m WHERE `+where, args...).Scan(&page.Total)
+    if err != nil {
+        return nil, fmt.Errorf("failed to count messages: %w", err)
+    }
+
+    if q.Before > 0 {
+        args = append(args, q.Before)
+        where += fmt.Sprintf(` AND m.id < $%d`, len(args))
+    }
+    order := "DESC"
+    if q.After > 0 {
+        args = append(args, q.After)
+        where += fmt.Sprintf(` AND m.id > $%d`, len(args))
+    }
+    if q.Oldest {
+        order = "ASC"
+    }
+    args = append(args, q.Limit+1)
+
+    query := fmt.Sprintf(`SELECT %s
+              FROM chat_messages m
+              JOIN users u ON m.user_id = u.user_id
+              WHERE %s
+              ORDER BY m.id %s
+              LIMIT $%d`, messageColumns, where, order, len(args))
+
+    rows, err := tx.Query(ctx, query, args...)
+    if err != nil {
+        return nil, fmt.Errorf("failed to query messages: %w", err)
+    }
+    defer rows.Close()
+
+    for rows.Next() {
+        msg, err := scanMessagePostgres(rows)
+        if err != nil {
+            return nil, fmt.Errorf("failed to scan message: %w", err)
+        }
+        page.Messages = append(page.Messages, *msg)
+    }
+
+    if err := rows.Err(); err != nil {
+        return nil, fmt.Errorf("error iterating messages: %w", err)
+    }
+
+    trimPage(&page, q.Limit)
+    if err := loadReactionsPostgres(ctx, tx, page.Messages); err != nil {
+        return nil, err
+    }
+    if err := loadAttachmentsPostgres(ctx, tx, page.Messages); err != nil {
+        return nil, err
+    }
+
+    if err := tx.Commit(ctx); err != nil {
+        return nil, fmt.Errorf("failed to commit transaction: %w", err)
+    }
+    return &page, nil
+}
+
+func getMessagePostgres(pool *db.DBPool, ctx context.Context, messageID int) (*Message, error) {
+    query := `SELECT ` + messageColumns + `
+              FROM chat_messages m
+              JOIN users u ON m.user_id = u.user_id
+              WHERE m.id = $1`
+
+    msg, err := scanMessagePostgres(pool.PgxPool.QueryRow(ctx, query, messageID))
+    if errors.Is(err, pgx.ErrNoRows) {
+        return nil, ErrMessageNotFound
+    }
+    if err != nil {
+        return nil, fmt.Errorf("failed to get message: %w", err)
+    }
+
+    messages := []Message{*msg}
+    if err := loadReactionsPostgres(ctx, pool.PgxPool, messages); err != nil {
+        return nil, err
+    }
+    if err := loadAttachmentsPostgres(ctx, pool.PgxPool, messages); err != nil {
+        return nil, err
+    }
+    return &messages[0], nil
+}
+
+// pgxQuerier is what pgxpool.Pool and pgx.Tx have in common for reading.
+type pgxQuerier interface {
+    Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+}
+
+func loadReactionsPostgres(ctx context.Context, q pgxQuerier, messages []Message) error {
+    if len(messages) == 0 {
+        return nil
+    }
+
+    ids := make([]int, len(messages))
+    for i, msg := range messages {
+        ids[i] = msg.ID
+    }
+
+    rows, err := q.Query(ctx, `SELECT message_id, emoji, user_id FROM chat_message_reactions
+              WHERE message_id = ANY($1)
+              ORDER BY created_at`, ids)
+    if err != nil {
+        return fmt.Errorf("failed to query reactions: %w", err)
+    }
+    defer rows.Close()
+
+    var reactions []reactionRow
+    for rows.Next() {
+        var r reactionRow
+        if err := rows.Scan(&r.messageID, &r.emoji, &r.userID); err != nil {
+            return fmt.Errorf("failed to scan reaction: %w", err)
+        }
+        reactions = append(reactions, r)
+    }
+    if err := rows.Err(); err != nil {
+        return fmt.Errorf("error iterating reactions: %w", err)
+    }
+
+    attachReactions(messages, reactions)
+    return nil
+}
+
+func editMessagePostgres(pool *db.DBPool, ctx context.Context, messageID int, content string, at time.Time) error {
+    tx, err := pool.PgxPool.Begin(ctx)
+    if err != nil {
+        return fmt.Errorf("failed to begin transaction: %w", err)
+    }
+    defer tx.Rollback(ctx)
+
+    var previous string
+    var deletedAt *time.Time
+    err = tx.QueryRow(ctx, `SELECT content, deleted_at FROM chat_messages WHERE id = $1 FOR UPDATE`, messageID).Scan(&previous, &deletedAt)
+    if errors.Is(err, pgx.ErrNoRows) {
+        return ErrMessageNotFound
+    }
+    if err != nil {
+        return fmt.Errorf("failed to get message: %w", err)
+    }
+    if deletedAt != nil {
+        return ErrMessageDeleted
+    }
+
+    _, err = tx.Exec(ctx, `INSERT INTO chat_message_edits (message_id, content, edited_at) VALUES ($1, $2, $3)`,
+        messageID, previous, at)
+    if err != nil {
+        return fmt.Errorf("failed to store message edit: %w", err)
+    }
+
+    _, err = tx.Exec(ctx, `UPDATE chat_messages SET content = $2, edited_at = $3 WHERE id = $1`, messageID, content, at)
+    if err != nil {
+        return fmt.Errorf("failed to edit message: %w", err)
+    }
+
+    if err := tx.Commit(ctx); err != nil {
+        return fmt.Errorf("failed to commit transaction: %w", err)
+    }
+    return nil
+}
+
+func deleteMessagePostgres(pool *db.DBPool, ctx context.Context, messageID int, deletedBy string, at time.Time) error {
+    tag, err := pool.PgxPool.Exec(ctx, `UPDATE chat_messages SET deleted_at = $3, deleted_by = $2 WHERE id = $1 AND deleted_at IS NULL`,
+        messageID, deletedBy, at)
+    if err != nil {
+        return fmt.Errorf("failed to delete message: %w", err)
+    }
+    if tag.RowsAffected() == 0 {
+        return ErrMessageDeleted
+    }
+    return nil
+}
+
+func getMessageEditsPostgres(pool *db.DBPool, ctx context.Context, messageID int) ([]MessageEdit, error) {
+    rows, err := pool.PgxPool.Query(ctx, `SELECT content, edited_at FROM chat_message_edits WHERE message_id = $1 ORDER BY id`, messageID)
+    if err != nil {
+        return nil, fmt.Errorf("failed to query message edits: %w", err)
+    }
+    defer rows.Close()
+
+    edits := []MessageEdit{}
+    for rows.Next() {
+        var edit MessageEdit
+        if err := rows.Scan(&edit.Content, &edit.EditedAt); err != nil {
+            return nil, fmt.Errorf("failed to scan message edit: %w", err)
+        }
+        edits = append(edits, edit)
+    }
+    if err := rows.Err(); err != nil {
+        return nil, fmt.Errorf("error iterating message edits: %w", err)
+    }
+    return edits, nil
+}
+
+func addReactionPostgres(pool *db.DBPool, ctx context.Context, messageID int, userID, emoji string) (bool, error) {
+    tag, err := pool.PgxPool.Exec(ctx, `INSERT INTO chat_message_reactions (message_id, user_id, emoji, created_at)
+        VALUES ($1, $2, $3, $4) ON CONFLICT (message_id, user_id, emoji) DO NOTHING`, messageID, userID, emoji, time.Now())
+    if err != nil {
+        return false, fmt.Errorf("failed to add reaction: %w", err)
+    }
+    return tag.RowsAffected() > 0, nil
+}
+
+func removeReactionPostgres(pool *db.DBPool, ctx context.Context, messageID int, userID, emoji string) (bool, error) {
+    tag, err := pool.PgxPool.Exec(ctx, `DELETE FROM chat_message_reactions WHERE message_id = $1 AND user_id = $2 AND emoji = $3`,
+        messageID, userID, emoji)
+    if err != nil {
+        return false, fmt.Errorf("failed to remove reaction: %w", err)
+    }
+    return tag.RowsAffected() > 0, nil
+}
+
+func getUsernameByIDPostgres(pool *db.DBPool, ctx context.Context, userID string) (string, error) {
+    var username string
+    err := pool.PgxPool.QueryRow(ctx, `SELECT username FROM users WHERE user_id = $1`, userID).Scan(&username)
+    return username, err
+}
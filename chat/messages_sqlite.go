@@ -0,0 +1,344 @@
+package chat
+
+import (
+    "context"
+    "database/sql"
+    "errors"
+    "fmt"
+    "strings"
+    "time"
+
+    "gooner/db"
+)
+
+func scanMessageSQLite(row rowScanner) (*Message, error) {
+    var msg Message
+    var replyTo sql.NullInt64
+    var editedAt, deletedAt sql.NullTime
+    err := row.Scan(
+        &msg.ID,
+        &msg.UserID,
+        &msg.Username,
+        &msg.Content,
+        &msg.RoomID,
+        &replyTo,
+        &msg.ReplyCount,
+        &msg.CreatedAt,
+        &editedAt,
+        &deletedAt,
+    )
+    if err != nil {
+        return nil, err
+    }
+    if replyTo.Valid {
+        thread := int(replyTo.Int64)
+        msg.ReplyTo = &thread
+    }
+    if editedAt.Valid {
+        msg.EditedAt = &editedAt.Time
+    }
+    if deletedAt.Valid {
+        msg.DeletedAt = &deletedAt.Time
+    }
+    return &msg, nil
+}
+
+func storeMessageSQLite(pool *db.DBPool, ctx context.Context, userID, roomID, content string, replyTo *int, attachments []Attachment, at time.Time) (int, error) {
+    writeTx, err := pool.GetWriteTx(ctx)
+    if err != nil {
+        return 0, fmt.Errorf("failed to begin transaction: %w", err)
+    }
+    defer writeTx.Rollback()
+
+    query := `INSERT INTO chat_messages (user_id, room_id, content, reply_to, created_at) 
+              VALUES (?, ?, ?, ?, ?)`
+
+    result, err := writeTx.ExecContext(ctx, query, userID, roomID, content, replyTo, at)
+    if err != nil {
+        return 0, fmt.Errorf("failed to store message: %w", err)
+    }
+
+    messageID, err := result.LastInsertId()
+    if err != nil {
+        return 0, fmt.Errorf("failed to get message ID: %w", err)
+    }
+
+    for i, a := range attachments {
+        _, err = writeTx.ExecContext(ctx, `INSERT INTO chat_attachments
+            (id, message_id, position, filename, content_type, size, width, height, blob_key, thumbnail_key, created_at)
+            VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+            a.ID, messageID, i, a.Filename, a.ContentType, a.Size, nullInt(a.Width), nullInt(a.Height),
+            a.blobKey, nullString(a.thumbnailKey), a.CreatedAt)
+        if err != nil {
+            return 0, fmt.Errorf("failed to store attachment: %w", err)
+        }
+    }
+
+    if err = writeTx.Commit(); err != nil {
+        return 0, fmt.Errorf("failed to commit transaction: %w", err)
+    }
+    return int(messageID), nil
+}
+
+func getMessagesSQLite(pool *db.DBPool, ctx context.Context, roomID string, q MessageQuery) (*MessagePage, error) {
+    readTx, err := pool.GetReadTx(ctx)
+    if err != nil {
+        return nil, fmt.Errorf("failed to begin read transaction: %w", err)
+    }
+    defer readTx.Rollback()
+
+    where := `m.room_id = ?`
+    args := []any{roomID}
+    if q.Thread > 0 {
+        where += ` AND m.reply_to = ?`
+        args = append(args, q.Thread)
+    }
+
+    var page MessagePage
+    err = readTx.QueryRowContext(ctx, `SELECT COUNT(*) FROM chat_messages m WHERE `+where, args...).Scan(&page.Total)
+    if err != nil {
+        return nil, fmt.Errorf("failed to count messages: %w", err)
+    }
+
+    if q.Before > 0 {
+        where += ` AND m.id < ?`
+        args = append(args, q.Before)
+    }
+    order := "DESC"
+    if q.After > 0 {
+        where += ` AND m.id > ?`
+        args = append(args, q.After)
+    }
+    if q.Oldest {
+        order = "ASC"
+    }
+    args = append(args, q.Limit+1)
+
+    query := fmt.Sprintf(`SELECT %s
+              FROM chat_messages m
+              JOIN users u ON m.user_id = u.user_id
+              WHERE %s
+              ORDER BY m.id %s
+              LIMIT ?`, messageColumns, where, order)
+
+    rows, err := readTx.QueryContext(ctx, query, args...)
+    if err != nil {
+        return nil, fmt.Errorf("failed to query messages: %w", err)
+    }
+    defer rows.Close()
+
+    for rows.Next() {
+        msg, err := scanMessageSQLite(rows)
+        if err != nil {
+            return nil, fmt.Errorf("failed to scan message: %w", err)
+        }
+        page.Messages = append(page.Messages, *msg)
+    }
+
+    if err = rows.Err(); err != nil {
+        return nil, fmt.Errorf("error iterating messages: %w", err)
+    }
+
+    trimPage(&page, q.Limit)
+    if err := loadReactionsSQLite(ctx, readTx, page.Messages); err != nil {
+        return nil, err
+    }
+    if err := loadAttachmentsSQLite(ctx, readTx, page.Messages); err != nil {
+        return nil, err
+    }
+    return &page, readTx.Commit()
+}
+
+func getMessageSQLite(pool *db.DBPool, ctx context.Context, messageID int) (*Message, error) {
+    readTx, err := pool.GetReadTx(ctx)
+    if err != nil {
+        return nil, fmt.Errorf("failed to begin read transaction: %w", err)
+    }
+    defer readTx.Rollback()
+
+    query := `SELECT ` + messageColumns + `
+              FROM chat_messages m
+              JOIN users u ON m.user_id = u.user_id
+              WHERE m.id = ?`
+
+    msg, err := scanMessageSQLite(readTx.QueryRowContext(ctx, query, messageID))
+    if errors.Is(err, sql.ErrNoRows) {
+        return nil, ErrMessageNotFound
+    }
+    if err != nil {
+        return nil, fmt.Errorf("failed to get message: %w", err)
+    }
+
+    messages := []Message{*msg}
+    if err := loadReactionsSQLite(ctx, readTx, messages); err != nil {
+        return nil, err
+    }
+    if err := loadAttachmentsSQLite(ctx, readTx, messages); err != nil {
+        return nil, err
+    }
+    return &messages[0], readTx.Commit()
+}
+
+func loadReactionsSQLite(ctx context.Context, readTx *db.RequestDB, messages []Message) error {
+    if len(messages) == 0 {
+        return nil
+    }
+
+    args := make([]any, len(messages))
+    for i, msg := range messages {
+        args[i] = msg.ID
+    }
+    query := `SELECT message_id, emoji, user_id FROM chat_message_reactions
+              WHERE message_id IN (?` + strings.Repeat(", ?", len(messages)-1) + `)
+              ORDER BY created_at, rowid`
+
+    rows, err := readTx.QueryContext(ctx, query, args...)
+    if err != nil {
+        return fmt.Errorf("failed to query reactions: %w", err)
+    }
+    defer rows.Close()
+
+    var reactions []reactionRow
+    for rows.Next() {
+        var r reactionRow
+        if err := rows.Scan(&r.messageID, &r.emoji, &r.userID); err != nil {
+            return fmt.Errorf("failed to scan reaction: %w", err)
+        }
+        reactions = append(reactions, r)
+    }
+    if err := rows.Err(); err != nil {
+        return fmt.Errorf("error iterating reactions: %w", err)
+    }
+
+    attachReactions(messages, reactions)
+    return nil
+}
+
+func editMessageSQLite(pool *db.DBPool, ctx context.Context, messageID int, content string, at time.Time) error {
+    writeTx, err := pool.GetWriteTx(ctx)
+    if err != nil {
+        return fmt.Errorf("failed to begin transaction: %w", err)
+    }
+    defer writeTx.Rollback()
+
+    var previous string
+    var deletedAt sql.NullTime
+    err = writeTx.QueryRowContext(ctx, `SELECT content, deleted_at FROM chat_messages WHERE id = ?`, messageID).Scan(&previous, &deletedAt)
+    if errors.Is(err, sql.ErrNoRows) {
+        return ErrMessageNotFound
+    }
+    if err != nil {
+        return fmt.Errorf("failed to get message: %w", err)
+    }
+    if deletedAt.Valid {
+        return ErrMessageDeleted
+    }
+
+    _, err = writeTx.ExecContext(ctx, `INSERT INTO chat_message_edits (message_id, content, edited_at) VALUES (?, ?, ?)`,
+        messageID, previous, at)
+    if err != nil {
+        return fmt.Errorf("failed to store message edit: %w", err)
+    }
+
+    _, err = writeTx.ExecContext(ctx, `UPDATE chat_messages SET content = ?, edited_at = ? WHERE id = ?`, content, at, messageID)
+    if err != nil {
+        return fmt.Errorf("failed to edit message: %w", err)
+    }
+
+    return writeTx.Commit()
+}
+
+func deleteMessageSQLite(pool *db.DBPool, ctx context.Context, messageID int, deletedBy string, at time.Time) error {
+    writeTx, err := pool.GetWriteTx(ctx)
+    if err != nil {
+        return fmt.Errorf("failed to begin transaction: %w", err)
+    }
+    defer writeTx.Rollback()
+
+    result, err := writeTx.ExecContext(ctx, `UPDATE chat_messages SET deleted_at = ?, deleted_by = ? WHERE id = ? AND deleted_at IS NULL`,
+        at, deletedBy, messageID)
+    if err != nil {
+        return fmt.Errorf("failed to delete message: %w", err)
+    }
+    if deleted, _ := result.RowsAffected(); deleted == 0 {
+        return ErrMessageDeleted
+    }
+    return writeTx.Commit()
+}
+
+func getMessageEditsSQLite(pool *db.DBPool, ctx context.Context, messageID int) ([]MessageEdit, error) {
+    readTx, err := pool.GetReadTx(ctx)
+    if err != nil {
+        return nil, fmt.Errorf("failed to begin read transaction: %w", err)
+    }
+    defer readTx.Rollback()
+
+    rows, err := readTx.QueryContext(ctx, `SELECT content, edited_at FROM chat_message_edits WHERE message_id = ? ORDER BY id`, messageID)
+    if err != nil {
+        return nil, fmt.Errorf("failed to query message edits: %w", err)
+    }
+    defer rows.Close()
+
+    edits := []MessageEdit{}
+    for rows.Next() {
+        var edit MessageEdit
+        if err := rows.Scan(&edit.Content, &edit.EditedAt); err != nil {
+            return nil, fmt.Errorf("failed to scan message edit: %w", err)
+        }
+        edits = append(edits, edit)
+    }
+    if err := rows.Err(); err != nil {
+        return nil, fmt.Errorf("error iterating message edits: %w", err)
+    }
+    return edits, readTx.Commit()
+}
+
+func addReactionSQLite(pool *db.DBPool, ctx context.Context, messageID int, userID, emoji string) (bool, error) {
+    writeTx, err := pool.GetWriteTx(ctx)
+    if err != nil {
+        return false, fmt.Errorf("failed to begin transaction: %w", err)
+    }
+    defer writeTx.Rollback()
+
+    result, err := writeTx.ExecContext(ctx, `INSERT INTO chat_message_reactions (message_id, user_id, emoji, created_at)
+        VALUES (?, ?, ?, ?) ON CONFLICT (message_id, user_id, emoji) DO NOTHING`, messageID, userID, emoji, time.Now())
+    if err != nil {
+        return false, fmt.Errorf("failed to add reaction: %w", err)
+    }
+    added, _ := result.RowsAffected()
+    return added > 0, writeTx.Commit()
+}
+
+func removeReactionSQLite(pool *db.DBPool, ctx context.Context, messageID int, userID, emoji string) (bool, error) {
+    writeTx, err := pool.GetWriteTx(ctx)
+    if err != nil {
+        return false, fmt.Errorf("failed to begin transaction: %w", err)
+    }
+    defer writeTx.Rollback()
+
+    result, err := writeTx.ExecContext(ctx, `DELETE FROM chat_message_reactions WHERE message_id = ? AND user_id = ? AND emoji = ?`,
+        messageID, userID, emoji)
+    if err != nil {
+        return false, fmt.Errorf("failed to remove reaction: %w", err)
+    }
+    removed, _ := result.RowsAffected()
+    return removed > 0, writeTx.Commit()
+}
+
+func getUsernameByIDSQLite(pool *db.DBPool, ctx context.Context, userID string) (string, error) {
+    readTx, err := pool.GetReadTx(ctx)
+    if err != nil {
+        return "", err
+    }
+    defer readTx.Rollback()
+
+    var username string
+    query := `SELECT username FROM users WHERE user_id = ?`
+    err = readTx.QueryRowContext(ctx, query, userID).Scan(&username)
+    if err != nil {
+        return "", err
+    }
+
+    readTx.Commit()
+    return username, nil
+}
@@ -0,0 +1,180 @@
+package chat
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "regexp"
+    "strings"
+    "time"
+
+    "gooner/appcontext"
+    "gooner/db"
+)
+
+// maxMentions caps how many users one message can notify.
+const maxMentions = 20
+
+// mentionPattern matches @username where the @ does not follow a word, so
+// email addresses are not mentions.
+var mentionPattern = regexp.MustCompile(`(?:^|[^\p{L}\p{N}_@.])@([\p{L}\p{N}_.\-]+)`)
+
+// parseMentions returns the lowercased usernames mentioned in content,
+// each once.
+func parseMentions(content string) []string {
+    var names []string
+    seen := make(map[string]bool)
+    for _, match := range mentionPattern.FindAllStringSubmatch(content, -1) {
+        name := strings.ToLower(strings.TrimRight(match[1], ".-"))
+        if name == "" || seen[name] {
+            continue
+        }
+        seen[name] = true
+        names = append(names, name)
+        if len(names) == maxMentions {
+            break
+        }
+    }
+    return names
+}
+
+// notifyMentions records the users message mentions and sends each of
+// them a notification. Users already mentioned by an earlier version of
+// the message are not notified again. In private rooms only members can
+// be mentioned.
+func (h *Handler) notifyMentions(ctx context.Context, room *Room, message *Message) {
+    names := parseMentions(message.Content)
+    if len(names) == 0 {
+        return
+    }
+
+    notifications, err := StoreMentions(h.Pool, ctx, message, names, room.Private)
+    if err != nil {
+        h.Logger.Printf("Failed to store mentions of message %d: %v", message.ID, err)
+        return
+    }
+    if h.Hub == nil {
+        return
+    }
+
+    for i := range notifications {
+        data, err := json.Marshal(NotificationEvent{Type: "notification", Notification: &notifications[i]})
+        if err != nil {
+            h.Logger.Printf("Failed to encode notification %d: %v", notifications[i].ID, err)
+            continue
+        }
+        h.Hub.SendToUser(notifications[i].UserID, data)
+    }
+}
+
+// StoreMentions records which of usernames message mentions and creates a
+// notification for every user who was not mentioned by it before.
+func StoreMentions(pool *db.DBPool, ctx context.Context, message *Message, usernames []string, membersOnly bool) ([]Notification, error) {
+    switch pool.Type {
+    case "postgres":
+        return storeMentionsPostgres(pool, ctx, message, usernames, membersOnly)
+    case "sqlite3":
+        return storeMentionsSQLite(pool, ctx, message, usernames, membersOnly)
+    default:
+        return nil, fmt.Errorf("unsupported database type: %s", pool.Type)
+    }
+}
+
+// ListNotifications returns a user's latest notifications and how many of
+// them are unread. Notifications from private rooms the user has left are
+// left out.
+func ListNotifications(pool *db.DBPool, ctx context.Context, userID string, unreadOnly bool, limit int) ([]Notification, int, error) {
+    switch pool.Type {
+    case "postgres":
+        return listNotificationsPostgres(pool, ctx, userID, unreadOnly, limit)
+    case "sqlite3":
+        return listNotificationsSQLite(pool, ctx, userID, unreadOnly, limit)
+    default:
+        return nil, 0, fmt.Errorf("unsupported database type: %s", pool.Type)
+    }
+}
+
+// MarkNotificationsRead marks the user's notifications with ids read, or
+// all of them if ids is empty, and returns how many were unread.
+func MarkNotificationsRead(pool *db.DBPool, ctx context.Context, userID string, ids []int, at time.Time) (int, error) {
+    switch pool.Type {
+    case "postgres":
+        return markNotificationsReadPostgres(pool, ctx, userID, ids, at)
+    case "sqlite3":
+        return markNotificationsReadSQLite(pool, ctx, userID, ids, at)
+    default:
+        return 0, fmt.Errorf("unsupported database type: %s", pool.Type)
+    }
+}
+
+// notificationColumns are the columns scanned into a Notification, for a
+// query over chat_notifications n joined with visibleNotifications.
+const notificationColumns = `n.id, n.user_id, n.type, n.room_id, n.message_id, n.actor_id, COALESCE(a.username, ''),
+                 CASE WHEN m.deleted_at IS NULL THEN m.content ELSE '' END,
+                 n.created_at, n.read_at`
+
+const visibleNotifications = `chat_notifications n
+              JOIN chat_messages m ON m.id = n.message_id
+              JOIN chat_rooms r ON r.id = n.room_id
+              LEFT JOIN chat_room_members me ON me.room_id = n.room_id AND me.user_id = n.user_id
+              LEFT JOIN users a ON a.user_id = n.actor_id`
+
+// ListNotificationsHandler returns the caller's latest notifications,
+// only the unread ones with ?unread=true.
+func ListNotificationsHandler(ctx *appcontext.AppContext) {
+    userID, ok := ctx.Context.Value("userID").(string)
+    if !ok {
+        http.Error(ctx.Writer, "Unauthorized", http.StatusUnauthorized)
+        return
+    }
+
+    limit, ok := queryInt(ctx, "limit", 50, 100)
+    if !ok {
+        return
+    }
+    unreadOnly := ctx.Request.URL.Query().Get("unread") == "true"
+
+    notifications, unread, err := ListNotifications(ctx.Pool, ctx.Context, userID, unreadOnly, limit)
+    if err != nil {
+        ctx.Logger.Printf("Failed to list notifications: %v", err)
+        http.Error(ctx.Writer, "Failed to list notifications", http.StatusInternalServerError)
+        return
+    }
+    if notifications == nil {
+        notifications = []Notification{}
+    }
+
+    writeJSON(ctx, http.StatusOK, ListNotificationsResponse{Notifications: notifications, Unread: unread})
+}
+
+// MarkNotificationsReadHandler marks the caller's notifications read.
+func MarkNotificationsReadHandler(ctx *appcontext.AppContext) {
+    userID, ok := ctx.Context.Value("userID").(string)
+    if !ok {
+        http.Error(ctx.Writer, "Unauthorized", http.StatusUnauthorized)
+        return
+    }
+
+    var req MarkReadRequest
+    if err := json.NewDecoder(ctx.Request.Body).Decode(&req); err != nil {
+        http.Error(ctx.Writer, "Invalid JSON", http.StatusBadRequest)
+        return
+    }
+    if !req.All && len(req.IDs) == 0 {
+        http.Error(ctx.Writer, "ids or all is required", http.StatusBadRequest)
+        return
+    }
+    if req.All {
+        req.IDs = nil
+    }
+
+    updated, err := MarkNotificationsRead(ctx.Pool, ctx.Context, userID, req.IDs, time.Now())
+    if err != nil {
+        ctx.Logger.Printf("Failed to mark notifications read: %v", err)
+        http.Error(ctx.Writer, "Failed to mark notifications read", http.StatusInternalServerError)
+        return
+    }
+
+    writeJSON(ctx, http.StatusOK, MarkReadResponse{Updated: updated})
+}
@@ -0,0 +1,135 @@
+package chat
+
+import (
+    "context"
+    "fmt"
+    "time"
+
+    "gooner/db"
+)
+
+func storeMentionsPostgres(pool *db.DBPool, ctx context.Context, message *Message, usernames []string, membersOnly bool) ([]Notification, error) {
+    tx, err := pool.PgxPool.Begin(ctx)
+    if err != nil {
+        return nil, fmt.Errorf("failed to begin transaction: %w", err)
+    }
+    defer tx.Rollback(ctx)
+
+    query := `SELECT user_id FROM users WHERE LOWER(username) = ANY($1) AND user_id != $2`
+    args := []any{usernames, message.UserID}
+    if membersOnly {
+        query += ` AND user_id IN (SELECT user_id FROM chat_room_members WHERE room_id = $3)`
+        args = append(args, message.RoomID)
+    }
+
+    rows, err := tx.Query(ctx, query, args...)
+    if err != nil {
+        return nil, fmt.Errorf("failed to look up mentioned users: %w", err)
+    }
+    var userIDs []string
+    for rows.Next() {
+        var userID string
+        if err := rows.Scan(&userID); err != nil {
+            rows.Close()
+            return nil, fmt.Errorf("failed to scan mentioned user: %w", err)
+        }
+        userIDs = append(userIDs, userID)
+    }
+    rows.Close()
+    if err := rows.Err(); err != nil {
+        return nil, fmt.Errorf("error iterating mentioned users: %w", err)
+    }
+
+    now := time.Now()
+    var notifications []Notification
+    for _, userID := range userIDs {
+        tag, err := tx.Exec(ctx, `INSERT INTO chat_mentions (message_id, user_id) VALUES ($1, $2)
+            ON CONFLICT (message_id, user_id) DO NOTHING`, message.ID, userID)
+        if err != nil {
+            return nil, fmt.Errorf("failed to store mention: %w", err)
+        }
+        if tag.RowsAffected() == 0 {
+            continue
+        }
+
+        var id int
+        err = tx.QueryRow(ctx, `INSERT INTO chat_notifications (user_id, type, room_id, message_id, actor_id, created_at)
+            VALUES ($1, 'mention', $2, $3, $4, $5) RETURNING id`, userID, message.RoomID, message.ID, message.UserID, now).Scan(&id)
+        if err != nil {
+            return nil, fmt.Errorf("failed to store notification: %w", err)
+        }
+
+        notifications = append(notifications, Notification{
+            ID:            id,
+            UserID:        userID,
+            Type:          "mention",
+            RoomID:        message.RoomID,
+            MessageID:     message.ID,
+            ActorID:       message.UserID,
+            ActorUsername: message.Username,
+            Content:       message.Content,
+            CreatedAt:     now,
+        })
+    }
+
+    if err := tx.Commit(ctx); err != nil {
+        return nil, fmt.Errorf("failed to commit transaction: %w", err)
+    }
+    return notifications, nil
+}
+
+func listNotificationsPostgres(pool *db.DBPool, ctx context.Context, userID string, unreadOnly bool, limit int) ([]Notification, int, error) {
+    where := `n.user_id = $1 AND (NOT r.is_private OR me.user_id IS NOT NULL)`
+
+    var unread int
+    err := pool.PgxPool.QueryRow(ctx, `SELECT COUNT(*) FROM `+visibleNotifications+`
+              WHERE `+where+` AND n.read_at IS NULL`, userID).Scan(&unread)
+    if err != nil {
+        return nil, 0, fmt.Errorf("failed to count notifications: %w", err)
+    }
+
+    if unreadOnly {
+        where += ` AND n.read_at IS NULL`
+    }
+    query := `SELECT ` + notificationColumns + ` FROM ` + visibleNotifications + `
+              WHERE ` + where + `
+              ORDER BY n.id DESC
+              LIMIT $2`
+
+    rows, err := pool.PgxPool.Query(ctx, query, userID, limit)
+    if err != nil {
+        return nil, 0, fmt.Errorf("failed to query notifications: %w", err)
+    }
+    defer rows.Close()
+
+    var notifications []Notification
+    for rows.Next() {
+        var n Notification
+        err := rows.Scan(&n.ID, &n.UserID, &n.Type, &n.RoomID, &n.MessageID, &n.ActorID, &n.ActorUsername,
+            &n.Content, &n.CreatedAt, &n.ReadAt)
+        if err != nil {
+            return nil, 0, fmt.Errorf("failed to scan notification: %w", err)
+        }
+        notifications = append(notifications, n)
+    }
+    if err := rows.Err(); err != nil {
+        return nil, 0, fmt.Errorf("error iterating notifications: %w", err)
+    }
+
+    return notifications, unread, nil
+}
+
+func markNotificationsReadPostgres(pool *db.DBPool, ctx context.Context, userID string, ids []int, at time.Time) (int, error) {
+    query := `UPDATE chat_notifications SET read_at = $1 WHERE user_id = $2 AND read_at IS NULL`
+    args := []any{at, userID}
+    if len(ids) > 0 {
+        query += ` AND id = ANY($3)`
+        args = append(args, ids)
+    }
+
+    tag, err := pool.PgxPool.Exec(ctx, query, args...)
+    if err != nil {
+        return 0, fmt.Errorf("failed to mark notifications read: %w", err)
+    }
+    return int(tag.RowsAffected()), nil
+}
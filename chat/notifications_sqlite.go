@@ -0,0 +1,161 @@
+package chat
+
+import (
+    "context"
+    "database/sql"
+    "fmt"
+    "strings"
+    "time"
+
+    "gooner/db"
+)
+
+func storeMentionsSQLite(pool *db.DBPool, ctx context.Context, message *Message, usernames []string, membersOnly bool) ([]Notification, error) {
+    writeTx, err := pool.GetWriteTx(ctx)
+    if err != nil {
+        return nil, fmt.Errorf("failed to begin transaction: %w", err)
+    }
+    defer writeTx.Rollback()
+
+    query := `SELECT user_id FROM users
+              WHERE LOWER(username) IN (?` + strings.Repeat(", ?", len(usernames)-1) + `) AND user_id != ?`
+    args := make([]any, 0, len(usernames)+2)
+    for _, name := range usernames {
+        args = append(args, name)
+    }
+    args = append(args, message.UserID)
+    if membersOnly {
+        query += ` AND user_id IN (SELECT user_id FROM chat_room_members WHERE room_id = ?)`
+        args = append(args, message.RoomID)
+    }
+
+    rows, err := writeTx.QueryContext(ctx, query, args...)
+    if err != nil {
+        return nil, fmt.Errorf("failed to look up mentioned users: %w", err)
+    }
+    var userIDs []string
+    for rows.Next() {
+        var userID string
+        if err := rows.Scan(&userID); err != nil {
+            rows.Close()
+            return nil, fmt.Errorf("failed to scan mentioned user: %w", err)
+        }
+        userIDs = append(userIDs, userID)
+    }
+    rows.Close()
+    if err := rows.Err(); err != nil {
+        return nil, fmt.Errorf("error iterating mentioned users: %w", err)
+    }
+
+    now := time.Now()
+    var notifications []Notification
+    for _, userID := range userIDs {
+        result, err := writeTx.ExecContext(ctx, `INSERT INTO chat_mentions (message_id, user_id) VALUES (?, ?)
+            ON CONFLICT (message_id, user_id) DO NOTHING`, message.ID, userID)
+        if err != nil {
+            return nil, fmt.Errorf("failed to store mention: %w", err)
+        }
+        if added, _ := result.RowsAffected(); added == 0 {
+            continue
+        }
+
+        result, err = writeTx.ExecContext(ctx, `INSERT INTO chat_notifications (user_id, type, room_id, message_id, actor_id, created_at)
+            VALUES (?, 'mention', ?, ?, ?, ?)`, userID, message.RoomID, message.ID, message.UserID, now)
+        if err != nil {
+            return nil, fmt.Errorf("failed to store notification: %w", err)
+        }
+        id, err := result.LastInsertId()
+        if err != nil {
+            return nil, fmt.Errorf("failed to get notification ID: %w", err)
+        }
+
+        notifications = append(notifications, Notification{
+            ID:            int(id),
+            UserID:        userID,
+            Type:          "mention",
+            RoomID:        message.RoomID,
+            MessageID:     message.ID,
+            ActorID:       message.UserID,
+            ActorUsername: message.Username,
+            Content:       message.Content,
+            CreatedAt:     now,
+        })
+    }
+
+    return notifications, writeTx.Commit()
+}
+
+func listNotificationsSQLite(pool *db.DBPool, ctx context.Context, userID string, unreadOnly bool, limit int) ([]Notification, int, error) {
+    readTx, err := pool.GetReadTx(ctx)
+    if err != nil {
+        return nil, 0, fmt.Errorf("failed to begin read transaction: %w", err)
+    }
+    defer readTx.Rollback()
+
+    where := `n.user_id = ? AND (r.is_private = 0 OR me.user_id IS NOT NULL)`
+
+    var unread int
+    err = readTx.QueryRowContext(ctx, `SELECT COUNT(*) FROM `+visibleNotifications+`
+              WHERE `+where+` AND n.read_at IS NULL`, userID).Scan(&unread)
+    if err != nil {
+        return nil, 0, fmt.Errorf("failed to count notifications: %w", err)
+    }
+
+    if unreadOnly {
+        where += ` AND n.read_at IS NULL`
+    }
+    query := `SELECT ` + notificationColumns + ` FROM ` + visibleNotifications + `
+              WHERE ` + where + `
+              ORDER BY n.id DESC
+              LIMIT ?`
+
+    rows, err := readTx.QueryContext(ctx, query, userID, limit)
+    if err != nil {
+        return nil, 0, fmt.Errorf("failed to query notifications: %w", err)
+    }
+    defer rows.Close()
+
+    var notifications []Notification
+    for rows.Next() {
+        var n Notification
+        var readAt sql.NullTime
+        err := rows.Scan(&n.ID, &n.UserID, &n.Type, &n.RoomID, &n.MessageID, &n.ActorID, &n.ActorUsername,
+            &n.Content, &n.CreatedAt, &readAt)
+        if err != nil {
+            return nil, 0, fmt.Errorf("failed to scan notification: %w", err)
+        }
+        if readAt.Valid {
+            n.ReadAt = &readAt.Time
+        }
+        notifications = append(notifications, n)
+    }
+    if err := rows.Err(); err != nil {
+        return nil, 0, fmt.Errorf("error iterating notifications: %w", err)
+    }
+
+    return notifications, unread, readTx.Commit()
+}
+
+func markNotificationsReadSQLite(pool *db.DBPool, ctx context.Context, userID string, ids []int, at time.Time) (int, error) {
+    writeTx, err := pool.GetWriteTx(ctx)
+    if err != nil {
+        return 0, fmt.Errorf("failed to begin transaction: %w", err)
+    }
+    defer writeTx.Rollback()
+
+    query := `UPDATE chat_notifications SET read_at = ? WHERE user_id = ? AND read_at IS NULL`
+    args := []any{at, userID}
+    if len(ids) > 0 {
+        query += ` AND id IN (?` + strings.Repeat(", ?", len(ids)-1) + `)`
+        for _, id := range ids {
+            args = append(args, id)
+        }
+    }
+
+    result, err := writeTx.ExecContext(ctx, query, args...)
+    if err != nil {
+        return 0, fmt.Errorf("failed to mark notifications read: %w", err)
+    }
+    updated, _ := result.RowsAffected()
+    return int(updated), writeTx.Commit()
+}
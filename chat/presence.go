@@ -0,0 +1,360 @@
+package chat
+
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "log"
+    "net/http"
+    "sort"
+    "strings"
+    "sync"
+    "time"
+
+    "gooner/appcontext"
+    "gooner/db"
+    "gooner/websocket"
+)
+
+const (
+    defaultPresenceHeartbeat = 30 * time.Second
+    defaultTypingInterval    = 2 * time.Second
+    presenceTimeout          = 5 * time.Second
+)
+
+// Presence is one user's state in a room.
+type Presence struct {
+    UserID     string    `json:"user_id"`
+    Username   string    `json:"username"`
+    Online     bool      `json:"online"`
+    LastSeenAt time.Time `json:"last_seen_at"`
+}
+
+type RoomPresenceResponse struct {
+    RoomID string     `json:"room_id"`
+    Online int        `json:"online"`
+    Users  []Presence `json:"users"`
+}
+
+// PresenceEvent is published to a room's topic when a user comes online
+// ("presence" with status "online"), goes away ("presence" with status
+// "offline") or is typing ("typing").
+type PresenceEvent struct {
+    Type     string `json:"type"`
+    RoomID   string `json:"room_id"`
+    UserID   string `json:"user_id"`
+    Username string `json:"username,omitempty"`
+    Status   string `json:"status,omitempty"`
+}
+
+// PresenceTracker records who is in which room. Subscribing to a room's
+// topic counts as being in it. While a user is subscribed on this
+// instance, the heartbeat keeps their last_seen_at fresh, so a user whose
+// instance died shows as offline once the heartbeat is overdue. A user in
+// the same room through two instances who leaves on one is marked offline
+// by it and online again by the other's next heartbeat.
+type PresenceTracker struct {
+    Pool           *db.DBPool
+    Hub            *websocket.Hub
+    Logger         *log.Logger
+    Heartbeat      time.Duration
+    TypingInterval time.Duration // at most one typing event per user and room per interval
+
+    mu     sync.Mutex
+    here   map[presenceKey]bool
+    typing map[presenceKey]time.Time
+
+    stop context.CancelFunc
+    done chan struct{}
+}
+
+type presenceKey struct {
+    roomID string
+    userID string
+}
+
+func NewPresenceTracker(pool *db.DBPool, hub *websocket.Hub, logger *log.Logger) *PresenceTracker {
+    return &PresenceTracker{
+        Pool:           pool,
+        Hub:            hub,
+        Logger:         logger,
+        Heartbeat:      defaultPresenceHeartbeat,
+        TypingInterval: defaultTypingInterval,
+        here:           make(map[presenceKey]bool),
+        typing:         make(map[presenceKey]time.Time),
+    }
+}
+
+// onlineCutoff is how recent a heartbeat has to be for a user marked
+// online to count as online.
+func (p *PresenceTracker) onlineCutoff() time.Time {
+    return time.Now().Add(-2*p.Heartbeat - presenceTimeout)
+}
+
+// Track is the websocket.PresenceHandler for "chat" topics.
+func (p *PresenceTracker) Track(userID, topic string, online bool) {
+    roomID := strings.TrimPrefix(topic, "chat:")
+    key := presenceKey{roomID: roomID, userID: userID}
+
+    p.mu.Lock()
+    if online {
+        p.here[key] = true
+    } else {
+        delete(p.here, key)
+    }
+    p.mu.Unlock()
+
+    ctx, cancel := context.WithTimeout(context.Background(), presenceTimeout)
+    defer cancel()
+
+    if err := SetPresence(p.Pool, ctx, roomID, userID, online, time.Now()); err != nil {
+        p.Logger.Printf("Failed to update presence of %s in %s: %v", userID, roomID, err)
+    }
+
+    status := "offline"
+    if online {
+        status = "online"
+    }
+    p.publish(ctx, PresenceEvent{Type: "presence", RoomID: roomID, UserID: userID, Status: status})
+}
+
+// SocketTyping is the websocket.ActionHandler for
+// {"action": "typing", "topic": "chat:<room>"}. Typing events are not
+// stored; extra ones within TypingInterval are acked but not published.
+func (p *PresenceTracker) SocketTyping(ctx context.Context, userID string, msg websocket.ClientMessage) (any, error) {
+    roomID, ok := strings.CutPrefix(msg.Topic, "chat:")
+    if !ok {
+        return nil, websocket.ErrUnknownTopic
+    }
+
+    key := presenceKey{roomID: roomID, userID: userID}
+    now := time.Now()
+
+    p.mu.Lock()
+    last, seen := p.typing[key]
+    allowed := !seen || now.Sub(last) >= p.TypingInterval
+    if allowed {
+        p.typing[key] = now
+    }
+    p.mu.Unlock()
+
+    if allowed {
+        p.publish(ctx, PresenceEvent{Type: "typing", RoomID: roomID, UserID: userID})
+    }
+    return nil, nil
+}
+
+func (p *PresenceTracker) publish(ctx context.Context, event PresenceEvent) {
+    if p.Hub == nil {
+        return
+    }
+
+    if username, err := getUsernameByID(p.Pool, ctx, event.UserID); err == nil {
+        event.Username = username
+    }
+
+    data, err := json.Marshal(event)
+    if err != nil {
+        p.Logger.Printf("Failed to encode %s event: %v", event.Type, err)
+        return
+    }
+    p.Hub.Publish(websocket.RoomTopic(event.RoomID), data)
+}
+
+func (p *PresenceTracker) Start() {
+    if p.Heartbeat <= 0 {
+        p.Heartbeat = defaultPresenceHeartbeat
+    }
+
+    ctx, stop := context.WithCancel(context.Background())
+    p.stop = stop
+    p.done = make(chan struct{})
+
+    go func() {
+        defer close(p.done)
+
+        ticker := time.NewTicker(p.Heartbeat)
+        defer ticker.Stop()
+
+        for {
+            select {
+            case <-ctx.Done():
+                return
+            case <-ticker.C:
+                p.beat(ctx)
+            }
+        }
+    }()
+}
+
+// Stop ends the heartbeat and marks everyone on this instance offline.
+func (p *PresenceTracker) Stop() {
+    if p.stop == nil {
+        return
+    }
+    p.stop()
+    <-p.done
+
+    ctx, cancel := context.WithTimeout(context.Background(), presenceTimeout)
+    defer cancel()
+
+    now := time.Now()
+    for _, key := range p.present() {
+        if err := SetPresence(p.Pool, ctx, key.roomID, key.userID, false, now); err != nil {
+            p.Logger.Printf("Failed to update presence of %s in %s: %v", key.userID, key.roomID, err)
+        }
+    }
+}
+
+func (p *PresenceTracker) beat(ctx context.Context) {
+    now := time.Now()
+
+    p.mu.Lock()
+    for key, last := range p.typing {
+        if now.Sub(last) >= p.TypingInterval {
+            delete(p.typing, key)
+        }
+    }
+    p.mu.Unlock()
+
+    keys := p.present()
+    if len(keys) == 0 {
+        return
+    }
+
+    rooms := make([]string, len(keys))
+    users := make([]string, len(keys))
+    for i, key := range keys {
+        rooms[i], users[i] = key.roomID, key.userID
+    }
+    revived, err := TouchPresence(p.Pool, ctx, rooms, users, now)
+    if err != nil && ctx.Err() == nil {
+        p.Logger.Printf("Failed to refresh chat presence: %v", err)
+    }
+
+    // the user left the room on another instance while still connected to
+    // this one, and that instance told the room they went offline
+    for _, i := range revived {
+        p.publish(ctx, PresenceEvent{Type: "presence", RoomID: rooms[i], UserID: users[i], Status: "online"})
+    }
+}
+
+func (p *PresenceTracker) present() []presenceKey {
+    p.mu.Lock()
+    defer p.mu.Unlock()
+
+    keys := make([]presenceKey, 0, len(p.here))
+    for key := range p.here {
+        keys = append(keys, key)
+    }
+    return keys
+}
+
+// RoomPresenceHandler lists who is online in a room and when the others
+// were last seen there.
+func (p *PresenceTracker) RoomPresenceHandler(ctx *appcontext.AppContext) {
+    userID, ok := ctx.Context.Value("userID").(string)
+    if !ok {
+        http.Error(ctx.Writer, "Unauthorized", http.StatusUnauthorized)
+        return
+    }
+
+    roomID := ctx.Request.PathValue("id")
+    if _, err := visibleRoom(p.Pool, ctx.Context, roomID, userID); err != nil {
+        if errors.Is(err, ErrRoomNotFound) {
+            http.Error(ctx.Writer, "Room not found", http.StatusNotFound)
+            return
+        }
+        ctx.Logger.Printf("Failed to get room %s: %v", roomID, err)
+        http.Error(ctx.Writer, "Failed to get presence", http.StatusInternalServerError)
+        return
+    }
+
+    users, err := GetRoomPresence(p.Pool, ctx.Context, roomID, p.onlineCutoff())
+    if err != nil {
+        ctx.Logger.Printf("Failed to get presence for room %s: %v", roomID, err)
+        http.Error(ctx.Writer, "Failed to get presence", http.StatusInternalServerError)
+        return
+    }
+
+    response := RoomPresenceResponse{RoomID: roomID, Users: users}
+    if response.Users == nil {
+        response.Users = []Presence{}
+    }
+    for _, user := range users {
+        if user.Online {
+            response.Online++
+        }
+    }
+
+    ctx.Writer.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(ctx.Writer).Encode(response)
+}
+
+// SetPresence records that userID joined (online) or left a room at at.
+func SetPresence(pool *db.DBPool, ctx context.Context, roomID, userID string, online bool, at time.Time) error {
+    switch pool.Type {
+    case "postgres":
+        return setPresencePostgres(pool, ctx, roomID, userID, online, at)
+    case "sqlite3":
+        return setPresenceSQLite(pool, ctx, roomID, userID, online, at)
+    default:
+        return fmt.Errorf("unsupported database type: %s", pool.Type)
+    }
+}
+
+// TouchPresence refreshes last_seen_at of users that are still in a room
+// and marks them online again where another instance marked them offline
+// when they left there; rooms[i] and users[i] belong together. It returns
+// the indexes of the users that were marked online again.
+func TouchPresence(pool *db.DBPool, ctx context.Context, rooms, users []string, at time.Time) ([]int, error) {
+    switch pool.Type {
+    case "postgres":
+        return touchPresencePostgres(pool, ctx, rooms, users, at)
+    case "sqlite3":
+        return touchPresenceSQLite(pool, ctx, rooms, users, at)
+    default:
+        return nil, fmt.Errorf("unsupported database type: %s", pool.Type)
+    }
+}
+
+// GetPresentNonMembers returns the users who have been in a room without
+// being members of it, which only public rooms allow.
+func GetPresentNonMembers(pool *db.DBPool, ctx context.Context, roomID string) ([]string, error) {
+    switch pool.Type {
+    case "postgres":
+        return getPresentNonMembersPostgres(pool, ctx, roomID)
+    case "sqlite3":
+        return getPresentNonMembersSQLite(pool, ctx, roomID)
+    default:
+        return nil, fmt.Errorf("unsupported database type: %s", pool.Type)
+    }
+}
+
+// GetRoomPresence returns everyone who has been in a room, online users
+// first. Users marked online without a heartbeat since onlineSince count
+// as offline.
+func GetRoomPresence(pool *db.DBPool, ctx context.Context, roomID string, onlineSince time.Time) ([]Presence, error) {
+    var users []Presence
+    var err error
+    switch pool.Type {
+    case "postgres":
+        users, err = getRoomPresencePostgres(pool, ctx, roomID)
+    case "sqlite3":
+        users, err = getRoomPresenceSQLite(pool, ctx, roomID)
+    default:
+        return nil, fmt.Errorf("unsupported database type: %s", pool.Type)
+    }
+    if err != nil {
+        return nil, err
+    }
+
+    for i := range users {
+        users[i].Online = users[i].Online && !users[i].LastSeenAt.Before(onlineSince)
+    }
+    sort.SliceStable(users, func(i, j int) bool {
+        return users[i].Online && !users[j].Online
+    })
+    return users, nil
+}
@@ -0,0 +1,102 @@
+package chat
+
+import (
+    "context"
+    "fmt"
+    "time"
+
+    "gooner/db"
+)
+
+func setPresencePostgres(pool *db.DBPool, ctx context.Context, roomID, userID string, online bool, at time.Time) error {
+    query := `INSERT INTO chat_presence (room_id, user_id, online, last_seen_at)
+              VALUES ($1, $2, $3, $4)
+              ON CONFLICT (room_id, user_id) DO UPDATE SET online = excluded.online, last_seen_at = excluded.last_seen_at`
+    if _, err := pool.PgxPool.Exec(ctx, query, roomID, userID, online, at); err != nil {
+        return fmt.Errorf("failed to update presence: %w", err)
+    }
+    return nil
+}
+
+func touchPresencePostgres(pool *db.DBPool, ctx context.Context, rooms, users []string, at time.Time) ([]int, error) {
+    // old is the row as it was before the update
+    query := `UPDATE chat_presence p SET online = true, last_seen_at = $3
+              FROM unnest($1::text[], $2::text[]) WITH ORDINALITY AS t(room_id, user_id, i), chat_presence old
+              WHERE p.room_id = t.room_id AND p.user_id = t.user_id
+                AND old.room_id = p.room_id AND old.user_id = p.user_id
+              RETURNING t.i, old.online`
+
+    rows, err := pool.PgxPool.Query(ctx, query, rooms, users, at)
+    if err != nil {
+        return nil, fmt.Errorf("failed to refresh presence: %w", err)
+    }
+    defer rows.Close()
+
+    var revived []int
+    for rows.Next() {
+        var i int
+        var wasOnline bool
+        if err := rows.Scan(&i, &wasOnline); err != nil {
+            return nil, fmt.Errorf("failed to scan presence: %w", err)
+        }
+        if !wasOnline {
+            revived = append(revived, i-1)
+        }
+    }
+    if err := rows.Err(); err != nil {
+        return nil, fmt.Errorf("failed to refresh presence: %w", err)
+    }
+    return revived, nil
+}
+
+func getRoomPresencePostgres(pool *db.DBPool, ctx context.Context, roomID string) ([]Presence, error) {
+    query := `SELECT p.user_id, u.username, p.online, p.last_seen_at
+              FROM chat_presence p
+              JOIN users u ON u.user_id = p.user_id
+              WHERE p.room_id = $1
+              ORDER BY p.last_seen_at DESC`
+
+    rows, err := pool.PgxPool.Query(ctx, query, roomID)
+    if err != nil {
+        return nil, fmt.Errorf("failed to query presence: %w", err)
+    }
+    defer rows.Close()
+
+    var users []Presence
+    for rows.Next() {
+        var user Presence
+        if err := rows.Scan(&user.UserID, &user.Username, &user.Online, &user.LastSeenAt); err != nil {
+            return nil, fmt.Errorf("failed to scan presence: %w", err)
+        }
+        users = append(users, user)
+    }
+    if err := rows.Err(); err != nil {
+        return nil, fmt.Errorf("error iterating presence: %w", err)
+    }
+    return users, nil
+}
+
+func getPresentNonMembersPostgres(pool *db.DBPool, ctx context.Context, roomID string) ([]string, error) {
+    query := `SELECT p.user_id FROM chat_presence p
+              WHERE p.room_id = $1
+                AND NOT EXISTS (SELECT 1 FROM chat_room_members m WHERE m.room_id = p.room_id AND m.user_id = p.user_id)`
+
+    rows, err := pool.PgxPool.Query(ctx, query, roomID)
+    if err != nil {
+        return nil, fmt.Errorf("failed to query presence: %w", err)
+    }
+    defer rows.Close()
+
+    var users []string
+    for rows.Next() {
+        var userID string
+        if err := rows.Scan(&userID); err != nil {
+            return nil, fmt.Errorf("failed to scan presence: %w", err)
+        }
+        users = append(users, userID)
+    }
+    if err := rows.Err(); err != nil {
+        return nil, fmt.Errorf("error iterating presence: %w", err)
+    }
+    return users, nil
+}
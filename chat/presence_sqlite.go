@@ -0,0 +1,116 @@
+package chat
+
+import (
+    "context"
+    "fmt"
+    "time"
+
+    "gooner/db"
+)
+
+func setPresenceSQLite(pool *db.DBPool, ctx context.Context, roomID, userID string, online bool, at time.Time) error {
+    writeTx, err := pool.GetWriteTx(ctx)
+    if err != nil {
+        return fmt.Errorf("failed to begin transaction: %w", err)
+    }
+    defer writeTx.Rollback()
+
+    query := `INSERT INTO chat_presence (room_id, user_id, online, last_seen_at)
+              VALUES (?, ?, ?, ?)
+              ON CONFLICT (room_id, user_id) DO UPDATE SET online = excluded.online, last_seen_at = excluded.last_seen_at`
+    if _, err := writeTx.ExecContext(ctx, query, roomID, userID, online, at); err != nil {
+        return fmt.Errorf("failed to update presence: %w", err)
+    }
+    return writeTx.Commit()
+}
+
+func touchPresenceSQLite(pool *db.DBPool, ctx context.Context, rooms, users []string, at time.Time) ([]int, error) {
+    writeTx, err := pool.GetWriteTx(ctx)
+    if err != nil {
+        return nil, fmt.Errorf("failed to begin transaction: %w", err)
+    }
+    defer writeTx.Rollback()
+
+    revive := `UPDATE chat_presence SET online = 1, last_seen_at = ? WHERE room_id = ? AND user_id = ? AND online = 0`
+    touch := `UPDATE chat_presence SET last_seen_at = ? WHERE room_id = ? AND user_id = ? AND online = 1`
+
+    var revived []int
+    for i := range rooms {
+        result, err := writeTx.ExecContext(ctx, revive, at, rooms[i], users[i])
+        if err != nil {
+            return nil, fmt.Errorf("failed to refresh presence: %w", err)
+        }
+        if n, _ := result.RowsAffected(); n > 0 {
+            revived = append(revived, i)
+            continue
+        }
+        if _, err := writeTx.ExecContext(ctx, touch, at, rooms[i], users[i]); err != nil {
+            return nil, fmt.Errorf("failed to refresh presence: %w", err)
+        }
+    }
+    return revived, writeTx.Commit()
+}
+
+func getRoomPresenceSQLite(pool *db.DBPool, ctx context.Context, roomID string) ([]Presence, error) {
+    readTx, err := pool.GetReadTx(ctx)
+    if err != nil {
+        return nil, fmt.Errorf("failed to begin read transaction: %w", err)
+    }
+    defer readTx.Rollback()
+
+    query := `SELECT p.user_id, u.username, p.online, p.last_seen_at
+              FROM chat_presence p
+              JOIN users u ON u.user_id = p.user_id
+              WHERE p.room_id = ?
+              ORDER BY p.last_seen_at DESC`
+
+    rows, err := readTx.QueryContext(ctx, query, roomID)
+    if err != nil {
+        return nil, fmt.Errorf("failed to query presence: %w", err)
+    }
+    defer rows.Close()
+
+    var users []Presence
+    for rows.Next() {
+        var user Presence
+        if err := rows.Scan(&user.UserID, &user.Username, &user.Online, &user.LastSeenAt); err != nil {
+            return nil, fmt.Errorf("failed to scan presence: %w", err)
+        }
+        users = append(users, user)
+    }
+    if err := rows.Err(); err != nil {
+        return nil, fmt.Errorf("error iterating presence: %w", err)
+    }
+    return users, readTx.Commit()
+}
+
+func getPresentNonMembersSQLite(pool *db.DBPool, ctx context.Context, roomID string) ([]string, error) {
+    readTx, err := pool.GetReadTx(ctx)
+    if err != nil {
+        return nil, fmt.Errorf("failed to begin read transaction: %w", err)
+    }
+    defer readTx.Rollback()
+
+    query := `SELECT p.user_id FROM chat_presence p
+              WHERE p.room_id = ?
+                AND NOT EXISTS (SELECT 1 FROM chat_room_members m WHERE m.room_id = p.room_id AND m.user_id = p.user_id)`
+
+    rows, err := readTx.QueryContext(ctx, query, roomID)
+    if err != nil {
+        return nil, fmt.Errorf("failed to query presence: %w", err)
+    }
+    defer rows.Close()
+
+    var users []string
+    for rows.Next() {
+        var userID string
+        if err := rows.Scan(&userID); err != nil {
+            return nil, fmt.Errorf("failed to scan presence: %w", err)
+        }
+        users = append(users, userID)
+    }
+    if err := rows.Err(); err != nil {
+        return nil, fmt.Errorf("error iterating presence: %w", err)
+    }
+    return users, readTx.Commit()
+}
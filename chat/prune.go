@@ -0,0 +1,262 @@
+package chat
+
+import (
+    "compress/gzip"
+    "context"
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "os"
+    "path/filepath"
+    "time"
+
+    "gooner/appcontext"
+    "gooner/auth"
+    "gooner/blob"
+    "gooner/db"
+    "gooner/jobs"
+)
+
+// PruneJobType is the job that deletes the chat messages that fall outside
+// their room's retention.
+const PruneJobType = "chat_prune"
+
+const defaultPruneBatchSize = 500
+
+// Pruner enforces retention. Rooms without overrides use Default. With an
+// ArchiveDir, pruned messages are first appended to
+// <ArchiveDir>/<room>/<run start>.jsonl.gz, one JSON message per line.
+// The blobs of their attachments are deleted from Blobs, if it is set,
+// once the messages are.
+type Pruner struct {
+    Pool       *db.DBPool
+    Blobs      blob.Store
+    Default    RetentionPolicy
+    ArchiveDir string
+    BatchSize  int
+}
+
+func NewPruner(pool *db.DBPool, def RetentionPolicy, archiveDir string) *Pruner {
+    return &Pruner{
+        Pool:       pool,
+        Default:    def,
+        ArchiveDir: archiveDir,
+        BatchSize:  defaultPruneBatchSize,
+    }
+}
+
+// Run prunes every room once. Each batch is archived before it is deleted,
+// so a failed run can leave messages in an archive that are still in the
+// database, and archived again by the next run, but never deletes a message
+// it did not archive.
+func (p *Pruner) Run(ctx context.Context) (*PruneResult, error) {
+    rooms, err := listRetentionRows(p.Pool, ctx)
+    if err != nil {
+        return nil, err
+    }
+
+    start := time.Now()
+    result := &PruneResult{}
+    for i := range rooms {
+        room := &rooms[i]
+        policy := room.policy(p.Default)
+        if room.Messages == 0 || policy == (RetentionPolicy{}) {
+            continue
+        }
+
+        var before time.Time
+        if policy.MaxAge > 0 {
+            before = start.Add(-policy.MaxAge)
+        }
+        cutoff, err := pruneCutoff(p.Pool, ctx, room.RoomID, before, policy.MaxCount)
+        if err != nil {
+            return nil, err
+        }
+        if cutoff == 0 {
+            continue
+        }
+
+        deleted, archive, err := p.pruneRoom(ctx, room.RoomID, cutoff, start, result)
+        if deleted > 0 {
+            result.Rooms++
+            result.Deleted += deleted
+        }
+        if archive != "" {
+            result.Archives = append(result.Archives, archive)
+        }
+        if err != nil {
+            return nil, fmt.Errorf("failed to prune room %s: %w", room.RoomID, err)
+        }
+
+        if err := jobs.ReportProgress(ctx, (i+1)*100/len(rooms), room.RoomID); err != nil {
+            return nil, err
+        }
+    }
+    return result, nil
+}
+
+// pruneRoom deletes the messages of a room up to cutoff in batches and
+// returns how many it deleted and the archive they went to. Blobs that
+// could not be deleted are counted in result.
+func (p *Pruner) pruneRoom(ctx context.Context, roomID string, cutoff int, start time.Time, result *PruneResult) (int64, string, error) {
+    var path string
+    if p.ArchiveDir != "" {
+        path = filepath.Join(p.ArchiveDir, roomID, start.UTC().Format("20060102T150405Z")+".jsonl.gz")
+    }
+
+    var blobKeys []string
+    pruned := func(messages []Message, keys []string) error {
+        blobKeys = keys
+        if path == "" {
+            return nil
+        }
+        return appendArchive(path, messages)
+    }
+
+    batchSize := p.BatchSize
+    if batchSize <= 0 {
+        batchSize = defaultPruneBatchSize
+    }
+
+    var deleted int64
+    var err error
+    for {
+        var n int
+        blobKeys = nil
+        n, err = pruneBatch(p.Pool, ctx, roomID, cutoff, batchSize, start, pruned)
+        deleted += int64(n)
+        if err != nil {
+            break
+        }
+        result.BlobsFailed += p.deleteBlobs(ctx, blobKeys)
+        if n < batchSize {
+            break
+        }
+    }
+    if deleted == 0 {
+        path = ""
+    }
+    return deleted, path, err
+}
+
+// deleteBlobs deletes the blobs of pruned attachments and returns how many
+// it could not delete. They are left behind rather than failing the run,
+// since their messages are gone already.
+func (p *Pruner) deleteBlobs(ctx context.Context, keys []string) int {
+    if p.Blobs == nil {
+        return 0
+    }
+    failed := 0
+    for _, key := range keys {
+        if err := p.Blobs.Delete(ctx, key); err != nil {
+            failed++
+        }
+    }
+    return failed
+}
+
+// appendArchive writes messages to the archive at path as a gzip member of
+// their own, so the file stays readable (gzip readers go on to the next
+// member) if a later batch is never written.
+func appendArchive(path string, messages []Message) error {
+    if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+        return fmt.Errorf("failed to create archive directory: %w", err)
+    }
+
+    file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o640)
+    if err != nil {
+        return fmt.Errorf("failed to open archive: %w", err)
+    }
+    defer file.Close()
+
+    zw := gzip.NewWriter(file)
+    encoder := json.NewEncoder(zw)
+    for i := range messages {
+        if err := encoder.Encode(&messages[i]); err != nil {
+            return fmt.Errorf("failed to write archive: %w", err)
+        }
+    }
+    if err := zw.Close(); err != nil {
+        return fmt.Errorf("failed to write archive: %w", err)
+    }
+
+    // the messages are deleted once this returns
+    if err := file.Sync(); err != nil {
+        return fmt.Errorf("failed to sync archive: %w", err)
+    }
+    return file.Close()
+}
+
+// NewPruneJob returns the handler for PruneJobType.
+func NewPruneJob(p *Pruner) jobs.HandlerFunc {
+    return func(ctx context.Context, job *db.Job) ([]byte, error) {
+        result, err := p.Run(ctx)
+        if err != nil {
+            return nil, err
+        }
+        return jobs.Encode(job, result)
+    }
+}
+
+// RetentionStatusHandler shows admins the retention of every room, direct
+// conversations included, and the latest pruning job.
+func (p *Pruner) RetentionStatusHandler(ctx *appcontext.AppContext) {
+    if !requireAdmin(ctx) {
+        return
+    }
+
+    rooms, err := ListRetention(ctx.Pool, ctx.Context, p.Default)
+    if err != nil {
+        ctx.Logger.Printf("Failed to get retention status: %v", err)
+        http.Error(ctx.Writer, "Failed to get retention status", http.StatusInternalServerError)
+        return
+    }
+
+    runs, err := db.ListJobs(ctx.Pool, ctx.Context, db.JobFilter{Type: PruneJobType, Limit: 1})
+    if err != nil {
+        ctx.Logger.Printf("Failed to get retention status: %v", err)
+        http.Error(ctx.Writer, "Failed to get retention status", http.StatusInternalServerError)
+        return
+    }
+
+    response := RetentionStatusResponse{
+        Default: p.Default.settings(),
+        Archive: p.ArchiveDir != "",
+        Rooms:   rooms,
+    }
+    if len(runs) > 0 {
+        response.LastRun = &runs[0]
+    }
+    writeJSON(ctx, http.StatusOK, response)
+}
+
+// RunRetentionHandler lets admins queue a pruning run now rather than at
+// the next chat_retention schedule tick.
+func (p *Pruner) RunRetentionHandler(ctx *appcontext.AppContext) {
+    if !requireAdmin(ctx) {
+        return
+    }
+
+    jobID, err := jobs.Enqueue(ctx.Pool, ctx.Context, PruneJobType, 0, nil)
+    if err != nil {
+        ctx.Logger.Printf("Failed to enqueue %s job: %v", PruneJobType, err)
+        http.Error(ctx.Writer, "Failed to enqueue job", http.StatusInternalServerError)
+        return
+    }
+
+    writeJSON(ctx, http.StatusAccepted, map[string]any{"job_id": jobID})
+}
+
+// requireAdmin lets admins through and answers everyone else.
+func requireAdmin(ctx *appcontext.AppContext) bool {
+    userID, ok := ctx.Context.Value("userID").(string)
+    if !ok {
+        http.Error(ctx.Writer, "Unauthorized", http.StatusUnauthorized)
+        return false
+    }
+    if !auth.IsAdmin(userID) {
+        http.Error(ctx.Writer, "Forbidden", http.StatusForbidden)
+        return false
+    }
+    return true
+}
@@ -0,0 +1,169 @@
+package chat
+
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "net/http"
+    "time"
+
+    "gooner/appcontext"
+    "gooner/db"
+)
+
+// RetentionPolicy bounds how much history a room keeps. Zero fields do not
+// limit it.
+type RetentionPolicy struct {
+    MaxAge   time.Duration
+    MaxCount int
+}
+
+func (p RetentionPolicy) settings() RetentionSettings {
+    settings := RetentionSettings{MaxCount: p.MaxCount}
+    if p.MaxAge > 0 {
+        settings.MaxAge = p.MaxAge.String()
+    }
+    return settings
+}
+
+// roomRetentionRow is a room as the pruner sees it, with its overrides as
+// stored: max age in seconds, nil for the default.
+type roomRetentionRow struct {
+    RoomRetention
+    maxAge   *int64
+    maxCount *int
+}
+
+// policy is the room's overrides applied to def.
+func (r *roomRetentionRow) policy(def RetentionPolicy) RetentionPolicy {
+    if r.maxAge != nil {
+        def.MaxAge = time.Duration(*r.maxAge) * time.Second
+    }
+    if r.maxCount != nil {
+        def.MaxCount = *r.maxCount
+    }
+    return def
+}
+
+// ListRetention returns the retention of every room, direct conversations
+// included, with def as the server default.
+func ListRetention(pool *db.DBPool, ctx context.Context, def RetentionPolicy) ([]RoomRetention, error) {
+    rows, err := listRetentionRows(pool, ctx)
+    if err != nil {
+        return nil, err
+    }
+
+    rooms := make([]RoomRetention, len(rows))
+    for i := range rows {
+        room := rows[i].RoomRetention
+        if rows[i].maxAge != nil {
+            maxAge := (time.Duration(*rows[i].maxAge) * time.Second).String()
+            room.Override.MaxAge = &maxAge
+        }
+        room.Override.MaxCount = rows[i].maxCount
+        room.Effective = rows[i].policy(def).settings()
+        rooms[i] = room
+    }
+    return rooms, nil
+}
+
+func listRetentionRows(pool *db.DBPool, ctx context.Context) ([]roomRetentionRow, error) {
+    switch pool.Type {
+    case "postgres":
+        return listRetentionRowsPostgres(pool, ctx)
+    case "sqlite3":
+        return listRetentionRowsSQLite(pool, ctx)
+    default:
+        return nil, fmt.Errorf("unsupported database type: %s", pool.Type)
+    }
+}
+
+// SetRoomRetention stores a room's retention overrides, maxAge in seconds.
+// Nil goes back to the server default.
+func SetRoomRetention(pool *db.DBPool, ctx context.Context, roomID string, maxAge *int64, maxCount *int) error {
+    switch pool.Type {
+    case "postgres":
+        return setRoomRetentionPostgres(pool, ctx, roomID, maxAge, maxCount)
+    case "sqlite3":
+        return setRoomRetentionSQLite(pool, ctx, roomID, maxAge, maxCount)
+    default:
+        return fmt.Errorf("unsupported database type: %s", pool.Type)
+    }
+}
+
+// pruneCutoff returns the id of the newest message of a room that is older
+// than before or has at least maxCount newer ones, 0 if there is none. A
+// zero before or maxCount does not select anything.
+func pruneCutoff(pool *db.DBPool, ctx context.Context, roomID string, before time.Time, maxCount int) (int, error) {
+    switch pool.Type {
+    case "postgres":
+        return pruneCutoffPostgres(pool, ctx, roomID, before, maxCount)
+    case "sqlite3":
+        return pruneCutoffSQLite(pool, ctx, roomID, before, maxCount)
+    default:
+        return 0, fmt.Errorf("unsupported database type: %s", pool.Type)
+    }
+}
+
+// pruneBatch deletes the oldest messages of a room up to cutoff, at most
+// limit of them, and returns how many it deleted. They are passed to
+// pruned, with the blob keys of their attachments, before the deletion is
+// committed.
+func pruneBatch(pool *db.DBPool, ctx context.Context, roomID string, cutoff, limit int, at time.Time, pruned func([]Message, []string) error) (int, error) {
+    switch pool.Type {
+    case "postgres":
+        return pruneBatchPostgres(pool, ctx, roomID, cutoff, limit, at, pruned)
+    case "sqlite3":
+        return pruneBatchSQLite(pool, ctx, roomID, cutoff, limit, at, pruned)
+    default:
+        return 0, fmt.Errorf("unsupported database type: %s", pool.Type)
+    }
+}
+
+// SetRetentionHandler lets the owner of a room override the server's
+// retention for it. Fields left out or null go back to the default.
+func (h *Handler) SetRetentionHandler(ctx *appcontext.AppContext) {
+    room, _, ok := h.roomFromPath(ctx)
+    if !ok {
+        return
+    }
+    if room.Role != RoleOwner {
+        http.Error(ctx.Writer, "Forbidden", http.StatusForbidden)
+        return
+    }
+
+    var req RetentionOverride
+    if err := json.NewDecoder(ctx.Request.Body).Decode(&req); err != nil {
+        http.Error(ctx.Writer, "Invalid JSON", http.StatusBadRequest)
+        return
+    }
+
+    var maxAge *int64
+    if req.MaxAge != nil {
+        d, err := time.ParseDuration(*req.MaxAge)
+        if err != nil || d < 0 || (d > 0 && d < time.Minute) {
+            http.Error(ctx.Writer, "max_age must be a duration of at least 1m, or 0s", http.StatusBadRequest)
+            return
+        }
+        seconds := int64(d / time.Second)
+        maxAge = &seconds
+        *req.MaxAge = (time.Duration(seconds) * time.Second).String()
+    }
+    if req.MaxCount != nil && *req.MaxCount < 0 {
+        http.Error(ctx.Writer, "max_count must not be negative", http.StatusBadRequest)
+        return
+    }
+
+    if err := SetRoomRetention(h.Pool, ctx.Context, room.ID, maxAge, req.MaxCount); err != nil {
+        if errors.Is(err, ErrRoomNotFound) {
+            http.Error(ctx.Writer, "Room not found", http.StatusNotFound)
+            return
+        }
+        ctx.Logger.Printf("Failed to set retention of room %s: %v", room.ID, err)
+        http.Error(ctx.Writer, "Failed to set retention", http.StatusInternalServerError)
+        return
+    }
+
+    writeJSON(ctx, http.StatusOK, req)
+}
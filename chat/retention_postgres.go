@@ -0,0 +1,156 @@
+package chat
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "time"
+
+    "github.com/jackc/pgx/v5"
+    "gooner/db"
+)
+
+func listRetentionRowsPostgres(pool *db.DBPool, ctx context.Context) ([]roomRetentionRow, error) {
+    query := `SELECT r.id, r.name, r.kind, r.retention_max_age, r.retention_max_count, r.pruned_at, r.pruned_total,
+                     (SELECT COUNT(*) FROM chat_messages m WHERE m.room_id = r.id), o.created_at
+              FROM chat_rooms r
+              LEFT JOIN chat_messages o ON o.id = (SELECT MIN(m.id) FROM chat_messages m WHERE m.room_id = r.id)
+              ORDER BY r.id`
+
+    rows, err := pool.PgxPool.Query(ctx, query)
+    if err != nil {
+        return nil, fmt.Errorf("failed to query room retention: %w", err)
+    }
+    defer rows.Close()
+
+    var rooms []roomRetentionRow
+    for rows.Next() {
+        var room roomRetentionRow
+        err := rows.Scan(
+            &room.RoomID,
+            &room.Name,
+            &room.Kind,
+            &room.maxAge,
+            &room.maxCount,
+            &room.PrunedAt,
+            &room.PrunedTotal,
+            &room.Messages,
+            &room.OldestAt,
+        )
+        if err != nil {
+            return nil, fmt.Errorf("failed to scan room retention: %w", err)
+        }
+        rooms = append(rooms, room)
+    }
+    if err := rows.Err(); err != nil {
+        return nil, fmt.Errorf("error iterating room retention: %w", err)
+    }
+    return rooms, nil
+}
+
+func setRoomRetentionPostgres(pool *db.DBPool, ctx context.Context, roomID string, maxAge *int64, maxCount *int) error {
+    tag, err := pool.PgxPool.Exec(ctx, `UPDATE chat_rooms SET retention_max_age = $1, retention_max_count = $2 WHERE id = $3`,
+        maxAge, maxCount, roomID)
+    if err != nil {
+        return fmt.Errorf("failed to set room retention: %w", err)
+    }
+    if tag.RowsAffected() == 0 {
+        return ErrRoomNotFound
+    }
+    return nil
+}
+
+func pruneCutoffPostgres(pool *db.DBPool, ctx context.Context, roomID string, before time.Time, maxCount int) (int, error) {
+    var cutoff int
+    if !before.IsZero() {
+        err := pool.PgxPool.QueryRow(ctx, `SELECT COALESCE(MAX(id), 0) FROM chat_messages WHERE room_id = $1 AND created_at < $2`,
+            roomID, before).Scan(&cutoff)
+        if err != nil {
+            return 0, fmt.Errorf("failed to find expired messages: %w", err)
+        }
+    }
+    if maxCount > 0 {
+        var id int
+        err := pool.PgxPool.QueryRow(ctx, `SELECT id FROM chat_messages WHERE room_id = $1 ORDER BY id DESC LIMIT 1 OFFSET $2`,
+            roomID, maxCount).Scan(&id)
+        if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+            return 0, fmt.Errorf("failed to find messages over the limit: %w", err)
+        }
+        cutoff = max(cutoff, id)
+    }
+    return cutoff, nil
+}
+
+func pruneBatchPostgres(pool *db.DBPool, ctx context.Context, roomID string, cutoff, limit int, at time.Time, pruned func([]Message, []string) error) (int, error) {
+    tx, err := pool.PgxPool.Begin(ctx)
+    if err != nil {
+        return 0, fmt.Errorf("failed to begin transaction: %w", err)
+    }
+    defer tx.Rollback(ctx)
+
+    // the rows are locked so an edit cannot slip in between archiving a
+    // message and deleting it
+    query := `SELECT ` + messageColumns + `
+              FROM chat_messages m
+              JOIN users u ON m.user_id = u.user_id
+              WHERE m.room_id = $1 AND m.id <= $2
+              ORDER BY m.id
+              LIMIT $3
+              FOR UPDATE OF m`
+
+    rows, err := tx.Query(ctx, query, roomID, cutoff, limit)
+    if err != nil {
+        return 0, fmt.Errorf("failed to query messages: %w", err)
+    }
+    defer rows.Close()
+
+    var messages []Message
+    var ids []int
+    for rows.Next() {
+        msg, err := scanMessagePostgres(rows)
+        if err != nil {
+            return 0, fmt.Errorf("failed to scan message: %w", err)
+        }
+        messages = append(messages, *msg)
+        ids = append(ids, msg.ID)
+    }
+    if err := rows.Err(); err != nil {
+        return 0, fmt.Errorf("error iterating messages: %w", err)
+    }
+    rows.Close()
+    if len(messages) == 0 {
+        return 0, nil
+    }
+
+    if err := loadReactionsPostgres(ctx, tx, messages); err != nil {
+        return 0, err
+    }
+    if err := loadAttachmentsPostgres(ctx, tx, messages); err != nil {
+        return 0, err
+    }
+    keys, err := attachmentKeysPostgres(ctx, tx, ids)
+    if err != nil {
+        return 0, err
+    }
+    if err := pruned(messages, keys); err != nil {
+        return 0, err
+    }
+
+    // replies to pruned messages lose their reply_to through the foreign key
+    tag, err := tx.Exec(ctx, `DELETE FROM chat_messages WHERE id = ANY($1)`, ids)
+    if err != nil {
+        return 0, fmt.Errorf("failed to prune messages: %w", err)
+    }
+    deleted := tag.RowsAffected()
+
+    _, err = tx.Exec(ctx, `UPDATE chat_rooms SET pruned_at = $1, pruned_total = pruned_total + $2 WHERE id = $3`,
+        at, deleted, roomID)
+    if err != nil {
+        return 0, fmt.Errorf("failed to update room: %w", err)
+    }
+
+    if err := tx.Commit(ctx); err != nil {
+        return 0, fmt.Errorf("failed to commit transaction: %w", err)
+    }
+    return int(deleted), nil
+}
@@ -0,0 +1,196 @@
+package chat
+
+import (
+    "context"
+    "database/sql"
+    "errors"
+    "fmt"
+    "time"
+
+    "gooner/db"
+)
+
+func listRetentionRowsSQLite(pool *db.DBPool, ctx context.Context) ([]roomRetentionRow, error) {
+    readTx, err := pool.GetReadTx(ctx)
+    if err != nil {
+        return nil, fmt.Errorf("failed to begin read transaction: %w", err)
+    }
+    defer readTx.Rollback()
+
+    // the oldest message is joined rather than selected by a subquery so
+    // its created_at keeps the column's type
+    query := `SELECT r.id, r.name, r.kind, r.retention_max_age, r.retention_max_count, r.pruned_at, r.pruned_total,
+                     (SELECT COUNT(*) FROM chat_messages m WHERE m.room_id = r.id), o.created_at
+              FROM chat_rooms r
+              LEFT JOIN chat_messages o ON o.id = (SELECT MIN(m.id) FROM chat_messages m WHERE m.room_id = r.id)
+              ORDER BY r.id`
+
+    rows, err := readTx.QueryContext(ctx, query)
+    if err != nil {
+        return nil, fmt.Errorf("failed to query room retention: %w", err)
+    }
+    defer rows.Close()
+
+    var rooms []roomRetentionRow
+    for rows.Next() {
+        var room roomRetentionRow
+        var maxAge, maxCount sql.NullInt64
+        var prunedAt, oldestAt sql.NullTime
+        err := rows.Scan(
+            &room.RoomID,
+            &room.Name,
+            &room.Kind,
+            &maxAge,
+            &maxCount,
+            &prunedAt,
+            &room.PrunedTotal,
+            &room.Messages,
+            &oldestAt,
+        )
+        if err != nil {
+            return nil, fmt.Errorf("failed to scan room retention: %w", err)
+        }
+        if maxAge.Valid {
+            room.maxAge = &maxAge.Int64
+        }
+        if maxCount.Valid {
+            count := int(maxCount.Int64)
+            room.maxCount = &count
+        }
+        if prunedAt.Valid {
+            room.PrunedAt = &prunedAt.Time
+        }
+        if oldestAt.Valid {
+            room.OldestAt = &oldestAt.Time
+        }
+        rooms = append(rooms, room)
+    }
+    if err := rows.Err(); err != nil {
+        return nil, fmt.Errorf("error iterating room retention: %w", err)
+    }
+    return rooms, readTx.Commit()
+}
+
+func setRoomRetentionSQLite(pool *db.DBPool, ctx context.Context, roomID string, maxAge *int64, maxCount *int) error {
+    writeTx, err := pool.GetWriteTx(ctx)
+    if err != nil {
+        return fmt.Errorf("failed to begin transaction: %w", err)
+    }
+    defer writeTx.Rollback()
+
+    result, err := writeTx.ExecContext(ctx, `UPDATE chat_rooms SET retention_max_age = ?, retention_max_count = ? WHERE id = ?`,
+        maxAge, maxCount, roomID)
+    if err != nil {
+        return fmt.Errorf("failed to set room retention: %w", err)
+    }
+    if updated, _ := result.RowsAffected(); updated == 0 {
+        return ErrRoomNotFound
+    }
+    return writeTx.Commit()
+}
+
+func pruneCutoffSQLite(pool *db.DBPool, ctx context.Context, roomID string, before time.Time, maxCount int) (int, error) {
+    readTx, err := pool.GetReadTx(ctx)
+    if err != nil {
+        return 0, fmt.Errorf("failed to begin read transaction: %w", err)
+    }
+    defer readTx.Rollback()
+
+    var cutoff int
+    if !before.IsZero() {
+        // created_at is text with whatever offset it was written with, or
+        // none for CURRENT_TIMESTAMP, so it is compared as a time
+        err := readTx.QueryRowContext(ctx, `SELECT COALESCE(MAX(id), 0) FROM chat_messages
+            WHERE room_id = ? AND julianday(created_at) < julianday(?)`,
+            roomID, before.UTC()).Scan(&cutoff)
+        if err != nil {
+            return 0, fmt.Errorf("failed to find expired messages: %w", err)
+        }
+    }
+    if maxCount > 0 {
+        var id int
+        err := readTx.QueryRowContext(ctx, `SELECT id FROM chat_messages WHERE room_id = ? ORDER BY id DESC LIMIT 1 OFFSET ?`,
+            roomID, maxCount).Scan(&id)
+        if err != nil && !errors.Is(err, sql.ErrNoRows) {
+            return 0, fmt.Errorf("failed to find messages over the limit: %w", err)
+        }
+        cutoff = max(cutoff, id)
+    }
+    return cutoff, readTx.Commit()
+}
+
+func pruneBatchSQLite(pool *db.DBPool, ctx context.Context, roomID string, cutoff, limit int, at time.Time, pruned func([]Message, []string) error) (int, error) {
+    writeTx, err := pool.GetWriteTx(ctx)
+    if err != nil {
+        return 0, fmt.Errorf("failed to begin transaction: %w", err)
+    }
+    defer writeTx.Rollback()
+
+    query := `SELECT ` + messageColumns + `
+              FROM chat_messages m
+              JOIN users u ON m.user_id = u.user_id
+              WHERE m.room_id = ? AND m.id <= ?
+              ORDER BY m.id
+              LIMIT ?`
+
+    rows, err := writeTx.QueryContext(ctx, query, roomID, cutoff, limit)
+    if err != nil {
+        return 0, fmt.Errorf("failed to query messages: %w", err)
+    }
+    defer rows.Close()
+
+    var messages []Message
+    for rows.Next() {
+        msg, err := scanMessageSQLite(rows)
+        if err != nil {
+            return 0, fmt.Errorf("failed to scan message: %w", err)
+        }
+        messages = append(messages, *msg)
+    }
+    if err := rows.Err(); err != nil {
+        return 0, fmt.Errorf("error iterating messages: %w", err)
+    }
+    rows.Close()
+    if len(messages) == 0 {
+        return 0, nil
+    }
+
+    if err := loadReactionsSQLite(ctx, writeTx, messages); err != nil {
+        return 0, err
+    }
+    if err := loadAttachmentsSQLite(ctx, writeTx, messages); err != nil {
+        return 0, err
+    }
+    last := messages[len(messages)-1].ID
+    keys, err := attachmentKeysSQLite(ctx, writeTx, roomID, last)
+    if err != nil {
+        return 0, err
+    }
+    if err := pruned(messages, keys); err != nil {
+        return 0, err
+    }
+
+    // SQLite has no foreign key on reply_to, so replies that outlive their
+    // thread are unlinked here
+    _, err = writeTx.ExecContext(ctx, `UPDATE chat_messages SET reply_to = NULL WHERE room_id = ? AND reply_to <= ?`, roomID, last)
+    if err != nil {
+        return 0, fmt.Errorf("failed to unlink replies: %w", err)
+    }
+
+    result, err := writeTx.ExecContext(ctx, `DELETE FROM chat_messages WHERE room_id = ? AND id <= ?`, roomID, last)
+    if err != nil {
+        return 0, fmt.Errorf("failed to prune messages: %w", err)
+    }
+    deleted, _ := result.RowsAffected()
+
+    _, err = writeTx.ExecContext(ctx, `UPDATE chat_rooms SET pruned_at = ?, pruned_total = pruned_total + ? WHERE id = ?`,
+        at, deleted, roomID)
+    if err != nil {
+        return 0, fmt.Errorf("failed to update room: %w", err)
+    }
+
+    if err := writeTx.Commit(); err != nil {
+        return 0, fmt.Errorf("failed to commit transaction: %w", err)
+    }
+    return int(deleted), nil
+}
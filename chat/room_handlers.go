@@ -0,0 +1,470 @@
+package chat
+
+import (
+    "encoding/json"
+    "errors"
+    "net/http"
+    "regexp"
+    "strings"
+    "time"
+
+    "gooner/appcontext"
+    "gooner/db"
+    "gooner/websocket"
+)
+
+const (
+    maxRoomNameLength        = 100
+    maxRoomDescriptionLength = 1000
+)
+
+var roomIDPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,63}$`)
+
+// CreateRoomHandler creates a room owned by the caller.
+func (h *Handler) CreateRoomHandler(ctx *appcontext.AppContext) {
+    userID, ok := ctx.Context.Value("userID").(string)
+    if !ok {
+        http.Error(ctx.Writer, "Unauthorized", http.StatusUnauthorized)
+        return
+    }
+
+    var req CreateRoomRequest
+    if err := json.NewDecoder(ctx.Request.Body).Decode(&req); err != nil {
+        http.Error(ctx.Writer, "Invalid JSON", http.StatusBadRequest)
+        return
+    }
+
+    req.Name = strings.TrimSpace(req.Name)
+    if msg := validateRoom(req.Name, req.Description); msg != "" {
+        http.Error(ctx.Writer, msg, http.StatusBadRequest)
+        return
+    }
+
+    if req.ID == "" {
+        id, err := db.GenUUID()
+        if err != nil {
+            ctx.Logger.Printf("Failed to generate room id: %v", err)
+            http.Error(ctx.Writer, "Failed to create room", http.StatusInternalServerError)
+            return
+        }
+        req.ID = id
+    } else if !roomIDPattern.MatchString(req.ID) {
+        http.Error(ctx.Writer, "id must be 1-64 lowercase letters, digits, '-' or '_'", http.StatusBadRequest)
+        return
+    }
+
+    room := &Room{
+        ID:          req.ID,
+        Name:        req.Name,
+        Description: req.Description,
+        Kind:        RoomKindRoom,
+        Private:     req.Private,
+        OwnerID:     userID,
+        Role:        RoleOwner,
+        CreatedAt:   time.Now(),
+    }
+
+    if err := CreateRoom(h.Pool, ctx.Context, room, userID); err != nil {
+        if errors.Is(err, ErrRoomExists) {
+            http.Error(ctx.Writer, "Room already exists", http.StatusConflict)
+            return
+        }
+        ctx.Logger.Printf("Failed to create room: %v", err)
+        http.Error(ctx.Writer, "Failed to create room", http.StatusInternalServerError)
+        return
+    }
+
+    writeJSON(ctx, http.StatusCreated, room)
+}
+
+// ListRoomsHandler lists the public rooms and the caller's private rooms.
+// Archived rooms are left out unless ?archived=true.
+func (h *Handler) ListRoomsHandler(ctx *appcontext.AppContext) {
+    userID, ok := ctx.Context.Value("userID").(string)
+    if !ok {
+        http.Error(ctx.Writer, "Unauthorized", http.StatusUnauthorized)
+        return
+    }
+
+    includeArchived := ctx.Request.URL.Query().Get("archived") == "true"
+    rooms, err := ListRooms(h.Pool, ctx.Context, userID, includeArchived)
+    if err != nil {
+        ctx.Logger.Printf("Failed to list rooms: %v", err)
+        http.Error(ctx.Writer, "Failed to list rooms", http.StatusInternalServerError)
+        return
+    }
+    if rooms == nil {
+        rooms = []Room{}
+    }
+
+    writeJSON(ctx, http.StatusOK, ListRoomsResponse{Rooms: rooms, Count: len(rooms)})
+}
+
+func (h *Handler) GetRoomHandler(ctx *appcontext.AppContext) {
+    room, _, ok := h.roomFromPath(ctx)
+    if !ok {
+        return
+    }
+    writeJSON(ctx, http.StatusOK, room)
+}
+
+// UpdateRoomHandler lets owners and moderators rename a room or change its
+// description. Only the owner can make it public or private.
+func (h *Handler) UpdateRoomHandler(ctx *appcontext.AppContext) {
+    room, _, ok := h.roomFromPath(ctx)
+    if !ok {
+        return
+    }
+
+    var req UpdateRoomRequest
+    if err := json.NewDecoder(ctx.Request.Body).Decode(&req); err != nil {
+        http.Error(ctx.Writer, "Invalid JSON", http.StatusBadRequest)
+        return
+    }
+
+    if !canModerate(room.Role) || (req.Private != nil && room.Role != RoleOwner) {
+        http.Error(ctx.Writer, "Forbidden", http.StatusForbidden)
+        return
+    }
+    if room.ArchivedAt != nil {
+        http.Error(ctx.Writer, "Room is archived", http.StatusConflict)
+        return
+    }
+
+    if req.Name != nil {
+        *req.Name = strings.TrimSpace(*req.Name)
+        room.Name = *req.Name
+    }
+    if req.Description != nil {
+        room.Description = *req.Description
+    }
+    madePrivate := false
+    if req.Private != nil {
+        madePrivate = *req.Private && !room.Private
+        room.Private = *req.Private
+    }
+    if msg := validateRoom(room.Name, room.Description); msg != "" {
+        http.Error(ctx.Writer, msg, http.StatusBadRequest)
+        return
+    }
+
+    if err := UpdateRoom(h.Pool, ctx.Context, room.ID, req); err != nil {
+        ctx.Logger.Printf("Failed to update room %s: %v", room.ID, err)
+        http.Error(ctx.Writer, "Failed to update room", http.StatusInternalServerError)
+        return
+    }
+
+    h.publishRoomEvent(room.ID, RoomEvent{Type: "room_updated", Room: room})
+    if madePrivate {
+        h.unsubscribeNonMembers(ctx, room.ID)
+    }
+    writeJSON(ctx, http.StatusOK, room)
+}
+
+// unsubscribeNonMembers takes users who were following a public room
+// without joining it off its topic once it turns private. Everyone who
+// subscribed has a presence row, so that is where they are found; the hub
+// reaches their connections on every instance.
+func (h *Handler) unsubscribeNonMembers(ctx *appcontext.AppContext, roomID string) {
+    if h.Hub == nil {
+        return
+    }
+
+    users, err := GetPresentNonMembers(h.Pool, ctx.Context, roomID)
+    if err != nil {
+        ctx.Logger.Printf("Failed to find non-members of room %s: %v", roomID, err)
+        return
+    }
+    for _, userID := range users {
+        h.Hub.Unsubscribe(userID, websocket.RoomTopic(roomID))
+    }
+}
+
+// ArchiveRoomHandler makes a room read-only. Only its owner can do that.
+func (h *Handler) ArchiveRoomHandler(ctx *appcontext.AppContext) {
+    room, _, ok := h.roomFromPath(ctx)
+    if !ok {
+        return
+    }
+    if room.Role != RoleOwner {
+        http.Error(ctx.Writer, "Forbidden", http.StatusForbidden)
+        return
+    }
+
+    now := time.Now()
+    if err := ArchiveRoom(h.Pool, ctx.Context, room.ID, now); err != nil {
+        if errors.Is(err, ErrRoomArchived) {
+            http.Error(ctx.Writer, "Room is archived", http.StatusConflict)
+            return
+        }
+        ctx.Logger.Printf("Failed to archive room %s: %v", room.ID, err)
+        http.Error(ctx.Writer, "Failed to archive room", http.StatusInternalServerError)
+        return
+    }
+    room.ArchivedAt = &now
+
+    h.publishRoomEvent(room.ID, RoomEvent{Type: "room_archived", Room: room})
+    writeJSON(ctx, http.StatusOK, room)
+}
+
+// JoinRoomHandler adds the caller to a public room.
+func (h *Handler) JoinRoomHandler(ctx *appcontext.AppContext) {
+    room, userID, ok := h.roomFromPath(ctx)
+    if !ok {
+        return
+    }
+    if room.ArchivedAt != nil {
+        http.Error(ctx.Writer, "Room is archived", http.StatusConflict)
+        return
+    }
+    if room.Role != "" {
+        writeJSON(ctx, http.StatusOK, room)
+        return
+    }
+
+    if _, err := AddMember(h.Pool, ctx.Context, room.ID, userID, RoleMember); err != nil {
+        ctx.Logger.Printf("Failed to join room %s: %v", room.ID, err)
+        http.Error(ctx.Writer, "Failed to join room", http.StatusInternalServerError)
+        return
+    }
+    room.Role = RoleMember
+
+    h.publishMemberEvent(ctx, "member_added", room.ID, userID, RoleMember)
+    writeJSON(ctx, http.StatusOK, room)
+}
+
+func (h *Handler) ListMembersHandler(ctx *appcontext.AppContext) {
+    room, _, ok := h.roomFromPath(ctx)
+    if !ok {
+        return
+    }
+
+    members, err := ListMembers(h.Pool, ctx.Context, room.ID)
+    if err != nil {
+        ctx.Logger.Printf("Failed to list members of room %s: %v", room.ID, err)
+        http.Error(ctx.Writer, "Failed to list members", http.StatusInternalServerError)
+        return
+    }
+    if members == nil {
+        members = []Member{}
+    }
+
+    writeJSON(ctx, http.StatusOK, ListMembersResponse{Members: members, Count: len(members)})
+}
+
+// AddMemberHandler lets owners and moderators add users to a room. Only
+// the owner can add moderators.
+func (h *Handler) AddMemberHandler(ctx *appcontext.AppContext) {
+    room, _, ok := h.roomFromPath(ctx)
+    if !ok {
+        return
+    }
+
+    var req MemberRequest
+    if err := json.NewDecoder(ctx.Request.Body).Decode(&req); err != nil {
+        http.Error(ctx.Writer, "Invalid JSON", http.StatusBadRequest)
+        return
+    }
+    if req.Role == "" {
+        req.Role = RoleMember
+    }
+    if req.UserID == "" || (req.Role != RoleMember && req.Role != RoleModerator) {
+        http.Error(ctx.Writer, "user_id and a role of member or moderator are required", http.StatusBadRequest)
+        return
+    }
+
+    if !canModerate(room.Role) || (req.Role == RoleModerator && room.Role != RoleOwner) {
+        http.Error(ctx.Writer, "Forbidden", http.StatusForbidden)
+        return
+    }
+    if room.ArchivedAt != nil {
+        http.Error(ctx.Writer, "Room is archived", http.StatusConflict)
+        return
+    }
+
+    exists, err := userExists(h.Pool, ctx.Context, req.UserID)
+    if err != nil {
+        ctx.Logger.Printf("Failed to look up user %s: %v", req.UserID, err)
+        http.Error(ctx.Writer, "Failed to add member", http.StatusInternalServerError)
+        return
+    }
+    if !exists {
+        http.Error(ctx.Writer, "User not found", http.StatusNotFound)
+        return
+    }
+
+    added, err := AddMember(h.Pool, ctx.Context, room.ID, req.UserID, req.Role)
+    if err != nil {
+        ctx.Logger.Printf("Failed to add member to room %s: %v", room.ID, err)
+        http.Error(ctx.Writer, "Failed to add member", http.StatusInternalServerError)
+        return
+    }
+    if !added {
+        http.Error(ctx.Writer, "User is already a member", http.StatusConflict)
+        return
+    }
+
+    member := h.publishMemberEvent(ctx, "member_added", room.ID, req.UserID, req.Role)
+    writeJSON(ctx, http.StatusCreated, member)
+}
+
+// UpdateMemberHandler lets the owner make members moderators and back.
+func (h *Handler) UpdateMemberHandler(ctx *appcontext.AppContext) {
+    room, _, ok := h.roomFromPath(ctx)
+    if !ok {
+        return
+    }
+    memberID := ctx.Request.PathValue("user")
+
+    var req MemberRequest
+    if err := json.NewDecoder(ctx.Request.Body).Decode(&req); err != nil {
+        http.Error(ctx.Writer, "Invalid JSON", http.StatusBadRequest)
+        return
+    }
+    if req.Role != RoleMember && req.Role != RoleModerator {
+        http.Error(ctx.Writer, "role must be member or moderator", http.StatusBadRequest)
+        return
+    }
+
+    if room.Role != RoleOwner || memberID == room.OwnerID {
+        http.Error(ctx.Writer, "Forbidden", http.StatusForbidden)
+        return
+    }
+
+    if err := SetMemberRole(h.Pool, ctx.Context, room.ID, memberID, req.Role); err != nil {
+        if errors.Is(err, ErrMemberNotFound) {
+            http.Error(ctx.Writer, "Member not found", http.StatusNotFound)
+            return
+        }
+        ctx.Logger.Printf("Failed to update member of room %s: %v", room.ID, err)
+        http.Error(ctx.Writer, "Failed to update member", http.StatusInternalServerError)
+        return
+    }
+
+    member := h.publishMemberEvent(ctx, "member_updated", room.ID, memberID, req.Role)
+    writeJSON(ctx, http.StatusOK, member)
+}
+
+// RemoveMemberHandler removes a member from a room. Members can leave,
+// moderators can remove members and the owner anyone but themselves.
+func (h *Handler) RemoveMemberHandler(ctx *appcontext.AppContext) {
+    room, userID, ok := h.roomFromPath(ctx)
+    if !ok {
+        return
+    }
+    memberID := ctx.Request.PathValue("user")
+
+    if memberID == room.OwnerID {
+        http.Error(ctx.Writer, "The owner cannot leave the room", http.StatusForbidden)
+        return
+    }
+    if memberID != userID {
+        allowed := room.Role == RoleOwner
+        if room.Role == RoleModerator {
+            member, err := GetRoom(h.Pool, ctx.Context, room.ID, memberID)
+            if err != nil {
+                ctx.Logger.Printf("Failed to look up member of room %s: %v", room.ID, err)
+                http.Error(ctx.Writer, "Failed to remove member", http.StatusInternalServerError)
+                return
+            }
+            allowed = member.Role == RoleMember
+        }
+        if !allowed {
+            http.Error(ctx.Writer, "Forbidden", http.StatusForbidden)
+            return
+        }
+    }
+
+    if err := RemoveMember(h.Pool, ctx.Context, room.ID, memberID); err != nil {
+        if errors.Is(err, ErrMemberNotFound) {
+            http.Error(ctx.Writer, "Member not found", http.StatusNotFound)
+            return
+        }
+        ctx.Logger.Printf("Failed to remove member of room %s: %v", room.ID, err)
+        http.Error(ctx.Writer, "Failed to remove member", http.StatusInternalServerError)
+        return
+    }
+
+    removed := &Member{RoomID: room.ID, UserID: memberID}
+    if username, err := getUsernameByID(h.Pool, ctx.Context, memberID); err == nil {
+        removed.Username = username
+    }
+    h.publishRoomEvent(room.ID, RoomEvent{Type: "member_removed", Member: removed})
+    if room.Private && h.Hub != nil {
+        h.Hub.Unsubscribe(memberID, websocket.RoomTopic(room.ID))
+    }
+    ctx.Writer.WriteHeader(http.StatusNoContent)
+}
+
+// roomFromPath loads the room named by the {id} path value as the caller
+// sees it, writing the error response if that fails. Direct conversations
+// are not rooms here.
+func (h *Handler) roomFromPath(ctx *appcontext.AppContext) (*Room, string, bool) {
+    userID, ok := ctx.Context.Value("userID").(string)
+    if !ok {
+        http.Error(ctx.Writer, "Unauthorized", http.StatusUnauthorized)
+        return nil, "", false
+    }
+
+    roomID := ctx.Request.PathValue("id")
+    room, err := visibleRoom(h.Pool, ctx.Context, roomID, userID)
+    if err == nil && room.Kind != RoomKindRoom {
+        err = ErrRoomNotFound
+    }
+    if err != nil {
+        if errors.Is(err, ErrRoomNotFound) {
+            http.Error(ctx.Writer, "Room not found", http.StatusNotFound)
+            return nil, "", false
+        }
+        ctx.Logger.Printf("Failed to get room %s: %v", roomID, err)
+        http.Error(ctx.Writer, "Failed to get room", http.StatusInternalServerError)
+        return nil, "", false
+    }
+    return room, userID, true
+}
+
+func (h *Handler) publishMemberEvent(ctx *appcontext.AppContext, eventType, roomID, userID, role string) *Member {
+    member := &Member{RoomID: roomID, UserID: userID, Role: role, JoinedAt: time.Now()}
+    if username, err := getUsernameByID(h.Pool, ctx.Context, userID); err == nil {
+        member.Username = username
+    }
+    h.publishRoomEvent(roomID, RoomEvent{Type: eventType, Member: member})
+    return member
+}
+
+func (h *Handler) publishRoomEvent(roomID string, event RoomEvent) {
+    if h.Hub == nil {
+        return
+    }
+
+    data, err := json.Marshal(event)
+    if err != nil {
+        h.Logger.Printf("Failed to encode %s event: %v", event.Type, err)
+        return
+    }
+    h.Hub.Publish(websocket.RoomTopic(roomID), data)
+}
+
+func canModerate(role string) bool {
+    return role == RoleOwner || role == RoleModerator
+}
+
+func validateRoom(name, description string) string {
+    switch {
+    case name == "":
+        return "name is required"
+    case len([]rune(name)) > maxRoomNameLength:
+        return "name is too long"
+    case len([]rune(description)) > maxRoomDescriptionLength:
+        return "description is too long"
+    }
+    return ""
+}
+
+func writeJSON(ctx *appcontext.AppContext, status int, v any) {
+    ctx.Writer.Header().Set("Content-Type", "application/json")
+    ctx.Writer.WriteHeader(status)
+    if err := json.NewEncoder(ctx.Writer).Encode(v); err != nil {
+        ctx.Logger.Printf("Failed to encode response: %v", err)
+    }
+}
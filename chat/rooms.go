@@ -0,0 +1,149 @@
+package chat
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "time"
+
+    "gooner/db"
+)
+
+const (
+    RoomKindRoom   = "room"
+    RoomKindDirect = "dm"
+)
+
+const (
+    RoleOwner     = "owner"
+    RoleModerator = "moderator"
+    RoleMember    = "member"
+)
+
+var (
+    ErrRoomExists     = errors.New("room already exists")
+    ErrRoomArchived   = errors.New("room is archived")
+    ErrMemberNotFound = errors.New("member not found")
+    ErrUserNotFound   = errors.New("user not found")
+)
+
+// visibleRoom returns roomID as userID sees it. Private rooms they are not
+// a member of are reported as not found rather than forbidden, so their
+// names do not leak.
+func visibleRoom(pool *db.DBPool, ctx context.Context, roomID, userID string) (*Room, error) {
+    room, err := GetRoom(pool, ctx, roomID, userID)
+    if err != nil {
+        return nil, err
+    }
+    if room.Private && room.Role == "" {
+        return nil, ErrRoomNotFound
+    }
+    return room, nil
+}
+
+// CreateRoom stores room with owner as its owner. room.ID must be set.
+func CreateRoom(pool *db.DBPool, ctx context.Context, room *Room, owner string) error {
+    switch pool.Type {
+    case "postgres":
+        return createRoomPostgres(pool, ctx, room, owner)
+    case "sqlite3":
+        return createRoomSQLite(pool, ctx, room, owner)
+    default:
+        return fmt.Errorf("unsupported database type: %s", pool.Type)
+    }
+}
+
+// GetRoom returns a room with the role userID has in it.
+func GetRoom(pool *db.DBPool, ctx context.Context, roomID, userID string) (*Room, error) {
+    switch pool.Type {
+    case "postgres":
+        return getRoomPostgres(pool, ctx, roomID, userID)
+    case "sqlite3":
+        return getRoomSQLite(pool, ctx, roomID, userID)
+    default:
+        return nil, fmt.Errorf("unsupported database type: %s", pool.Type)
+    }
+}
+
+// ListRooms returns the public rooms and the private rooms userID is a
+// member of, by name.
+func ListRooms(pool *db.DBPool, ctx context.Context, userID string, includeArchived bool) ([]Room, error) {
+    switch pool.Type {
+    case "postgres":
+        return listRoomsPostgres(pool, ctx, userID, includeArchived)
+    case "sqlite3":
+        return listRoomsSQLite(pool, ctx, userID, includeArchived)
+    default:
+        return nil, fmt.Errorf("unsupported database type: %s", pool.Type)
+    }
+}
+
+// UpdateRoom changes the fields of req that are set.
+func UpdateRoom(pool *db.DBPool, ctx context.Context, roomID string, req UpdateRoomRequest) error {
+    switch pool.Type {
+    case "postgres":
+        return updateRoomPostgres(pool, ctx, roomID, req)
+    case "sqlite3":
+        return updateRoomSQLite(pool, ctx, roomID, req)
+    default:
+        return fmt.Errorf("unsupported database type: %s", pool.Type)
+    }
+}
+
+// ArchiveRoom makes a room read-only. Its messages and members are kept.
+func ArchiveRoom(pool *db.DBPool, ctx context.Context, roomID string, at time.Time) error {
+    switch pool.Type {
+    case "postgres":
+        return archiveRoomPostgres(pool, ctx, roomID, at)
+    case "sqlite3":
+        return archiveRoomSQLite(pool, ctx, roomID, at)
+    default:
+        return fmt.Errorf("unsupported database type: %s", pool.Type)
+    }
+}
+
+func ListMembers(pool *db.DBPool, ctx context.Context, roomID string) ([]Member, error) {
+    switch pool.Type {
+    case "postgres":
+        return listMembersPostgres(pool, ctx, roomID)
+    case "sqlite3":
+        return listMembersSQLite(pool, ctx, roomID)
+    default:
+        return nil, fmt.Errorf("unsupported database type: %s", pool.Type)
+    }
+}
+
+// AddMember adds userID to a room and reports whether they were not a
+// member yet. Existing members keep their role.
+func AddMember(pool *db.DBPool, ctx context.Context, roomID, userID, role string) (bool, error) {
+    switch pool.Type {
+    case "postgres":
+        return addMemberPostgres(pool, ctx, roomID, userID, role)
+    case "sqlite3":
+        return addMemberSQLite(pool, ctx, roomID, userID, role)
+    default:
+        return false, fmt.Errorf("unsupported database type: %s", pool.Type)
+    }
+}
+
+func SetMemberRole(pool *db.DBPool, ctx context.Context, roomID, userID, role string) error {
+    switch pool.Type {
+    case "postgres":
+        return setMemberRolePostgres(pool, ctx, roomID, userID, role)
+    case "sqlite3":
+        return setMemberRoleSQLite(pool, ctx, roomID, userID, role)
+    default:
+        return fmt.Errorf("unsupported database type: %s", pool.Type)
+    }
+}
+
+func RemoveMember(pool *db.DBPool, ctx context.Context, roomID, userID string) error {
+    switch pool.Type {
+    case "postgres":
+        return removeMemberPostgres(pool, ctx, roomID, userID)
+    case "sqlite3":
+        return removeMemberSQLite(pool, ctx, roomID, userID)
+    default:
+        return fmt.Errorf("unsupported database type: %s", pool.Type)
+    }
+}
@@ -0,0 +1,187 @@
+package chat
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "time"
+
+    "github.com/jackc/pgx/v5"
+    "gooner/db"
+)
+
+const roomSelectPostgres = `SELECT r.id, r.name, COALESCE(r.description, ''), r.kind, r.is_private, r.archived_at, r.created_at,
+                 COALESCE(me.role, ''), COALESCE(o.user_id, '')
+          FROM chat_rooms r
+          LEFT JOIN chat_room_members me ON me.room_id = r.id AND me.user_id = $1
+          LEFT JOIN chat_room_members o ON o.room_id = r.id AND o.role = 'owner'`
+
+func scanRoomPostgres(row pgx.Row) (*Room, error) {
+    var room Room
+    err := row.Scan(
+        &room.ID,
+        &room.Name,
+        &room.Description,
+        &room.Kind,
+        &room.Private,
+        &room.ArchivedAt,
+        &room.CreatedAt,
+        &room.Role,
+        &room.OwnerID,
+    )
+    if err != nil {
+        return nil, err
+    }
+    return &room, nil
+}
+
+func createRoomPostgres(pool *db.DBPool, ctx context.Context, room *Room, owner string) error {
+    tx, err := pool.PgxPool.Begin(ctx)
+    if err != nil {
+        return fmt.Errorf("failed to begin transaction: %w", err)
+    }
+    defer tx.Rollback(ctx)
+
+    tag, err := tx.Exec(ctx, `INSERT INTO chat_rooms (id, name, description, kind, is_private, created_at)
+        VALUES ($1, $2, $3, $4, $5, $6) ON CONFLICT (id) DO NOTHING`,
+        room.ID, room.Name, room.Description, room.Kind, room.Private, room.CreatedAt)
+    if err != nil {
+        return fmt.Errorf("failed to create room: %w", err)
+    }
+    if tag.RowsAffected() == 0 {
+        return ErrRoomExists
+    }
+
+    _, err = tx.Exec(ctx, `INSERT INTO chat_room_members (room_id, user_id, role, joined_at) VALUES ($1, $2, $3, $4)`,
+        room.ID, owner, RoleOwner, room.CreatedAt)
+    if err != nil {
+        return fmt.Errorf("failed to add room owner: %w", err)
+    }
+
+    if err := tx.Commit(ctx); err != nil {
+        return fmt.Errorf("failed to commit transaction: %w", err)
+    }
+    return nil
+}
+
+func getRoomPostgres(pool *db.DBPool, ctx context.Context, roomID, userID string) (*Room, error) {
+    room, err := scanRoomPostgres(pool.PgxPool.QueryRow(ctx, roomSelectPostgres+` WHERE r.id = $2`, userID, roomID))
+    if errors.Is(err, pgx.ErrNoRows) {
+        return nil, ErrRoomNotFound
+    }
+    if err != nil {
+        return nil, fmt.Errorf("failed to get room: %w", err)
+    }
+    return room, nil
+}
+
+func listRoomsPostgres(pool *db.DBPool, ctx context.Context, userID string, includeArchived bool) ([]Room, error) {
+    query := roomSelectPostgres + `
+          WHERE r.kind = 'room'
+            AND (NOT r.is_private OR me.user_id IS NOT NULL)
+            AND ($2 OR r.archived_at IS NULL)
+          ORDER BY r.name, r.id`
+
+    rows, err := pool.PgxPool.Query(ctx, query, userID, includeArchived)
+    if err != nil {
+        return nil, fmt.Errorf("failed to query rooms: %w", err)
+    }
+    defer rows.Close()
+
+    var rooms []Room
+    for rows.Next() {
+        room, err := scanRoomPostgres(rows)
+        if err != nil {
+            return nil, fmt.Errorf("failed to scan room: %w", err)
+        }
+        rooms = append(rooms, *room)
+    }
+    if err := rows.Err(); err != nil {
+        return nil, fmt.Errorf("error iterating rooms: %w", err)
+    }
+    return rooms, nil
+}
+
+func updateRoomPostgres(pool *db.DBPool, ctx context.Context, roomID string, req UpdateRoomRequest) error {
+    tag, err := pool.PgxPool.Exec(ctx, `UPDATE chat_rooms SET
+            name = COALESCE($2, name),
+            description = COALESCE($3, description),
+            is_private = COALESCE($4, is_private)
+        WHERE id = $1`, roomID, req.Name, req.Description, req.Private)
+    if err != nil {
+        return fmt.Errorf("failed to update room: %w", err)
+    }
+    if tag.RowsAffected() == 0 {
+        return ErrRoomNotFound
+    }
+    return nil
+}
+
+func archiveRoomPostgres(pool *db.DBPool, ctx context.Context, roomID string, at time.Time) error {
+    tag, err := pool.PgxPool.Exec(ctx, `UPDATE chat_rooms SET archived_at = $2 WHERE id = $1 AND archived_at IS NULL`, roomID, at)
+    if err != nil {
+        return fmt.Errorf("failed to archive room: %w", err)
+    }
+    if tag.RowsAffected() == 0 {
+        return ErrRoomArchived
+    }
+    return nil
+}
+
+func listMembersPostgres(pool *db.DBPool, ctx context.Context, roomID string) ([]Member, error) {
+    query := `SELECT m.room_id, m.user_id, u.username, m.role, m.joined_at
+              FROM chat_room_members m
+              JOIN users u ON u.user_id = m.user_id
+              WHERE m.room_id = $1
+              ORDER BY CASE m.role WHEN 'owner' THEN 0 WHEN 'moderator' THEN 1 ELSE 2 END, u.username`
+
+    rows, err := pool.PgxPool.Query(ctx, query, roomID)
+    if err != nil {
+        return nil, fmt.Errorf("failed to query members: %w", err)
+    }
+    defer rows.Close()
+
+    var members []Member
+    for rows.Next() {
+        var m Member
+        if err := rows.Scan(&m.RoomID, &m.UserID, &m.Username, &m.Role, &m.JoinedAt); err != nil {
+            return nil, fmt.Errorf("failed to scan member: %w", err)
+        }
+        members = append(members, m)
+    }
+    if err := rows.Err(); err != nil {
+        return nil, fmt.Errorf("error iterating members: %w", err)
+    }
+    return members, nil
+}
+
+func addMemberPostgres(pool *db.DBPool, ctx context.Context, roomID, userID, role string) (bool, error) {
+    tag, err := pool.PgxPool.Exec(ctx, `INSERT INTO chat_room_members (room_id, user_id, role, joined_at)
+        VALUES ($1, $2, $3, $4) ON CONFLICT (room_id, user_id) DO NOTHING`, roomID, userID, role, time.Now())
+    if err != nil {
+        return false, fmt.Errorf("failed to add member: %w", err)
+    }
+    return tag.RowsAffected() > 0, nil
+}
+
+func setMemberRolePostgres(pool *db.DBPool, ctx context.Context, roomID, userID, role string) error {
+    tag, err := pool.PgxPool.Exec(ctx, `UPDATE chat_room_members SET role = $3 WHERE room_id = $1 AND user_id = $2`, roomID, userID, role)
+    if err != nil {
+        return fmt.Errorf("failed to update member: %w", err)
+    }
+    if tag.RowsAffected() == 0 {
+        return ErrMemberNotFound
+    }
+    return nil
+}
+
+func removeMemberPostgres(pool *db.DBPool, ctx context.Context, roomID, userID string) error {
+    tag, err := pool.PgxPool.Exec(ctx, `DELETE FROM chat_room_members WHERE room_id = $1 AND user_id = $2`, roomID, userID)
+    if err != nil {
+        return fmt.Errorf("failed to remove member: %w", err)
+    }
+    if tag.RowsAffected() == 0 {
+        return ErrMemberNotFound
+    }
+    return nil
+}
@@ -0,0 +1,241 @@
+package chat
+
+import (
+    "context"
+    "database/sql"
+    "errors"
+    "fmt"
+    "time"
+
+    "gooner/db"
+)
+
+const roomSelectSQLite = `SELECT r.id, r.name, COALESCE(r.description, ''), r.kind, r.is_private, r.archived_at, r.created_at,
+                 COALESCE(me.role, ''), COALESCE(o.user_id, '')
+          FROM chat_rooms r
+          LEFT JOIN chat_room_members me ON me.room_id = r.id AND me.user_id = ?
+          LEFT JOIN chat_room_members o ON o.room_id = r.id AND o.role = 'owner'`
+
+type rowScanner interface {
+    Scan(dest ...any) error
+}
+
+func scanRoomSQLite(row rowScanner) (*Room, error) {
+    var room Room
+    var archivedAt sql.NullTime
+    err := row.Scan(
+        &room.ID,
+        &room.Name,
+        &room.Description,
+        &room.Kind,
+        &room.Private,
+        &archivedAt,
+        &room.CreatedAt,
+        &room.Role,
+        &room.OwnerID,
+    )
+    if err != nil {
+        return nil, err
+    }
+    if archivedAt.Valid {
+        room.ArchivedAt = &archivedAt.Time
+    }
+    return &room, nil
+}
+
+func createRoomSQLite(pool *db.DBPool, ctx context.Context, room *Room, owner string) error {
+    writeTx, err := pool.GetWriteTx(ctx)
+    if err != nil {
+        return fmt.Errorf("failed to begin transaction: %w", err)
+    }
+    defer writeTx.Rollback()
+
+    result, err := writeTx.ExecContext(ctx, `INSERT INTO chat_rooms (id, name, description, kind, is_private, created_at)
+        VALUES (?, ?, ?, ?, ?, ?) ON CONFLICT (id) DO NOTHING`,
+        room.ID, room.Name, room.Description, room.Kind, room.Private, room.CreatedAt)
+    if err != nil {
+        return fmt.Errorf("failed to create room: %w", err)
+    }
+    if created, _ := result.RowsAffected(); created == 0 {
+        return ErrRoomExists
+    }
+
+    _, err = writeTx.ExecContext(ctx, `INSERT INTO chat_room_members (room_id, user_id, role, joined_at) VALUES (?, ?, ?, ?)`,
+        room.ID, owner, RoleOwner, room.CreatedAt)
+    if err != nil {
+        return fmt.Errorf("failed to add room owner: %w", err)
+    }
+
+    return writeTx.Commit()
+}
+
+func getRoomSQLite(pool *db.DBPool, ctx context.Context, roomID, userID string) (*Room, error) {
+    readTx, err := pool.GetReadTx(ctx)
+    if err != nil {
+        return nil, fmt.Errorf("failed to begin read transaction: %w", err)
+    }
+    defer readTx.Rollback()
+
+    room, err := scanRoomSQLite(readTx.QueryRowContext(ctx, roomSelectSQLite+` WHERE r.id = ?`, userID, roomID))
+    if errors.Is(err, sql.ErrNoRows) {
+        return nil, ErrRoomNotFound
+    }
+    if err != nil {
+        return nil, fmt.Errorf("failed to get room: %w", err)
+    }
+    return room, readTx.Commit()
+}
+
+func listRoomsSQLite(pool *db.DBPool, ctx context.Context, userID string, includeArchived bool) ([]Room, error) {
+    readTx, err := pool.GetReadTx(ctx)
+    if err != nil {
+        return nil, fmt.Errorf("failed to begin read transaction: %w", err)
+    }
+    defer readTx.Rollback()
+
+    query := roomSelectSQLite + `
+          WHERE r.kind = 'room'
+            AND (r.is_private = 0 OR me.user_id IS NOT NULL)
+            AND (? OR r.archived_at IS NULL)
+          ORDER BY r.name, r.id`
+
+    rows, err := readTx.QueryContext(ctx, query, userID, includeArchived)
+    if err != nil {
+        return nil, fmt.Errorf("failed to query rooms: %w", err)
+    }
+    defer rows.Close()
+
+    var rooms []Room
+    for rows.Next() {
+        room, err := scanRoomSQLite(rows)
+        if err != nil {
+            return nil, fmt.Errorf("failed to scan room: %w", err)
+        }
+        rooms = append(rooms, *room)
+    }
+    if err := rows.Err(); err != nil {
+        return nil, fmt.Errorf("error iterating rooms: %w", err)
+    }
+    return rooms, readTx.Commit()
+}
+
+func updateRoomSQLite(pool *db.DBPool, ctx context.Context, roomID string, req UpdateRoomRequest) error {
+    writeTx, err := pool.GetWriteTx(ctx)
+    if err != nil {
+        return fmt.Errorf("failed to begin transaction: %w", err)
+    }
+    defer writeTx.Rollback()
+
+    result, err := writeTx.ExecContext(ctx, `UPDATE chat_rooms SET
+            name = COALESCE(?, name),
+            description = COALESCE(?, description),
+            is_private = COALESCE(?, is_private)
+        WHERE id = ?`, req.Name, req.Description, req.Private, roomID)
+    if err != nil {
+        return fmt.Errorf("failed to update room: %w", err)
+    }
+    if updated, _ := result.RowsAffected(); updated == 0 {
+        return ErrRoomNotFound
+    }
+    return writeTx.Commit()
+}
+
+func archiveRoomSQLite(pool *db.DBPool, ctx context.Context, roomID string, at time.Time) error {
+    writeTx, err := pool.GetWriteTx(ctx)
+    if err != nil {
+        return fmt.Errorf("failed to begin transaction: %w", err)
+    }
+    defer writeTx.Rollback()
+
+    result, err := writeTx.ExecContext(ctx, `UPDATE chat_rooms SET archived_at = ? WHERE id = ? AND archived_at IS NULL`, at, roomID)
+    if err != nil {
+        return fmt.Errorf("failed to archive room: %w", err)
+    }
+    if archived, _ := result.RowsAffected(); archived == 0 {
+        return ErrRoomArchived
+    }
+    return writeTx.Commit()
+}
+
+func listMembersSQLite(pool *db.DBPool, ctx context.Context, roomID string) ([]Member, error) {
+    readTx, err := pool.GetReadTx(ctx)
+    if err != nil {
+        return nil, fmt.Errorf("failed to begin read transaction: %w", err)
+    }
+    defer readTx.Rollback()
+
+    query := `SELECT m.room_id, m.user_id, u.username, m.role, m.joined_at
+              FROM chat_room_members m
+              JOIN users u ON u.user_id = m.user_id
+              WHERE m.room_id = ?
+              ORDER BY CASE m.role WHEN 'owner' THEN 0 WHEN 'moderator' THEN 1 ELSE 2 END, u.username`
+
+    rows, err := readTx.QueryContext(ctx, query, roomID)
+    if err != nil {
+        return nil, fmt.Errorf("failed to query members: %w", err)
+    }
+    defer rows.Close()
+
+    var members []Member
+    for rows.Next() {
+        var m Member
+        if err := rows.Scan(&m.RoomID, &m.UserID, &m.Username, &m.Role, &m.JoinedAt); err != nil {
+            return nil, fmt.Errorf("failed to scan member: %w", err)
+        }
+        members = append(members, m)
+    }
+    if err := rows.Err(); err != nil {
+        return nil, fmt.Errorf("error iterating members: %w", err)
+    }
+    return members, readTx.Commit()
+}
+
+func addMemberSQLite(pool *db.DBPool, ctx context.Context, roomID, userID, role string) (bool, error) {
+    writeTx, err := pool.GetWriteTx(ctx)
+    if err != nil {
+        return false, fmt.Errorf("failed to begin transaction: %w", err)
+    }
+    defer writeTx.Rollback()
+
+    result, err := writeTx.ExecContext(ctx, `INSERT INTO chat_room_members (room_id, user_id, role, joined_at)
+        VALUES (?, ?, ?, ?) ON CONFLICT (room_id, user_id) DO NOTHING`, roomID, userID, role, time.Now())
+    if err != nil {
+        return false, fmt.Errorf("failed to add member: %w", err)
+    }
+    added, _ := result.RowsAffected()
+    return added > 0, writeTx.Commit()
+}
+
+func setMemberRoleSQLite(pool *db.DBPool, ctx context.Context, roomID, userID, role string) error {
+    writeTx, err := pool.GetWriteTx(ctx)
+    if err != nil {
+        return fmt.Errorf("failed to begin transaction: %w", err)
+    }
+    defer writeTx.Rollback()
+
+    result, err := writeTx.ExecContext(ctx, `UPDATE chat_room_members SET role = ? WHERE room_id = ? AND user_id = ?`, role, roomID, userID)
+    if err != nil {
+        return fmt.Errorf("failed to update member: %w", err)
+    }
+    if updated, _ := result.RowsAffected(); updated == 0 {
+        return ErrMemberNotFound
+    }
+    return writeTx.Commit()
+}
+
+func removeMemberSQLite(pool *db.DBPool, ctx context.Context, roomID, userID string) error {
+    writeTx, err := pool.GetWriteTx(ctx)
+    if err != nil {
+        return fmt.Errorf("failed to begin transaction: %w", err)
+    }
+    defer writeTx.Rollback()
+
+    result, err := writeTx.ExecContext(ctx, `DELETE FROM chat_room_members WHERE room_id = ? AND user_id = ?`, roomID, userID)
+    if err != nil {
+        return fmt.Errorf("failed to remove member: %w", err)
+    }
+    if removed, _ := result.RowsAffected(); removed == 0 {
+        return ErrMemberNotFound
+    }
+    return writeTx.Commit()
+}
@@ -0,0 +1,143 @@
+package chat
+
+import (
+    "context"
+    "fmt"
+    "html"
+    "net/http"
+    "strings"
+    "time"
+
+    "gooner/appcontext"
+    "gooner/db"
+)
+
+// markStart and markEnd delimit matches in snippets coming from the
+// database. They are private use characters, so they survive HTML
+// escaping and cannot be confused with anything a user typed into a tag.
+const (
+    markStart = "\ue000"
+    markEnd   = "\ue001"
+)
+
+// EnsureSearchIndex sets up the full-text index of chat messages where it
+// is not part of the migrations, and reports whether search uses it. On
+// SQLite it needs FTS5 (-tags sqlite_fts5); without it search falls back
+// to LIKE.
+func EnsureSearchIndex(pool *db.DBPool, ctx context.Context) (bool, error) {
+    switch pool.Type {
+    case "postgres":
+        return true, nil
+    case "sqlite3":
+        return ensureSearchIndexSQLite(pool, ctx)
+    default:
+        return false, fmt.Errorf("unsupported database type: %s", pool.Type)
+    }
+}
+
+// SearchMessages runs a full-text search for userID, best matches first,
+// and reports whether there are more results past q.Limit. Every term of
+// q.Text has to match.
+func SearchMessages(pool *db.DBPool, ctx context.Context, userID string, q SearchQuery) ([]SearchResult, bool, error) {
+    var results []SearchResult
+    var err error
+    switch pool.Type {
+    case "postgres":
+        results, err = searchMessagesPostgres(pool, ctx, userID, q)
+    case "sqlite3":
+        results, err = searchMessagesSQLite(pool, ctx, userID, q)
+    default:
+        return nil, false, fmt.Errorf("unsupported database type: %s", pool.Type)
+    }
+    if err != nil {
+        return nil, false, err
+    }
+
+    hasMore := len(results) > q.Limit
+    if hasMore {
+        results = results[:q.Limit]
+    }
+    for i := range results {
+        results[i].Snippet = highlight(results[i].Snippet)
+    }
+    return results, hasMore, nil
+}
+
+// highlight escapes a snippet for HTML and turns its match delimiters into
+// <mark> tags.
+func highlight(snippet string) string {
+    return strings.NewReplacer(markStart, "<mark>", markEnd, "</mark>").Replace(html.EscapeString(snippet))
+}
+
+// SearchHandler searches the messages of the rooms and conversations the
+// caller can read for ?q=, optionally only in ?room_id=, by ?author=<user
+// id> and between ?from= and ?to= (RFC 3339 times or dates).
+func SearchHandler(ctx *appcontext.AppContext) {
+    userID, ok := ctx.Context.Value("userID").(string)
+    if !ok {
+        http.Error(ctx.Writer, "Unauthorized", http.StatusUnauthorized)
+        return
+    }
+
+    params := ctx.Request.URL.Query()
+    q := SearchQuery{
+        Text:   strings.TrimSpace(params.Get("q")),
+        RoomID: params.Get("room_id"),
+        UserID: params.Get("author"),
+    }
+    if q.Text == "" {
+        http.Error(ctx.Writer, "q is required", http.StatusBadRequest)
+        return
+    }
+    if len([]rune(q.Text)) > 200 {
+        http.Error(ctx.Writer, "q is too long", http.StatusBadRequest)
+        return
+    }
+
+    var err error
+    if q.From, err = parseSearchTime(params.Get("from"), false); err != nil {
+        http.Error(ctx.Writer, "from must be an RFC 3339 time or a date", http.StatusBadRequest)
+        return
+    }
+    if q.To, err = parseSearchTime(params.Get("to"), true); err != nil {
+        http.Error(ctx.Writer, "to must be an RFC 3339 time or a date", http.StatusBadRequest)
+        return
+    }
+    if q.Limit, ok = queryInt(ctx, "limit", 20, 100); !ok {
+        return
+    }
+    if q.Offset, ok = queryInt(ctx, "offset", 0, 0); !ok {
+        return
+    }
+
+    results, hasMore, err := SearchMessages(ctx.Pool, ctx.Context, userID, q)
+    if err != nil {
+        ctx.Logger.Printf("Failed to search messages: %v", err)
+        http.Error(ctx.Writer, "Failed to search messages", http.StatusInternalServerError)
+        return
+    }
+    if results == nil {
+        results = []SearchResult{}
+    }
+
+    writeJSON(ctx, http.StatusOK, SearchResponse{Results: results, HasMore: hasMore})
+}
+
+// parseSearchTime parses a search bound. A date as the upper bound
+// includes the whole day.
+func parseSearchTime(value string, end bool) (time.Time, error) {
+    if value == "" {
+        return time.Time{}, nil
+    }
+    if t, err := time.Parse(time.RFC3339, value); err == nil {
+        return t, nil
+    }
+    t, err := time.ParseInLocation(time.DateOnly, value, time.Local)
+    if err != nil {
+        return time.Time{}, err
+    }
+    if end {
+        t = t.AddDate(0, 0, 1).Add(-time.Nanosecond)
+    }
+    return t, nil
+}
@@ -0,0 +1,69 @@
+package chat
+
+import (
+    "context"
+    "fmt"
+
+    "gooner/db"
+)
+
+func searchMessagesPostgres(pool *db.DBPool, ctx context.Context, userID string, q SearchQuery) ([]SearchResult, error) {
+    options := fmt.Sprintf(`StartSel="%s", StopSel="%s", MaxWords=24, MinWords=8, MaxFragments=1, FragmentDelimiter="…"`, markStart, markEnd)
+    args := []any{q.Text, userID, options}
+
+    where := `m.content_tsv @@ query
+                AND m.deleted_at IS NULL
+                AND (NOT r.is_private OR EXISTS (
+                    SELECT 1 FROM chat_room_members me WHERE me.room_id = r.id AND me.user_id = $2))`
+    if q.RoomID != "" {
+        args = append(args, q.RoomID)
+        where += fmt.Sprintf(` AND m.room_id = $%d`, len(args))
+    }
+    if q.UserID != "" {
+        args = append(args, q.UserID)
+        where += fmt.Sprintf(` AND m.user_id = $%d`, len(args))
+    }
+    if !q.From.IsZero() {
+        args = append(args, q.From)
+        where += fmt.Sprintf(` AND m.created_at >= $%d`, len(args))
+    }
+    if !q.To.IsZero() {
+        args = append(args, q.To)
+        where += fmt.Sprintf(` AND m.created_at <= $%d`, len(args))
+    }
+    args = append(args, q.Limit+1, q.Offset)
+
+    query := fmt.Sprintf(`SELECT %s,
+                     ts_headline('simple', m.content, query, $3),
+                     ts_rank(m.content_tsv, query) AS rank
+              FROM chat_messages m
+              JOIN users u ON m.user_id = u.user_id
+              JOIN chat_rooms r ON r.id = m.room_id,
+                   plainto_tsquery('simple', $1) query
+              WHERE %s
+              ORDER BY rank DESC, m.id DESC
+              LIMIT $%d OFFSET $%d`, messageColumns, where, len(args)-1, len(args))
+
+    rows, err := pool.PgxPool.Query(ctx, query, args...)
+    if err != nil {
+        return nil, fmt.Errorf("failed to search messages: %w", err)
+    }
+    defer rows.Close()
+
+    var results []SearchResult
+    for rows.Next() {
+        var result SearchResult
+        msg, err := scanMessagePostgres(scanFunc(func(dest ...any) error {
+            return rows.Scan(append(dest, &result.Snippet, &result.Rank)...)
+        }))
+        if err != nil {
+            return nil, fmt.Errorf("failed to scan search result: %w", err)
+        }
+        result.Message = *msg
+        results = append(results, result)
+    }
+    if err := rows.Err(); err != nil {
+        return nil, fmt.Errorf("error iterating search results: %w", err)
+    }
+    return results, nil
+}
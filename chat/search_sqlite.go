@@ -0,0 +1,277 @@
+package chat
+
+import (
+    "context"
+    "fmt"
+    "regexp"
+    "strings"
+    "unicode/utf8"
+
+    "gooner/db"
+)
+
+// searchIndexSQLite is the full-text index over the content of messages
+// that are not deleted. An external content table must be told exactly
+// what it indexed, so deleted messages are never passed to the 'delete'
+// command.
+const searchIndexSQLite = `
+CREATE VIRTUAL TABLE IF NOT EXISTS chat_messages_fts USING fts5(
+    content,
+    content = 'chat_messages',
+    content_rowid = 'id',
+    tokenize = 'unicode61 remove_diacritics 2'
+);
+
+CREATE TRIGGER IF NOT EXISTS chat_messages_fts_insert AFTER INSERT ON chat_messages
+WHEN new.deleted_at IS NULL BEGIN
+    INSERT INTO chat_messages_fts (rowid, content) VALUES (new.id, new.content);
+END;
+
+CREATE TRIGGER IF NOT EXISTS chat_messages_fts_delete AFTER DELETE ON chat_messages
+WHEN old.deleted_at IS NULL BEGIN
+    INSERT INTO chat_messages_fts (chat_messages_fts, rowid, content) VALUES ('delete', old.id, old.content);
+END;
+
+-- one trigger for both halves of an update: SQLite does not promise the
+-- order separate triggers on the same event fire in
+CREATE TRIGGER IF NOT EXISTS chat_messages_fts_update AFTER UPDATE OF content, deleted_at ON chat_messages BEGIN
+    INSERT INTO chat_messages_fts (chat_messages_fts, rowid, content)
+    SELECT 'delete', old.id, old.content WHERE old.deleted_at IS NULL;
+    INSERT INTO chat_messages_fts (rowid, content)
+    SELECT new.id, new.content WHERE new.deleted_at IS NULL;
+END;`
+
+// dropSearchTriggersSQLite stops maintaining the index. Without FTS5 the
+// triggers would make every write to chat_messages fail.
+const dropSearchTriggersSQLite = `
+DROP TRIGGER IF EXISTS chat_messages_fts_insert;
+DROP TRIGGER IF EXISTS chat_messages_fts_delete;
+DROP TRIGGER IF EXISTS chat_messages_fts_update;`
+
+// likeSnippetLength is about what snippet() returns for 16 tokens.
+const likeSnippetLength = 120
+
+func ensureSearchIndexSQLite(pool *db.DBPool, ctx context.Context) (bool, error) {
+    writeTx, err := pool.GetWriteTx(ctx)
+    if err != nil {
+        return false, fmt.Errorf("failed to begin transaction: %w", err)
+    }
+    defer writeTx.Rollback()
+
+    var fts5 bool
+    if err := writeTx.QueryRowContext(ctx, `SELECT sqlite_compileoption_used('ENABLE_FTS5')`).Scan(&fts5); err != nil {
+        return false, fmt.Errorf("failed to check for FTS5: %w", err)
+    }
+    if !fts5 {
+        if _, err := writeTx.ExecContext(ctx, dropSearchTriggersSQLite); err != nil {
+            return false, fmt.Errorf("failed to drop search index triggers: %w", err)
+        }
+        return false, writeTx.Commit()
+    }
+
+    indexed, err := searchIndexedSQLite(ctx, writeTx)
+    if err != nil || indexed {
+        return indexed, err
+    }
+
+    // the index is new, or was left behind while a build without FTS5 ran
+    // and missed the writes since
+    if _, err := writeTx.ExecContext(ctx, searchIndexSQLite); err != nil {
+        return false, fmt.Errorf("failed to create search index: %w", err)
+    }
+    _, err = writeTx.ExecContext(ctx, `INSERT INTO chat_messages_fts (chat_messages_fts) VALUES ('delete-all')`)
+    if err != nil {
+        return false, fmt.Errorf("failed to clear search index: %w", err)
+    }
+    _, err = writeTx.ExecContext(ctx, `INSERT INTO chat_messages_fts (rowid, content)
+        SELECT id, content FROM chat_messages WHERE deleted_at IS NULL`)
+    if err != nil {
+        return false, fmt.Errorf("failed to fill search index: %w", err)
+    }
+    return true, writeTx.Commit()
+}
+
+// searchIndexedSQLite reports whether the full-text index is kept up to
+// date, which its triggers only are with FTS5.
+func searchIndexedSQLite(ctx context.Context, tx *db.RequestDB) (bool, error) {
+    var indexed bool
+    err := tx.QueryRowContext(ctx, `SELECT EXISTS (
+        SELECT 1 FROM sqlite_master WHERE type = 'trigger' AND name = 'chat_messages_fts_insert')`).Scan(&indexed)
+    if err != nil {
+        return false, fmt.Errorf("failed to check search index: %w", err)
+    }
+    return indexed, nil
+}
+
+// ftsQuery turns search text into an FTS5 query that matches messages
+// containing every term. Terms are quoted so nothing the user types is
+// taken as query syntax.
+func ftsQuery(text string) string {
+    terms := strings.Fields(text)
+    for i, term := range terms {
+        terms[i] = `"` + strings.ReplaceAll(term, `"`, `""`) + `"`
+    }
+    return strings.Join(terms, " ")
+}
+
+func searchMessagesSQLite(pool *db.DBPool, ctx context.Context, userID string, q SearchQuery) ([]SearchResult, error) {
+    readTx, err := pool.GetReadTx(ctx)
+    if err != nil {
+        return nil, fmt.Errorf("failed to begin read transaction: %w", err)
+    }
+    defer readTx.Rollback()
+
+    indexed, err := searchIndexedSQLite(ctx, readTx)
+    if err != nil {
+        return nil, err
+    }
+    if !indexed {
+        results, err := searchMessagesLikeSQLite(ctx, readTx, userID, q)
+        if err != nil {
+            return nil, err
+        }
+        return results, readTx.Commit()
+    }
+
+    filters, filterArgs := searchFiltersSQLite(userID, q)
+    args := append([]any{markStart, markEnd, ftsQuery(q.Text)}, filterArgs...)
+    args = append(args, q.Limit+1, q.Offset)
+
+    // bm25 is lower for better matches, negate it so rank goes the same
+    // way as on Postgres
+    query := `SELECT ` + messageColumns + `,
+                     snippet(chat_messages_fts, 0, ?, ?, '…', 16),
+                     -bm25(chat_messages_fts) AS rank
+              FROM chat_messages_fts
+              JOIN chat_messages m ON m.id = chat_messages_fts.rowid
+              JOIN users u ON m.user_id = u.user_id
+              JOIN chat_rooms r ON r.id = m.room_id
+              WHERE chat_messages_fts MATCH ?` + filters + `
+              ORDER BY rank DESC, m.id DESC
+              LIMIT ? OFFSET ?`
+
+    rows, err := readTx.QueryContext(ctx, query, args...)
+    if err != nil {
+        return nil, fmt.Errorf("failed to search messages: %w", err)
+    }
+    defer rows.Close()
+
+    var results []SearchResult
+    for rows.Next() {
+        var result SearchResult
+        msg, err := scanMessageSQLite(scanFunc(func(dest ...any) error {
+            return rows.Scan(append(dest, &result.Snippet, &result.Rank)...)
+        }))
+        if err != nil {
+            return nil, fmt.Errorf("failed to scan search result: %w", err)
+        }
+        result.Message = *msg
+        results = append(results, result)
+    }
+    if err := rows.Err(); err != nil {
+        return nil, fmt.Errorf("error iterating search results: %w", err)
+    }
+
+    return results, readTx.Commit()
+}
+
+// searchMessagesLikeSQLite searches without the full-text index, newest
+// first. Every term has to appear in the content, case-insensitively for
+// ASCII only, and every result ranks 0.
+func searchMessagesLikeSQLite(ctx context.Context, readTx *db.RequestDB, userID string, q SearchQuery) ([]SearchResult, error) {
+    terms := strings.Fields(q.Text)
+    filters, args := searchFiltersSQLite(userID, q)
+    var like string
+    var likeArgs []any
+    for _, term := range terms {
+        like += ` AND m.content LIKE ? ESCAPE '\'`
+        likeArgs = append(likeArgs, "%"+likeEscaper.Replace(term)+"%")
+    }
+    args = append(likeArgs, args...)
+    args = append(args, q.Limit+1, q.Offset)
+
+    query := `SELECT ` + messageColumns + `
+              FROM chat_messages m
+              JOIN users u ON m.user_id = u.user_id
+              JOIN chat_rooms r ON r.id = m.room_id
+              WHERE 1 = 1` + like + filters + `
+              ORDER BY m.id DESC
+              LIMIT ? OFFSET ?`
+
+    rows, err := readTx.QueryContext(ctx, query, args...)
+    if err != nil {
+        return nil, fmt.Errorf("failed to search messages: %w", err)
+    }
+    defer rows.Close()
+
+    var results []SearchResult
+    for rows.Next() {
+        msg, err := scanMessageSQLite(rows)
+        if err != nil {
+            return nil, fmt.Errorf("failed to scan search result: %w", err)
+        }
+        results = append(results, SearchResult{Message: *msg, Snippet: likeSnippet(msg.Content, terms)})
+    }
+    if err := rows.Err(); err != nil {
+        return nil, fmt.Errorf("error iterating search results: %w", err)
+    }
+    return results, nil
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// searchFiltersSQLite returns the conditions both kinds of search share,
+// each starting with AND, and their arguments.
+func searchFiltersSQLite(userID string, q SearchQuery) (string, []any) {
+    where := `
+                AND m.deleted_at IS NULL
+                AND (r.is_private = 0 OR EXISTS (
+                    SELECT 1 FROM chat_room_members me WHERE me.room_id = r.id AND me.user_id = ?))`
+    args := []any{userID}
+    if q.RoomID != "" {
+        where += ` AND m.room_id = ?`
+        args = append(args, q.RoomID)
+    }
+    if q.UserID != "" {
+        where += ` AND m.user_id = ?`
+        args = append(args, q.UserID)
+    }
+    // created_at is text with whatever offset it was written with, or none
+    // for CURRENT_TIMESTAMP, so it is compared as a time rather than a string
+    if !q.From.IsZero() {
+        where += ` AND julianday(m.created_at) >= julianday(?)`
+        args = append(args, q.From.UTC())
+    }
+    if !q.To.IsZero() {
+        where += ` AND julianday(m.created_at) <= julianday(?)`
+        args = append(args, q.To.UTC())
+    }
+    return where, args
+}
+
+// likeSnippet marks the terms in content the way snippet() does, cut to
+// about likeSnippetLength runes around the first match.
+func likeSnippet(content string, terms []string) string {
+    patterns := make([]string, len(terms))
+    for i, term := range terms {
+        patterns[i] = regexp.QuoteMeta(term)
+    }
+    match := regexp.MustCompile(`(?i)` + strings.Join(patterns, "|"))
+
+    if runes := []rune(content); len(runes) > likeSnippetLength {
+        start := 0
+        if loc := match.FindStringIndex(content); loc != nil {
+            start = max(0, utf8.RuneCountInString(content[:loc[0]])-likeSnippetLength/4)
+        }
+        end := min(len(runes), start+likeSnippetLength)
+        snippet := string(runes[start:end])
+        if start > 0 {
+            snippet = "…" + snippet
+        }
+        if end < len(runes) {
+            snippet += "…"
+        }
+        content = snippet
+    }
+    return match.ReplaceAllString(content, markStart+"$0"+markEnd)
+}
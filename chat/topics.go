@@ -0,0 +1,21 @@
+package chat
+
+import (
+    "context"
+    "errors"
+
+    "gooner/db"
+    "gooner/websocket"
+)
+
+// AuthorizeRoomTopic lets signed in users subscribe to "chat:<room>" for
+// public rooms and for private rooms they are a member of.
+func AuthorizeRoomTopic(pool *db.DBPool) websocket.TopicAuthorizer {
+    return func(ctx context.Context, userID, roomID string) error {
+        _, err := visibleRoom(pool, ctx, roomID, userID)
+        if errors.Is(err, ErrRoomNotFound) {
+            return websocket.ErrUnknownTopic
+        }
+        return err
+    }
+}
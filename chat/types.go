@@ -2,30 +2,319 @@ package chat
 
 import (
     "time"
+
+    "gooner/db"
 )
 
 type Message struct {
-    ID        int       `json:"id"`
-    UserID    string    `json:"user_id"`
-    Username  string    `json:"username"`
-    Content   string    `json:"content"`
-    RoomID    string    `json:"room_id"`
-    CreatedAt time.Time `json:"created_at"`
+    ID          int          `json:"id"`
+    UserID      string       `json:"user_id"`
+    Username    string       `json:"username"`
+    Content     string       `json:"content"` // empty once deleted
+    RoomID      string       `json:"room_id"`
+    ReplyTo     *int         `json:"reply_to,omitempty"` // the first message of the thread
+    ReplyCount  int          `json:"reply_count,omitempty"`
+    CreatedAt   time.Time    `json:"created_at"`
+    EditedAt    *time.Time   `json:"edited_at,omitempty"`
+    DeletedAt   *time.Time   `json:"deleted_at,omitempty"`
+    Reactions   []Reaction   `json:"reactions,omitempty"`
+    Attachments []Attachment `json:"attachments,omitempty"`
+}
+
+// Reaction is one emoji on a message with the users who reacted with it,
+// in the order they did.
+type Reaction struct {
+    Emoji string   `json:"emoji"`
+    Count int      `json:"count"`
+    Users []string `json:"users"`
+}
+
+// Attachment is a file uploaded with a message. ContentType is sniffed
+// from the file, not taken from the upload. Images have their size and a
+// thumbnail at ThumbnailURL when they could be decoded. Only room members
+// can download attachments, so message history leaves them out for anyone
+// else reading a public room; live "message" events on the room's topic
+// still list them to every subscriber.
+type Attachment struct {
+    ID           string    `json:"id"`
+    Filename     string    `json:"filename"`
+    ContentType  string    `json:"content_type"`
+    Size         int64     `json:"size"`
+    Width        int       `json:"width,omitempty"`
+    Height       int       `json:"height,omitempty"`
+    URL          string    `json:"url"`
+    ThumbnailURL string    `json:"thumbnail_url,omitempty"`
+    CreatedAt    time.Time `json:"created_at"`
+
+    blobKey      string
+    thumbnailKey string
+}
+
+// MessageEdit is a previous version of a message's content, replaced at
+// EditedAt.
+type MessageEdit struct {
+    Content  string    `json:"content"`
+    EditedAt time.Time `json:"edited_at"`
 }
 
 type Room struct {
-    ID          string    `json:"id"`
-    Name        string    `json:"name"`
-    Description string    `json:"description"`
-    CreatedAt   time.Time `json:"created_at"`
+    ID          string     `json:"id"`
+    Name        string     `json:"name"`
+    Description string     `json:"description"`
+    Kind        string     `json:"kind"` // "room" or "dm"
+    Private     bool       `json:"private"`
+    OwnerID     string     `json:"owner_id,omitempty"`
+    Role        string     `json:"role,omitempty"` // the caller's role, empty if not a member
+    ArchivedAt  *time.Time `json:"archived_at,omitempty"`
+    CreatedAt   time.Time  `json:"created_at"`
+}
+
+type Member struct {
+    RoomID   string    `json:"room_id"`
+    UserID   string    `json:"user_id"`
+    Username string    `json:"username"`
+    Role     string    `json:"role"`
+    JoinedAt time.Time `json:"joined_at"`
+}
+
+type CreateRoomRequest struct {
+    ID          string `json:"id,omitempty"` // generated when empty
+    Name        string `json:"name"`
+    Description string `json:"description"`
+    Private     bool   `json:"private"`
+}
+
+// UpdateRoomRequest changes the fields that are set.
+type UpdateRoomRequest struct {
+    Name        *string `json:"name,omitempty"`
+    Description *string `json:"description,omitempty"`
+    Private     *bool   `json:"private,omitempty"`
+}
+
+type MemberRequest struct {
+    UserID string `json:"user_id"`
+    Role   string `json:"role"`
+}
+
+type ListRoomsResponse struct {
+    Rooms []Room `json:"rooms"`
+    Count int    `json:"count"`
+}
+
+type ListMembersResponse struct {
+    Members []Member `json:"members"`
+    Count   int      `json:"count"`
+}
+
+// RoomEvent is published to a room's topic when the room or its members
+// change: "room_updated", "room_archived", "member_added",
+// "member_updated" or "member_removed".
+type RoomEvent struct {
+    Type   string  `json:"type"`
+    Room   *Room   `json:"room,omitempty"`
+    Member *Member `json:"member,omitempty"`
 }
 
 type SendMessageRequest struct {
     Content string `json:"content"`
     RoomID  string `json:"room_id"`
+    ReplyTo int    `json:"reply_to,omitempty"`
+}
+
+type EditMessageRequest struct {
+    Content string `json:"content"`
+}
+
+type MessageHistoryResponse struct {
+    Message *Message      `json:"message"`
+    Edits   []MessageEdit `json:"edits"`
+}
+
+// MessageEvent is what subscribers of a room's topic receive for
+// "chat_message", "message_edited" and "message_deleted".
+type MessageEvent struct {
+    Type    string   `json:"type"`
+    Message *Message `json:"message"`
+}
+
+// ReactionEvent is published to a room's topic as "reaction_added" or
+// "reaction_removed".
+type ReactionEvent struct {
+    Type      string `json:"type"`
+    RoomID    string `json:"room_id"`
+    MessageID int    `json:"message_id"`
+    UserID    string `json:"user_id"`
+    Emoji     string `json:"emoji"`
+}
+
+// MessageQuery selects a page of a room's history by message id. Without
+// cursors it is the latest Limit messages.
+type MessageQuery struct {
+    Before int  // only messages with a smaller id
+    After  int  // only messages with a larger id
+    Thread int  // only replies to this message
+    Oldest bool // the oldest Limit messages of the range, in that order
+    Limit  int
+}
+
+// MessagePage is one page of a room's history. Total counts every message
+// in the room, or in the thread, not just the ones the cursors select.
+type MessagePage struct {
+    Messages []Message
+    Total    int
+    HasMore  bool
 }
 
 type GetMessagesResponse struct {
     Messages []Message `json:"messages"`
     Total    int       `json:"total"`
+    HasMore  bool      `json:"has_more"`
+}
+
+// SyncMessagesResponse carries the messages a reconnecting client missed,
+// oldest first. LatestID is the cursor for the next sync.
+type SyncMessagesResponse struct {
+    Messages []Message `json:"messages"`
+    HasMore  bool      `json:"has_more"`
+    LatestID int       `json:"latest_id"`
+}
+
+// ThreadResponse is the first message of a thread and a page of its
+// replies, oldest first.
+type ThreadResponse struct {
+    Message *Message  `json:"message"`
+    Replies []Message `json:"replies"`
+    HasMore bool      `json:"has_more"`
+}
+
+// Notification tells a user about a message that concerns them. The only
+// type so far is "mention".
+type Notification struct {
+    ID            int        `json:"id"`
+    UserID        string     `json:"user_id"`
+    Type          string     `json:"type"`
+    RoomID        string     `json:"room_id"`
+    MessageID     int        `json:"message_id"`
+    ActorID       string     `json:"actor_id"`
+    ActorUsername string     `json:"actor_username"`
+    Content       string     `json:"content"`
+    CreatedAt     time.Time  `json:"created_at"`
+    ReadAt        *time.Time `json:"read_at,omitempty"`
+}
+
+type ListNotificationsResponse struct {
+    Notifications []Notification `json:"notifications"`
+    Unread        int            `json:"unread"`
+}
+
+// MarkReadRequest marks the notifications with the given ids read, or all
+// of them.
+type MarkReadRequest struct {
+    IDs []int `json:"ids"`
+    All bool  `json:"all"`
+}
+
+type MarkReadResponse struct {
+    Updated int `json:"updated"`
+}
+
+// NotificationEvent is sent to the notified user's connections.
+type NotificationEvent struct {
+    Type         string        `json:"type"`
+    Notification *Notification `json:"notification"`
+}
+
+// Conversation is a direct conversation as one of its participants sees
+// it. Unread counts the others' messages after the last one they read.
+type Conversation struct {
+    ID           string    `json:"id"`
+    Participants []Member  `json:"participants"`
+    LastMessage  *Message  `json:"last_message,omitempty"`
+    Unread       int       `json:"unread"`
+    CreatedAt    time.Time `json:"created_at"`
+}
+
+// CreateConversationRequest names the other participants of a direct
+// conversation.
+type CreateConversationRequest struct {
+    UserIDs []string `json:"user_ids"`
+}
+
+type ListConversationsResponse struct {
+    Conversations []Conversation `json:"conversations"`
+    Count         int            `json:"count"`
+}
+
+// MarkConversationReadRequest marks a conversation read up to MessageID,
+// or up to its latest message if it is 0.
+type MarkConversationReadRequest struct {
+    MessageID int `json:"message_id"`
+}
+
+// SearchQuery filters a full-text search over the messages the searcher
+// can read. Zero fields do not filter.
+type SearchQuery struct {
+    Text   string
+    RoomID string
+    UserID string // the author
+    From   time.Time
+    To     time.Time
+    Limit  int
+    Offset int
+}
+
+// SearchResult is a matching message with a snippet of its content. The
+// snippet is HTML-escaped with the matches in <mark> tags.
+type SearchResult struct {
+    Message Message `json:"message"`
+    Snippet string  `json:"snippet"`
+    Rank    float64 `json:"rank"`
+}
+
+type SearchResponse struct {
+    Results []SearchResult `json:"results"`
+    HasMore bool           `json:"has_more"`
+}
+
+// RetentionOverride is a room's own retention settings. Nil fields use the
+// server default; "0s" or 0 keeps messages forever.
+type RetentionOverride struct {
+    MaxAge   *string `json:"max_age"`
+    MaxCount *int    `json:"max_count"`
+}
+
+// RetentionSettings is the retention the pruner enforces. An empty MaxAge
+// or a zero MaxCount does not limit history.
+type RetentionSettings struct {
+    MaxAge   string `json:"max_age,omitempty"`
+    MaxCount int    `json:"max_count,omitempty"`
+}
+
+// RoomRetention is a room's retention and how much history it holds.
+type RoomRetention struct {
+    RoomID      string            `json:"room_id"`
+    Name        string            `json:"name"`
+    Kind        string            `json:"kind"`
+    Override    RetentionOverride `json:"override"`
+    Effective   RetentionSettings `json:"effective"`
+    Messages    int               `json:"messages"`
+    OldestAt    *time.Time        `json:"oldest_at,omitempty"`
+    PrunedAt    *time.Time        `json:"pruned_at,omitempty"`
+    PrunedTotal int64             `json:"pruned_total"`
+}
+
+type RetentionStatusResponse struct {
+    Default RetentionSettings `json:"default"`
+    Archive bool              `json:"archive"` // whether pruned messages are archived first
+    Rooms   []RoomRetention   `json:"rooms"`
+    LastRun *db.JobRecord     `json:"last_run,omitempty"`
+}
+
+// PruneResult is what a pruning run removed. It is the result of
+// PruneJobType jobs.
+type PruneResult struct {
+    Rooms       int      `json:"rooms"` // rooms messages were pruned from
+    Deleted     int64    `json:"deleted"`
+    Archives    []string `json:"archives,omitempty"`     // files the messages were written to
+    BlobsFailed int      `json:"blobs_failed,omitempty"` // attachment blobs left behind
 }
@@ -0,0 +1,114 @@
+// rpcecho is a fake RPC worker for trying out transports locally. It answers
+// every request by echoing the payload back as the result.
+//
+//	go run ./cmd/rpcecho -mode stdio
+//	go run ./cmd/rpcecho -mode unix -socket /tmp/gooner-c-worker.sock
+//	go run ./cmd/rpcecho -mode http -addr :9001
+package main
+
+import (
+    "bufio"
+    "encoding/json"
+    "flag"
+    "io"
+    "log"
+    "net"
+    "net/http"
+    "os"
+
+    "gooner/rpc"
+)
+
+func echo(req rpc.RPCRequest) rpc.RPCResponse {
+    return rpc.RPCResponse{
+        JobID:   req.JobID,
+        Success: true,
+        Result:  req.Payload,
+        Stage:   "completed",
+    }
+}
+
+func serveFrames(r io.Reader, w io.Writer) error {
+    for {
+        frame, err := rpc.ReadFrame(r)
+        if err != nil {
+            return err
+        }
+
+        var req rpc.RPCRequest
+        if err := json.Unmarshal(frame, &req); err != nil {
+            log.Printf("invalid request: %v", err)
+            continue
+        }
+
+        out, _ := json.Marshal(echo(req))
+        if err := rpc.WriteFrame(w, out); err != nil {
+            return err
+        }
+    }
+}
+
+func main() {
+    mode := flag.String("mode", "stdio", "stdio, unix or http")
+    socket := flag.String("socket", "/tmp/gooner-c-worker.sock", "unix socket path")
+    addr := flag.String("addr", ":9001", "http listen address")
+    flag.Parse()
+
+    // stdout carries frames in stdio mode, so logs go to stderr
+    log.SetOutput(os.Stderr)
+
+    switch *mode {
+    case "stdio":
+        out := bufio.NewWriter(os.Stdout)
+        err := serveFrames(os.Stdin, flushWriter{out})
+        if err != nil && err != io.EOF {
+            log.Fatal(err)
+        }
+
+    case "unix":
+        os.Remove(*socket)
+        listener, err := net.Listen("unix", *socket)
+        if err != nil {
+            log.Fatal(err)
+        }
+        log.Printf("listening on %s", *socket)
+        for {
+            conn, err := listener.Accept()
+            if err != nil {
+                log.Fatal(err)
+            }
+            go func() {
+                defer conn.Close()
+                serveFrames(conn, conn)
+            }()
+        }
+
+    case "http":
+        http.HandleFunc("/rpc", func(w http.ResponseWriter, r *http.Request) {
+            var req rpc.RPCRequest
+            if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+                http.Error(w, err.Error(), http.StatusBadRequest)
+                return
+            }
+            w.Header().Set("Content-Type", "application/json")
+            json.NewEncoder(w).Encode(echo(req))
+        })
+        log.Printf("listening on %s", *addr)
+        log.Fatal(http.ListenAndServe(*addr, nil))
+
+    default:
+        log.Fatalf("unknown mode %q", *mode)
+    }
+}
+
+type flushWriter struct {
+    *bufio.Writer
+}
+
+func (w flushWriter) Write(p []byte) (int, error) {
+    n, err := w.Writer.Write(p)
+    if err != nil {
+        return n, err
+    }
+    return n, w.Flush()
+}
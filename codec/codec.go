@@ -0,0 +1,71 @@
+package codec
+
+import (
+    "encoding/json"
+    "fmt"
+    "sort"
+    "sync"
+)
+
+const (
+    JSON    = "json"
+    MsgPack = "msgpack"
+)
+
+// Codec turns values into bytes for job payloads and results. The name is
+// stored next to the bytes so any worker version can pick the right decoder.
+type Codec interface {
+    Name() string
+    Marshal(v any) ([]byte, error)
+    Unmarshal(data []byte, v any) error
+}
+
+var (
+    registryMu sync.RWMutex
+    registry   = map[string]Codec{
+        JSON:    jsonCodec{},
+        MsgPack: msgpackCodec{},
+    }
+)
+
+func Register(c Codec) {
+    registryMu.Lock()
+    defer registryMu.Unlock()
+    registry[c.Name()] = c
+}
+
+func Get(name string) (Codec, error) {
+    registryMu.RLock()
+    defer registryMu.RUnlock()
+
+    c, ok := registry[name]
+    if !ok {
+        return nil, fmt.Errorf("unknown codec %q (available: %v)", name, namesLocked())
+    }
+    return c, nil
+}
+
+func namesLocked() []string {
+    names := make([]string, 0, len(registry))
+    for name := range registry {
+        names = append(names, name)
+    }
+    sort.Strings(names)
+    return names
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Name() string { return JSON }
+
+func (jsonCodec) Marshal(v any) ([]byte, error) { return json.Marshal(v) }
+
+func (jsonCodec) Unmarshal(data []byte, v any) error { return json.Unmarshal(data, v) }
+
+type msgpackCodec struct{}
+
+func (msgpackCodec) Name() string { return MsgPack }
+
+func (msgpackCodec) Marshal(v any) ([]byte, error) { return MarshalMsgPack(v) }
+
+func (msgpackCodec) Unmarshal(data []byte, v any) error { return UnmarshalMsgPack(data, v) }
@@ -0,0 +1,50 @@
+package codec
+
+import (
+    "bytes"
+    "fmt"
+
+    "github.com/vmihailenco/msgpack/v5"
+)
+
+// MessagePack (https://github.com/msgpack/msgpack/blob/master/spec.md) via
+// vmihailenco/msgpack. Struct fields use the msgpack tag and fall back to
+// the json tag, so existing types need no new tags. time.Time uses the
+// timestamp extension.
+
+func MarshalMsgPack(v any) ([]byte, error) {
+    var buf bytes.Buffer
+    enc := msgpack.NewEncoder(&buf)
+    enc.SetCustomStructTag("json")
+    enc.UseCompactInts(true)
+    enc.SetSortMapKeys(true)
+    if err := enc.Encode(v); err != nil {
+        return nil, err
+    }
+    return buf.Bytes(), nil
+}
+
+// UnmarshalMsgPack decodes into v. Values decoded into interface{} take the
+// shapes encoding/json would give them where it can: map[string]any,
+// []any, int64/uint64 and float64.
+func UnmarshalMsgPack(data []byte, v any) error {
+    // the decoder sizes []any from the array header before reading any
+    // elements, so a corrupt or hostile length would be allocated up front;
+    // walking the data first rejects lengths the input cannot back
+    r := bytes.NewReader(data)
+    dec := msgpack.NewDecoder(r)
+    if err := dec.Skip(); err != nil {
+        return err
+    }
+    r.Reset(data)
+    dec.Reset(r)
+    dec.SetCustomStructTag("json")
+    dec.UseLooseInterfaceDecoding(true)
+    if err := dec.Decode(v); err != nil {
+        return err
+    }
+    if r.Len() != 0 {
+        return fmt.Errorf("msgpack: %d trailing bytes", r.Len())
+    }
+    return nil
+}
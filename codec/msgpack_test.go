@@ -0,0 +1,216 @@
+package codec
+
+import (
+    "math"
+    "reflect"
+    "testing"
+    "time"
+)
+
+type Base struct {
+    ID      int    `json:"id"`
+    Created string `json:"created,omitempty"`
+}
+
+type Meta struct {
+    Source string `json:"source"`
+}
+
+type payload struct {
+    Base
+    *Meta
+
+    Bool    bool              `json:"bool"`
+    Int     int               `json:"int"`
+    Int8    int8              `json:"int8"`
+    Int64   int64             `json:"int64"`
+    Uint16  uint16            `json:"uint16"`
+    Uint64  uint64            `json:"uint64"`
+    Float32 float32           `json:"float32"`
+    Float64 float64           `json:"float64"`
+    String  string            `json:"string"`
+    Bytes   []byte            `json:"bytes"`
+    Array   [3]int            `json:"array"`
+    Slice   []string          `json:"slice"`
+    Map     map[string]int    `json:"map"`
+    IntKeys map[int]string    `json:"int_keys"`
+    Nested  *payload          `json:"nested"`
+    Any     any               `json:"any"`
+    Time    time.Time         `json:"time"`
+    Skipped string            `json:"-"`
+    Renamed string            `msgpack:"renamed" json:"not_this"`
+    Empty   map[string]string `json:"empty,omitempty"`
+    unexported int
+}
+
+func TestMsgPackRoundTrip(t *testing.T) {
+    in := payload{
+        Base:    Base{ID: 7, Created: "today"},
+        Meta:    &Meta{Source: "test"},
+        Bool:    true,
+        Int:     -1 << 40,
+        Int8:    math.MinInt8,
+        Int64:   math.MaxInt64,
+        Uint16:  math.MaxUint16,
+        Uint64:  math.MaxUint64,
+        Float32: 1.5,
+        Float64: math.Pi,
+        String:  "héllo",
+        Bytes:   []byte{0, 1, 2, 255},
+        Array:   [3]int{1, 2, 3},
+        Slice:   []string{"a", "", "c"},
+        Map:     map[string]int{"a": 1, "b": -2},
+        IntKeys: map[int]string{1: "one", -1: "minus one"},
+        Nested:  &payload{String: "inner"},
+        Any:     "anything",
+        Time:    time.Date(2024, 2, 29, 12, 30, 0, 123456789, time.UTC),
+        Renamed: "tagged",
+    }
+
+    data, err := MarshalMsgPack(in)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    var out payload
+    if err := UnmarshalMsgPack(data, &out); err != nil {
+        t.Fatal(err)
+    }
+
+    if !out.Time.Equal(in.Time) {
+        t.Fatalf("time: got %v, want %v", out.Time, in.Time)
+    }
+    out.Time = in.Time
+    out.Nested.Time = in.Nested.Time
+    if !reflect.DeepEqual(out, in) {
+        t.Fatalf("got %+v\nwant %+v", out, in)
+    }
+}
+
+func TestMsgPackFieldNames(t *testing.T) {
+    in := payload{
+        Base:    Base{ID: 1},
+        Meta:    &Meta{Source: "s"},
+        Skipped: "secret",
+        Renamed: "r",
+    }
+
+    data, err := MarshalMsgPack(in)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    var m map[string]any
+    if err := UnmarshalMsgPack(data, &m); err != nil {
+        t.Fatal(err)
+    }
+
+    // embedded structs are flattened, value or pointer
+    for _, key := range []string{"id", "source", "renamed", "nested"} {
+        if _, ok := m[key]; !ok {
+            t.Errorf("missing key %q in %v", key, m)
+        }
+    }
+    // omitempty, "-" and the json tag shadowed by a msgpack tag
+    for _, key := range []string{"created", "empty", "Skipped", "not_this", "Base", "Meta", "unexported"} {
+        if _, ok := m[key]; ok {
+            t.Errorf("unexpected key %q in %v", key, m)
+        }
+    }
+    if m["nested"] != nil {
+        t.Errorf("nil pointer encoded as %v", m["nested"])
+    }
+}
+
+func TestMsgPackNilPointerEmbedded(t *testing.T) {
+    data, err := MarshalMsgPack(payload{String: "no meta"})
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    var out payload
+    if err := UnmarshalMsgPack(data, &out); err != nil {
+        t.Fatal(err)
+    }
+    if out.String != "no meta" {
+        t.Fatalf("got %+v", out)
+    }
+}
+
+func TestMsgPackInterfaceShapes(t *testing.T) {
+    in := map[string]any{
+        "int":    int64(-5),
+        "big":    uint64(math.MaxUint64),
+        "float":  2.5,
+        "list":   []any{int64(1), "two"},
+        "object": map[string]any{"nested": true},
+        "null":   nil,
+    }
+
+    data, err := MarshalMsgPack(in)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    var out any
+    if err := UnmarshalMsgPack(data, &out); err != nil {
+        t.Fatal(err)
+    }
+    if !reflect.DeepEqual(out, any(in)) {
+        t.Fatalf("got %#v\nwant %#v", out, in)
+    }
+}
+
+func TestMsgPackCorruptInput(t *testing.T) {
+    valid, err := MarshalMsgPack(map[string]any{"key": "value", "list": []int{1, 2, 3}})
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    tests := map[string][]byte{
+        "empty":          {},
+        "truncated":      valid[:len(valid)-2],
+        "trailing bytes": append(append([]byte(nil), valid...), 0x01),
+        "invalid code":   {0xc1},
+        "huge string":    {0xdb, 0xff, 0xff, 0xff, 0xff, 'a'},
+        "huge array":     {0xdd, 0xff, 0xff, 0xff, 0xff},
+    }
+    for name, data := range tests {
+        var out any
+        if err := UnmarshalMsgPack(data, &out); err == nil {
+            t.Errorf("%s: expected an error, got %#v", name, out)
+        }
+    }
+
+    var wrongType struct {
+        Key int `json:"key"`
+    }
+    if err := UnmarshalMsgPack(valid, &wrongType); err == nil {
+        t.Error("expected an error decoding a string into an int")
+    }
+}
+
+func TestCodecRegistry(t *testing.T) {
+    for _, name := range []string{JSON, MsgPack} {
+        c, err := Get(name)
+        if err != nil {
+            t.Fatal(err)
+        }
+
+        data, err := c.Marshal(map[string]any{"n": int64(1)})
+        if err != nil {
+            t.Fatal(err)
+        }
+        var out map[string]any
+        if err := c.Unmarshal(data, &out); err != nil {
+            t.Fatal(err)
+        }
+        if len(out) != 1 {
+            t.Fatalf("%s: got %v", name, out)
+        }
+    }
+
+    if _, err := Get("xml"); err == nil {
+        t.Fatal("expected an error for an unknown codec")
+    }
+}
@@ -8,9 +8,10 @@ import (
 
 type Config struct {
     Server struct {
-        Port string `yaml:"port" env:"APP_SERVER_PORT"`
-        Host string `yaml:"host" env:"APP_SERVER_HOST"`
-        Name string `yaml:"name" env:"APP_SERVER_NAME"`
+        Port    string `yaml:"port" env:"APP_SERVER_PORT"`
+        Host    string `yaml:"host" env:"APP_SERVER_HOST"`
+        Name    string `yaml:"name" env:"APP_SERVER_NAME"`
+        BaseURL string `yaml:"base_url" env:"APP_SERVER_BASE_URL"`
     } `yaml:"server"`
 
     Database struct {
@@ -29,6 +30,8 @@ type Config struct {
         Pepper        string `yaml:"pepper" env:"APP_AUTH_PEPPER"`
         TokenExpiry   string `yaml:"token_expiry" env:"APP_AUTH_TOKEN_EXPIRY"`
         RefreshExpiry string `yaml:"refresh_expiry" env:"APP_AUTH_REFRESH_EXPIRY"`
+        // user IDs that may use the admin endpoints, e.g. chat retention
+        AdminUsers []string `yaml:"admin_users"`
     } `yaml:"auth"`
 
     OAuth struct {
@@ -47,6 +50,72 @@ type Config struct {
         Secret  string `yaml:"secret" env:"APP_WEBHOOKS_SECRET"`
         Timeout string `yaml:"timeout" env:"APP_WEBHOOKS_TIMEOUT"`
     } `yaml:"webhooks"`
+
+    Jobs struct {
+        Workers           int    `yaml:"workers" env:"APP_JOBS_WORKERS"`
+        PollInterval      string `yaml:"poll_interval" env:"APP_JOBS_POLL_INTERVAL"`
+        HeartbeatInterval string `yaml:"heartbeat_interval" env:"APP_JOBS_HEARTBEAT_INTERVAL"`
+        ReapInterval      string `yaml:"reap_interval" env:"APP_JOBS_REAP_INTERVAL"`
+        StaleAfter        string `yaml:"stale_after" env:"APP_JOBS_STALE_AFTER"`
+        SchedulerInterval string `yaml:"scheduler_interval" env:"APP_JOBS_SCHEDULER_INTERVAL"`
+        // job types any user may queue through POST /api/jobs; admins may
+        // queue every registered type
+        EnqueueTypes      []string `yaml:"enqueue_types"`
+        Retry             []struct {
+            JobType    string  `yaml:"job_type"`
+            MaxRetries int     `yaml:"max_retries"`
+            BaseDelay  string  `yaml:"base_delay"`
+            MaxDelay   string  `yaml:"max_delay"`
+            Jitter     float64 `yaml:"jitter"`
+        } `yaml:"retry"`
+        // cron expression, @daily style descriptor or "@every <duration>";
+        // empty turns the job off
+        Schedules struct {
+            RefreshTokenCleanup string `yaml:"refresh_token_cleanup" env:"APP_JOBS_SCHEDULES_REFRESH_TOKEN_CLEANUP"`
+            ChatRetention       string `yaml:"chat_retention" env:"APP_JOBS_SCHEDULES_CHAT_RETENTION"`
+            MetricsSnapshot     string `yaml:"metrics_snapshot" env:"APP_JOBS_SCHEDULES_METRICS_SNAPSHOT"`
+        } `yaml:"schedules"`
+    } `yaml:"jobs"`
+
+    WebSocket struct {
+        // origins browsers may open sockets from, e.g. "https://app.example.com";
+        // empty allows only the server's own host, "*" allows any
+        AllowedOrigins []string `yaml:"allowed_origins"`
+        TicketTTL      string   `yaml:"ticket_ttl" env:"APP_WEBSOCKET_TICKET_TTL"`
+        // messages queued per connection, and what happens to a client that
+        // fills its queue: "disconnect", "drop_oldest" or "coalesce"
+        SendBuffer     int    `yaml:"send_buffer" env:"APP_WEBSOCKET_SEND_BUFFER"`
+        SlowConsumer   string `yaml:"slow_consumer" env:"APP_WEBSOCKET_SLOW_CONSUMER"`
+        MaxMessageSize int64  `yaml:"max_message_size" env:"APP_WEBSOCKET_MAX_MESSAGE_SIZE"`
+        WriteWait      string `yaml:"write_wait" env:"APP_WEBSOCKET_WRITE_WAIT"`
+        PongWait       string `yaml:"pong_wait" env:"APP_WEBSOCKET_PONG_WAIT"`
+        PingInterval   string `yaml:"ping_interval" env:"APP_WEBSOCKET_PING_INTERVAL"`
+    } `yaml:"websocket"`
+
+    Chat struct {
+        // default retention of rooms without their own; empty and 0 keep
+        // messages forever
+        Retention         string `yaml:"retention" env:"APP_CHAT_RETENTION"`
+        RetentionMaxCount int    `yaml:"retention_max_count" env:"APP_CHAT_RETENTION_MAX_COUNT"`
+        ArchiveDir        string `yaml:"archive_dir" env:"APP_CHAT_ARCHIVE_DIR"` // empty prunes without archiving
+        Attachments       struct {
+            Store    string `yaml:"store" env:"APP_CHAT_ATTACHMENTS_STORE"` // local
+            Dir      string `yaml:"dir" env:"APP_CHAT_ATTACHMENTS_DIR"`
+            MaxSize  int64  `yaml:"max_size" env:"APP_CHAT_ATTACHMENTS_MAX_SIZE"`   // bytes per file
+            MaxFiles int    `yaml:"max_files" env:"APP_CHAT_ATTACHMENTS_MAX_FILES"` // per message
+        } `yaml:"attachments"`
+    } `yaml:"chat"`
+
+    RPC struct {
+        CallbackSecret string `yaml:"callback_secret" env:"APP_RPC_CALLBACK_SECRET"`
+        Services       []struct {
+            Name      string   `yaml:"name"`
+            Transport string   `yaml:"transport"` // http, stdio, unix
+            URL       string   `yaml:"url"`
+            Command   []string `yaml:"command"`
+            Socket    string   `yaml:"socket"`
+        } `yaml:"services"`
+    } `yaml:"rpc"`
 }
 
 func Load() (*Config, error) {
@@ -75,12 +144,33 @@ func setDefaults(config *Config) {
     config.Server.Port = "8000"
     config.Server.Host = "localhost"
     config.Server.Name = "GOONER"
+    config.Server.BaseURL = "http://localhost:8000"
     config.Database.Type = "sqlite3"
     config.Database.Database = "app.db"
     config.Database.SSLMode = "disable"
     config.Auth.TokenExpiry = "24h"
     config.Auth.RefreshExpiry = "168h"
     config.Webhooks.Timeout = "30s"
+    config.Jobs.Workers = 4
+    config.Jobs.PollInterval = "1s"
+    config.Jobs.HeartbeatInterval = "10s"
+    config.Jobs.ReapInterval = "30s"
+    config.Jobs.StaleAfter = "1m"
+    config.Jobs.SchedulerInterval = "15s"
+    config.WebSocket.TicketTTL = "30s"
+    config.WebSocket.SendBuffer = 256
+    config.WebSocket.SlowConsumer = "disconnect"
+    config.WebSocket.MaxMessageSize = 64 * 1024
+    config.WebSocket.WriteWait = "10s"
+    config.WebSocket.PongWait = "60s"
+    config.WebSocket.PingInterval = "54s"
+    config.Chat.Attachments.Store = "local"
+    config.Chat.Attachments.Dir = "./data/attachments"
+    config.Chat.Attachments.MaxSize = 10 << 20
+    config.Chat.Attachments.MaxFiles = 10
+    config.Jobs.Schedules.RefreshTokenCleanup = "0 3 * * *"
+    config.Jobs.Schedules.ChatRetention = "30 3 * * *"
+    config.Jobs.Schedules.MetricsSnapshot = "@every 15m"
 }
 
 func overrideWithEnv(config *Config) {
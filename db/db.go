@@ -272,6 +272,67 @@ func (rdb *RequestDB) Rollback() error {
     return rdb.Tx.Rollback()
 }
 
+// The SQLite driver stores a time.Time as text in the time's own zone, and
+// text only compares and sorts right when every row uses the same one. The
+// statement methods below store all times in UTC, whatever the caller
+// passed.
+
+func (rdb *RequestDB) Exec(query string, args ...any) (sql.Result, error) {
+    return rdb.Tx.Exec(query, utcArgs(args)...)
+}
+
+func (rdb *RequestDB) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+    return rdb.Tx.ExecContext(ctx, query, utcArgs(args)...)
+}
+
+func (rdb *RequestDB) Query(query string, args ...any) (*sql.Rows, error) {
+    return rdb.Tx.Query(query, utcArgs(args)...)
+}
+
+func (rdb *RequestDB) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+    return rdb.Tx.QueryContext(ctx, query, utcArgs(args)...)
+}
+
+func (rdb *RequestDB) QueryRow(query string, args ...any) *sql.Row {
+    return rdb.Tx.QueryRow(query, utcArgs(args)...)
+}
+
+func (rdb *RequestDB) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+    return rdb.Tx.QueryRowContext(ctx, query, utcArgs(args)...)
+}
+
+func utcArgs(args []any) []any {
+    var out []any
+    for i, arg := range args {
+        var utc any
+        switch v := arg.(type) {
+        case time.Time:
+            utc = v.UTC()
+        case *time.Time:
+            if v == nil {
+                continue
+            }
+            utc = v.UTC()
+        case sql.NullTime:
+            if !v.Valid {
+                continue
+            }
+            utc = sql.NullTime{Time: v.Time.UTC(), Valid: true}
+        default:
+            continue
+        }
+
+        if out == nil {
+            out = append([]any(nil), args...)
+        }
+        out[i] = utc
+    }
+    if out == nil {
+        return args
+    }
+    return out
+}
+
 func InsertUser(pool *DBPool, ctx context.Context, email string, username string, password string) error {
     switch pool.Type {
     case "postgres":
@@ -337,3 +398,16 @@ func RevokeRefreshTokensForUser(pool *DBPool, ctx context.Context, userID string
         return fmt.Errorf("unsupported database type: %s", pool.Type)
     }
 }
+
+// DeleteExpiredRefreshTokens removes refresh tokens past their expiry and
+// returns how many were deleted.
+func DeleteExpiredRefreshTokens(pool *DBPool, ctx context.Context) (int64, error) {
+    switch pool.Type {
+    case "postgres":
+        return DeleteExpiredRefreshTokensPG(pool, ctx)
+    case "sqlite3":
+        return DeleteExpiredRefreshTokensSQLite(pool, ctx)
+    default:
+        return 0, fmt.Errorf("unsupported database type: %s", pool.Type)
+    }
+}
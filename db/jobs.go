@@ -0,0 +1,309 @@
+package db
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "time"
+
+    "gooner/codec"
+)
+
+const (
+    JobStatusPending    = "pending"
+    JobStatusRunning    = "running"
+    JobStatusCompleted  = "completed"
+    JobStatusFailed     = "failed"
+    JobStatusCancelled  = "cancelled"
+    JobStatusDeadLetter = "dead_letter" // failed and out of retries
+)
+
+// ErrJobNotRunning is returned when a job is finished or released
+// but is no longer in the running state (cancelled, reaped, already done).
+var ErrJobNotRunning = errors.New("job is not running")
+
+// ErrJobRetriesExhausted is returned by RetryJob once retry_count reached max_retries.
+var ErrJobRetriesExhausted = errors.New("job retries exhausted")
+
+var ErrJobNotFound = errors.New("job not found")
+
+// ErrJobNotPending is returned by CancelJob for jobs that already started or finished.
+var ErrJobNotPending = errors.New("job is not pending")
+
+type Job struct {
+    ID             int       `json:"id"`
+    Type           string    `json:"type"`
+    Priority       int       `json:"priority"`
+    Payload        []byte    `json:"payload,omitempty"`
+    Status         string    `json:"status"`
+    TimeoutSeconds int       `json:"timeout_seconds"`
+    RetryCount     int       `json:"retry_count"`
+    MaxRetries     int       `json:"max_retries"`
+    Codec          string    `json:"codec"`
+    WorkerID       string    `json:"worker_id,omitempty"`
+    UserID         string    `json:"user_id,omitempty"` // who enqueued it, empty for system jobs
+    CreatedAt      time.Time `json:"created_at"`
+    ScheduledFor   time.Time `json:"scheduled_for"`
+}
+
+// JobRecord is a job as seen from outside the workers: still in job_queue,
+// or archived to job_history with its result. Error holds the error of the
+// latest failed attempt.
+type JobRecord struct {
+    Job
+    Result          []byte     `json:"result,omitempty"`
+    Error           string     `json:"error,omitempty"`
+    Progress        int        `json:"progress"`
+    ProgressMessage string     `json:"progress_message,omitempty"`
+    StartedAt       *time.Time `json:"started_at,omitempty"`
+    CompletedAt     *time.Time `json:"completed_at,omitempty"`
+    ExecutionTimeMs *int       `json:"execution_time_ms,omitempty"`
+}
+
+// JobFilter narrows ListJobs. Empty fields match everything.
+type JobFilter struct {
+    UserID   string // owner; system jobs have none
+    Type     string
+    Status   string
+    WorkerID string
+    Limit    int
+    Offset   int
+}
+
+// IsFinalJobStatus reports whether jobs with this status live in job_history.
+func IsFinalJobStatus(status string) bool {
+    switch status {
+    case JobStatusCompleted, JobStatusFailed, JobStatusCancelled, JobStatusDeadLetter:
+        return true
+    }
+    return false
+}
+
+// JobSpec describes a job to enqueue. Codec names the encoding of Payload
+// (and of the result) and is stored with the job; it defaults to JSON.
+// A zero ScheduledFor makes the job due right away. UserID is the owner
+// that status and progress notifications are sent to.
+type JobSpec struct {
+    Type         string
+    Priority     int
+    Payload      []byte
+    Codec        string
+    MaxRetries   int
+    ScheduledFor time.Time
+    UserID       string
+}
+
+func CreateJob(pool *DBPool, ctx context.Context, spec JobSpec) (int, error) {
+    if spec.Codec == "" {
+        spec.Codec = codec.JSON
+    }
+
+    switch pool.Type {
+    case "postgres":
+        return CreateJobPG(pool, ctx, spec)
+    case "sqlite3":
+        return CreateJobSQLite(pool, ctx, spec)
+    default:
+        return 0, fmt.Errorf("unsupported database type: %s", pool.Type)
+    }
+}
+
+// ClaimNextJob atomically moves the highest priority due job to running
+// and assigns it to workerID. Returns nil, nil when the queue is empty.
+func ClaimNextJob(pool *DBPool, ctx context.Context, workerID string) (*Job, error) {
+    switch pool.Type {
+    case "postgres":
+        return ClaimNextJobPG(pool, ctx, workerID)
+    case "sqlite3":
+        return ClaimNextJobSQLite(pool, ctx, workerID)
+    default:
+        return nil, fmt.Errorf("unsupported database type: %s", pool.Type)
+    }
+}
+
+func CompleteJob(pool *DBPool, ctx context.Context, jobID int, result []byte) error {
+    switch pool.Type {
+    case "postgres":
+        return CompleteJobPG(pool, ctx, jobID, result)
+    case "sqlite3":
+        return CompleteJobSQLite(pool, ctx, jobID, result)
+    default:
+        return fmt.Errorf("unsupported database type: %s", pool.Type)
+    }
+}
+
+func FailJob(pool *DBPool, ctx context.Context, jobID int, errMsg string) error {
+    switch pool.Type {
+    case "postgres":
+        return FailJobPG(pool, ctx, jobID, errMsg)
+    case "sqlite3":
+        return FailJobSQLite(pool, ctx, jobID, errMsg)
+    default:
+        return fmt.Errorf("unsupported database type: %s", pool.Type)
+    }
+}
+
+// UpdateJobProgress records how far a running job got, as a percentage
+// and an optional message. It returns the job's id, type and owner, or
+// ErrJobNotRunning once the job is no longer running.
+func UpdateJobProgress(pool *DBPool, ctx context.Context, jobID, progress int, message string) (*Job, error) {
+    switch pool.Type {
+    case "postgres":
+        return UpdateJobProgressPG(pool, ctx, jobID, progress, message)
+    case "sqlite3":
+        return UpdateJobProgressSQLite(pool, ctx, jobID, progress, message)
+    default:
+        return nil, fmt.Errorf("unsupported database type: %s", pool.Type)
+    }
+}
+
+// ReleaseJob puts a running job back to pending without counting a retry,
+// used when a worker shuts down before the job could finish.
+func ReleaseJob(pool *DBPool, ctx context.Context, jobID int) error {
+    switch pool.Type {
+    case "postgres":
+        return ReleaseJobPG(pool, ctx, jobID)
+    case "sqlite3":
+        return ReleaseJobSQLite(pool, ctx, jobID)
+    default:
+        return fmt.Errorf("unsupported database type: %s", pool.Type)
+    }
+}
+
+// GetJob looks a job up in job_queue and then in job_history.
+func GetJob(pool *DBPool, ctx context.Context, jobID int) (*JobRecord, error) {
+    switch pool.Type {
+    case "postgres":
+        return GetJobPG(pool, ctx, jobID)
+    case "sqlite3":
+        return GetJobSQLite(pool, ctx, jobID)
+    default:
+        return nil, fmt.Errorf("unsupported database type: %s", pool.Type)
+    }
+}
+
+// ListJobs returns queued and archived jobs, newest first, without payloads
+// and results.
+func ListJobs(pool *DBPool, ctx context.Context, filter JobFilter) ([]JobRecord, error) {
+    switch pool.Type {
+    case "postgres":
+        return ListJobsPG(pool, ctx, filter)
+    case "sqlite3":
+        return ListJobsSQLite(pool, ctx, filter)
+    default:
+        return nil, fmt.Errorf("unsupported database type: %s", pool.Type)
+    }
+}
+
+// CancelJob cancels a job that has not been claimed yet. The archive
+// trigger moves it to job_history.
+func CancelJob(pool *DBPool, ctx context.Context, jobID int) error {
+    switch pool.Type {
+    case "postgres":
+        return CancelJobPG(pool, ctx, jobID)
+    case "sqlite3":
+        return CancelJobSQLite(pool, ctx, jobID)
+    default:
+        return fmt.Errorf("unsupported database type: %s", pool.Type)
+    }
+}
+
+// NextRunFunc picks when a job runs again, given its type and how many
+// times it has been retried so far.
+type NextRunFunc func(jobType string, retryCount int) time.Time
+
+// RetryJob puts a running job back to pending, bumps retry_count, keeps
+// errMsg as last_error and delays the job until nextRun. Returns
+// ErrJobRetriesExhausted once retry_count reached max_retries.
+func RetryJob(pool *DBPool, ctx context.Context, jobID int, errMsg string, nextRun NextRunFunc) error {
+    switch pool.Type {
+    case "postgres":
+        return RetryJobPG(pool, ctx, jobID, errMsg, nextRun)
+    case "sqlite3":
+        return RetryJobSQLite(pool, ctx, jobID, errMsg, nextRun)
+    default:
+        return fmt.Errorf("unsupported database type: %s", pool.Type)
+    }
+}
+
+// DeadLetterJob archives a running job that ran out of retries, keeping
+// errMsg in job_history.error.
+func DeadLetterJob(pool *DBPool, ctx context.Context, jobID int, errMsg string) error {
+    switch pool.Type {
+    case "postgres":
+        return DeadLetterJobPG(pool, ctx, jobID, errMsg)
+    case "sqlite3":
+        return DeadLetterJobSQLite(pool, ctx, jobID, errMsg)
+    default:
+        return fmt.Errorf("unsupported database type: %s", pool.Type)
+    }
+}
+
+// StaleJob is a running job whose worker stopped sending heartbeats, or
+// that ran past its timeout.
+type StaleJob struct {
+    Job
+    TimedOut bool
+}
+
+// FindStaleJobs returns running jobs that are past started_at +
+// timeout_seconds + grace, or whose worker is gone or has not sent a
+// heartbeat since heartbeatCutoff.
+func FindStaleJobs(pool *DBPool, ctx context.Context, heartbeatCutoff time.Time, grace time.Duration) ([]StaleJob, error) {
+    switch pool.Type {
+    case "postgres":
+        return FindStaleJobsPG(pool, ctx, heartbeatCutoff, grace)
+    case "sqlite3":
+        return FindStaleJobsSQLite(pool, ctx, heartbeatCutoff, grace)
+    default:
+        return nil, fmt.Errorf("unsupported database type: %s", pool.Type)
+    }
+}
+
+// ReapJob takes a stale job away from workerID. It goes back to pending
+// like RetryJob, or to dead_letter once its retries are used up, and the
+// new status is returned. Returns ErrJobNotRunning if the job finished or
+// changed hands in the meantime.
+func ReapJob(pool *DBPool, ctx context.Context, jobID int, workerID, errMsg string, nextRun NextRunFunc) (string, error) {
+    switch pool.Type {
+    case "postgres":
+        return ReapJobPG(pool, ctx, jobID, workerID, errMsg, nextRun)
+    case "sqlite3":
+        return ReapJobSQLite(pool, ctx, jobID, workerID, errMsg, nextRun)
+    default:
+        return "", fmt.Errorf("unsupported database type: %s", pool.Type)
+    }
+}
+
+func RegisterJobWorker(pool *DBPool, ctx context.Context, workerID, hostname string) error {
+    switch pool.Type {
+    case "postgres":
+        return RegisterJobWorkerPG(pool, ctx, workerID, hostname)
+    case "sqlite3":
+        return RegisterJobWorkerSQLite(pool, ctx, workerID, hostname)
+    default:
+        return fmt.Errorf("unsupported database type: %s", pool.Type)
+    }
+}
+
+func HeartbeatJobWorkers(pool *DBPool, ctx context.Context, workerIDs []string) error {
+    switch pool.Type {
+    case "postgres":
+        return HeartbeatJobWorkersPG(pool, ctx, workerIDs)
+    case "sqlite3":
+        return HeartbeatJobWorkersSQLite(pool, ctx, workerIDs)
+    default:
+        return fmt.Errorf("unsupported database type: %s", pool.Type)
+    }
+}
+
+func RemoveJobWorkers(pool *DBPool, ctx context.Context, workerIDs []string) error {
+    switch pool.Type {
+    case "postgres":
+        return RemoveJobWorkersPG(pool, ctx, workerIDs)
+    case "sqlite3":
+        return RemoveJobWorkersSQLite(pool, ctx, workerIDs)
+    default:
+        return fmt.Errorf("unsupported database type: %s", pool.Type)
+    }
+}
@@ -0,0 +1,407 @@
+package db
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "time"
+
+    "github.com/jackc/pgx/v5"
+)
+
+func CreateJobPG(pool *DBPool, ctx context.Context, spec JobSpec) (int, error) {
+    query := `INSERT INTO job_queue (type, priority, payload, codec, max_retries, scheduled_for, user_id)
+              VALUES ($1, $2, $3, $4, $5, COALESCE($6, NOW()), NULLIF($7, ''))
+              RETURNING id`
+
+    var scheduledFor *time.Time
+    if !spec.ScheduledFor.IsZero() {
+        scheduledFor = &spec.ScheduledFor
+    }
+
+    var jobID int
+    err := pool.PgxPool.QueryRow(ctx, query,
+        spec.Type, spec.Priority, spec.Payload, spec.Codec, spec.MaxRetries, scheduledFor, spec.UserID).Scan(&jobID)
+    if err != nil {
+        return 0, fmt.Errorf("failed to create job: %w", err)
+    }
+
+    return jobID, nil
+}
+
+func GetJobPG(pool *DBPool, ctx context.Context, jobID int) (*JobRecord, error) {
+    var job JobRecord
+
+    queued := `SELECT id, type, priority, payload, codec, status, timeout_seconds, retry_count, max_retries,
+                      COALESCE(last_error, ''), COALESCE(worker_id, ''), COALESCE(user_id, ''),
+                      progress, COALESCE(progress_message, ''), created_at, scheduled_for, started_at
+               FROM job_queue WHERE id = $1`
+
+    err := pool.PgxPool.QueryRow(ctx, queued, jobID).Scan(
+        &job.ID, &job.Type, &job.Priority, &job.Payload, &job.Codec, &job.Status,
+        &job.TimeoutSeconds, &job.RetryCount, &job.MaxRetries, &job.Error, &job.WorkerID,
+        &job.UserID, &job.Progress, &job.ProgressMessage, &job.CreatedAt, &job.ScheduledFor,
+        &job.StartedAt,
+    )
+    if err == nil {
+        return &job, nil
+    }
+    if !errors.Is(err, pgx.ErrNoRows) {
+        return nil, fmt.Errorf("failed to get job: %w", err)
+    }
+
+    archived := `SELECT id, type, COALESCE(priority, 0), payload, codec, result, COALESCE(error, ''), status,
+                        COALESCE(retry_count, 0), COALESCE(worker_id, ''), COALESCE(user_id, ''),
+                        progress, COALESCE(progress_message, ''), created_at, started_at,
+                        completed_at, execution_time_ms
+                 FROM job_history WHERE id = $1`
+
+    err = pool.PgxPool.QueryRow(ctx, archived, jobID).Scan(
+        &job.ID, &job.Type, &job.Priority, &job.Payload, &job.Codec, &job.Result, &job.Error,
+        &job.Status, &job.RetryCount, &job.WorkerID, &job.UserID, &job.Progress,
+        &job.ProgressMessage, &job.CreatedAt, &job.StartedAt, &job.CompletedAt, &job.ExecutionTimeMs,
+    )
+    if err != nil {
+        if errors.Is(err, pgx.ErrNoRows) {
+            return nil, ErrJobNotFound
+        }
+        return nil, fmt.Errorf("failed to get job: %w", err)
+    }
+
+    return &job, nil
+}
+
+func ListJobsPG(pool *DBPool, ctx context.Context, filter JobFilter) ([]JobRecord, error) {
+    // $1..$4 are the filters, empty strings match everything
+    queued := `SELECT id, type, priority, status, codec, retry_count, max_retries,
+                      COALESCE(last_error, '') AS error, COALESCE(worker_id, '') AS worker_id,
+                      COALESCE(user_id, '') AS user_id, progress, created_at, scheduled_for, started_at, NULL::TIMESTAMPTZ AS completed_at,
+                      NULL::INTEGER AS execution_time_ms
+               FROM job_queue
+               WHERE ($1 = '' OR type = $1) AND ($2 = '' OR status = $2) AND ($3 = '' OR worker_id = $3)
+                 AND ($4 = '' OR user_id = $4)`
+
+    archived := `SELECT id, type, COALESCE(priority, 0), status, codec, COALESCE(retry_count, 0), 0,
+                        COALESCE(error, ''), COALESCE(worker_id, ''), COALESCE(user_id, ''), progress,
+                        created_at, NULL::TIMESTAMPTZ, started_at, completed_at, execution_time_ms
+                 FROM job_history
+                 WHERE ($1 = '' OR type = $1) AND ($2 = '' OR status = $2) AND ($3 = '' OR worker_id = $3)
+                 AND ($4 = '' OR user_id = $4)`
+
+    var query string
+    switch {
+    case filter.Status == "":
+        query = queued + " UNION ALL " + archived
+    case IsFinalJobStatus(filter.Status):
+        query = archived
+    default:
+        query = queued
+    }
+    query += " ORDER BY id DESC LIMIT $5 OFFSET $6"
+
+    rows, err := pool.PgxPool.Query(ctx, query,
+        filter.Type, filter.Status, filter.WorkerID, filter.UserID, filter.Limit, filter.Offset)
+    if err != nil {
+        return nil, fmt.Errorf("failed to list jobs: %w", err)
+    }
+    defer rows.Close()
+
+    var jobs []JobRecord
+    for rows.Next() {
+        var job JobRecord
+        var scheduledFor *time.Time
+        err := rows.Scan(
+            &job.ID, &job.Type, &job.Priority, &job.Status, &job.Codec, &job.RetryCount,
+            &job.MaxRetries, &job.Error, &job.WorkerID, &job.UserID, &job.Progress,
+            &job.CreatedAt, &scheduledFor,
+            &job.StartedAt, &job.CompletedAt, &job.ExecutionTimeMs,
+        )
+        if err != nil {
+            return nil, fmt.Errorf("failed to scan job: %w", err)
+        }
+        if scheduledFor != nil {
+            job.ScheduledFor = *scheduledFor
+        }
+        jobs = append(jobs, job)
+    }
+
+    return jobs, rows.Err()
+}
+
+func CancelJobPG(pool *DBPool, ctx context.Context, jobID int) error {
+    tag, err := pool.PgxPool.Exec(ctx,
+        `UPDATE job_queue SET status = 'cancelled' WHERE id = $1 AND status = 'pending'`, jobID)
+    if err != nil {
+        return fmt.Errorf("failed to cancel job: %w", err)
+    }
+    if tag.RowsAffected() == 0 {
+        return ErrJobNotPending
+    }
+
+    return nil
+}
+
+func ClaimNextJobPG(pool *DBPool, ctx context.Context, workerID string) (*Job, error) {
+    query := `SELECT job_id, job_type, job_payload, job_codec, job_timeout, job_retry_count, job_max_retries,
+                     COALESCE(job_user_id, '')
+              FROM claim_next_job($1)`
+
+    job := Job{
+        Status:   JobStatusRunning,
+        WorkerID: workerID,
+    }
+
+    err := pool.PgxPool.QueryRow(ctx, query, workerID).Scan(
+        &job.ID,
+        &job.Type,
+        &job.Payload,
+        &job.Codec,
+        &job.TimeoutSeconds,
+        &job.RetryCount,
+        &job.MaxRetries,
+        &job.UserID,
+    )
+    if err != nil {
+        if errors.Is(err, pgx.ErrNoRows) {
+            return nil, nil
+        }
+        return nil, fmt.Errorf("failed to claim job: %w", err)
+    }
+
+    return &job, nil
+}
+
+func CompleteJobPG(pool *DBPool, ctx context.Context, jobID int, result []byte) error {
+    tx, err := pool.PgxPool.Begin(ctx)
+    if err != nil {
+        return fmt.Errorf("failed to begin transaction: %w", err)
+    }
+    defer tx.Rollback(ctx)
+
+    // the archive trigger moves the row into job_history on this update
+    tag, err := tx.Exec(ctx,
+        `UPDATE job_queue SET status = 'completed' WHERE id = $1 AND status = 'running'`, jobID)
+    if err != nil {
+        return fmt.Errorf("failed to complete job: %w", err)
+    }
+    if tag.RowsAffected() == 0 {
+        return ErrJobNotRunning
+    }
+
+    _, err = tx.Exec(ctx, `UPDATE job_history SET result = $1 WHERE id = $2`, result, jobID)
+    if err != nil {
+        return fmt.Errorf("failed to store job result: %w", err)
+    }
+
+    return tx.Commit(ctx)
+}
+
+func FailJobPG(pool *DBPool, ctx context.Context, jobID int, errMsg string) error {
+    return finishJobPG(pool, ctx, jobID, JobStatusFailed, errMsg)
+}
+
+func DeadLetterJobPG(pool *DBPool, ctx context.Context, jobID int, errMsg string) error {
+    return finishJobPG(pool, ctx, jobID, JobStatusDeadLetter, errMsg)
+}
+
+// finishJobPG moves a running job to a final error state. The archive
+// trigger copies last_error into job_history.error.
+func finishJobPG(pool *DBPool, ctx context.Context, jobID int, status, errMsg string) error {
+    query := `UPDATE job_queue SET status = $2, last_error = $3
+              WHERE id = $1 AND status = 'running'`
+
+    tag, err := pool.PgxPool.Exec(ctx, query, jobID, status, errMsg)
+    if err != nil {
+        return fmt.Errorf("failed to mark job %s: %w", status, err)
+    }
+    if tag.RowsAffected() == 0 {
+        return ErrJobNotRunning
+    }
+
+    return nil
+}
+
+func UpdateJobProgressPG(pool *DBPool, ctx context.Context, jobID, progress int, message string) (*Job, error) {
+    query := `UPDATE job_queue SET progress = $2, progress_message = NULLIF($3, '')
+              WHERE id = $1 AND status = 'running'
+              RETURNING id, type, COALESCE(user_id, '')`
+
+    job := Job{Status: JobStatusRunning}
+    err := pool.PgxPool.QueryRow(ctx, query, jobID, progress, message).Scan(&job.ID, &job.Type, &job.UserID)
+    if err != nil {
+        if errors.Is(err, pgx.ErrNoRows) {
+            return nil, ErrJobNotRunning
+        }
+        return nil, fmt.Errorf("failed to update job progress: %w", err)
+    }
+
+    return &job, nil
+}
+
+func ReleaseJobPG(pool *DBPool, ctx context.Context, jobID int) error {
+    query := `UPDATE job_queue
+              SET status = 'pending', worker_id = NULL, claimed_at = NULL, started_at = NULL
+              WHERE id = $1 AND status = 'running'`
+
+    tag, err := pool.PgxPool.Exec(ctx, query, jobID)
+    if err != nil {
+        return fmt.Errorf("failed to release job: %w", err)
+    }
+    if tag.RowsAffected() == 0 {
+        return ErrJobNotRunning
+    }
+
+    return nil
+}
+
+func RetryJobPG(pool *DBPool, ctx context.Context, jobID int, errMsg string, nextRun NextRunFunc) error {
+    tx, err := pool.PgxPool.Begin(ctx)
+    if err != nil {
+        return fmt.Errorf("failed to begin transaction: %w", err)
+    }
+    defer tx.Rollback(ctx)
+
+    var jobType, status string
+    var retryCount, maxRetries int
+    err = tx.QueryRow(ctx,
+        `SELECT type, status, retry_count, max_retries FROM job_queue WHERE id = $1 FOR UPDATE`, jobID).
+        Scan(&jobType, &status, &retryCount, &maxRetries)
+    if err != nil {
+        if errors.Is(err, pgx.ErrNoRows) {
+            return ErrJobNotRunning
+        }
+        return fmt.Errorf("failed to load job: %w", err)
+    }
+
+    if status != JobStatusRunning {
+        return ErrJobNotRunning
+    }
+    if retryCount >= maxRetries {
+        return ErrJobRetriesExhausted
+    }
+
+    query := `UPDATE job_queue
+              SET status = 'pending', retry_count = retry_count + 1, scheduled_for = $2,
+                  last_error = $3, worker_id = NULL, claimed_at = NULL, started_at = NULL
+              WHERE id = $1`
+
+    _, err = tx.Exec(ctx, query, jobID, nextRun(jobType, retryCount), errMsg)
+    if err != nil {
+        return fmt.Errorf("failed to retry job: %w", err)
+    }
+
+    return tx.Commit(ctx)
+}
+
+func FindStaleJobsPG(pool *DBPool, ctx context.Context, heartbeatCutoff time.Time, grace time.Duration) ([]StaleJob, error) {
+    query := `SELECT q.id, q.type, COALESCE(q.worker_id, ''), COALESCE(q.user_id, ''), q.retry_count,
+                     q.max_retries, q.timeout_seconds,
+                     COALESCE(q.started_at + make_interval(secs => q.timeout_seconds + $2::float8) < NOW(), FALSE)
+              FROM job_queue q
+              LEFT JOIN job_workers w ON w.worker_id = q.worker_id
+              WHERE q.status = 'running'
+                AND (q.started_at + make_interval(secs => q.timeout_seconds + $2::float8) < NOW()
+                     OR w.last_heartbeat IS NULL
+                     OR w.last_heartbeat < $1)`
+
+    rows, err := pool.PgxPool.Query(ctx, query, heartbeatCutoff, grace.Seconds())
+    if err != nil {
+        return nil, fmt.Errorf("failed to find stale jobs: %w", err)
+    }
+    defer rows.Close()
+
+    var jobs []StaleJob
+    for rows.Next() {
+        job := StaleJob{Job: Job{Status: JobStatusRunning}}
+        err := rows.Scan(&job.ID, &job.Type, &job.WorkerID, &job.UserID, &job.RetryCount,
+            &job.MaxRetries, &job.TimeoutSeconds, &job.TimedOut)
+        if err != nil {
+            return nil, fmt.Errorf("failed to scan stale job: %w", err)
+        }
+        jobs = append(jobs, job)
+    }
+
+    return jobs, rows.Err()
+}
+
+func ReapJobPG(pool *DBPool, ctx context.Context, jobID int, workerID, errMsg string, nextRun NextRunFunc) (string, error) {
+    tx, err := pool.PgxPool.Begin(ctx)
+    if err != nil {
+        return "", fmt.Errorf("failed to begin transaction: %w", err)
+    }
+    defer tx.Rollback(ctx)
+
+    var jobType, status, currentWorker string
+    var retryCount, maxRetries int
+    err = tx.QueryRow(ctx,
+        `SELECT type, status, COALESCE(worker_id, ''), retry_count, max_retries
+         FROM job_queue WHERE id = $1 FOR UPDATE`, jobID).
+        Scan(&jobType, &status, &currentWorker, &retryCount, &maxRetries)
+    if err != nil {
+        if errors.Is(err, pgx.ErrNoRows) {
+            return "", ErrJobNotRunning
+        }
+        return "", fmt.Errorf("failed to load job: %w", err)
+    }
+
+    if status != JobStatusRunning || currentWorker != workerID {
+        return "", ErrJobNotRunning
+    }
+
+    if retryCount >= maxRetries {
+        _, err = tx.Exec(ctx,
+            `UPDATE job_queue SET status = 'dead_letter', last_error = $2 WHERE id = $1`, jobID, errMsg)
+        if err != nil {
+            return "", fmt.Errorf("failed to dead-letter job: %w", err)
+        }
+        return JobStatusDeadLetter, tx.Commit(ctx)
+    }
+
+    query := `UPDATE job_queue
+              SET status = 'pending', retry_count = retry_count + 1, scheduled_for = $2,
+                  last_error = $3, worker_id = NULL, claimed_at = NULL, started_at = NULL
+              WHERE id = $1`
+
+    _, err = tx.Exec(ctx, query, jobID, nextRun(jobType, retryCount), errMsg)
+    if err != nil {
+        return "", fmt.Errorf("failed to requeue job: %w", err)
+    }
+
+    return JobStatusPending, tx.Commit(ctx)
+}
+
+func RegisterJobWorkerPG(pool *DBPool, ctx context.Context, workerID, hostname string) error {
+    query := `INSERT INTO job_workers (worker_id, hostname, started_at, last_heartbeat)
+              VALUES ($1, $2, NOW(), NOW())
+              ON CONFLICT (worker_id) DO UPDATE
+              SET hostname = EXCLUDED.hostname, started_at = NOW(), last_heartbeat = NOW()`
+
+    _, err := pool.PgxPool.Exec(ctx, query, workerID, hostname)
+    if err != nil {
+        return fmt.Errorf("failed to register job worker: %w", err)
+    }
+
+    return nil
+}
+
+func HeartbeatJobWorkersPG(pool *DBPool, ctx context.Context, workerIDs []string) error {
+    query := `UPDATE job_workers SET last_heartbeat = NOW() WHERE worker_id = ANY($1)`
+
+    _, err := pool.PgxPool.Exec(ctx, query, workerIDs)
+    if err != nil {
+        return fmt.Errorf("failed to send job worker heartbeat: %w", err)
+    }
+
+    return nil
+}
+
+func RemoveJobWorkersPG(pool *DBPool, ctx context.Context, workerIDs []string) error {
+    query := `DELETE FROM job_workers WHERE worker_id = ANY($1)`
+
+    _, err := pool.PgxPool.Exec(ctx, query, workerIDs)
+    if err != nil {
+        return fmt.Errorf("failed to remove job workers: %w", err)
+    }
+
+    return nil
+}
@@ -0,0 +1,561 @@
+package db
+
+import (
+    "context"
+    "database/sql"
+    "fmt"
+    "time"
+)
+
+// Timestamps are written in UTC so the TEXT values sort chronologically
+// when compared against each other in SQL.
+
+func CreateJobSQLite(pool *DBPool, ctx context.Context, spec JobSpec) (int, error) {
+    writeTx, err := pool.GetWriteTx(ctx)
+    if err != nil {
+        return 0, fmt.Errorf("failed to begin transaction: %w", err)
+    }
+    defer writeTx.Rollback()
+
+    query := `INSERT INTO job_queue (type, priority, payload, codec, max_retries, created_at, scheduled_for, user_id)
+              VALUES (?, ?, ?, ?, ?, ?, ?, NULLIF(?, ''))`
+
+    now := time.Now().UTC()
+    scheduledFor := now
+    if !spec.ScheduledFor.IsZero() {
+        scheduledFor = spec.ScheduledFor.UTC()
+    }
+
+    result, err := writeTx.ExecContext(ctx, query,
+        spec.Type, spec.Priority, spec.Payload, spec.Codec, spec.MaxRetries, now, scheduledFor, spec.UserID)
+    if err != nil {
+        return 0, fmt.Errorf("failed to create job: %w", err)
+    }
+
+    jobID, err := result.LastInsertId()
+    if err != nil {
+        return 0, fmt.Errorf("failed to get job ID: %w", err)
+    }
+
+    if err = writeTx.Commit(); err != nil {
+        return 0, fmt.Errorf("failed to commit transaction: %w", err)
+    }
+
+    return int(jobID), nil
+}
+
+func GetJobSQLite(pool *DBPool, ctx context.Context, jobID int) (*JobRecord, error) {
+    readTx, err := pool.GetReadTx(ctx)
+    if err != nil {
+        return nil, fmt.Errorf("failed to begin transaction: %w", err)
+    }
+    defer readTx.Rollback()
+
+    var job JobRecord
+
+    queued := `SELECT id, type, priority, payload, codec, status, timeout_seconds, retry_count, max_retries,
+                      COALESCE(last_error, ''), COALESCE(worker_id, ''), COALESCE(user_id, ''),
+                      progress, COALESCE(progress_message, ''), created_at, scheduled_for, started_at
+               FROM job_queue WHERE id = ?`
+
+    err = readTx.QueryRowContext(ctx, queued, jobID).Scan(
+        &job.ID, &job.Type, &job.Priority, &job.Payload, &job.Codec, &job.Status,
+        &job.TimeoutSeconds, &job.RetryCount, &job.MaxRetries, &job.Error, &job.WorkerID,
+        &job.UserID, &job.Progress, &job.ProgressMessage, &job.CreatedAt, &job.ScheduledFor,
+        &job.StartedAt,
+    )
+    if err == nil {
+        return &job, nil
+    }
+    if err != sql.ErrNoRows {
+        return nil, fmt.Errorf("failed to get job: %w", err)
+    }
+
+    archived := `SELECT id, type, COALESCE(priority, 0), payload, codec, result, COALESCE(error, ''), status,
+                        COALESCE(retry_count, 0), COALESCE(worker_id, ''), COALESCE(user_id, ''),
+                        progress, COALESCE(progress_message, ''), created_at, started_at,
+                        completed_at, execution_time_ms
+                 FROM job_history WHERE id = ?`
+
+    err = readTx.QueryRowContext(ctx, archived, jobID).Scan(
+        &job.ID, &job.Type, &job.Priority, &job.Payload, &job.Codec, &job.Result, &job.Error,
+        &job.Status, &job.RetryCount, &job.WorkerID, &job.UserID, &job.Progress,
+        &job.ProgressMessage, &job.CreatedAt, &job.StartedAt, &job.CompletedAt, &job.ExecutionTimeMs,
+    )
+    if err != nil {
+        if err == sql.ErrNoRows {
+            return nil, ErrJobNotFound
+        }
+        return nil, fmt.Errorf("failed to get job: %w", err)
+    }
+
+    return &job, nil
+}
+
+// ListJobsSQLite queries both tables separately and merges them, because
+// SQLite loses the TIMESTAMP column types in a UNION.
+func ListJobsSQLite(pool *DBPool, ctx context.Context, filter JobFilter) ([]JobRecord, error) {
+    readTx, err := pool.GetReadTx(ctx)
+    if err != nil {
+        return nil, fmt.Errorf("failed to begin transaction: %w", err)
+    }
+    defer readTx.Rollback()
+
+    where := `WHERE (? = '' OR type = ?) AND (? = '' OR status = ?) AND (? = '' OR worker_id = ?)
+                AND (? = '' OR user_id = ?)
+              ORDER BY id DESC LIMIT ?`
+    args := []any{
+        filter.Type, filter.Type, filter.Status, filter.Status, filter.WorkerID, filter.WorkerID,
+        filter.UserID, filter.UserID,
+        filter.Limit + filter.Offset,
+    }
+
+    var queued, archived []JobRecord
+
+    if filter.Status == "" || !IsFinalJobStatus(filter.Status) {
+        query := `SELECT id, type, priority, status, codec, retry_count, max_retries,
+                         COALESCE(last_error, ''), COALESCE(worker_id, ''), COALESCE(user_id, ''), progress,
+                         created_at, scheduled_for, started_at
+                  FROM job_queue ` + where
+
+        rows, err := readTx.QueryContext(ctx, query, args...)
+        if err != nil {
+            return nil, fmt.Errorf("failed to list jobs: %w", err)
+        }
+        defer rows.Close()
+
+        for rows.Next() {
+            var job JobRecord
+            err := rows.Scan(
+                &job.ID, &job.Type, &job.Priority, &job.Status, &job.Codec, &job.RetryCount,
+                &job.MaxRetries, &job.Error, &job.WorkerID, &job.UserID, &job.Progress,
+                &job.CreatedAt, &job.ScheduledFor, &job.StartedAt,
+            )
+            if err != nil {
+                return nil, fmt.Errorf("failed to scan job: %w", err)
+            }
+            queued = append(queued, job)
+        }
+        if err := rows.Err(); err != nil {
+            return nil, err
+        }
+    }
+
+    if filter.Status == "" || IsFinalJobStatus(filter.Status) {
+        query := `SELECT id, type, COALESCE(priority, 0), status, codec, COALESCE(retry_count, 0),
+                         COALESCE(error, ''), COALESCE(worker_id, ''), COALESCE(user_id, ''), progress,
+                         created_at, started_at, completed_at, execution_time_ms
+                  FROM job_history ` + where
+
+        rows, err := readTx.QueryContext(ctx, query, args...)
+        if err != nil {
+            return nil, fmt.Errorf("failed to list jobs: %w", err)
+        }
+        defer rows.Close()
+
+        for rows.Next() {
+            var job JobRecord
+            err := rows.Scan(
+                &job.ID, &job.Type, &job.Priority, &job.Status, &job.Codec, &job.RetryCount,
+                &job.Error, &job.WorkerID, &job.UserID, &job.Progress, &job.CreatedAt,
+                &job.StartedAt, &job.CompletedAt, &job.ExecutionTimeMs,
+            )
+            if err != nil {
+                return nil, fmt.Errorf("failed to scan job: %w", err)
+            }
+            archived = append(archived, job)
+        }
+        if err := rows.Err(); err != nil {
+            return nil, err
+        }
+    }
+
+    // both lists are sorted by id descending
+    merged := make([]JobRecord, 0, len(queued)+len(archived))
+    for len(queued) > 0 || len(archived) > 0 {
+        if len(archived) == 0 || (len(queued) > 0 && queued[0].ID > archived[0].ID) {
+            merged = append(merged, queued[0])
+            queued = queued[1:]
+        } else {
+            merged = append(merged, archived[0])
+            archived = archived[1:]
+        }
+    }
+
+    if filter.Offset >= len(merged) {
+        return nil, nil
+    }
+    merged = merged[filter.Offset:]
+    if len(merged) > filter.Limit {
+        merged = merged[:filter.Limit]
+    }
+
+    return merged, nil
+}
+
+func CancelJobSQLite(pool *DBPool, ctx context.Context, jobID int) error {
+    writeTx, err := pool.GetWriteTx(ctx)
+    if err != nil {
+        return fmt.Errorf("failed to begin transaction: %w", err)
+    }
+    defer writeTx.Rollback()
+
+    res, err := writeTx.ExecContext(ctx,
+        `UPDATE job_queue SET status = 'cancelled' WHERE id = ? AND status = 'pending'`, jobID)
+    if err != nil {
+        return fmt.Errorf("failed to cancel job: %w", err)
+    }
+    if n, _ := res.RowsAffected(); n == 0 {
+        return ErrJobNotPending
+    }
+
+    return writeTx.Commit()
+}
+
+// ClaimNextJobSQLite relies on the write pool having a single connection
+// with immediate transactions, so select-then-update cannot race.
+func ClaimNextJobSQLite(pool *DBPool, ctx context.Context, workerID string) (*Job, error) {
+    writeTx, err := pool.GetWriteTx(ctx)
+    if err != nil {
+        return nil, fmt.Errorf("failed to begin transaction: %w", err)
+    }
+    defer writeTx.Rollback()
+
+    now := time.Now().UTC()
+
+    query := `SELECT id, type, payload, codec, timeout_seconds, retry_count, max_retries, COALESCE(user_id, '')
+              FROM job_queue
+              WHERE status = 'pending' AND scheduled_for <= ?
+              ORDER BY priority DESC, created_at ASC
+              LIMIT 1`
+
+    job := Job{
+        Status:   JobStatusRunning,
+        WorkerID: workerID,
+    }
+
+    err = writeTx.QueryRowContext(ctx, query, now).Scan(
+        &job.ID,
+        &job.Type,
+        &job.Payload,
+        &job.Codec,
+        &job.TimeoutSeconds,
+        &job.RetryCount,
+        &job.MaxRetries,
+        &job.UserID,
+    )
+    if err != nil {
+        if err == sql.ErrNoRows {
+            return nil, nil
+        }
+        return nil, fmt.Errorf("failed to select job: %w", err)
+    }
+
+    update := `UPDATE job_queue
+               SET status = 'running', claimed_at = ?, started_at = ?, worker_id = ?,
+                   progress = 0, progress_message = NULL
+               WHERE id = ?`
+
+    _, err = writeTx.ExecContext(ctx, update, now, now, workerID, job.ID)
+    if err != nil {
+        return nil, fmt.Errorf("failed to claim job: %w", err)
+    }
+
+    if err = writeTx.Commit(); err != nil {
+        return nil, fmt.Errorf("failed to commit transaction: %w", err)
+    }
+
+    return &job, nil
+}
+
+func CompleteJobSQLite(pool *DBPool, ctx context.Context, jobID int, result []byte) error {
+    writeTx, err := pool.GetWriteTx(ctx)
+    if err != nil {
+        return fmt.Errorf("failed to begin transaction: %w", err)
+    }
+    defer writeTx.Rollback()
+
+    // the archive trigger moves the row into job_history on this update
+    res, err := writeTx.ExecContext(ctx,
+        `UPDATE job_queue SET status = 'completed' WHERE id = ? AND status = 'running'`, jobID)
+    if err != nil {
+        return fmt.Errorf("failed to complete job: %w", err)
+    }
+    if n, _ := res.RowsAffected(); n == 0 {
+        return ErrJobNotRunning
+    }
+
+    _, err = writeTx.ExecContext(ctx, `UPDATE job_history SET result = ? WHERE id = ?`, result, jobID)
+    if err != nil {
+        return fmt.Errorf("failed to store job result: %w", err)
+    }
+
+    return writeTx.Commit()
+}
+
+func FailJobSQLite(pool *DBPool, ctx context.Context, jobID int, errMsg string) error {
+    return finishJobSQLite(pool, ctx, jobID, JobStatusFailed, errMsg)
+}
+
+func DeadLetterJobSQLite(pool *DBPool, ctx context.Context, jobID int, errMsg string) error {
+    return finishJobSQLite(pool, ctx, jobID, JobStatusDeadLetter, errMsg)
+}
+
+// finishJobSQLite moves a running job to a final error state. The archive
+// trigger copies last_error into job_history.error.
+func finishJobSQLite(pool *DBPool, ctx context.Context, jobID int, status, errMsg string) error {
+    writeTx, err := pool.GetWriteTx(ctx)
+    if err != nil {
+        return fmt.Errorf("failed to begin transaction: %w", err)
+    }
+    defer writeTx.Rollback()
+
+    query := `UPDATE job_queue SET status = ?, last_error = ?
+              WHERE id = ? AND status = 'running'`
+
+    res, err := writeTx.ExecContext(ctx, query, status, errMsg, jobID)
+    if err != nil {
+        return fmt.Errorf("failed to mark job %s: %w", status, err)
+    }
+    if n, _ := res.RowsAffected(); n == 0 {
+        return ErrJobNotRunning
+    }
+
+    return writeTx.Commit()
+}
+
+func UpdateJobProgressSQLite(pool *DBPool, ctx context.Context, jobID, progress int, message string) (*Job, error) {
+    writeTx, err := pool.GetWriteTx(ctx)
+    if err != nil {
+        return nil, fmt.Errorf("failed to begin transaction: %w", err)
+    }
+    defer writeTx.Rollback()
+
+    res, err := writeTx.ExecContext(ctx,
+        `UPDATE job_queue SET progress = ?, progress_message = NULLIF(?, '')
+         WHERE id = ? AND status = 'running'`, progress, message, jobID)
+    if err != nil {
+        return nil, fmt.Errorf("failed to update job progress: %w", err)
+    }
+    if n, _ := res.RowsAffected(); n == 0 {
+        return nil, ErrJobNotRunning
+    }
+
+    job := Job{ID: jobID, Status: JobStatusRunning}
+    err = writeTx.QueryRowContext(ctx,
+        `SELECT type, COALESCE(user_id, '') FROM job_queue WHERE id = ?`, jobID).Scan(&job.Type, &job.UserID)
+    if err != nil {
+        return nil, fmt.Errorf("failed to load job: %w", err)
+    }
+
+    return &job, writeTx.Commit()
+}
+
+func ReleaseJobSQLite(pool *DBPool, ctx context.Context, jobID int) error {
+    writeTx, err := pool.GetWriteTx(ctx)
+    if err != nil {
+        return fmt.Errorf("failed to begin transaction: %w", err)
+    }
+    defer writeTx.Rollback()
+
+    query := `UPDATE job_queue
+              SET status = 'pending', worker_id = NULL, claimed_at = NULL, started_at = NULL
+              WHERE id = ? AND status = 'running'`
+
+    res, err := writeTx.ExecContext(ctx, query, jobID)
+    if err != nil {
+        return fmt.Errorf("failed to release job: %w", err)
+    }
+    if n, _ := res.RowsAffected(); n == 0 {
+        return ErrJobNotRunning
+    }
+
+    return writeTx.Commit()
+}
+
+func RetryJobSQLite(pool *DBPool, ctx context.Context, jobID int, errMsg string, nextRun NextRunFunc) error {
+    writeTx, err := pool.GetWriteTx(ctx)
+    if err != nil {
+        return fmt.Errorf("failed to begin transaction: %w", err)
+    }
+    defer writeTx.Rollback()
+
+    var jobType, status string
+    var retryCount, maxRetries int
+    err = writeTx.QueryRowContext(ctx,
+        `SELECT type, status, retry_count, max_retries FROM job_queue WHERE id = ?`, jobID).
+        Scan(&jobType, &status, &retryCount, &maxRetries)
+    if err != nil {
+        if err == sql.ErrNoRows {
+            return ErrJobNotRunning
+        }
+        return fmt.Errorf("failed to load job: %w", err)
+    }
+
+    if status != JobStatusRunning {
+        return ErrJobNotRunning
+    }
+    if retryCount >= maxRetries {
+        return ErrJobRetriesExhausted
+    }
+
+    query := `UPDATE job_queue
+              SET status = 'pending', retry_count = retry_count + 1, scheduled_for = ?,
+                  last_error = ?, worker_id = NULL, claimed_at = NULL, started_at = NULL
+              WHERE id = ?`
+
+    _, err = writeTx.ExecContext(ctx, query, nextRun(jobType, retryCount).UTC(), errMsg, jobID)
+    if err != nil {
+        return fmt.Errorf("failed to retry job: %w", err)
+    }
+
+    return writeTx.Commit()
+}
+
+// FindStaleJobsSQLite filters in Go, since started_at + timeout_seconds
+// cannot be compared reliably against the stored TEXT timestamps.
+func FindStaleJobsSQLite(pool *DBPool, ctx context.Context, heartbeatCutoff time.Time, grace time.Duration) ([]StaleJob, error) {
+    readTx, err := pool.GetReadTx(ctx)
+    if err != nil {
+        return nil, fmt.Errorf("failed to begin transaction: %w", err)
+    }
+    defer readTx.Rollback()
+
+    query := `SELECT q.id, q.type, COALESCE(q.worker_id, ''), COALESCE(q.user_id, ''), q.retry_count,
+                     q.max_retries, q.timeout_seconds, q.started_at, w.last_heartbeat
+              FROM job_queue q
+              LEFT JOIN job_workers w ON w.worker_id = q.worker_id
+              WHERE q.status = 'running'`
+
+    rows, err := readTx.QueryContext(ctx, query)
+    if err != nil {
+        return nil, fmt.Errorf("failed to find stale jobs: %w", err)
+    }
+    defer rows.Close()
+
+    now := time.Now()
+    var jobs []StaleJob
+    for rows.Next() {
+        job := StaleJob{Job: Job{Status: JobStatusRunning}}
+        var startedAt, lastHeartbeat sql.NullTime
+        err := rows.Scan(&job.ID, &job.Type, &job.WorkerID, &job.UserID, &job.RetryCount,
+            &job.MaxRetries, &job.TimeoutSeconds, &startedAt, &lastHeartbeat)
+        if err != nil {
+            return nil, fmt.Errorf("failed to scan stale job: %w", err)
+        }
+
+        deadline := startedAt.Time.Add(time.Duration(job.TimeoutSeconds)*time.Second + grace)
+        job.TimedOut = startedAt.Valid && now.After(deadline)
+        workerGone := !lastHeartbeat.Valid || lastHeartbeat.Time.Before(heartbeatCutoff)
+
+        if job.TimedOut || workerGone {
+            jobs = append(jobs, job)
+        }
+    }
+
+    return jobs, rows.Err()
+}
+
+func ReapJobSQLite(pool *DBPool, ctx context.Context, jobID int, workerID, errMsg string, nextRun NextRunFunc) (string, error) {
+    writeTx, err := pool.GetWriteTx(ctx)
+    if err != nil {
+        return "", fmt.Errorf("failed to begin transaction: %w", err)
+    }
+    defer writeTx.Rollback()
+
+    var jobType, status, currentWorker string
+    var retryCount, maxRetries int
+    err = writeTx.QueryRowContext(ctx,
+        `SELECT type, status, COALESCE(worker_id, ''), retry_count, max_retries
+         FROM job_queue WHERE id = ?`, jobID).
+        Scan(&jobType, &status, &currentWorker, &retryCount, &maxRetries)
+    if err != nil {
+        if err == sql.ErrNoRows {
+            return "", ErrJobNotRunning
+        }
+        return "", fmt.Errorf("failed to load job: %w", err)
+    }
+
+    if status != JobStatusRunning || currentWorker != workerID {
+        return "", ErrJobNotRunning
+    }
+
+    if retryCount >= maxRetries {
+        _, err = writeTx.ExecContext(ctx,
+            `UPDATE job_queue SET status = 'dead_letter', last_error = ? WHERE id = ?`, errMsg, jobID)
+        if err != nil {
+            return "", fmt.Errorf("failed to dead-letter job: %w", err)
+        }
+        return JobStatusDeadLetter, writeTx.Commit()
+    }
+
+    query := `UPDATE job_queue
+              SET status = 'pending', retry_count = retry_count + 1, scheduled_for = ?,
+                  last_error = ?, worker_id = NULL, claimed_at = NULL, started_at = NULL
+              WHERE id = ?`
+
+    _, err = writeTx.ExecContext(ctx, query, nextRun(jobType, retryCount).UTC(), errMsg, jobID)
+    if err != nil {
+        return "", fmt.Errorf("failed to requeue job: %w", err)
+    }
+
+    return JobStatusPending, writeTx.Commit()
+}
+
+func RegisterJobWorkerSQLite(pool *DBPool, ctx context.Context, workerID, hostname string) error {
+    writeTx, err := pool.GetWriteTx(ctx)
+    if err != nil {
+        return fmt.Errorf("failed to begin transaction: %w", err)
+    }
+    defer writeTx.Rollback()
+
+    query := `INSERT INTO job_workers (worker_id, hostname, started_at, last_heartbeat)
+              VALUES (?, ?, ?, ?)
+              ON CONFLICT (worker_id) DO UPDATE
+              SET hostname = excluded.hostname, started_at = excluded.started_at,
+                  last_heartbeat = excluded.last_heartbeat`
+
+    now := time.Now().UTC()
+    _, err = writeTx.ExecContext(ctx, query, workerID, hostname, now, now)
+    if err != nil {
+        return fmt.Errorf("failed to register job worker: %w", err)
+    }
+
+    return writeTx.Commit()
+}
+
+func HeartbeatJobWorkersSQLite(pool *DBPool, ctx context.Context, workerIDs []string) error {
+    writeTx, err := pool.GetWriteTx(ctx)
+    if err != nil {
+        return fmt.Errorf("failed to begin transaction: %w", err)
+    }
+    defer writeTx.Rollback()
+
+    now := time.Now().UTC()
+    for _, workerID := range workerIDs {
+        _, err = writeTx.ExecContext(ctx,
+            `UPDATE job_workers SET last_heartbeat = ? WHERE worker_id = ?`, now, workerID)
+        if err != nil {
+            return fmt.Errorf("failed to send job worker heartbeat: %w", err)
+        }
+    }
+
+    return writeTx.Commit()
+}
+
+func RemoveJobWorkersSQLite(pool *DBPool, ctx context.Context, workerIDs []string) error {
+    writeTx, err := pool.GetWriteTx(ctx)
+    if err != nil {
+        return fmt.Errorf("failed to begin transaction: %w", err)
+    }
+    defer writeTx.Rollback()
+
+    for _, workerID := range workerIDs {
+        _, err = writeTx.ExecContext(ctx, `DELETE FROM job_workers WHERE worker_id = ?`, workerID)
+        if err != nil {
+            return fmt.Errorf("failed to remove job workers: %w", err)
+        }
+    }
+
+    return writeTx.Commit()
+}
@@ -0,0 +1,69 @@
+package db
+
+import (
+    "context"
+    "errors"
+    "fmt"
+
+    "github.com/jackc/pgx/v5"
+)
+
+// MaxNotifyPayload is the largest payload Postgres accepts for NOTIFY,
+// minus one byte for the terminator.
+const MaxNotifyPayload = 7999
+
+var ErrNotifyUnsupported = errors.New("LISTEN/NOTIFY needs a postgres database")
+
+// Notify sends payloads on a Postgres notification channel. They are sent
+// in one transaction, so listeners receive them together and in order.
+func Notify(pool *DBPool, ctx context.Context, channel string, payloads ...string) error {
+    if pool.Type != "postgres" {
+        return ErrNotifyUnsupported
+    }
+
+    tx, err := pool.PgxPool.Begin(ctx)
+    if err != nil {
+        return fmt.Errorf("failed to begin transaction: %w", err)
+    }
+    defer tx.Rollback(ctx)
+
+    for _, payload := range payloads {
+        if _, err := tx.Exec(ctx, `SELECT pg_notify($1, $2)`, channel, payload); err != nil {
+            return fmt.Errorf("failed to notify %s: %w", channel, err)
+        }
+    }
+
+    if err := tx.Commit(ctx); err != nil {
+        return fmt.Errorf("failed to commit transaction: %w", err)
+    }
+    return nil
+}
+
+// Listen holds a pool connection that listens on channel and calls fn for
+// every notification. It returns when ctx is done or the connection fails;
+// notifications sent while nobody listens are lost.
+func Listen(pool *DBPool, ctx context.Context, channel string, fn func(payload string)) error {
+    if pool.Type != "postgres" {
+        return ErrNotifyUnsupported
+    }
+
+    pooled, err := pool.PgxPool.Acquire(ctx)
+    if err != nil {
+        return fmt.Errorf("failed to acquire connection: %w", err)
+    }
+    // the session keeps listening, so it must not go back to the pool
+    conn := pooled.Hijack()
+    defer conn.Close(context.Background())
+
+    if _, err := conn.Exec(ctx, "LISTEN "+pgx.Identifier{channel}.Sanitize()); err != nil {
+        return fmt.Errorf("failed to listen on %s: %w", channel, err)
+    }
+
+    for {
+        notification, err := conn.WaitForNotification(ctx)
+        if err != nil {
+            return fmt.Errorf("failed to wait for notification: %w", err)
+        }
+        fn(notification.Payload)
+    }
+}
@@ -172,3 +172,13 @@ func RevokeRefreshTokensForUserPG(pool *DBPool, ctx context.Context, userID stri
     return tx.Commit(ctx)
 }
 
+
+func DeleteExpiredRefreshTokensPG(pool *DBPool, ctx context.Context) (int64, error) {
+    query := `DELETE FROM refresh_tokens WHERE expires_at <= NOW()`
+    tag, err := pool.PgxPool.Exec(ctx, query)
+    if err != nil {
+        return 0, fmt.Errorf("failed to delete expired refresh tokens: %w", err)
+    }
+
+    return tag.RowsAffected(), nil
+}
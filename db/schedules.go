@@ -0,0 +1,78 @@
+package db
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "time"
+)
+
+// ErrScheduleNotDue is returned by FireJobSchedule when the tick was
+// already taken, usually by another instance.
+var ErrScheduleNotDue = errors.New("job schedule is not due")
+
+type JobSchedule struct {
+    ID        int        `json:"id"`
+    Name      string     `json:"name"`
+    JobType   string     `json:"job_type"`
+    Spec      string     `json:"spec"`
+    Priority  int        `json:"priority"`
+    Payload   []byte     `json:"payload,omitempty"`
+    Codec     string     `json:"codec"`
+    Enabled   bool       `json:"enabled"`
+    NextRunAt time.Time  `json:"next_run_at"`
+    LastRunAt *time.Time `json:"last_run_at,omitempty"`
+    LastJobID *int       `json:"last_job_id,omitempty"`
+}
+
+// UpsertJobSchedule creates or updates a schedule by name. next_run_at is
+// only replaced when the spec changed, so restarts neither skip nor repeat
+// a tick, and enabled is left as it is.
+func UpsertJobSchedule(pool *DBPool, ctx context.Context, schedule JobSchedule) error {
+    switch pool.Type {
+    case "postgres":
+        return UpsertJobSchedulePG(pool, ctx, schedule)
+    case "sqlite3":
+        return UpsertJobScheduleSQLite(pool, ctx, schedule)
+    default:
+        return fmt.Errorf("unsupported database type: %s", pool.Type)
+    }
+}
+
+func DeleteJobSchedule(pool *DBPool, ctx context.Context, name string) error {
+    switch pool.Type {
+    case "postgres":
+        return DeleteJobSchedulePG(pool, ctx, name)
+    case "sqlite3":
+        return DeleteJobScheduleSQLite(pool, ctx, name)
+    default:
+        return fmt.Errorf("unsupported database type: %s", pool.Type)
+    }
+}
+
+// DueJobSchedules returns enabled schedules with next_run_at at or before now.
+func DueJobSchedules(pool *DBPool, ctx context.Context, now time.Time) ([]JobSchedule, error) {
+    switch pool.Type {
+    case "postgres":
+        return DueJobSchedulesPG(pool, ctx, now)
+    case "sqlite3":
+        return DueJobSchedulesSQLite(pool, ctx, now)
+    default:
+        return nil, fmt.Errorf("unsupported database type: %s", pool.Type)
+    }
+}
+
+// FireJobSchedule enqueues the job of a due schedule and moves its
+// next_run_at to nextRunAt in one transaction. The update only applies
+// while next_run_at still equals schedule.NextRunAt, otherwise
+// ErrScheduleNotDue is returned and nothing is enqueued.
+func FireJobSchedule(pool *DBPool, ctx context.Context, schedule JobSchedule, nextRunAt time.Time, maxRetries int) (int, error) {
+    switch pool.Type {
+    case "postgres":
+        return FireJobSchedulePG(pool, ctx, schedule, nextRunAt, maxRetries)
+    case "sqlite3":
+        return FireJobScheduleSQLite(pool, ctx, schedule, nextRunAt, maxRetries)
+    default:
+        return 0, fmt.Errorf("unsupported database type: %s", pool.Type)
+    }
+}
@@ -0,0 +1,99 @@
+package db
+
+import (
+    "context"
+    "fmt"
+    "time"
+)
+
+func UpsertJobSchedulePG(pool *DBPool, ctx context.Context, schedule JobSchedule) error {
+    query := `INSERT INTO job_schedules (name, job_type, spec, priority, payload, codec, next_run_at)
+              VALUES ($1, $2, $3, $4, $5, $6, $7)
+              ON CONFLICT (name) DO UPDATE
+              SET job_type = EXCLUDED.job_type, priority = EXCLUDED.priority,
+                  payload = EXCLUDED.payload, codec = EXCLUDED.codec,
+                  next_run_at = CASE WHEN job_schedules.spec = EXCLUDED.spec
+                                     THEN job_schedules.next_run_at
+                                     ELSE EXCLUDED.next_run_at END,
+                  spec = EXCLUDED.spec`
+
+    _, err := pool.PgxPool.Exec(ctx, query, schedule.Name, schedule.JobType, schedule.Spec,
+        schedule.Priority, schedule.Payload, schedule.Codec, schedule.NextRunAt)
+    if err != nil {
+        return fmt.Errorf("failed to save job schedule: %w", err)
+    }
+
+    return nil
+}
+
+func DeleteJobSchedulePG(pool *DBPool, ctx context.Context, name string) error {
+    _, err := pool.PgxPool.Exec(ctx, `DELETE FROM job_schedules WHERE name = $1`, name)
+    if err != nil {
+        return fmt.Errorf("failed to delete job schedule: %w", err)
+    }
+
+    return nil
+}
+
+func DueJobSchedulesPG(pool *DBPool, ctx context.Context, now time.Time) ([]JobSchedule, error) {
+    query := `SELECT id, name, job_type, spec, COALESCE(priority, 0), payload, codec, enabled,
+                     next_run_at, last_run_at, last_job_id
+              FROM job_schedules
+              WHERE enabled AND next_run_at <= $1
+              ORDER BY next_run_at`
+
+    rows, err := pool.PgxPool.Query(ctx, query, now)
+    if err != nil {
+        return nil, fmt.Errorf("failed to load due job schedules: %w", err)
+    }
+    defer rows.Close()
+
+    var schedules []JobSchedule
+    for rows.Next() {
+        var s JobSchedule
+        err := rows.Scan(&s.ID, &s.Name, &s.JobType, &s.Spec, &s.Priority, &s.Payload, &s.Codec,
+            &s.Enabled, &s.NextRunAt, &s.LastRunAt, &s.LastJobID)
+        if err != nil {
+            return nil, fmt.Errorf("failed to scan job schedule: %w", err)
+        }
+        schedules = append(schedules, s)
+    }
+
+    return schedules, rows.Err()
+}
+
+func FireJobSchedulePG(pool *DBPool, ctx context.Context, schedule JobSchedule, nextRunAt time.Time, maxRetries int) (int, error) {
+    tx, err := pool.PgxPool.Begin(ctx)
+    if err != nil {
+        return 0, fmt.Errorf("failed to begin transaction: %w", err)
+    }
+    defer tx.Rollback(ctx)
+
+    tag, err := tx.Exec(ctx,
+        `UPDATE job_schedules SET next_run_at = $2, last_run_at = NOW()
+         WHERE id = $1 AND next_run_at = $3 AND enabled`,
+        schedule.ID, nextRunAt, schedule.NextRunAt)
+    if err != nil {
+        return 0, fmt.Errorf("failed to advance job schedule: %w", err)
+    }
+    if tag.RowsAffected() == 0 {
+        return 0, ErrScheduleNotDue
+    }
+
+    var jobID int
+    err = tx.QueryRow(ctx,
+        `INSERT INTO job_queue (type, priority, payload, codec, max_retries)
+         VALUES ($1, $2, $3, $4, $5)
+         RETURNING id`,
+        schedule.JobType, schedule.Priority, schedule.Payload, schedule.Codec, maxRetries).Scan(&jobID)
+    if err != nil {
+        return 0, fmt.Errorf("failed to create job: %w", err)
+    }
+
+    _, err = tx.Exec(ctx, `UPDATE job_schedules SET last_job_id = $2 WHERE id = $1`, schedule.ID, jobID)
+    if err != nil {
+        return 0, fmt.Errorf("failed to update job schedule: %w", err)
+    }
+
+    return jobID, tx.Commit(ctx)
+}
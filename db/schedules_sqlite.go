@@ -0,0 +1,122 @@
+package db
+
+import (
+    "context"
+    "fmt"
+    "time"
+)
+
+func UpsertJobScheduleSQLite(pool *DBPool, ctx context.Context, schedule JobSchedule) error {
+    writeTx, err := pool.GetWriteTx(ctx)
+    if err != nil {
+        return fmt.Errorf("failed to begin transaction: %w", err)
+    }
+    defer writeTx.Rollback()
+
+    query := `INSERT INTO job_schedules (name, job_type, spec, priority, payload, codec, next_run_at)
+              VALUES (?, ?, ?, ?, ?, ?, ?)
+              ON CONFLICT (name) DO UPDATE
+              SET job_type = excluded.job_type, priority = excluded.priority,
+                  payload = excluded.payload, codec = excluded.codec,
+                  next_run_at = CASE WHEN job_schedules.spec = excluded.spec
+                                     THEN job_schedules.next_run_at
+                                     ELSE excluded.next_run_at END,
+                  spec = excluded.spec`
+
+    _, err = writeTx.ExecContext(ctx, query, schedule.Name, schedule.JobType, schedule.Spec,
+        schedule.Priority, schedule.Payload, schedule.Codec, schedule.NextRunAt.UTC())
+    if err != nil {
+        return fmt.Errorf("failed to save job schedule: %w", err)
+    }
+
+    return writeTx.Commit()
+}
+
+func DeleteJobScheduleSQLite(pool *DBPool, ctx context.Context, name string) error {
+    writeTx, err := pool.GetWriteTx(ctx)
+    if err != nil {
+        return fmt.Errorf("failed to begin transaction: %w", err)
+    }
+    defer writeTx.Rollback()
+
+    _, err = writeTx.ExecContext(ctx, `DELETE FROM job_schedules WHERE name = ?`, name)
+    if err != nil {
+        return fmt.Errorf("failed to delete job schedule: %w", err)
+    }
+
+    return writeTx.Commit()
+}
+
+func DueJobSchedulesSQLite(pool *DBPool, ctx context.Context, now time.Time) ([]JobSchedule, error) {
+    readTx, err := pool.GetReadTx(ctx)
+    if err != nil {
+        return nil, fmt.Errorf("failed to begin transaction: %w", err)
+    }
+    defer readTx.Rollback()
+
+    query := `SELECT id, name, job_type, spec, COALESCE(priority, 0), payload, codec, enabled,
+                     next_run_at, last_run_at, last_job_id
+              FROM job_schedules
+              WHERE enabled AND next_run_at <= ?
+              ORDER BY next_run_at`
+
+    rows, err := readTx.QueryContext(ctx, query, now.UTC())
+    if err != nil {
+        return nil, fmt.Errorf("failed to load due job schedules: %w", err)
+    }
+    defer rows.Close()
+
+    var schedules []JobSchedule
+    for rows.Next() {
+        var s JobSchedule
+        err := rows.Scan(&s.ID, &s.Name, &s.JobType, &s.Spec, &s.Priority, &s.Payload, &s.Codec,
+            &s.Enabled, &s.NextRunAt, &s.LastRunAt, &s.LastJobID)
+        if err != nil {
+            return nil, fmt.Errorf("failed to scan job schedule: %w", err)
+        }
+        schedules = append(schedules, s)
+    }
+
+    return schedules, rows.Err()
+}
+
+func FireJobScheduleSQLite(pool *DBPool, ctx context.Context, schedule JobSchedule, nextRunAt time.Time, maxRetries int) (int, error) {
+    writeTx, err := pool.GetWriteTx(ctx)
+    if err != nil {
+        return 0, fmt.Errorf("failed to begin transaction: %w", err)
+    }
+    defer writeTx.Rollback()
+
+    now := time.Now().UTC()
+
+    res, err := writeTx.ExecContext(ctx,
+        `UPDATE job_schedules SET next_run_at = ?, last_run_at = ?
+         WHERE id = ? AND next_run_at = ? AND enabled`,
+        nextRunAt.UTC(), now, schedule.ID, schedule.NextRunAt.UTC())
+    if err != nil {
+        return 0, fmt.Errorf("failed to advance job schedule: %w", err)
+    }
+    if n, _ := res.RowsAffected(); n == 0 {
+        return 0, ErrScheduleNotDue
+    }
+
+    result, err := writeTx.ExecContext(ctx,
+        `INSERT INTO job_queue (type, priority, payload, codec, max_retries, created_at, scheduled_for)
+         VALUES (?, ?, ?, ?, ?, ?, ?)`,
+        schedule.JobType, schedule.Priority, schedule.Payload, schedule.Codec, maxRetries, now, now)
+    if err != nil {
+        return 0, fmt.Errorf("failed to create job: %w", err)
+    }
+
+    jobID, err := result.LastInsertId()
+    if err != nil {
+        return 0, fmt.Errorf("failed to get job ID: %w", err)
+    }
+
+    _, err = writeTx.ExecContext(ctx, `UPDATE job_schedules SET last_job_id = ? WHERE id = ?`, jobID, schedule.ID)
+    if err != nil {
+        return 0, fmt.Errorf("failed to update job schedule: %w", err)
+    }
+
+    return int(jobID), writeTx.Commit()
+}
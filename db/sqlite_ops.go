@@ -203,3 +203,20 @@ func RevokeRefreshTokensForUserSQLite(pool *DBPool, ctx context.Context, userID
 
     return writeTx.Commit()
 }
+
+func DeleteExpiredRefreshTokensSQLite(pool *DBPool, ctx context.Context) (int64, error) {
+    writeTx, err := pool.GetWriteTx(ctx)
+    if err != nil {
+        return 0, fmt.Errorf("failed to begin transaction: %w", err)
+    }
+    defer writeTx.Rollback()
+
+    query := `DELETE FROM refresh_tokens WHERE expires_at <= ?`
+    result, err := writeTx.ExecContext(ctx, query, time.Now())
+    if err != nil {
+        return 0, fmt.Errorf("failed to delete expired refresh tokens: %w", err)
+    }
+
+    deleted, _ := result.RowsAffected()
+    return deleted, writeTx.Commit()
+}
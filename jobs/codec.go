@@ -0,0 +1,105 @@
+package jobs
+
+import (
+    "context"
+    "fmt"
+    "sync"
+    "time"
+
+    "gooner/codec"
+    "gooner/db"
+)
+
+// DefaultCodec encodes payloads of job types without their own SetCodec.
+const DefaultCodec = codec.MsgPack
+
+var (
+    codecMu sync.RWMutex
+    codecs  = make(map[string]string)
+)
+
+// SetCodec chooses the codec new jobs of jobType are written with. Jobs
+// already queued keep the codec they were created with.
+func SetCodec(jobType, name string) error {
+    if _, err := codec.Get(name); err != nil {
+        return err
+    }
+
+    codecMu.Lock()
+    defer codecMu.Unlock()
+    codecs[jobType] = name
+    return nil
+}
+
+func CodecFor(jobType string) string {
+    codecMu.RLock()
+    defer codecMu.RUnlock()
+
+    if name, ok := codecs[jobType]; ok {
+        return name
+    }
+    return DefaultCodec
+}
+
+// Enqueue encodes v with the codec of jobType and queues the job with the
+// retry limit of its RetryPolicy. The job belongs to the user in ctx (the
+// "userID" value set by the auth middleware), who then receives its status
+// and progress notifications.
+func Enqueue(pool *db.DBPool, ctx context.Context, jobType string, priority int, v any) (int, error) {
+    return EnqueueAt(pool, ctx, jobType, priority, v, time.Time{})
+}
+
+// EnqueueAt is Enqueue for a job that should not run before runAt.
+func EnqueueAt(pool *db.DBPool, ctx context.Context, jobType string, priority int, v any, runAt time.Time) (int, error) {
+    name := CodecFor(jobType)
+    c, err := codec.Get(name)
+    if err != nil {
+        return 0, err
+    }
+
+    payload, err := c.Marshal(v)
+    if err != nil {
+        return 0, fmt.Errorf("failed to encode %s payload: %w", jobType, err)
+    }
+
+    userID, _ := ctx.Value("userID").(string)
+
+    return db.CreateJob(pool, ctx, db.JobSpec{
+        Type:         jobType,
+        Priority:     priority,
+        Payload:      payload,
+        Codec:        name,
+        MaxRetries:   RetryPolicyFor(jobType).MaxRetries,
+        ScheduledFor: runAt,
+        UserID:       userID,
+    })
+}
+
+// Decode reads the job payload with the codec the job was created with.
+func Decode(job *db.Job, v any) error {
+    c, err := jobCodec(job)
+    if err != nil {
+        return err
+    }
+    if err := c.Unmarshal(job.Payload, v); err != nil {
+        return fmt.Errorf("failed to decode %s payload (%s): %w", job.Type, c.Name(), err)
+    }
+    return nil
+}
+
+// Encode encodes a handler result with the codec of the job, so the
+// result in job_history is read back the same way as the payload.
+func Encode(job *db.Job, v any) ([]byte, error) {
+    c, err := jobCodec(job)
+    if err != nil {
+        return nil, err
+    }
+    return c.Marshal(v)
+}
+
+func jobCodec(job *db.Job) (codec.Codec, error) {
+    if job.Codec == "" {
+        return codec.Get(codec.JSON)
+    }
+    return codec.Get(job.Codec)
+}
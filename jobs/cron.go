@@ -0,0 +1,232 @@
+package jobs
+
+import (
+    "fmt"
+    "strconv"
+    "strings"
+    "time"
+)
+
+// Schedule tells the scheduler when a recurring job runs next.
+type Schedule interface {
+    // Next returns the first run time strictly after after.
+    Next(after time.Time) time.Time
+}
+
+// ParseSchedule parses a schedule spec. It accepts standard five field cron
+// expressions (minute hour day-of-month month day-of-week, evaluated in
+// UTC), the descriptors @yearly, @monthly, @weekly, @daily, @midnight and
+// @hourly, and "@every <duration>" for fixed intervals.
+func ParseSchedule(spec string) (Schedule, error) {
+    spec = strings.TrimSpace(spec)
+
+    if rest, ok := strings.CutPrefix(spec, "@every "); ok {
+        interval, err := time.ParseDuration(strings.TrimSpace(rest))
+        if err != nil {
+            return nil, fmt.Errorf("invalid schedule %q: %w", spec, err)
+        }
+        if interval < time.Second {
+            return nil, fmt.Errorf("invalid schedule %q: interval must be at least 1s", spec)
+        }
+        return everySchedule{interval: interval}, nil
+    }
+
+    if expr, ok := cronDescriptors[spec]; ok {
+        spec = expr
+    }
+
+    fields := strings.Fields(spec)
+    if len(fields) != 5 {
+        return nil, fmt.Errorf("invalid schedule %q: expected 5 fields, got %d", spec, len(fields))
+    }
+
+    var s cronSchedule
+    var err error
+    if s.minute, err = parseCronField(fields[0], cronMinute); err != nil {
+        return nil, fmt.Errorf("invalid schedule %q: %w", spec, err)
+    }
+    if s.hour, err = parseCronField(fields[1], cronHour); err != nil {
+        return nil, fmt.Errorf("invalid schedule %q: %w", spec, err)
+    }
+    if s.dom, err = parseCronField(fields[2], cronDom); err != nil {
+        return nil, fmt.Errorf("invalid schedule %q: %w", spec, err)
+    }
+    if s.month, err = parseCronField(fields[3], cronMonth); err != nil {
+        return nil, fmt.Errorf("invalid schedule %q: %w", spec, err)
+    }
+    if s.dow, err = parseCronField(fields[4], cronDow); err != nil {
+        return nil, fmt.Errorf("invalid schedule %q: %w", spec, err)
+    }
+    // Sunday may be written as 7
+    if s.dow&(1<<7) != 0 {
+        s.dow = s.dow&^(1<<7) | 1
+    }
+    s.domStar = fields[2] == "*" || fields[2] == "?"
+    s.dowStar = fields[4] == "*" || fields[4] == "?"
+
+    if s.Next(time.Now()).IsZero() {
+        return nil, fmt.Errorf("invalid schedule %q: never fires", spec)
+    }
+    return s, nil
+}
+
+var cronDescriptors = map[string]string{
+    "@yearly":   "0 0 1 1 *",
+    "@annually": "0 0 1 1 *",
+    "@monthly":  "0 0 1 * *",
+    "@weekly":   "0 0 * * 0",
+    "@daily":    "0 0 * * *",
+    "@midnight": "0 0 * * *",
+    "@hourly":   "0 * * * *",
+}
+
+// everySchedule fires on multiples of interval, so all instances agree on
+// the tick times regardless of when they started.
+type everySchedule struct {
+    interval time.Duration
+}
+
+func (s everySchedule) Next(after time.Time) time.Time {
+    return after.Truncate(s.interval).Add(s.interval)
+}
+
+type cronBounds struct {
+    name     string
+    min, max int
+    names    map[string]int
+}
+
+var (
+    cronMinute = cronBounds{name: "minute", min: 0, max: 59}
+    cronHour   = cronBounds{name: "hour", min: 0, max: 23}
+    cronDom    = cronBounds{name: "day of month", min: 1, max: 31}
+    cronMonth  = cronBounds{name: "month", min: 1, max: 12, names: map[string]int{
+        "jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+        "jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+    }}
+    cronDow = cronBounds{name: "day of week", min: 0, max: 7, names: map[string]int{
+        "sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+    }}
+)
+
+// parseCronField turns a comma separated list of values, ranges (a-b) and
+// steps (*/n, a-b/n, a/n) into a bit set.
+func parseCronField(field string, b cronBounds) (uint64, error) {
+    var bits uint64
+    for _, part := range strings.Split(field, ",") {
+        rangePart, stepPart, hasStep := strings.Cut(part, "/")
+
+        step := 1
+        if hasStep {
+            n, err := strconv.Atoi(stepPart)
+            if err != nil || n <= 0 {
+                return 0, fmt.Errorf("bad step %q in %s", stepPart, b.name)
+            }
+            step = n
+        }
+
+        var lo, hi int
+        switch {
+        case rangePart == "*" || rangePart == "?":
+            lo, hi = b.min, b.max
+            if b.max == 7 {
+                hi = 6 // * in day of week must not set both 0 and 7
+            }
+        case strings.Contains(rangePart, "-"):
+            from, to, _ := strings.Cut(rangePart, "-")
+            var err error
+            if lo, err = cronValue(from, b); err != nil {
+                return 0, err
+            }
+            if hi, err = cronValue(to, b); err != nil {
+                return 0, err
+            }
+            if lo > hi {
+                return 0, fmt.Errorf("bad range %q in %s", rangePart, b.name)
+            }
+        default:
+            v, err := cronValue(rangePart, b)
+            if err != nil {
+                return 0, err
+            }
+            lo, hi = v, v
+            if hasStep {
+                hi = b.max
+            }
+        }
+
+        for v := lo; v <= hi; v += step {
+            bits |= 1 << uint(v)
+        }
+    }
+    return bits, nil
+}
+
+func cronValue(s string, b cronBounds) (int, error) {
+    if v, ok := b.names[strings.ToLower(s)]; ok {
+        return v, nil
+    }
+    v, err := strconv.Atoi(s)
+    if err != nil || v < b.min || v > b.max {
+        return 0, fmt.Errorf("bad %s %q (want %d-%d)", b.name, s, b.min, b.max)
+    }
+    return v, nil
+}
+
+type cronSchedule struct {
+    minute, hour, dom, month, dow uint64
+    domStar, dowStar              bool
+}
+
+// Next walks forward field by field from the coarsest one, resetting the
+// finer fields whenever a coarser one moves. It gives up after five years,
+// which only happens for dates like February 30th.
+func (s cronSchedule) Next(after time.Time) time.Time {
+    t := after.UTC().Truncate(time.Minute).Add(time.Minute)
+    limit := t.AddDate(5, 0, 0)
+
+WRAP:
+    for t.Before(limit) {
+        for s.month&(1<<uint(t.Month())) == 0 {
+            t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+            if t.Month() == time.January {
+                continue WRAP
+            }
+        }
+
+        for !s.dayMatches(t) {
+            t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, time.UTC)
+            if t.Day() == 1 {
+                continue WRAP
+            }
+        }
+
+        for s.hour&(1<<uint(t.Hour())) == 0 {
+            t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, time.UTC)
+            if t.Hour() == 0 {
+                continue WRAP
+            }
+        }
+
+        for s.minute&(1<<uint(t.Minute())) == 0 {
+            t = t.Add(time.Minute)
+            if t.Minute() == 0 {
+                continue WRAP
+            }
+        }
+
+        return t
+    }
+    return time.Time{}
+}
+
+// dayMatches follows cron: when both day of month and day of week are
+// restricted, a day matching either one counts.
+func (s cronSchedule) dayMatches(t time.Time) bool {
+    domMatch := s.dom&(1<<uint(t.Day())) != 0
+    dowMatch := s.dow&(1<<uint(t.Weekday())) != 0
+    if s.domStar || s.dowStar {
+        return domMatch && dowMatch
+    }
+    return domMatch || dowMatch
+}
@@ -0,0 +1,107 @@
+package jobs
+
+import (
+    "testing"
+    "time"
+)
+
+func TestParseScheduleErrors(t *testing.T) {
+    specs := []string{
+        "",
+        "* * * *",
+        "* * * * * *",
+        "60 * * * *",
+        "* 24 * * *",
+        "* * 0 * *",
+        "* * 32 * *",
+        "* * * 13 *",
+        "* * * * 8",
+        "* * * foo *",
+        "5-1 * * * *",
+        "*/0 * * * *",
+        "*/x * * * *",
+        "1,,2 * * * *",
+        "0 0 30 2 *", // February 30th never comes
+        "@fortnightly",
+        "@every",
+        "@every 10",
+        "@every 500ms",
+    }
+
+    for _, spec := range specs {
+        if _, err := ParseSchedule(spec); err == nil {
+            t.Errorf("ParseSchedule(%q): expected an error", spec)
+        }
+    }
+}
+
+func TestScheduleNext(t *testing.T) {
+    tests := []struct {
+        spec  string
+        after string
+        want  string
+    }{
+        // strictly after, truncated to the minute
+        {"* * * * *", "2024-05-10T12:00:00Z", "2024-05-10T12:01:00Z"},
+        {"* * * * *", "2024-05-10T12:00:30Z", "2024-05-10T12:01:00Z"},
+        {"*/15 * * * *", "2024-05-10T12:14:59Z", "2024-05-10T12:15:00Z"},
+        {"0 3 * * *", "2024-05-10T03:00:00Z", "2024-05-11T03:00:00Z"},
+        {"30 3 * * *", "2024-05-10T02:59:00Z", "2024-05-10T03:30:00Z"},
+
+        // month and year boundaries
+        {"0 0 1 * *", "2024-01-31T23:59:00Z", "2024-02-01T00:00:00Z"},
+        {"0 0 31 * *", "2024-04-01T00:00:00Z", "2024-05-31T00:00:00Z"},
+        {"0 0 29 2 *", "2024-03-01T00:00:00Z", "2028-02-29T00:00:00Z"},
+        {"@yearly", "2024-12-31T23:59:00Z", "2025-01-01T00:00:00Z"},
+        {"59 23 31 12 *", "2024-12-31T23:59:00Z", "2025-12-31T23:59:00Z"},
+        {"0 12 * jan,jul *", "2024-07-31T12:00:00Z", "2025-01-01T12:00:00Z"},
+        {"0 0 * * *", "2024-12-31T10:00:00Z", "2025-01-01T00:00:00Z"},
+
+        // day of week, with names and 7 for Sunday
+        {"0 9 * * mon-fri", "2024-05-10T09:00:00Z", "2024-05-13T09:00:00Z"},
+        {"0 0 * * 7", "2024-05-10T00:00:00Z", "2024-05-12T00:00:00Z"},
+        {"@weekly", "2024-05-12T00:00:00Z", "2024-05-19T00:00:00Z"},
+
+        // both day fields restricted: either one matches
+        {"0 0 13 * 5", "2024-05-01T00:00:00Z", "2024-05-03T00:00:00Z"},
+        {"0 0 13 * 5", "2024-05-10T00:00:00Z", "2024-05-13T00:00:00Z"},
+        {"0 0 13 * 5", "2024-05-13T00:00:00Z", "2024-05-17T00:00:00Z"},
+        // one of them a star: both must match
+        {"0 0 13 * *", "2024-05-01T00:00:00Z", "2024-05-13T00:00:00Z"},
+        {"0 0 * * 5", "2024-05-01T00:00:00Z", "2024-05-03T00:00:00Z"},
+        {"0 0 13 5 ?", "2024-05-13T00:00:00Z", "2025-05-13T00:00:00Z"},
+
+        // fixed intervals are aligned to the epoch, not to after
+        {"@every 1h", "2024-05-10T12:34:56Z", "2024-05-10T13:00:00Z"},
+        {"@every 15m", "2024-05-10T12:45:00Z", "2024-05-10T13:00:00Z"},
+    }
+
+    for _, tt := range tests {
+        schedule, err := ParseSchedule(tt.spec)
+        if err != nil {
+            t.Errorf("ParseSchedule(%q): %v", tt.spec, err)
+            continue
+        }
+
+        after, _ := time.Parse(time.RFC3339, tt.after)
+        want, _ := time.Parse(time.RFC3339, tt.want)
+        if got := schedule.Next(after); !got.Equal(want) {
+            t.Errorf("%q after %s: got %s, want %s", tt.spec, tt.after, got.Format(time.RFC3339), tt.want)
+        }
+    }
+}
+
+func TestScheduleNextIsUTC(t *testing.T) {
+    schedule, err := ParseSchedule("0 3 * * *")
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    // 03:00 UTC is 22:00 the previous day in New York
+    loc := time.FixedZone("EST", -5*60*60)
+    after := time.Date(2024, 1, 10, 21, 0, 0, 0, loc)
+    want := time.Date(2024, 1, 11, 3, 0, 0, 0, time.UTC)
+    if got := schedule.Next(after); !got.Equal(want) {
+        t.Fatalf("got %s, want %s", got, want)
+    }
+}
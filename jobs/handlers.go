@@ -0,0 +1,342 @@
+package jobs
+
+import (
+    "bytes"
+    "encoding/json"
+    "errors"
+    "net/http"
+    "strconv"
+    "sync"
+    "time"
+
+    "gooner/appcontext"
+    "gooner/auth"
+    "gooner/codec"
+    "gooner/db"
+)
+
+type EnqueueRequest struct {
+    Type         string          `json:"type"`
+    Priority     int             `json:"priority"`
+    Payload      json.RawMessage `json:"payload"`
+    ScheduledFor *time.Time      `json:"scheduled_for,omitempty"`
+}
+
+// JobResponse is a job with its payload and result decoded using the
+// job's codec. Data that does not decode is returned as raw bytes.
+type JobResponse struct {
+    *db.JobRecord
+    Payload any `json:"payload,omitempty"`
+    Result  any `json:"result,omitempty"`
+}
+
+type ListJobsResponse struct {
+    Jobs  []db.JobRecord `json:"jobs"`
+    Count int            `json:"count"`
+}
+
+var jobStatuses = map[string]bool{
+    db.JobStatusPending:    true,
+    db.JobStatusRunning:    true,
+    db.JobStatusCompleted:  true,
+    db.JobStatusFailed:     true,
+    db.JobStatusCancelled:  true,
+    db.JobStatusDeadLetter: true,
+}
+
+var (
+    typesMu      sync.RWMutex
+    registered   = make(map[string]bool) // types a worker pool has a handler for
+    enqueueTypes = make(map[string]bool) // types users may queue themselves
+)
+
+func markRegistered(jobType string) {
+    typesMu.Lock()
+    defer typesMu.Unlock()
+    registered[jobType] = true
+}
+
+// AllowEnqueue lets users queue jobType through EnqueueHandler. Other
+// types, such as the scheduler's system jobs and rpc_call (which goes
+// through rpc.CreateRPCJob), are only queued by the code that owns them
+// and by admins.
+func AllowEnqueue(jobType string) {
+    typesMu.Lock()
+    defer typesMu.Unlock()
+    enqueueTypes[jobType] = true
+}
+
+// EnqueueHandler queues a job of a type allowed by AllowEnqueue, or of any
+// registered type for admins. The JSON payload is stored with the codec
+// configured for that type.
+func EnqueueHandler(ctx *appcontext.AppContext) {
+    userID, ok := ctx.Context.Value("userID").(string)
+    if !ok {
+        http.Error(ctx.Writer, "Unauthorized", http.StatusUnauthorized)
+        return
+    }
+
+    var req EnqueueRequest
+    if err := json.NewDecoder(ctx.Request.Body).Decode(&req); err != nil {
+        http.Error(ctx.Writer, "Invalid JSON", http.StatusBadRequest)
+        return
+    }
+
+    if req.Type == "" {
+        http.Error(ctx.Writer, "type is required", http.StatusBadRequest)
+        return
+    }
+
+    typesMu.RLock()
+    known, allowed := registered[req.Type], enqueueTypes[req.Type]
+    typesMu.RUnlock()
+    if !known {
+        http.Error(ctx.Writer, "Unknown job type", http.StatusBadRequest)
+        return
+    }
+    if !allowed && !auth.IsAdmin(userID) {
+        http.Error(ctx.Writer, "Job type cannot be enqueued", http.StatusForbidden)
+        return
+    }
+
+    var payload any
+    if len(req.Payload) > 0 {
+        decoder := json.NewDecoder(bytes.NewReader(req.Payload))
+        decoder.UseNumber()
+        if err := decoder.Decode(&payload); err != nil {
+            http.Error(ctx.Writer, "Invalid payload", http.StatusBadRequest)
+            return
+        }
+        payload = normalizeNumbers(payload)
+    }
+
+    var runAt time.Time
+    if req.ScheduledFor != nil {
+        runAt = *req.ScheduledFor
+    }
+
+    jobID, err := EnqueueAt(ctx.Pool, ctx.Context, req.Type, req.Priority, payload, runAt)
+    if err != nil {
+        ctx.Logger.Printf("Failed to enqueue %s job: %v", req.Type, err)
+        http.Error(ctx.Writer, "Failed to enqueue job", http.StatusInternalServerError)
+        return
+    }
+
+    writeJSON(ctx, http.StatusCreated, map[string]any{"job_id": jobID})
+}
+
+// GetJobHandler shows a job the user enqueued, or any job to admins.
+func GetJobHandler(ctx *appcontext.AppContext) {
+    userID, ok := ctx.Context.Value("userID").(string)
+    if !ok {
+        http.Error(ctx.Writer, "Unauthorized", http.StatusUnauthorized)
+        return
+    }
+
+    jobID, ok := jobIDFromPath(ctx)
+    if !ok {
+        return
+    }
+
+    job, ok := ownJob(ctx, userID, jobID)
+    if !ok {
+        return
+    }
+
+    writeJSON(ctx, http.StatusOK, JobResponse{
+        JobRecord: job,
+        Payload:   decodeForDisplay(job.Codec, job.Payload),
+        Result:    decodeForDisplay(job.Codec, job.Result),
+    })
+}
+
+// ListJobsHandler lists the user's queued and finished jobs, newest first,
+// filtered by the type, status and worker query parameters. Admins see
+// every job, including system jobs, and can filter by user.
+func ListJobsHandler(ctx *appcontext.AppContext) {
+    userID, ok := ctx.Context.Value("userID").(string)
+    if !ok {
+        http.Error(ctx.Writer, "Unauthorized", http.StatusUnauthorized)
+        return
+    }
+
+    query := ctx.Request.URL.Query()
+
+    filter := db.JobFilter{
+        UserID:   userID,
+        Type:     query.Get("type"),
+        Status:   query.Get("status"),
+        WorkerID: query.Get("worker"),
+        Limit:    50,
+    }
+    if auth.IsAdmin(userID) {
+        filter.UserID = query.Get("user")
+    }
+
+    if filter.Status != "" && !jobStatuses[filter.Status] {
+        http.Error(ctx.Writer, "Unknown status", http.StatusBadRequest)
+        return
+    }
+
+    if l, err := strconv.Atoi(query.Get("limit")); err == nil && l > 0 && l <= 100 {
+        filter.Limit = l
+    }
+    if o, err := strconv.Atoi(query.Get("offset")); err == nil && o >= 0 {
+        filter.Offset = o
+    }
+
+    jobs, err := db.ListJobs(ctx.Pool, ctx.Context, filter)
+    if err != nil {
+        ctx.Logger.Printf("Failed to list jobs: %v", err)
+        http.Error(ctx.Writer, "Failed to list jobs", http.StatusInternalServerError)
+        return
+    }
+    if jobs == nil {
+        jobs = []db.JobRecord{}
+    }
+
+    writeJSON(ctx, http.StatusOK, ListJobsResponse{Jobs: jobs, Count: len(jobs)})
+}
+
+// CancelJobHandler cancels a job of the user's that no worker has claimed
+// yet.
+func CancelJobHandler(ctx *appcontext.AppContext) {
+    userID, ok := ctx.Context.Value("userID").(string)
+    if !ok {
+        http.Error(ctx.Writer, "Unauthorized", http.StatusUnauthorized)
+        return
+    }
+
+    jobID, ok := jobIDFromPath(ctx)
+    if !ok {
+        return
+    }
+    if _, ok := ownJob(ctx, userID, jobID); !ok {
+        return
+    }
+
+    err := db.CancelJob(ctx.Pool, ctx.Context, jobID)
+    if errors.Is(err, db.ErrJobNotPending) {
+        http.Error(ctx.Writer, "Only pending jobs can be cancelled", http.StatusConflict)
+        return
+    }
+    if err != nil {
+        ctx.Logger.Printf("Failed to cancel job %d: %v", jobID, err)
+        http.Error(ctx.Writer, "Failed to cancel job", http.StatusInternalServerError)
+        return
+    }
+
+    writeJSON(ctx, http.StatusOK, map[string]any{"job_id": jobID, "status": db.JobStatusCancelled})
+}
+
+// RetryJobHandler enqueues a failed or dead-lettered job of the user's
+// again as a new job.
+func RetryJobHandler(ctx *appcontext.AppContext) {
+    userID, ok := ctx.Context.Value("userID").(string)
+    if !ok {
+        http.Error(ctx.Writer, "Unauthorized", http.StatusUnauthorized)
+        return
+    }
+
+    jobID, ok := jobIDFromPath(ctx)
+    if !ok {
+        return
+    }
+    if _, ok := ownJob(ctx, userID, jobID); !ok {
+        return
+    }
+
+    newID, err := Requeue(ctx.Pool, ctx.Context, jobID)
+    if err != nil {
+        switch {
+        case errors.Is(err, db.ErrJobNotFound):
+            http.Error(ctx.Writer, "Job not found", http.StatusNotFound)
+        case errors.Is(err, ErrNotRequeueable):
+            http.Error(ctx.Writer, "Only failed and dead-lettered jobs can be retried", http.StatusConflict)
+        default:
+            ctx.Logger.Printf("Failed to requeue job %d: %v", jobID, err)
+            http.Error(ctx.Writer, "Failed to retry job", http.StatusInternalServerError)
+        }
+        return
+    }
+
+    writeJSON(ctx, http.StatusCreated, map[string]any{"job_id": newID, "retry_of": jobID})
+}
+
+func jobIDFromPath(ctx *appcontext.AppContext) (int, bool) {
+    jobID, err := strconv.Atoi(ctx.Request.PathValue("id"))
+    if err != nil || jobID <= 0 {
+        http.Error(ctx.Writer, "Invalid job id", http.StatusBadRequest)
+        return 0, false
+    }
+    return jobID, true
+}
+
+// ownJob loads a job the user enqueued. Other users' jobs and system jobs
+// are reported as not found, except to admins.
+func ownJob(ctx *appcontext.AppContext, userID string, jobID int) (*db.JobRecord, bool) {
+    job, err := db.GetJob(ctx.Pool, ctx.Context, jobID)
+    if err == nil && job.UserID != userID && !auth.IsAdmin(userID) {
+        err = db.ErrJobNotFound
+    }
+    if errors.Is(err, db.ErrJobNotFound) {
+        http.Error(ctx.Writer, "Job not found", http.StatusNotFound)
+        return nil, false
+    }
+    if err != nil {
+        ctx.Logger.Printf("Failed to get job %d: %v", jobID, err)
+        http.Error(ctx.Writer, "Failed to get job", http.StatusInternalServerError)
+        return nil, false
+    }
+    return job, true
+}
+
+func writeJSON(ctx *appcontext.AppContext, status int, v any) {
+    ctx.Writer.Header().Set("Content-Type", "application/json")
+    ctx.Writer.WriteHeader(status)
+    if err := json.NewEncoder(ctx.Writer).Encode(v); err != nil {
+        ctx.Logger.Printf("Failed to encode response: %v", err)
+    }
+}
+
+func decodeForDisplay(codecName string, data []byte) any {
+    if len(data) == 0 {
+        return nil
+    }
+
+    c, err := codec.Get(codecName)
+    if err != nil {
+        return data
+    }
+
+    var v any
+    if err := c.Unmarshal(data, &v); err != nil {
+        return data
+    }
+    if _, err := json.Marshal(v); err != nil {
+        return data // e.g. MessagePack maps with non-string keys
+    }
+    return v
+}
+
+// normalizeNumbers turns json.Number into int64 where possible, so
+// integers stay integers in MessagePack payloads.
+func normalizeNumbers(v any) any {
+    switch val := v.(type) {
+    case json.Number:
+        if i, err := val.Int64(); err == nil {
+            return i
+        }
+        f, _ := val.Float64()
+        return f
+    case map[string]any:
+        for k, item := range val {
+            val[k] = normalizeNumbers(item)
+        }
+    case []any:
+        for i, item := range val {
+            val[i] = normalizeNumbers(item)
+        }
+    }
+    return v
+}
@@ -0,0 +1,40 @@
+package jobs
+
+import (
+    "context"
+
+    "gooner/db"
+)
+
+type progressKey struct{}
+
+// progressReporter is put into the context of every handler call by the
+// worker that runs the job.
+type progressReporter struct {
+    wp  *WorkerPool
+    job *db.Job
+}
+
+// ReportProgress records how far the job being handled got (0-100, with an
+// optional message) and streams it to the job's owner over the WebSocket
+// hub. Outside a worker, e.g. when a handler is called directly, it does
+// nothing. Reporting too often only costs database writes, so handlers of
+// large batches should report every few percent rather than every item.
+func ReportProgress(ctx context.Context, percent int, message string) error {
+    reporter, ok := ctx.Value(progressKey{}).(*progressReporter)
+    if !ok {
+        return nil
+    }
+
+    percent = max(0, min(percent, 100))
+
+    job, err := db.UpdateJobProgress(reporter.wp.Pool, ctx, reporter.job.ID, percent, message)
+    if err != nil {
+        return err
+    }
+
+    if reporter.wp.Hub != nil {
+        reporter.wp.Hub.SendJobProgress(job.UserID, job.ID, job.Type, percent, message)
+    }
+    return nil
+}
@@ -0,0 +1,117 @@
+package jobs
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "log"
+    "time"
+
+    "gooner/db"
+    "gooner/websocket"
+)
+
+const (
+    defaultReapInterval = 30 * time.Second
+    defaultStaleAfter   = time.Minute
+)
+
+// Reaper reclaims jobs that are stuck in running because their worker
+// died (no heartbeat for StaleAfter) or never finished them within their
+// timeout. They are requeued with the retry policy of their type, or
+// dead-lettered once out of retries. Every instance can run a reaper;
+// a job is only reaped while it is still held by the same worker.
+type Reaper struct {
+    Pool       *db.DBPool
+    Hub        *websocket.Hub
+    Logger     *log.Logger
+    Interval   time.Duration
+    StaleAfter time.Duration
+
+    stop context.CancelFunc
+    done chan struct{}
+}
+
+func NewReaper(pool *db.DBPool, hub *websocket.Hub, logger *log.Logger) *Reaper {
+    return &Reaper{
+        Pool:       pool,
+        Hub:        hub,
+        Logger:     logger,
+        Interval:   defaultReapInterval,
+        StaleAfter: defaultStaleAfter,
+    }
+}
+
+func (r *Reaper) Start() {
+    if r.Interval <= 0 {
+        r.Interval = defaultReapInterval
+    }
+    if r.StaleAfter <= 0 {
+        r.StaleAfter = defaultStaleAfter
+    }
+
+    ctx, stop := context.WithCancel(context.Background())
+    r.stop = stop
+    r.done = make(chan struct{})
+
+    go func() {
+        defer close(r.done)
+
+        ticker := time.NewTicker(r.Interval)
+        defer ticker.Stop()
+
+        for {
+            select {
+            case <-ctx.Done():
+                return
+            case <-ticker.C:
+                if _, err := r.ReapOnce(ctx); err != nil && ctx.Err() == nil {
+                    r.Logger.Printf("Job reaper failed: %v", err)
+                }
+            }
+        }
+    }()
+}
+
+func (r *Reaper) Stop() {
+    if r.stop == nil {
+        return
+    }
+    r.stop()
+    <-r.done
+}
+
+// ReapOnce runs a single pass and returns how many jobs were reclaimed.
+func (r *Reaper) ReapOnce(ctx context.Context) (int, error) {
+    // a live worker enforces the timeout itself and then needs up to
+    // finalizeTimeout to record the outcome, so give it that long first
+    stale, err := db.FindStaleJobs(r.Pool, ctx, time.Now().Add(-r.StaleAfter), finalizeTimeout)
+    if err != nil {
+        return 0, err
+    }
+
+    reaped := 0
+    for _, job := range stale {
+        reason := fmt.Sprintf("worker %s stopped sending heartbeats", job.WorkerID)
+        if job.TimedOut {
+            reason = fmt.Sprintf("job exceeded its %ds timeout on worker %s", job.TimeoutSeconds, job.WorkerID)
+        }
+
+        status, err := db.ReapJob(r.Pool, ctx, job.ID, job.WorkerID, reason, nextRetryAt)
+        if errors.Is(err, db.ErrJobNotRunning) {
+            continue // finished or moved on since the scan
+        }
+        if err != nil {
+            r.Logger.Printf("Failed to reap job %d: %v", job.ID, err)
+            continue
+        }
+
+        reaped++
+        r.Logger.Printf("Reaped job %d (%s): %s, now %s", job.ID, job.Type, reason, status)
+        if r.Hub != nil {
+            r.Hub.SendJobStatus(job.UserID, job.ID, job.Type, status)
+        }
+    }
+
+    return reaped, nil
+}
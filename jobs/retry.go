@@ -0,0 +1,127 @@
+package jobs
+
+import (
+    "context"
+    "errors"
+    "math/rand"
+    "sync"
+    "time"
+
+    "gooner/db"
+)
+
+// RetryPolicy decides how often and how far apart a failed job is retried.
+// The delay before retry n (0-based) is BaseDelay * 2^n capped at MaxDelay,
+// with up to Jitter (0..1) of it taken off at random so jobs that failed
+// together do not all come back at once.
+type RetryPolicy struct {
+    MaxRetries int
+    BaseDelay  time.Duration
+    MaxDelay   time.Duration
+    Jitter     float64
+}
+
+var DefaultRetryPolicy = RetryPolicy{
+    MaxRetries: 3,
+    BaseDelay:  5 * time.Second,
+    MaxDelay:   10 * time.Minute,
+    Jitter:     0.2,
+}
+
+var (
+    policyMu sync.RWMutex
+    policies = make(map[string]RetryPolicy)
+)
+
+// SetRetryPolicy sets the policy for jobType. MaxRetries is stored on
+// each job when it is enqueued, so a change only affects new jobs.
+func SetRetryPolicy(jobType string, policy RetryPolicy) {
+    policyMu.Lock()
+    defer policyMu.Unlock()
+    policies[jobType] = policy
+}
+
+func RetryPolicyFor(jobType string) RetryPolicy {
+    policyMu.RLock()
+    defer policyMu.RUnlock()
+
+    if policy, ok := policies[jobType]; ok {
+        return policy
+    }
+    return DefaultRetryPolicy
+}
+
+func (p RetryPolicy) Backoff(retryCount int) time.Duration {
+    delay := p.BaseDelay
+    if delay <= 0 {
+        delay = DefaultRetryPolicy.BaseDelay
+    }
+    maxDelay := p.MaxDelay
+    if maxDelay <= 0 {
+        maxDelay = DefaultRetryPolicy.MaxDelay
+    }
+    if maxDelay < delay {
+        maxDelay = delay
+    }
+
+    for i := 0; i < retryCount && delay < maxDelay; i++ {
+        delay *= 2
+    }
+    if delay > maxDelay {
+        delay = maxDelay
+    }
+
+    if p.Jitter > 0 {
+        jitter := min(p.Jitter, 1)
+        delay -= time.Duration(rand.Float64() * jitter * float64(delay))
+    }
+    return delay
+}
+
+// Retry schedules the next attempt of a running job according to the
+// policy of its type, or moves it to dead_letter once its retries are used
+// up. errMsg is kept as the job's last error either way. Returns whether
+// the job will run again.
+func Retry(pool *db.DBPool, ctx context.Context, jobID int, errMsg string) (bool, error) {
+    err := db.RetryJob(pool, ctx, jobID, errMsg, nextRetryAt)
+    if errors.Is(err, db.ErrJobRetriesExhausted) {
+        return false, db.DeadLetterJob(pool, ctx, jobID, errMsg)
+    }
+    if err != nil {
+        return false, err
+    }
+    return true, nil
+}
+
+// ErrNotRequeueable is returned by Requeue for jobs that did not fail.
+var ErrNotRequeueable = errors.New("jobs: only failed and dead-lettered jobs can be requeued")
+
+// Requeue enqueues a fresh copy (type, priority, payload, codec and owner) of a
+// failed or dead-lettered job from job_history and returns the new job id.
+// The original stays in the history as it was.
+func Requeue(pool *db.DBPool, ctx context.Context, jobID int) (int, error) {
+    job, err := db.GetJob(pool, ctx, jobID)
+    if err != nil {
+        return 0, err
+    }
+    if job.Status != db.JobStatusFailed && job.Status != db.JobStatusDeadLetter {
+        return 0, ErrNotRequeueable
+    }
+
+    return db.CreateJob(pool, ctx, db.JobSpec{
+        Type:       job.Type,
+        Priority:   job.Priority,
+        Payload:    job.Payload,
+        Codec:      job.Codec,
+        MaxRetries: RetryPolicyFor(job.Type).MaxRetries,
+        UserID:     job.UserID,
+    })
+}
+
+func nextRetryAt(jobType string, retryCount int) time.Time {
+    return time.Now().Add(RetryPolicyFor(jobType).Backoff(retryCount))
+}
+
+// ErrPermanent marks handler errors that retrying will not fix. Such jobs
+// are failed right away instead of being retried.
+var ErrPermanent = errors.New("jobs: permanent failure")
@@ -0,0 +1,142 @@
+package jobs
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "log"
+    "time"
+
+    "gooner/codec"
+    "gooner/db"
+)
+
+const defaultSchedulerInterval = 15 * time.Second
+
+// Scheduler enqueues recurring jobs from job_schedules when they are due.
+// Every instance can run one: advancing a schedule and enqueueing its job
+// happen in one transaction that only succeeds while next_run_at is still
+// the tick being fired, so each tick is enqueued once.
+type Scheduler struct {
+    Pool     *db.DBPool
+    Logger   *log.Logger
+    Interval time.Duration
+
+    stop context.CancelFunc
+    done chan struct{}
+}
+
+func NewScheduler(pool *db.DBPool, logger *log.Logger) *Scheduler {
+    return &Scheduler{
+        Pool:     pool,
+        Logger:   logger,
+        Interval: defaultSchedulerInterval,
+    }
+}
+
+// Add creates or updates the schedule called name. payload is encoded with
+// the codec of jobType. An empty spec removes the schedule, which lets
+// config turn a built-in job off.
+func (s *Scheduler) Add(ctx context.Context, name, spec, jobType string, payload any) error {
+    if spec == "" {
+        return db.DeleteJobSchedule(s.Pool, ctx, name)
+    }
+
+    schedule, err := ParseSchedule(spec)
+    if err != nil {
+        return err
+    }
+
+    codecName := CodecFor(jobType)
+    c, err := codec.Get(codecName)
+    if err != nil {
+        return err
+    }
+
+    data, err := c.Marshal(payload)
+    if err != nil {
+        return fmt.Errorf("failed to encode %s payload: %w", jobType, err)
+    }
+
+    return db.UpsertJobSchedule(s.Pool, ctx, db.JobSchedule{
+        Name:      name,
+        JobType:   jobType,
+        Spec:      spec,
+        Payload:   data,
+        Codec:     codecName,
+        NextRunAt: schedule.Next(time.Now()),
+    })
+}
+
+func (s *Scheduler) Start() {
+    if s.Interval <= 0 {
+        s.Interval = defaultSchedulerInterval
+    }
+
+    ctx, stop := context.WithCancel(context.Background())
+    s.stop = stop
+    s.done = make(chan struct{})
+
+    go func() {
+        defer close(s.done)
+
+        ticker := time.NewTicker(s.Interval)
+        defer ticker.Stop()
+
+        for {
+            if _, err := s.RunDue(ctx); err != nil && ctx.Err() == nil {
+                s.Logger.Printf("Job scheduler failed: %v", err)
+            }
+
+            select {
+            case <-ctx.Done():
+                return
+            case <-ticker.C:
+            }
+        }
+    }()
+}
+
+func (s *Scheduler) Stop() {
+    if s.stop == nil {
+        return
+    }
+    s.stop()
+    <-s.done
+}
+
+// RunDue enqueues the jobs of all due schedules and returns how many were
+// enqueued by this instance. The next run is computed from now rather than
+// from the missed tick, so a scheduler that was down fires once instead of
+// catching up on every tick it missed.
+func (s *Scheduler) RunDue(ctx context.Context) (int, error) {
+    now := time.Now()
+
+    due, err := db.DueJobSchedules(s.Pool, ctx, now)
+    if err != nil {
+        return 0, err
+    }
+
+    fired := 0
+    for _, sched := range due {
+        schedule, err := ParseSchedule(sched.Spec)
+        if err != nil {
+            s.Logger.Printf("Skipping job schedule %s: %v", sched.Name, err)
+            continue
+        }
+
+        jobID, err := db.FireJobSchedule(s.Pool, ctx, sched, schedule.Next(now), RetryPolicyFor(sched.JobType).MaxRetries)
+        if errors.Is(err, db.ErrScheduleNotDue) {
+            continue // another instance got there first
+        }
+        if err != nil {
+            s.Logger.Printf("Failed to fire job schedule %s: %v", sched.Name, err)
+            continue
+        }
+
+        fired++
+        s.Logger.Printf("Scheduled %s job %d from %s", sched.JobType, jobID, sched.Name)
+    }
+
+    return fired, nil
+}
@@ -0,0 +1,35 @@
+package jobs
+
+import (
+    "context"
+    "errors"
+    "strconv"
+
+    "gooner/auth"
+    "gooner/db"
+    "gooner/websocket"
+)
+
+// AuthorizeJobTopic lets users subscribe to "job:<id>" for jobs they
+// enqueued, and admins to any job.
+func AuthorizeJobTopic(pool *db.DBPool) websocket.TopicAuthorizer {
+    return func(ctx context.Context, userID, name string) error {
+        jobID, err := strconv.Atoi(name)
+        if err != nil {
+            return websocket.ErrUnknownTopic
+        }
+
+        job, err := db.GetJob(pool, ctx, jobID)
+        if errors.Is(err, db.ErrJobNotFound) {
+            return websocket.ErrUnknownTopic
+        }
+        if err != nil {
+            return err
+        }
+
+        if job.UserID != userID && !auth.IsAdmin(userID) {
+            return websocket.ErrForbidden
+        }
+        return nil
+    }
+}
@@ -0,0 +1,335 @@
+package jobs
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "log"
+    "os"
+    "sync"
+    "time"
+
+    "gooner/db"
+    "gooner/websocket"
+)
+
+const (
+    defaultJobTimeout = 300 * time.Second
+    finalizeTimeout   = 10 * time.Second
+)
+
+// HandlerFunc runs a claimed job. The returned bytes are stored as the job result.
+type HandlerFunc func(ctx context.Context, job *db.Job) ([]byte, error)
+
+// ErrDeferred tells the worker that the handler (or someone it handed off to,
+// e.g. an RPC callback) records the final job state itself.
+var ErrDeferred = errors.New("jobs: completion deferred")
+
+type WorkerPool struct {
+    Pool              *db.DBPool
+    Logger            *log.Logger
+    Concurrency       int
+    PollInterval      time.Duration
+    HeartbeatInterval time.Duration
+    Hub               *websocket.Hub // notified of status changes and progress, may be nil
+
+    mu        sync.RWMutex
+    handlers  map[string]HandlerFunc
+    workerIDs []string
+    onStop    []func()
+
+    stop   context.CancelFunc // stops claiming new jobs
+    abort  context.CancelFunc // cancels jobs still running at shutdown
+    jobCtx context.Context
+    wg     sync.WaitGroup
+}
+
+type outcome struct {
+    result []byte
+    err    error
+}
+
+func NewWorkerPool(pool *db.DBPool, logger *log.Logger, concurrency int) *WorkerPool {
+    if concurrency <= 0 {
+        concurrency = 1
+    }
+
+    return &WorkerPool{
+        Pool:              pool,
+        Logger:            logger,
+        Concurrency:       concurrency,
+        PollInterval:      time.Second,
+        HeartbeatInterval: 10 * time.Second,
+        handlers:          make(map[string]HandlerFunc),
+    }
+}
+
+// Register binds a handler to a job type. Jobs of unknown types are failed.
+func (wp *WorkerPool) Register(jobType string, handler HandlerFunc) {
+    wp.mu.Lock()
+    defer wp.mu.Unlock()
+    wp.handlers[jobType] = handler
+    markRegistered(jobType)
+}
+
+// OnShutdown registers cleanup that runs once all workers have stopped,
+// e.g. closing resources that handlers use.
+func (wp *WorkerPool) OnShutdown(fn func()) {
+    wp.mu.Lock()
+    defer wp.mu.Unlock()
+    wp.onStop = append(wp.onStop, fn)
+}
+
+func (wp *WorkerPool) handler(jobType string) HandlerFunc {
+    wp.mu.RLock()
+    defer wp.mu.RUnlock()
+    return wp.handlers[jobType]
+}
+
+func (wp *WorkerPool) Start() error {
+    if wp.PollInterval <= 0 {
+        wp.PollInterval = time.Second
+    }
+    if wp.HeartbeatInterval <= 0 {
+        wp.HeartbeatInterval = 10 * time.Second
+    }
+
+    hostname, err := os.Hostname()
+    if err != nil {
+        hostname = "unknown"
+    }
+
+    // hostname and pid repeat across container restarts, and a restarted
+    // process must not pass for the workers whose jobs it orphaned
+    instance, err := db.GenUUID()
+    if err != nil {
+        return fmt.Errorf("failed to generate worker id: %w", err)
+    }
+
+    for i := 0; i < wp.Concurrency; i++ {
+        workerID := fmt.Sprintf("%s-%d-%s-%d", hostname, os.Getpid(), instance[:8], i)
+        if err := db.RegisterJobWorker(wp.Pool, context.Background(), workerID, hostname); err != nil {
+            return fmt.Errorf("failed to register worker %s: %w", workerID, err)
+        }
+        wp.workerIDs = append(wp.workerIDs, workerID)
+    }
+
+    claimCtx, stop := context.WithCancel(context.Background())
+    jobCtx, abort := context.WithCancel(context.Background())
+    wp.stop = stop
+    wp.abort = abort
+    wp.jobCtx = jobCtx
+
+    for _, workerID := range wp.workerIDs {
+        wp.wg.Add(1)
+        go wp.work(claimCtx, workerID)
+    }
+
+    wp.wg.Add(1)
+    go wp.heartbeat(claimCtx)
+
+    wp.Logger.Printf("Started %d job workers", len(wp.workerIDs))
+    return nil
+}
+
+// Shutdown stops claiming and waits for in-flight jobs. If ctx expires first,
+// running jobs are cancelled and released back to the queue.
+func (wp *WorkerPool) Shutdown(ctx context.Context) error {
+    if wp.stop == nil {
+        return nil
+    }
+    wp.stop()
+
+    done := make(chan struct{})
+    go func() {
+        wp.wg.Wait()
+        close(done)
+    }()
+
+    var err error
+    select {
+    case <-done:
+    case <-ctx.Done():
+        err = ctx.Err()
+        wp.abort()
+        <-done
+    }
+    wp.abort()
+
+    wp.mu.RLock()
+    for _, fn := range wp.onStop {
+        fn()
+    }
+    wp.mu.RUnlock()
+
+    removeCtx, cancel := context.WithTimeout(context.Background(), finalizeTimeout)
+    defer cancel()
+    if rmErr := db.RemoveJobWorkers(wp.Pool, removeCtx, wp.workerIDs); rmErr != nil {
+        wp.Logger.Printf("Failed to deregister job workers: %v", rmErr)
+    }
+
+    wp.Logger.Println("Job workers stopped")
+    return err
+}
+
+func (wp *WorkerPool) work(ctx context.Context, workerID string) {
+    defer wp.wg.Done()
+
+    for ctx.Err() == nil {
+        job, err := db.ClaimNextJob(wp.Pool, ctx, workerID)
+        if err != nil {
+            if ctx.Err() == nil {
+                wp.Logger.Printf("Worker %s failed to claim job: %v", workerID, err)
+            }
+            sleep(ctx, wp.PollInterval)
+            continue
+        }
+
+        if job == nil {
+            sleep(ctx, wp.PollInterval)
+            continue
+        }
+
+        wp.process(job)
+    }
+}
+
+func (wp *WorkerPool) process(job *db.Job) {
+    handler := wp.handler(job.Type)
+    if handler == nil {
+        // another instance running a newer build may know the type
+        wp.retry(job, fmt.Sprintf("no handler registered for job type %q", job.Type))
+        return
+    }
+
+    timeout := time.Duration(job.TimeoutSeconds) * time.Second
+    if timeout <= 0 {
+        timeout = defaultJobTimeout
+    }
+
+    ctx, cancel := context.WithTimeout(wp.jobCtx, timeout)
+    defer cancel()
+    ctx = context.WithValue(ctx, progressKey{}, &progressReporter{wp: wp, job: job})
+
+    wp.notify(job, db.JobStatusRunning)
+
+    done := make(chan outcome, 1)
+    go func() {
+        defer func() {
+            if r := recover(); r != nil {
+                done <- outcome{err: fmt.Errorf("handler panic: %v", r)}
+            }
+        }()
+        result, err := handler(ctx, job)
+        done <- outcome{result: result, err: err}
+    }()
+
+    var out outcome
+    select {
+    case out = <-done:
+    case <-ctx.Done():
+        out = outcome{err: ctx.Err()}
+    }
+
+    switch {
+    case out.err == nil:
+        wp.complete(job, out.result)
+    case errors.Is(out.err, ErrDeferred):
+        // final state is recorded elsewhere
+    case wp.jobCtx.Err() != nil:
+        wp.release(job)
+    case errors.Is(ctx.Err(), context.DeadlineExceeded):
+        wp.retry(job, fmt.Sprintf("job timed out after %s", timeout))
+    case errors.Is(out.err, ErrPermanent):
+        wp.fail(job, out.err.Error())
+    default:
+        wp.retry(job, out.err.Error())
+    }
+}
+
+func (wp *WorkerPool) complete(job *db.Job, result []byte) {
+    ctx, cancel := context.WithTimeout(context.Background(), finalizeTimeout)
+    defer cancel()
+
+    if err := db.CompleteJob(wp.Pool, ctx, job.ID, result); err != nil {
+        wp.Logger.Printf("Failed to complete job %d: %v", job.ID, err)
+        return
+    }
+    wp.notify(job, db.JobStatusCompleted)
+}
+
+func (wp *WorkerPool) fail(job *db.Job, errMsg string) {
+    ctx, cancel := context.WithTimeout(context.Background(), finalizeTimeout)
+    defer cancel()
+
+    wp.Logger.Printf("Job %d (%s) failed: %s", job.ID, job.Type, errMsg)
+    if err := db.FailJob(wp.Pool, ctx, job.ID, errMsg); err != nil {
+        wp.Logger.Printf("Failed to mark job %d failed: %v", job.ID, err)
+        return
+    }
+    wp.notify(job, db.JobStatusFailed)
+}
+
+func (wp *WorkerPool) retry(job *db.Job, errMsg string) {
+    ctx, cancel := context.WithTimeout(context.Background(), finalizeTimeout)
+    defer cancel()
+
+    retried, err := Retry(wp.Pool, ctx, job.ID, errMsg)
+    if err != nil {
+        wp.Logger.Printf("Failed to retry job %d: %v", job.ID, err)
+        return
+    }
+
+    if retried {
+        wp.Logger.Printf("Job %d (%s) failed, retry %d of %d scheduled: %s",
+            job.ID, job.Type, job.RetryCount+1, job.MaxRetries, errMsg)
+        wp.notify(job, db.JobStatusPending)
+    } else {
+        wp.Logger.Printf("Job %d (%s) dead-lettered after %d retries: %s",
+            job.ID, job.Type, job.RetryCount, errMsg)
+        wp.notify(job, db.JobStatusDeadLetter)
+    }
+}
+
+func (wp *WorkerPool) release(job *db.Job) {
+    ctx, cancel := context.WithTimeout(context.Background(), finalizeTimeout)
+    defer cancel()
+
+    if err := db.ReleaseJob(wp.Pool, ctx, job.ID); err != nil {
+        wp.Logger.Printf("Failed to release job %d: %v", job.ID, err)
+    }
+}
+
+func (wp *WorkerPool) notify(job *db.Job, status string) {
+    if wp.Hub != nil {
+        wp.Hub.SendJobStatus(job.UserID, job.ID, job.Type, status)
+    }
+}
+
+func (wp *WorkerPool) heartbeat(ctx context.Context) {
+    defer wp.wg.Done()
+
+    ticker := time.NewTicker(wp.HeartbeatInterval)
+    defer ticker.Stop()
+
+    for {
+        select {
+        case <-ctx.Done():
+            return
+        case <-ticker.C:
+            if err := db.HeartbeatJobWorkers(wp.Pool, ctx, wp.workerIDs); err != nil && ctx.Err() == nil {
+                wp.Logger.Printf("Job worker heartbeat failed: %v", err)
+            }
+        }
+    }
+}
+
+func sleep(ctx context.Context, d time.Duration) {
+    timer := time.NewTimer(d)
+    defer timer.Stop()
+
+    select {
+    case <-ctx.Done():
+    case <-timer.C:
+    }
+}
@@ -9,8 +9,11 @@ import (
 	"gooner/config"
 	"gooner/websocket"
 	"gooner/admin"
+	"gooner/jobs"
+	"gooner/rpc"
 
 	"gooner/chat"
+	"gooner/blob"
 
     "context"
     "net/http"
@@ -21,7 +24,7 @@ import (
     "time"
 )
 
-func Run(pool *db.DBPool, router *router.Router, port string, name string) {
+func Run(pool *db.DBPool, router *router.Router, workers *jobs.WorkerPool, port string, name string) {
 	// BUG: timeouts make long running requests fail silently!
     server := &http.Server{
         Addr:    ":" + port,
@@ -46,6 +49,12 @@ func Run(pool *db.DBPool, router *router.Router, port string, name string) {
             router.Logger.Printf("Server shutdown error: %v", err)
         }
 
+        if workers != nil {
+            if err := workers.Shutdown(ctx); err != nil {
+                router.Logger.Printf("Job worker shutdown error: %v", err)
+            }
+        }
+
         if pool.ReadDB != nil {
             pool.ReadDB.Close()
         }
@@ -90,6 +99,7 @@ func main() {
         jwtExp,
         refreshExp,
     )
+    auth.SetAdmins(config.Auth.AdminUsers)
 	
 	wsHub := websocket.NewHub()
     go wsHub.Run()
@@ -101,14 +111,54 @@ func main() {
 		mainMux.Logger.Printf("Could not init database: %s", err)
     }
 
+    attachments, err := blob.NewStore(blob.Config{
+        Kind: config.Chat.Attachments.Store,
+        Dir:  config.Chat.Attachments.Dir,
+    })
+    if err != nil {
+        log.Fatalf("Failed to open attachment store: %v", err)
+    }
+
+    chatHandler := chat.NewHandler(DBPool, wsHub, mainMux.Logger)
+    chatHandler.Blobs = attachments
+    chatHandler.MaxAttachmentSize = config.Chat.Attachments.MaxSize
+    chatHandler.MaxAttachments = config.Chat.Attachments.MaxFiles
+    presence := chat.NewPresenceTracker(DBPool, wsHub, mainMux.Logger)
+
+    chatRetention, _ := time.ParseDuration(config.Chat.Retention)
+    pruner := chat.NewPruner(DBPool, chat.RetentionPolicy{
+        MaxAge:   chatRetention,
+        MaxCount: config.Chat.RetentionMaxCount,
+    }, config.Chat.ArchiveDir)
+    pruner.Blobs = attachments
+
+    if DBPool != nil {
+        indexed, err := chat.EnsureSearchIndex(DBPool, context.Background())
+        if err != nil {
+            log.Fatalf("Failed to set up chat search: %v", err)
+        }
+        if !indexed {
+            mainMux.Logger.Printf("SQLite was built without FTS5, chat search falls back to LIKE (build with -tags sqlite_fts5)")
+        }
+
+        wsHub.Authorize("chat", chat.AuthorizeRoomTopic(DBPool))
+        wsHub.Authorize("job", jobs.AuthorizeJobTopic(DBPool))
+        wsHub.Handle("send", chatHandler.SocketSendMessage)
+        wsHub.Handle("typing", presence.SocketTyping)
+        wsHub.OnPresence("chat", presence.Track)
+        presence.Start()
+    }
+
     sessionConfig := middleware.SessionConfig{
         JWTSecret: []byte(config.Auth.JWTSecret),
         PublicPaths: map[string]bool{
-            "/":               true,
-            "/assets":         true,
-            "/api/signup":     true,
-            "/api/login":      true,
-            "/api/webhooks":   true,
+            "/":                 true,
+            "/assets":           true,
+            "/api/signup":       true,
+            "/api/login":        true,
+            "/api/webhooks":     true,
+            "/api/rpc/callback": true,
+            "/api/ws":           true, // authenticates the upgrade itself
         },
     }
 
@@ -118,6 +168,55 @@ func main() {
 
     webhookHandler := webhooks.NewWebhookHandler(config.Webhooks.Secret)
 
+    ticketTTL, _ := time.ParseDuration(config.WebSocket.TicketTTL)
+    writeWait, _ := time.ParseDuration(config.WebSocket.WriteWait)
+    pongWait, _ := time.ParseDuration(config.WebSocket.PongWait)
+    pingInterval, _ := time.ParseDuration(config.WebSocket.PingInterval)
+    slowConsumer, err := websocket.ParseSlowConsumerPolicy(config.WebSocket.SlowConsumer)
+    if err != nil {
+        log.Fatalf("Invalid websocket config: %v", err)
+    }
+    wsConfig := websocket.HandlerConfig{
+        JWTSecret:      config.Auth.JWTSecret,
+        AllowedOrigins: config.WebSocket.AllowedOrigins,
+        TicketTTL:      ticketTTL,
+        SendBuffer:     config.WebSocket.SendBuffer,
+        SlowConsumer:   slowConsumer,
+        MaxMessageSize: config.WebSocket.MaxMessageSize,
+        WriteWait:      writeWait,
+        PongWait:       pongWait,
+        PingInterval:   pingInterval,
+    }
+
+    jobs.SetRetryPolicy(rpc.JobType, rpc.RetryPolicy)
+    for _, policy := range config.Jobs.Retry {
+        baseDelay, _ := time.ParseDuration(policy.BaseDelay)
+        maxDelay, _ := time.ParseDuration(policy.MaxDelay)
+        jobs.SetRetryPolicy(policy.JobType, jobs.RetryPolicy{
+            MaxRetries: policy.MaxRetries,
+            BaseDelay:  baseDelay,
+            MaxDelay:   maxDelay,
+            Jitter:     policy.Jitter,
+        })
+    }
+
+    rpcService := rpc.NewService(DBPool, wsHub, mainMux.Logger, config.Server.BaseURL, config.RPC.CallbackSecret)
+    rpcService.HTTPClient = mainMux.HTTPClient
+
+    var transports []rpc.TransportConfig
+    for _, svc := range config.RPC.Services {
+        transports = append(transports, rpc.TransportConfig{
+            Name:      svc.Name,
+            Transport: svc.Transport,
+            URL:       svc.URL,
+            Command:   svc.Command,
+            Socket:    svc.Socket,
+        })
+    }
+    if err := rpcService.LoadTransports(transports); err != nil {
+        log.Fatalf("Failed to load RPC transports: %v", err)
+    }
+
     mainMux.Use(middleware.Logger)
     mainMux.Use(authAdapter)
     mainMux.RegisterFileServer("./static", "./static/assets")
@@ -128,15 +227,106 @@ func main() {
     apiMux.Handle("POST /signup", router.SignupHandler)
     apiMux.Handle("POST /login", router.LoginHandler)
 
-	apiMux.Handle("POST /chat/send", chat.SendMessageHandler)
+	apiMux.Handle("POST /chat/send", chatHandler.SendMessageHandler)
 	apiMux.Handle("GET /chat/messages", chat.GetMessagesHandler)
+	apiMux.Handle("GET /chat/messages/sync", chat.SyncMessagesHandler)
+	apiMux.Handle("POST /chat/attachments", chatHandler.UploadAttachmentsHandler)
+	apiMux.Handle("GET /chat/attachments/{id}", chatHandler.DownloadAttachmentHandler)
+	apiMux.Handle("GET /chat/attachments/{id}/thumbnail", chatHandler.AttachmentThumbnailHandler)
+	apiMux.Handle("GET /chat/search", chat.SearchHandler)
+	apiMux.Handle("PATCH /chat/messages/{id}", chatHandler.EditMessageHandler)
+	apiMux.Handle("DELETE /chat/messages/{id}", chatHandler.DeleteMessageHandler)
+	apiMux.Handle("GET /chat/messages/{id}/history", chatHandler.MessageHistoryHandler)
+	apiMux.Handle("GET /chat/messages/{id}/thread", chatHandler.ThreadHandler)
+	apiMux.Handle("PUT /chat/messages/{id}/reactions/{emoji}", chatHandler.AddReactionHandler)
+	apiMux.Handle("DELETE /chat/messages/{id}/reactions/{emoji}", chatHandler.RemoveReactionHandler)
+	apiMux.Handle("POST /chat/rooms", chatHandler.CreateRoomHandler)
+	apiMux.Handle("GET /chat/rooms", chatHandler.ListRoomsHandler)
+	apiMux.Handle("GET /chat/rooms/{id}", chatHandler.GetRoomHandler)
+	apiMux.Handle("PATCH /chat/rooms/{id}", chatHandler.UpdateRoomHandler)
+	apiMux.Handle("POST /chat/rooms/{id}/archive", chatHandler.ArchiveRoomHandler)
+	apiMux.Handle("POST /chat/rooms/{id}/join", chatHandler.JoinRoomHandler)
+	apiMux.Handle("GET /chat/rooms/{id}/members", chatHandler.ListMembersHandler)
+	apiMux.Handle("POST /chat/rooms/{id}/members", chatHandler.AddMemberHandler)
+	apiMux.Handle("PATCH /chat/rooms/{id}/members/{user}", chatHandler.UpdateMemberHandler)
+	apiMux.Handle("DELETE /chat/rooms/{id}/members/{user}", chatHandler.RemoveMemberHandler)
+	apiMux.Handle("PUT /chat/rooms/{id}/retention", chatHandler.SetRetentionHandler)
+	apiMux.Handle("GET /chat/rooms/{id}/presence", presence.RoomPresenceHandler)
+	apiMux.Handle("POST /chat/dms", chatHandler.CreateConversationHandler)
+	apiMux.Handle("GET /chat/dms", chatHandler.ListConversationsHandler)
+	apiMux.Handle("POST /chat/dms/{id}/read", chatHandler.MarkConversationReadHandler)
+	apiMux.Handle("GET /chat/notifications", chat.ListNotificationsHandler)
+	apiMux.Handle("POST /chat/notifications/read", chat.MarkNotificationsReadHandler)
 	apiMux.Handle("GET /stress-test", chat.StressTestHandler)
     apiMux.Handle("POST /webhooks/generic", webhookHandler.GenericWebhook)
-    apiMux.Handle("GET /ws", websocket.WebSocketHandler(wsHub))
+    apiMux.Handle("GET /ws", websocket.WebSocketHandler(wsHub, wsConfig))
+    apiMux.Handle("POST /ws/ticket", websocket.TicketHandler(wsConfig))
+    apiMux.Handle("POST /rpc/calls", rpcService.CallHandler)
+    apiMux.Handle("POST /rpc/callback", rpcService.RPCCallbackHandler)
+
+    apiMux.Handle("POST /jobs", jobs.EnqueueHandler)
+    apiMux.Handle("GET /jobs", jobs.ListJobsHandler)
+    apiMux.Handle("GET /jobs/{id}", jobs.GetJobHandler)
+    apiMux.Handle("POST /jobs/{id}/cancel", jobs.CancelJobHandler)
+    apiMux.Handle("POST /jobs/{id}/retry", jobs.RetryJobHandler)
 
 	apiMux.Handle("GET /admin/metrics", admin.MetricsHandler)
+	apiMux.Handle("GET /admin/chat/retention", pruner.RetentionStatusHandler)
+	apiMux.Handle("POST /admin/chat/retention/run", pruner.RunRetentionHandler)
 
     mainMux.Include(apiMux, "/api")
 
-    Run(DBPool, mainMux, config.Server.Port, config.Server.Name)
+    var workers *jobs.WorkerPool
+    if DBPool != nil {
+        workers = jobs.NewWorkerPool(DBPool, mainMux.Logger, config.Jobs.Workers)
+        workers.PollInterval, _ = time.ParseDuration(config.Jobs.PollInterval)
+        workers.HeartbeatInterval, _ = time.ParseDuration(config.Jobs.HeartbeatInterval)
+        workers.Hub = wsHub
+        workers.Register(rpc.JobType, rpcService.ProcessRPCJob)
+        workers.OnShutdown(rpcService.Close)
+
+        if DBPool.Type == "postgres" {
+            relay := websocket.NewRelay(wsHub, DBPool, mainMux.Logger)
+            relay.Start()
+            workers.OnShutdown(relay.Stop)
+        }
+        workers.OnShutdown(presence.Stop)
+
+        reaper := jobs.NewReaper(DBPool, wsHub, mainMux.Logger)
+        reaper.Interval, _ = time.ParseDuration(config.Jobs.ReapInterval)
+        reaper.StaleAfter, _ = time.ParseDuration(config.Jobs.StaleAfter)
+        reaper.Start()
+        workers.OnShutdown(reaper.Stop)
+
+        workers.Register(router.RefreshTokenCleanupJobType, router.NewRefreshTokenCleanupJob(DBPool))
+        workers.Register(chat.PruneJobType, chat.NewPruneJob(pruner))
+        workers.Register(admin.MetricsSnapshotJobType, admin.NewMetricsSnapshotJob(DBPool))
+        for _, jobType := range config.Jobs.EnqueueTypes {
+            jobs.AllowEnqueue(jobType)
+        }
+
+        scheduler := jobs.NewScheduler(DBPool, mainMux.Logger)
+        scheduler.Interval, _ = time.ParseDuration(config.Jobs.SchedulerInterval)
+        builtins := []struct {
+            name, spec, jobType string
+        }{
+            {"refresh_token_cleanup", config.Jobs.Schedules.RefreshTokenCleanup, router.RefreshTokenCleanupJobType},
+            {"chat_retention", config.Jobs.Schedules.ChatRetention, chat.PruneJobType},
+            {"metrics_snapshot", config.Jobs.Schedules.MetricsSnapshot, admin.MetricsSnapshotJobType},
+        }
+        for _, b := range builtins {
+            if err := scheduler.Add(context.Background(), b.name, b.spec, b.jobType, nil); err != nil {
+                mainMux.Logger.Printf("Could not schedule %s: %s", b.name, err)
+            }
+        }
+        scheduler.Start()
+        workers.OnShutdown(scheduler.Stop)
+
+        if err := workers.Start(); err != nil {
+            mainMux.Logger.Printf("Could not start job workers: %s", err)
+            workers = nil
+        }
+    }
+
+    Run(DBPool, mainMux, workers, config.Server.Port, config.Server.Name)
 }
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_job_workers_heartbeat;
+DROP TABLE IF EXISTS job_workers;
@@ -0,0 +1,10 @@
+-- Registry of live job workers, kept fresh by heartbeats
+CREATE TABLE IF NOT EXISTS job_workers (
+    worker_id TEXT PRIMARY KEY,
+    hostname TEXT NOT NULL,
+    started_at TIMESTAMPTZ DEFAULT NOW(),
+    last_heartbeat TIMESTAMPTZ DEFAULT NOW()
+);
+
+-- Index for finding workers with stale heartbeats
+CREATE INDEX IF NOT EXISTS idx_job_workers_heartbeat ON job_workers (last_heartbeat);
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_rpc_errors_created_at;
+DROP INDEX IF EXISTS idx_rpc_errors_job_id;
+DROP TABLE IF EXISTS rpc_errors;
@@ -0,0 +1,13 @@
+-- Audit trail of RPC failures across all stages
+CREATE TABLE IF NOT EXISTS rpc_errors (
+    id SERIAL PRIMARY KEY,
+    job_id INTEGER,
+    stage TEXT NOT NULL,
+    error_type TEXT NOT NULL,
+    message TEXT NOT NULL,
+    retryable BOOLEAN DEFAULT FALSE,
+    created_at TIMESTAMPTZ DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_rpc_errors_job_id ON rpc_errors (job_id);
+CREATE INDEX IF NOT EXISTS idx_rpc_errors_created_at ON rpc_errors (created_at DESC);
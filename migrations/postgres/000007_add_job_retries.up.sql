@@ -0,0 +1,88 @@
+-- Jobs that used up their retries end up in 'dead_letter' instead of
+-- 'failed'. The error of the latest attempt is kept in last_error and
+-- copied to job_history.error when the job is archived.
+ALTER TABLE job_queue ADD COLUMN IF NOT EXISTS last_error TEXT;
+ALTER TABLE job_history ADD COLUMN IF NOT EXISTS retry_count INTEGER DEFAULT 0;
+
+ALTER TABLE job_queue DROP CONSTRAINT IF EXISTS job_queue_status_check;
+ALTER TABLE job_queue ADD CONSTRAINT job_queue_status_check
+    CHECK (status IN ('pending', 'running', 'completed', 'failed', 'cancelled', 'dead_letter'));
+
+CREATE OR REPLACE FUNCTION move_job_to_history()
+RETURNS TRIGGER AS $$
+BEGIN
+    IF NEW.status IN ('completed', 'failed', 'cancelled', 'dead_letter')
+       AND OLD.status NOT IN ('completed', 'failed', 'cancelled', 'dead_letter') THEN
+        INSERT INTO job_history (
+            id, type, priority, payload, codec, result, error, status,
+            created_at, started_at, completed_at, worker_id,
+            retry_count, execution_time_ms
+        ) VALUES (
+            NEW.id, NEW.type, NEW.priority, NEW.payload, NEW.codec,
+            NULL, -- result will be updated separately
+            CASE WHEN NEW.status IN ('failed', 'dead_letter') THEN COALESCE(NEW.last_error, 'Job failed') ELSE NULL END,
+            NEW.status, NEW.created_at, NEW.started_at, NOW(), NEW.worker_id,
+            NEW.retry_count,
+            CASE
+                WHEN NEW.started_at IS NOT NULL THEN
+                    EXTRACT(EPOCH FROM (NOW() - NEW.started_at))::INTEGER * 1000
+                ELSE NULL
+            END
+        );
+
+        DELETE FROM job_queue WHERE id = NEW.id;
+
+        RETURN NULL;
+    END IF;
+
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+-- Workers need the retry counters to compute the next backoff
+DROP FUNCTION IF EXISTS claim_next_job(TEXT);
+
+CREATE FUNCTION claim_next_job(worker_id_param TEXT)
+RETURNS TABLE(
+    job_id INTEGER,
+    job_type TEXT,
+    job_payload BYTEA,
+    job_codec TEXT,
+    job_timeout INTEGER,
+    job_retry_count INTEGER,
+    job_max_retries INTEGER
+) AS $$
+DECLARE
+    claimed_job_id INTEGER;
+BEGIN
+    UPDATE job_queue
+    SET
+        status = 'running',
+        claimed_at = NOW(),
+        started_at = NOW(),
+        worker_id = worker_id_param
+    WHERE id = (
+        SELECT id FROM job_queue
+        WHERE status = 'pending'
+        AND scheduled_for <= NOW()
+        ORDER BY priority DESC, created_at ASC
+        LIMIT 1
+        FOR UPDATE SKIP LOCKED
+    )
+    RETURNING id INTO claimed_job_id;
+
+    IF claimed_job_id IS NOT NULL THEN
+        RETURN QUERY
+        SELECT
+            jq.id,
+            jq.type,
+            jq.payload,
+            jq.codec,
+            jq.timeout_seconds,
+            jq.retry_count,
+            jq.max_retries
+        FROM job_queue jq
+        WHERE jq.id = claimed_job_id;
+    END IF;
+END;
+$$ LANGUAGE plpgsql;
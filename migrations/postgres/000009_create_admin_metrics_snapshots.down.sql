@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_admin_metrics_snapshots_taken_at;
+DROP TABLE IF EXISTS admin_metrics_snapshots;
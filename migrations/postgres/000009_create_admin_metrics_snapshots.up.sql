@@ -0,0 +1,8 @@
+-- Periodic copies of the real-time metrics for trend graphs
+CREATE TABLE IF NOT EXISTS admin_metrics_snapshots (
+    id SERIAL PRIMARY KEY,
+    taken_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    metrics JSONB NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_admin_metrics_snapshots_taken_at ON admin_metrics_snapshots (taken_at DESC);
@@ -0,0 +1,99 @@
+-- Jobs remember the user that enqueued them, so status and progress
+-- notifications only go to that user. Handlers report progress while
+-- running; the last value is archived with the job.
+ALTER TABLE job_queue ADD COLUMN IF NOT EXISTS user_id TEXT;
+ALTER TABLE job_queue ADD COLUMN IF NOT EXISTS progress INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE job_queue ADD COLUMN IF NOT EXISTS progress_message TEXT;
+
+ALTER TABLE job_history ADD COLUMN IF NOT EXISTS user_id TEXT;
+ALTER TABLE job_history ADD COLUMN IF NOT EXISTS progress INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE job_history ADD COLUMN IF NOT EXISTS progress_message TEXT;
+
+CREATE INDEX IF NOT EXISTS idx_job_queue_user ON job_queue (user_id);
+CREATE INDEX IF NOT EXISTS idx_job_history_user ON job_history (user_id);
+
+CREATE OR REPLACE FUNCTION move_job_to_history()
+RETURNS TRIGGER AS $$
+BEGIN
+    IF NEW.status IN ('completed', 'failed', 'cancelled', 'dead_letter')
+       AND OLD.status NOT IN ('completed', 'failed', 'cancelled', 'dead_letter') THEN
+        INSERT INTO job_history (
+            id, type, priority, payload, codec, result, error, status,
+            created_at, started_at, completed_at, worker_id,
+            retry_count, execution_time_ms, user_id, progress, progress_message
+        ) VALUES (
+            NEW.id, NEW.type, NEW.priority, NEW.payload, NEW.codec,
+            NULL, -- result will be updated separately
+            CASE WHEN NEW.status IN ('failed', 'dead_letter') THEN COALESCE(NEW.last_error, 'Job failed') ELSE NULL END,
+            NEW.status, NEW.created_at, NEW.started_at, NOW(), NEW.worker_id,
+            NEW.retry_count,
+            CASE
+                WHEN NEW.started_at IS NOT NULL THEN
+                    EXTRACT(EPOCH FROM (NOW() - NEW.started_at))::INTEGER * 1000
+                ELSE NULL
+            END,
+            NEW.user_id,
+            CASE WHEN NEW.status = 'completed' THEN 100 ELSE NEW.progress END,
+            NEW.progress_message
+        );
+
+        DELETE FROM job_queue WHERE id = NEW.id;
+
+        RETURN NULL;
+    END IF;
+
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+-- Workers need the owner to route progress notifications
+DROP FUNCTION IF EXISTS claim_next_job(TEXT);
+
+CREATE FUNCTION claim_next_job(worker_id_param TEXT)
+RETURNS TABLE(
+    job_id INTEGER,
+    job_type TEXT,
+    job_payload BYTEA,
+    job_codec TEXT,
+    job_timeout INTEGER,
+    job_retry_count INTEGER,
+    job_max_retries INTEGER,
+    job_user_id TEXT
+) AS $$
+DECLARE
+    claimed_job_id INTEGER;
+BEGIN
+    UPDATE job_queue
+    SET
+        status = 'running',
+        claimed_at = NOW(),
+        started_at = NOW(),
+        worker_id = worker_id_param,
+        progress = 0,
+        progress_message = NULL
+    WHERE id = (
+        SELECT id FROM job_queue
+        WHERE status = 'pending'
+        AND scheduled_for <= NOW()
+        ORDER BY priority DESC, created_at ASC
+        LIMIT 1
+        FOR UPDATE SKIP LOCKED
+    )
+    RETURNING id INTO claimed_job_id;
+
+    IF claimed_job_id IS NOT NULL THEN
+        RETURN QUERY
+        SELECT
+            jq.id,
+            jq.type,
+            jq.payload,
+            jq.codec,
+            jq.timeout_seconds,
+            jq.retry_count,
+            jq.max_retries,
+            jq.user_id
+        FROM job_queue jq
+        WHERE jq.id = claimed_job_id;
+    END IF;
+END;
+$$ LANGUAGE plpgsql;
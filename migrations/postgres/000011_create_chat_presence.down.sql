@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_chat_presence_user_id;
+DROP TABLE IF EXISTS chat_presence;
@@ -0,0 +1,11 @@
+-- Who is or was last in a room. online is refreshed by a heartbeat while
+-- the user is subscribed, so rows of a crashed instance go stale.
+CREATE TABLE IF NOT EXISTS chat_presence (
+    room_id TEXT NOT NULL REFERENCES chat_rooms(id) ON DELETE CASCADE,
+    user_id TEXT NOT NULL REFERENCES users(user_id) ON DELETE CASCADE,
+    online BOOLEAN NOT NULL DEFAULT FALSE,
+    last_seen_at TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (room_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_chat_presence_user_id ON chat_presence(user_id);
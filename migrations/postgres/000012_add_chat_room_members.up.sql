@@ -0,0 +1,23 @@
+-- Rooms can be private and are archived instead of deleted. Their owner
+-- is the member with the owner role.
+ALTER TABLE chat_rooms ADD COLUMN IF NOT EXISTS is_private BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE chat_rooms ADD COLUMN IF NOT EXISTS archived_at TIMESTAMPTZ;
+
+CREATE TABLE IF NOT EXISTS chat_room_members (
+    room_id TEXT NOT NULL REFERENCES chat_rooms(id) ON DELETE CASCADE,
+    user_id TEXT NOT NULL REFERENCES users(user_id) ON DELETE CASCADE,
+    role TEXT NOT NULL DEFAULT 'member' CHECK (role IN ('owner', 'moderator', 'member')),
+    joined_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (room_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_chat_room_members_user_id ON chat_room_members(user_id);
+
+-- everyone who already wrote in a room is a member of it
+INSERT INTO chat_room_members (room_id, user_id, role, joined_at)
+SELECT room_id, user_id, 'member', MIN(created_at)
+FROM chat_messages
+GROUP BY room_id, user_id
+ON CONFLICT DO NOTHING;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_chat_room_members_owner ON chat_room_members(room_id) WHERE role = 'owner';
@@ -0,0 +1,4 @@
+-- Message history is paged by id within a room, so the room index carries
+-- the id as well.
+CREATE INDEX IF NOT EXISTS idx_chat_messages_room_id_id ON chat_messages(room_id, id);
+DROP INDEX IF EXISTS idx_chat_messages_room_id;
@@ -0,0 +1,7 @@
+DROP TABLE IF EXISTS chat_message_reactions;
+DROP INDEX IF EXISTS idx_chat_message_edits_message_id;
+DROP TABLE IF EXISTS chat_message_edits;
+
+ALTER TABLE chat_messages DROP COLUMN IF EXISTS deleted_by;
+ALTER TABLE chat_messages DROP COLUMN IF EXISTS deleted_at;
+ALTER TABLE chat_messages DROP COLUMN IF EXISTS edited_at;
@@ -0,0 +1,28 @@
+-- Replies point at the first message of their thread.
+ALTER TABLE chat_messages ADD COLUMN IF NOT EXISTS reply_to INTEGER REFERENCES chat_messages(id) ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS idx_chat_messages_reply_to ON chat_messages(reply_to, id);
+
+CREATE TABLE IF NOT EXISTS chat_mentions (
+    message_id INTEGER NOT NULL REFERENCES chat_messages(id) ON DELETE CASCADE,
+    user_id TEXT NOT NULL REFERENCES users(user_id) ON DELETE CASCADE,
+    PRIMARY KEY (message_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_chat_mentions_user_id ON chat_mentions(user_id);
+
+-- Notifications stay unread until the user marks them read, whether or
+-- not they were online to get them over the WebSocket.
+CREATE TABLE IF NOT EXISTS chat_notifications (
+    id BIGSERIAL PRIMARY KEY,
+    user_id TEXT NOT NULL REFERENCES users(user_id) ON DELETE CASCADE,
+    type TEXT NOT NULL,
+    room_id TEXT NOT NULL REFERENCES chat_rooms(id) ON DELETE CASCADE,
+    message_id INTEGER NOT NULL REFERENCES chat_messages(id) ON DELETE CASCADE,
+    actor_id TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL,
+    read_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_chat_notifications_user_id ON chat_notifications(user_id, id);
+CREATE INDEX IF NOT EXISTS idx_chat_notifications_unread ON chat_notifications(user_id) WHERE read_at IS NULL;
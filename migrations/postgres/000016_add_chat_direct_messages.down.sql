@@ -0,0 +1,5 @@
+ALTER TABLE chat_room_members DROP COLUMN IF EXISTS last_read_id;
+
+DROP INDEX IF EXISTS idx_chat_rooms_dm_key;
+ALTER TABLE chat_rooms DROP COLUMN IF EXISTS dm_key;
+ALTER TABLE chat_rooms DROP COLUMN IF EXISTS kind;
@@ -0,0 +1,9 @@
+-- Direct conversations are private rooms of kind 'dm'. dm_key lists their
+-- participants so the same people always get the same conversation.
+ALTER TABLE chat_rooms ADD COLUMN IF NOT EXISTS kind TEXT NOT NULL DEFAULT 'room' CHECK (kind IN ('room', 'dm'));
+ALTER TABLE chat_rooms ADD COLUMN IF NOT EXISTS dm_key TEXT;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_chat_rooms_dm_key ON chat_rooms(dm_key) WHERE dm_key IS NOT NULL;
+
+-- the last message a member has read, for unread counts
+ALTER TABLE chat_room_members ADD COLUMN IF NOT EXISTS last_read_id INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_chat_messages_content_tsv;
+ALTER TABLE chat_messages DROP COLUMN IF EXISTS content_tsv;
@@ -0,0 +1,6 @@
+-- Full-text index over message content. The 'simple' configuration does
+-- not stem, like the SQLite index, so both match the same words.
+ALTER TABLE chat_messages ADD COLUMN IF NOT EXISTS content_tsv tsvector
+    GENERATED ALWAYS AS (to_tsvector('simple', content)) STORED;
+
+CREATE INDEX IF NOT EXISTS idx_chat_messages_content_tsv ON chat_messages USING GIN (content_tsv);
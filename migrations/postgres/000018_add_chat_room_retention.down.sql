@@ -0,0 +1,4 @@
+ALTER TABLE chat_rooms DROP COLUMN IF EXISTS pruned_total;
+ALTER TABLE chat_rooms DROP COLUMN IF EXISTS pruned_at;
+ALTER TABLE chat_rooms DROP COLUMN IF EXISTS retention_max_count;
+ALTER TABLE chat_rooms DROP COLUMN IF EXISTS retention_max_age;
@@ -0,0 +1,8 @@
+-- Per-room retention overrides, NULL uses the server default and 0 keeps
+-- messages forever. retention_max_age is in seconds.
+ALTER TABLE chat_rooms ADD COLUMN IF NOT EXISTS retention_max_age BIGINT CHECK (retention_max_age >= 0);
+ALTER TABLE chat_rooms ADD COLUMN IF NOT EXISTS retention_max_count INTEGER CHECK (retention_max_count >= 0);
+
+-- when the pruner last deleted messages from the room, and how many so far
+ALTER TABLE chat_rooms ADD COLUMN IF NOT EXISTS pruned_at TIMESTAMPTZ;
+ALTER TABLE chat_rooms ADD COLUMN IF NOT EXISTS pruned_total BIGINT NOT NULL DEFAULT 0;
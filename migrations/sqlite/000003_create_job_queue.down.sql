@@ -0,0 +1,10 @@
+DROP TRIGGER IF EXISTS trigger_move_job_to_history;
+DROP INDEX IF EXISTS idx_job_history_performance;
+DROP INDEX IF EXISTS idx_job_history_status;
+DROP INDEX IF EXISTS idx_job_history_type;
+DROP INDEX IF EXISTS idx_job_queue_type;
+DROP INDEX IF EXISTS idx_job_queue_scheduled;
+DROP INDEX IF EXISTS idx_job_queue_worker;
+DROP INDEX IF EXISTS idx_job_priority_queue;
+DROP TABLE IF EXISTS job_history;
+DROP TABLE IF EXISTS job_queue;
@@ -0,0 +1,77 @@
+-- Job queue table for active jobs
+CREATE TABLE IF NOT EXISTS job_queue (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    type TEXT NOT NULL,
+    priority INTEGER DEFAULT 0,  -- Higher = more important
+    payload BLOB,                -- MessagePack data for RPC
+    status TEXT DEFAULT 'pending' CHECK (status IN ('pending', 'running', 'completed', 'failed', 'cancelled')),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    claimed_at TIMESTAMP,
+    started_at TIMESTAMP,
+    timeout_seconds INTEGER DEFAULT 300,
+    retry_count INTEGER DEFAULT 0,
+    max_retries INTEGER DEFAULT 3,
+    worker_id TEXT,
+    scheduled_for TIMESTAMP DEFAULT CURRENT_TIMESTAMP  -- For delayed jobs
+);
+
+-- Job history table for completed jobs (audit trail and results)
+CREATE TABLE IF NOT EXISTS job_history (
+    id INTEGER PRIMARY KEY,      -- Same ID as job_queue
+    type TEXT NOT NULL,
+    priority INTEGER,
+    payload BLOB,
+    result BLOB,                 -- MessagePack results from RPC
+    error TEXT,                  -- Error details if failed
+    status TEXT NOT NULL,
+    created_at TIMESTAMP,
+    started_at TIMESTAMP,
+    completed_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    worker_id TEXT,
+    execution_time_ms INTEGER    -- For performance monitoring
+);
+
+-- Index for priority-based job selection
+CREATE INDEX idx_job_priority_queue ON job_queue (status, priority DESC, created_at);
+
+-- Index for worker queries and cleanup
+CREATE INDEX idx_job_queue_worker ON job_queue (worker_id, status);
+
+-- Index for scheduled jobs
+CREATE INDEX idx_job_queue_scheduled ON job_queue (scheduled_for, status);
+
+-- Index for job type filtering
+CREATE INDEX idx_job_queue_type ON job_queue (type, status);
+
+-- History table indexes for monitoring and retrieval
+CREATE INDEX idx_job_history_type ON job_history (type, completed_at DESC);
+CREATE INDEX idx_job_history_status ON job_history (status, completed_at DESC);
+CREATE INDEX idx_job_history_performance ON job_history (execution_time_ms DESC);
+
+-- Move finished jobs to history, same as move_job_to_history() on postgres.
+-- Claiming has no stored procedure here; it runs in a write transaction on
+-- the single-writer connection instead.
+CREATE TRIGGER trigger_move_job_to_history
+AFTER UPDATE OF status ON job_queue
+FOR EACH ROW
+WHEN NEW.status IN ('completed', 'failed', 'cancelled')
+ AND OLD.status NOT IN ('completed', 'failed', 'cancelled')
+BEGIN
+    INSERT INTO job_history (
+        id, type, priority, payload, result, error, status,
+        created_at, started_at, completed_at, worker_id,
+        execution_time_ms
+    ) VALUES (
+        NEW.id, NEW.type, NEW.priority, NEW.payload,
+        NULL, -- result will be updated separately
+        CASE WHEN NEW.status = 'failed' THEN 'Job failed' ELSE NULL END,
+        NEW.status, NEW.created_at, NEW.started_at, CURRENT_TIMESTAMP, NEW.worker_id,
+        CASE
+            WHEN NEW.started_at IS NOT NULL THEN
+                CAST((julianday('now') - julianday(NEW.started_at)) * 86400 AS INTEGER) * 1000
+            ELSE NULL
+        END
+    );
+
+    DELETE FROM job_queue WHERE id = NEW.id;
+END;
@@ -0,0 +1,13 @@
+-- Audit trail of RPC failures across all stages
+CREATE TABLE IF NOT EXISTS rpc_errors (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    job_id INTEGER,
+    stage TEXT NOT NULL,
+    error_type TEXT NOT NULL,
+    message TEXT NOT NULL,
+    retryable BOOLEAN DEFAULT 0,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_rpc_errors_job_id ON rpc_errors (job_id);
+CREATE INDEX idx_rpc_errors_created_at ON rpc_errors (created_at DESC);
@@ -0,0 +1,29 @@
+DROP TRIGGER IF EXISTS trigger_move_job_to_history;
+
+CREATE TRIGGER trigger_move_job_to_history
+AFTER UPDATE OF status ON job_queue
+FOR EACH ROW
+WHEN NEW.status IN ('completed', 'failed', 'cancelled')
+ AND OLD.status NOT IN ('completed', 'failed', 'cancelled')
+BEGIN
+    INSERT INTO job_history (
+        id, type, priority, payload, result, error, status,
+        created_at, started_at, completed_at, worker_id,
+        execution_time_ms
+    ) VALUES (
+        NEW.id, NEW.type, NEW.priority, NEW.payload,
+        NULL,
+        CASE WHEN NEW.status = 'failed' THEN 'Job failed' ELSE NULL END,
+        NEW.status, NEW.created_at, NEW.started_at, CURRENT_TIMESTAMP, NEW.worker_id,
+        CASE
+            WHEN NEW.started_at IS NOT NULL THEN
+                CAST((julianday('now') - julianday(NEW.started_at)) * 86400 AS INTEGER) * 1000
+            ELSE NULL
+        END
+    );
+
+    DELETE FROM job_queue WHERE id = NEW.id;
+END;
+
+ALTER TABLE job_history DROP COLUMN codec;
+ALTER TABLE job_queue DROP COLUMN codec;
@@ -0,0 +1,31 @@
+-- Name of the codec used for payload and result (see codec package).
+-- Existing rows were written as JSON.
+ALTER TABLE job_queue ADD COLUMN codec TEXT NOT NULL DEFAULT 'json';
+ALTER TABLE job_history ADD COLUMN codec TEXT NOT NULL DEFAULT 'json';
+
+DROP TRIGGER IF EXISTS trigger_move_job_to_history;
+
+CREATE TRIGGER trigger_move_job_to_history
+AFTER UPDATE OF status ON job_queue
+FOR EACH ROW
+WHEN NEW.status IN ('completed', 'failed', 'cancelled')
+ AND OLD.status NOT IN ('completed', 'failed', 'cancelled')
+BEGIN
+    INSERT INTO job_history (
+        id, type, priority, payload, codec, result, error, status,
+        created_at, started_at, completed_at, worker_id,
+        execution_time_ms
+    ) VALUES (
+        NEW.id, NEW.type, NEW.priority, NEW.payload, NEW.codec,
+        NULL, -- result will be updated separately
+        CASE WHEN NEW.status = 'failed' THEN 'Job failed' ELSE NULL END,
+        NEW.status, NEW.created_at, NEW.started_at, CURRENT_TIMESTAMP, NEW.worker_id,
+        CASE
+            WHEN NEW.started_at IS NOT NULL THEN
+                CAST((julianday('now') - julianday(NEW.started_at)) * 86400 AS INTEGER) * 1000
+            ELSE NULL
+        END
+    );
+
+    DELETE FROM job_queue WHERE id = NEW.id;
+END;
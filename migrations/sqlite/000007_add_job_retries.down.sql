@@ -0,0 +1,66 @@
+DROP TRIGGER IF EXISTS trigger_move_job_to_history;
+
+CREATE TABLE job_queue_old (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    type TEXT NOT NULL,
+    priority INTEGER DEFAULT 0,
+    payload BLOB,
+    status TEXT DEFAULT 'pending' CHECK (status IN ('pending', 'running', 'completed', 'failed', 'cancelled')),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    claimed_at TIMESTAMP,
+    started_at TIMESTAMP,
+    timeout_seconds INTEGER DEFAULT 300,
+    retry_count INTEGER DEFAULT 0,
+    max_retries INTEGER DEFAULT 3,
+    worker_id TEXT,
+    scheduled_for TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    codec TEXT NOT NULL DEFAULT 'json'
+);
+
+INSERT INTO job_queue_old (
+    id, type, priority, payload, status, created_at, claimed_at, started_at,
+    timeout_seconds, retry_count, max_retries, worker_id, scheduled_for, codec
+)
+SELECT
+    id, type, priority, payload, status, created_at, claimed_at, started_at,
+    timeout_seconds, retry_count, max_retries, worker_id, scheduled_for, codec
+FROM job_queue;
+
+DELETE FROM sqlite_sequence WHERE name = 'job_queue_old';
+INSERT INTO sqlite_sequence (name, seq)
+SELECT 'job_queue_old', seq FROM sqlite_sequence WHERE name = 'job_queue';
+
+DROP TABLE job_queue;
+ALTER TABLE job_queue_old RENAME TO job_queue;
+
+CREATE INDEX idx_job_priority_queue ON job_queue (status, priority DESC, created_at);
+CREATE INDEX idx_job_queue_worker ON job_queue (worker_id, status);
+CREATE INDEX idx_job_queue_scheduled ON job_queue (scheduled_for, status);
+CREATE INDEX idx_job_queue_type ON job_queue (type, status);
+
+ALTER TABLE job_history DROP COLUMN retry_count;
+
+CREATE TRIGGER trigger_move_job_to_history
+AFTER UPDATE OF status ON job_queue
+FOR EACH ROW
+WHEN NEW.status IN ('completed', 'failed', 'cancelled')
+ AND OLD.status NOT IN ('completed', 'failed', 'cancelled')
+BEGIN
+    INSERT INTO job_history (
+        id, type, priority, payload, codec, result, error, status,
+        created_at, started_at, completed_at, worker_id,
+        execution_time_ms
+    ) VALUES (
+        NEW.id, NEW.type, NEW.priority, NEW.payload, NEW.codec,
+        NULL,
+        CASE WHEN NEW.status = 'failed' THEN 'Job failed' ELSE NULL END,
+        NEW.status, NEW.created_at, NEW.started_at, CURRENT_TIMESTAMP, NEW.worker_id,
+        CASE
+            WHEN NEW.started_at IS NOT NULL THEN
+                CAST((julianday('now') - julianday(NEW.started_at)) * 86400 AS INTEGER) * 1000
+            ELSE NULL
+        END
+    );
+
+    DELETE FROM job_queue WHERE id = NEW.id;
+END;
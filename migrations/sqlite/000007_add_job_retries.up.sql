@@ -0,0 +1,75 @@
+-- Jobs that used up their retries end up in 'dead_letter' instead of
+-- 'failed'. The error of the latest attempt is kept in last_error and
+-- copied to job_history.error when the job is archived.
+--
+-- SQLite cannot change a CHECK constraint, so job_queue is rebuilt.
+DROP TRIGGER IF EXISTS trigger_move_job_to_history;
+
+CREATE TABLE job_queue_new (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    type TEXT NOT NULL,
+    priority INTEGER DEFAULT 0,  -- Higher = more important
+    payload BLOB,                -- MessagePack data for RPC
+    codec TEXT NOT NULL DEFAULT 'json',
+    status TEXT DEFAULT 'pending' CHECK (status IN ('pending', 'running', 'completed', 'failed', 'cancelled', 'dead_letter')),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    claimed_at TIMESTAMP,
+    started_at TIMESTAMP,
+    timeout_seconds INTEGER DEFAULT 300,
+    retry_count INTEGER DEFAULT 0,
+    max_retries INTEGER DEFAULT 3,
+    last_error TEXT,
+    worker_id TEXT,
+    scheduled_for TIMESTAMP DEFAULT CURRENT_TIMESTAMP  -- For delayed jobs
+);
+
+INSERT INTO job_queue_new (
+    id, type, priority, payload, codec, status, created_at, claimed_at, started_at,
+    timeout_seconds, retry_count, max_retries, worker_id, scheduled_for
+)
+SELECT
+    id, type, priority, payload, codec, status, created_at, claimed_at, started_at,
+    timeout_seconds, retry_count, max_retries, worker_id, scheduled_for
+FROM job_queue;
+
+-- Keep the id sequence, otherwise new jobs could reuse ids of jobs that
+-- were already archived to job_history.
+DELETE FROM sqlite_sequence WHERE name = 'job_queue_new';
+INSERT INTO sqlite_sequence (name, seq)
+SELECT 'job_queue_new', seq FROM sqlite_sequence WHERE name = 'job_queue';
+
+DROP TABLE job_queue;
+ALTER TABLE job_queue_new RENAME TO job_queue;
+
+CREATE INDEX idx_job_priority_queue ON job_queue (status, priority DESC, created_at);
+CREATE INDEX idx_job_queue_worker ON job_queue (worker_id, status);
+CREATE INDEX idx_job_queue_scheduled ON job_queue (scheduled_for, status);
+CREATE INDEX idx_job_queue_type ON job_queue (type, status);
+
+ALTER TABLE job_history ADD COLUMN retry_count INTEGER DEFAULT 0;
+
+CREATE TRIGGER trigger_move_job_to_history
+AFTER UPDATE OF status ON job_queue
+FOR EACH ROW
+WHEN NEW.status IN ('completed', 'failed', 'cancelled', 'dead_letter')
+ AND OLD.status NOT IN ('completed', 'failed', 'cancelled', 'dead_letter')
+BEGIN
+    INSERT INTO job_history (
+        id, type, priority, payload, codec, result, error, status,
+        created_at, started_at, completed_at, worker_id,
+        retry_count, execution_time_ms
+    ) VALUES (
+        NEW.id, NEW.type, NEW.priority, NEW.payload, NEW.codec,
+        NULL, -- result will be updated separately
+        CASE WHEN NEW.status IN ('failed', 'dead_letter') THEN COALESCE(NEW.last_error, 'Job failed') ELSE NULL END,
+        NEW.status, NEW.created_at, NEW.started_at, CURRENT_TIMESTAMP, NEW.worker_id,
+        NEW.retry_count,
+        CASE
+            WHEN NEW.started_at IS NOT NULL THEN
+                CAST((julianday('now') - julianday(NEW.started_at)) * 86400 AS INTEGER) * 1000
+            ELSE NULL
+        END
+    );
+
+    DELETE FROM job_queue WHERE id = NEW.id;
+END;
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_job_schedules_due;
+DROP TABLE IF EXISTS job_schedules;
@@ -0,0 +1,19 @@
+-- Recurring jobs. spec is a cron expression or "@every <duration>".
+-- Instances claim a tick by moving next_run_at forward only if it still
+-- holds the value they read, so each tick is enqueued once.
+CREATE TABLE IF NOT EXISTS job_schedules (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT NOT NULL UNIQUE,
+    job_type TEXT NOT NULL,
+    spec TEXT NOT NULL,
+    priority INTEGER DEFAULT 0,
+    payload BLOB,
+    codec TEXT NOT NULL DEFAULT 'json',
+    enabled BOOLEAN NOT NULL DEFAULT 1,
+    next_run_at TIMESTAMP NOT NULL,
+    last_run_at TIMESTAMP,
+    last_job_id INTEGER,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_job_schedules_due ON job_schedules (enabled, next_run_at);
@@ -0,0 +1,8 @@
+-- Periodic copies of the real-time metrics for trend graphs
+CREATE TABLE IF NOT EXISTS admin_metrics_snapshots (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    taken_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    metrics TEXT NOT NULL  -- JSON
+);
+
+CREATE INDEX idx_admin_metrics_snapshots_taken_at ON admin_metrics_snapshots (taken_at DESC);
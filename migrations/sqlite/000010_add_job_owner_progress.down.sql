@@ -0,0 +1,38 @@
+DROP TRIGGER IF EXISTS trigger_move_job_to_history;
+
+CREATE TRIGGER trigger_move_job_to_history
+AFTER UPDATE OF status ON job_queue
+FOR EACH ROW
+WHEN NEW.status IN ('completed', 'failed', 'cancelled', 'dead_letter')
+ AND OLD.status NOT IN ('completed', 'failed', 'cancelled', 'dead_letter')
+BEGIN
+    INSERT INTO job_history (
+        id, type, priority, payload, codec, result, error, status,
+        created_at, started_at, completed_at, worker_id,
+        retry_count, execution_time_ms
+    ) VALUES (
+        NEW.id, NEW.type, NEW.priority, NEW.payload, NEW.codec,
+        NULL, -- result will be updated separately
+        CASE WHEN NEW.status IN ('failed', 'dead_letter') THEN COALESCE(NEW.last_error, 'Job failed') ELSE NULL END,
+        NEW.status, NEW.created_at, NEW.started_at, CURRENT_TIMESTAMP, NEW.worker_id,
+        NEW.retry_count,
+        CASE
+            WHEN NEW.started_at IS NOT NULL THEN
+                CAST((julianday('now') - julianday(NEW.started_at)) * 86400 AS INTEGER) * 1000
+            ELSE NULL
+        END
+    );
+
+    DELETE FROM job_queue WHERE id = NEW.id;
+END;
+
+DROP INDEX IF EXISTS idx_job_history_user;
+DROP INDEX IF EXISTS idx_job_queue_user;
+
+ALTER TABLE job_history DROP COLUMN progress_message;
+ALTER TABLE job_history DROP COLUMN progress;
+ALTER TABLE job_history DROP COLUMN user_id;
+
+ALTER TABLE job_queue DROP COLUMN progress_message;
+ALTER TABLE job_queue DROP COLUMN progress;
+ALTER TABLE job_queue DROP COLUMN user_id;
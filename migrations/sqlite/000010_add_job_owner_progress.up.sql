@@ -0,0 +1,44 @@
+-- Jobs remember the user that enqueued them, so status and progress
+-- notifications only go to that user. Handlers report progress while
+-- running; the last value is archived with the job.
+ALTER TABLE job_queue ADD COLUMN user_id TEXT;
+ALTER TABLE job_queue ADD COLUMN progress INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE job_queue ADD COLUMN progress_message TEXT;
+
+ALTER TABLE job_history ADD COLUMN user_id TEXT;
+ALTER TABLE job_history ADD COLUMN progress INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE job_history ADD COLUMN progress_message TEXT;
+
+CREATE INDEX IF NOT EXISTS idx_job_queue_user ON job_queue (user_id);
+CREATE INDEX IF NOT EXISTS idx_job_history_user ON job_history (user_id);
+
+DROP TRIGGER IF EXISTS trigger_move_job_to_history;
+
+CREATE TRIGGER trigger_move_job_to_history
+AFTER UPDATE OF status ON job_queue
+FOR EACH ROW
+WHEN NEW.status IN ('completed', 'failed', 'cancelled', 'dead_letter')
+ AND OLD.status NOT IN ('completed', 'failed', 'cancelled', 'dead_letter')
+BEGIN
+    INSERT INTO job_history (
+        id, type, priority, payload, codec, result, error, status,
+        created_at, started_at, completed_at, worker_id,
+        retry_count, execution_time_ms, user_id, progress, progress_message
+    ) VALUES (
+        NEW.id, NEW.type, NEW.priority, NEW.payload, NEW.codec,
+        NULL, -- result will be updated separately
+        CASE WHEN NEW.status IN ('failed', 'dead_letter') THEN COALESCE(NEW.last_error, 'Job failed') ELSE NULL END,
+        NEW.status, NEW.created_at, NEW.started_at, CURRENT_TIMESTAMP, NEW.worker_id,
+        NEW.retry_count,
+        CASE
+            WHEN NEW.started_at IS NOT NULL THEN
+                CAST((julianday('now') - julianday(NEW.started_at)) * 86400 AS INTEGER) * 1000
+            ELSE NULL
+        END,
+        NEW.user_id,
+        CASE WHEN NEW.status = 'completed' THEN 100 ELSE NEW.progress END,
+        NEW.progress_message
+    );
+
+    DELETE FROM job_queue WHERE id = NEW.id;
+END;
@@ -0,0 +1,13 @@
+-- Who is or was last in a room. online is refreshed by a heartbeat while
+-- the user is subscribed, so rows of a crashed instance go stale.
+CREATE TABLE IF NOT EXISTS chat_presence (
+    room_id TEXT NOT NULL,
+    user_id TEXT NOT NULL,
+    online INTEGER NOT NULL DEFAULT 0,
+    last_seen_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (room_id, user_id),
+    FOREIGN KEY (room_id) REFERENCES chat_rooms(id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users(user_id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_chat_presence_user_id ON chat_presence(user_id);
@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS idx_chat_room_members_owner;
+DROP INDEX IF EXISTS idx_chat_room_members_user_id;
+DROP TABLE IF EXISTS chat_room_members;
+
+ALTER TABLE chat_rooms DROP COLUMN archived_at;
+ALTER TABLE chat_rooms DROP COLUMN is_private;
@@ -0,0 +1,24 @@
+-- Rooms can be private and are archived instead of deleted. Their owner
+-- is the member with the owner role.
+ALTER TABLE chat_rooms ADD COLUMN is_private INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE chat_rooms ADD COLUMN archived_at TIMESTAMP;
+
+CREATE TABLE IF NOT EXISTS chat_room_members (
+    room_id TEXT NOT NULL,
+    user_id TEXT NOT NULL,
+    role TEXT NOT NULL DEFAULT 'member' CHECK (role IN ('owner', 'moderator', 'member')),
+    joined_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (room_id, user_id),
+    FOREIGN KEY (room_id) REFERENCES chat_rooms(id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users(user_id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_chat_room_members_user_id ON chat_room_members(user_id);
+
+-- everyone who already wrote in a room is a member of it
+INSERT OR IGNORE INTO chat_room_members (room_id, user_id, role, joined_at)
+SELECT room_id, user_id, 'member', MIN(created_at)
+FROM chat_messages
+GROUP BY room_id, user_id;
+
+CREATE UNIQUE INDEX idx_chat_room_members_owner ON chat_room_members(room_id) WHERE role = 'owner';
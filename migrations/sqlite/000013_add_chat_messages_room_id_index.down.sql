@@ -0,0 +1,2 @@
+CREATE INDEX IF NOT EXISTS idx_chat_messages_room_id ON chat_messages(room_id);
+DROP INDEX IF EXISTS idx_chat_messages_room_id_id;
@@ -0,0 +1,7 @@
+DROP TABLE IF EXISTS chat_message_reactions;
+DROP INDEX IF EXISTS idx_chat_message_edits_message_id;
+DROP TABLE IF EXISTS chat_message_edits;
+
+ALTER TABLE chat_messages DROP COLUMN deleted_by;
+ALTER TABLE chat_messages DROP COLUMN deleted_at;
+ALTER TABLE chat_messages DROP COLUMN edited_at;
@@ -0,0 +1,25 @@
+-- Messages can be edited and soft-deleted by their author, and deleted by
+-- a room moderator. Previous versions are kept in chat_message_edits.
+ALTER TABLE chat_messages ADD COLUMN edited_at TIMESTAMP;
+ALTER TABLE chat_messages ADD COLUMN deleted_at TIMESTAMP;
+ALTER TABLE chat_messages ADD COLUMN deleted_by TEXT;
+
+CREATE TABLE IF NOT EXISTS chat_message_edits (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    message_id INTEGER NOT NULL,
+    content TEXT NOT NULL,
+    edited_at TIMESTAMP NOT NULL,
+    FOREIGN KEY (message_id) REFERENCES chat_messages(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_chat_message_edits_message_id ON chat_message_edits(message_id);
+
+CREATE TABLE IF NOT EXISTS chat_message_reactions (
+    message_id INTEGER NOT NULL,
+    user_id TEXT NOT NULL,
+    emoji TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (message_id, user_id, emoji),
+    FOREIGN KEY (message_id) REFERENCES chat_messages(id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users(user_id) ON DELETE CASCADE
+);
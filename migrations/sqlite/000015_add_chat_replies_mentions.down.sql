@@ -0,0 +1,8 @@
+DROP INDEX IF EXISTS idx_chat_notifications_unread;
+DROP INDEX IF EXISTS idx_chat_notifications_user_id;
+DROP TABLE IF EXISTS chat_notifications;
+DROP INDEX IF EXISTS idx_chat_mentions_user_id;
+DROP TABLE IF EXISTS chat_mentions;
+
+DROP INDEX IF EXISTS idx_chat_messages_reply_to;
+ALTER TABLE chat_messages DROP COLUMN reply_to;
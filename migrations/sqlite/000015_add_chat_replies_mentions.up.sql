@@ -0,0 +1,33 @@
+-- Replies point at the first message of their thread.
+ALTER TABLE chat_messages ADD COLUMN reply_to INTEGER;
+
+CREATE INDEX idx_chat_messages_reply_to ON chat_messages(reply_to, id);
+
+CREATE TABLE IF NOT EXISTS chat_mentions (
+    message_id INTEGER NOT NULL,
+    user_id TEXT NOT NULL,
+    PRIMARY KEY (message_id, user_id),
+    FOREIGN KEY (message_id) REFERENCES chat_messages(id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users(user_id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_chat_mentions_user_id ON chat_mentions(user_id);
+
+-- Notifications stay unread until the user marks them read, whether or
+-- not they were online to get them over the WebSocket.
+CREATE TABLE IF NOT EXISTS chat_notifications (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id TEXT NOT NULL,
+    type TEXT NOT NULL,
+    room_id TEXT NOT NULL,
+    message_id INTEGER NOT NULL,
+    actor_id TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    read_at TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(user_id) ON DELETE CASCADE,
+    FOREIGN KEY (room_id) REFERENCES chat_rooms(id) ON DELETE CASCADE,
+    FOREIGN KEY (message_id) REFERENCES chat_messages(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_chat_notifications_user_id ON chat_notifications(user_id, id);
+CREATE INDEX idx_chat_notifications_unread ON chat_notifications(user_id) WHERE read_at IS NULL;
@@ -0,0 +1,5 @@
+ALTER TABLE chat_room_members DROP COLUMN last_read_id;
+
+DROP INDEX IF EXISTS idx_chat_rooms_dm_key;
+ALTER TABLE chat_rooms DROP COLUMN dm_key;
+ALTER TABLE chat_rooms DROP COLUMN kind;
@@ -0,0 +1,5 @@
+-- The full-text index of chat messages needs SQLite built with FTS5
+-- (-tags sqlite_fts5), which a migration cannot count on. It is created by
+-- chat.EnsureSearchIndex at startup instead, and search falls back to LIKE
+-- without it.
+SELECT 1;
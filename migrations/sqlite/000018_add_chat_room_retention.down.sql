@@ -0,0 +1,4 @@
+ALTER TABLE chat_rooms DROP COLUMN pruned_total;
+ALTER TABLE chat_rooms DROP COLUMN pruned_at;
+ALTER TABLE chat_rooms DROP COLUMN retention_max_count;
+ALTER TABLE chat_rooms DROP COLUMN retention_max_age;
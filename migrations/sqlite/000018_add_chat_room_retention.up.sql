@@ -0,0 +1,8 @@
+-- Per-room retention overrides, NULL uses the server default and 0 keeps
+-- messages forever. retention_max_age is in seconds.
+ALTER TABLE chat_rooms ADD COLUMN retention_max_age INTEGER;
+ALTER TABLE chat_rooms ADD COLUMN retention_max_count INTEGER;
+
+-- when the pruner last deleted messages from the room, and how many so far
+ALTER TABLE chat_rooms ADD COLUMN pruned_at TIMESTAMP;
+ALTER TABLE chat_rooms ADD COLUMN pruned_total INTEGER NOT NULL DEFAULT 0;
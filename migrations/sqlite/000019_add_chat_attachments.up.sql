@@ -0,0 +1,18 @@
+-- Files uploaded with a message. The bytes live in the blob store under
+-- blob_key, and images get a thumbnail under thumbnail_key.
+CREATE TABLE IF NOT EXISTS chat_attachments (
+    id TEXT PRIMARY KEY,
+    message_id INTEGER NOT NULL,
+    position INTEGER NOT NULL,
+    filename TEXT NOT NULL,
+    content_type TEXT NOT NULL,
+    size INTEGER NOT NULL,
+    width INTEGER,
+    height INTEGER,
+    blob_key TEXT NOT NULL,
+    thumbnail_key TEXT,
+    created_at TIMESTAMP NOT NULL,
+    FOREIGN KEY (message_id) REFERENCES chat_messages(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_chat_attachments_message_id ON chat_attachments(message_id, position);
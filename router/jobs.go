@@ -0,0 +1,21 @@
+package router
+
+import (
+    "context"
+
+    "gooner/db"
+    "gooner/jobs"
+)
+
+// RefreshTokenCleanupJobType is the job that deletes expired refresh tokens.
+const RefreshTokenCleanupJobType = "refresh_token_cleanup"
+
+func NewRefreshTokenCleanupJob(pool *db.DBPool) jobs.HandlerFunc {
+    return func(ctx context.Context, job *db.Job) ([]byte, error) {
+        deleted, err := db.DeleteExpiredRefreshTokens(pool, ctx)
+        if err != nil {
+            return nil, err
+        }
+        return jobs.Encode(job, map[string]int64{"deleted": deleted})
+    }
+}
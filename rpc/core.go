@@ -1,10 +1,42 @@
 package rpc
 
 import (
-	"rpc"
-	"fmt"
+    "context"
+    "crypto/hmac"
+    "crypto/sha256"
+    "encoding/hex"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "log"
+    "net/http"
+    "sync"
+    "time"
+
+    "gooner/appcontext"
+    "gooner/db"
+    "gooner/jobs"
+    "gooner/websocket"
+)
+
+// JobType is the job_queue type that ProcessRPCJob is registered for.
+const JobType = "rpc_call"
+
+const (
+    defaultRPCTimeout = 30 * time.Second
+    signatureHeader   = "X-RPC-Signature"
 )
 
+// RetryPolicy is used for rpc_call jobs unless the config overrides it.
+// External services get more time to recover than local jobs.
+var RetryPolicy = jobs.RetryPolicy{
+    MaxRetries: 3,
+    BaseDelay:  30 * time.Second,
+    MaxDelay:   15 * time.Minute,
+    Jitter:     0.2,
+}
+
 type RPCRequest struct {
     JobID       int                    `json:"job_id"`
     Service     string                 `json:"service"`
@@ -15,104 +47,334 @@ type RPCRequest struct {
     MaxRetries  int                    `json:"max_retries"`
 }
 
+// CallRequest is the body of CallHandler. Payload is passed to the service
+// as is.
+type CallRequest struct {
+    Service string          `json:"service"`
+    Method  string          `json:"method"`
+    Payload json.RawMessage `json:"payload"`
+}
+
 type RPCResponse struct {
-    JobID   int    `json:"job_id"`
-    Success bool   `json:"success"`
-    Result  []byte `json:"result,omitempty"`
-    Error   string `json:"error,omitempty"`
-    Stage   string `json:"stage"`             // "queued", "calling", "completed", "failed"
+    JobID    int    `json:"job_id"`
+    Success  bool   `json:"success"`
+    Result   []byte `json:"result,omitempty"`
+    Error    string `json:"error,omitempty"`
+    Stage    string `json:"stage"`              // "queued", "calling", "progress", "completed", "failed"
+    Progress int    `json:"progress,omitempty"` // 0-100, with stage "progress"
+    Message  string `json:"message,omitempty"`
+}
+
+// ErrUnknownService is returned for calls to a service without a
+// transport.
+var ErrUnknownService = errors.New("rpc: unknown service")
+
+// stageProgress marks callbacks that report progress of a call that is
+// still running instead of its result.
+const stageProgress = "progress"
+
+type Service struct {
+    Pool           *db.DBPool
+    Hub            *websocket.Hub
+    Logger         *log.Logger
+    HTTPClient     *http.Client
+    BaseURL        string
+    CallbackSecret string
+
+    mu         sync.RWMutex
+    transports map[string]Transport
 }
 
-func CreateRPCJob(pool *db.DBPool, ctx context.Context, service, method string, payload []byte) (int, error) {
+func NewService(pool *db.DBPool, hub *websocket.Hub, logger *log.Logger, baseURL, callbackSecret string) *Service {
+    return &Service{
+        Pool:           pool,
+        Hub:            hub,
+        Logger:         logger,
+        BaseURL:        baseURL,
+        CallbackSecret: callbackSecret,
+        transports:     make(map[string]Transport),
+    }
+}
+
+// RegisterTransport routes calls for a service name to the given transport.
+func (s *Service) RegisterTransport(service string, transport Transport) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    s.transports[service] = transport
+}
+
+// LoadTransports builds and registers a transport for each configured service.
+func (s *Service) LoadTransports(configs []TransportConfig) error {
+    for _, cfg := range configs {
+        cfg.Secret = s.CallbackSecret
+        cfg.Client = s.HTTPClient
+        cfg.Logger = s.Logger
+
+        transport, err := NewTransport(cfg)
+        if err != nil {
+            return err
+        }
+        s.RegisterTransport(cfg.Name, transport)
+    }
+    return nil
+}
+
+// Close shuts down transports that hold resources, such as stdio subprocesses.
+func (s *Service) Close() {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    for service, transport := range s.transports {
+        if closer, ok := transport.(io.Closer); ok {
+            if err := closer.Close(); err != nil {
+                s.Logger.Printf("Failed to close %s transport: %v", service, err)
+            }
+        }
+    }
+}
+
+func (s *Service) transport(service string) Transport {
+    s.mu.RLock()
+    defer s.mu.RUnlock()
+    return s.transports[service]
+}
+
+// CreateRPCJob queues a call to service. The job belongs to the user in
+// ctx, who receives its status notifications.
+func (s *Service) CreateRPCJob(ctx context.Context, service, method string, payload []byte) (int, error) {
+    if s.transport(service) == nil {
+        return 0, fmt.Errorf("%w: %s", ErrUnknownService, service)
+    }
+
     rpcPayload := RPCRequest{
         Service:     service,
         Method:      method,
         Payload:     payload,
-        CallbackURL: fmt.Sprintf("%s/api/rpc/callback", config.BaseURL),
-        Timeout:     30 * time.Second,
-        MaxRetries:  3,
+        CallbackURL: fmt.Sprintf("%s/api/rpc/callback", s.BaseURL),
+        Timeout:     defaultRPCTimeout,
+        MaxRetries:  jobs.RetryPolicyFor(JobType).MaxRetries,
     }
 
-    jobPayload, _ := json.Marshal(rpcPayload)
-    jobID, err := db.CreateJob(pool, ctx, "rpc_call", 1, jobPayload)
+    // stored with the rpc_call codec (MessagePack by default), which keeps
+    // Payload as raw bytes instead of base64
+    jobID, err := jobs.Enqueue(s.Pool, ctx, JobType, 1, rpcPayload)
     if err != nil {
+        s.HandleRPCError(ctx, 0, "job_creation", "database", err.Error(), false)
         return 0, fmt.Errorf("failed to create RPC job: %w", err)
     }
 
-    broadcastRPCStatus(jobID, "queued", "", "")
+    userID, _ := ctx.Value("userID").(string)
+    s.notifyRPCStatus(userID, jobID, "queued", service, method)
     return jobID, nil
 }
 
-func ProcessRPCJob(jobID int, payload []byte) error {
+// CallHandler queues a call to a configured service for the caller.
+func (s *Service) CallHandler(ctx *appcontext.AppContext) {
+    if _, ok := ctx.Context.Value("userID").(string); !ok {
+        http.Error(ctx.Writer, "Unauthorized", http.StatusUnauthorized)
+        return
+    }
+
+    var req CallRequest
+    if err := json.NewDecoder(ctx.Request.Body).Decode(&req); err != nil {
+        http.Error(ctx.Writer, "Invalid JSON", http.StatusBadRequest)
+        return
+    }
+    if req.Service == "" || req.Method == "" {
+        http.Error(ctx.Writer, "service and method are required", http.StatusBadRequest)
+        return
+    }
+
+    jobID, err := s.CreateRPCJob(ctx.Context, req.Service, req.Method, req.Payload)
+    if err != nil {
+        if errors.Is(err, ErrUnknownService) {
+            http.Error(ctx.Writer, "Unknown service", http.StatusBadRequest)
+            return
+        }
+        s.Logger.Printf("Failed to create RPC job: %v", err)
+        http.Error(ctx.Writer, "Failed to create RPC job", http.StatusInternalServerError)
+        return
+    }
+
+    ctx.Writer.Header().Set("Content-Type", "application/json")
+    ctx.Writer.WriteHeader(http.StatusCreated)
+    json.NewEncoder(ctx.Writer).Encode(map[string]any{"job_id": jobID})
+}
+
+// ProcessRPCJob is the jobs.HandlerFunc for rpc_call jobs. Failures are
+// recorded by HandleRPCError, and asynchronous calls are finished by the
+// callback, so both report jobs.ErrDeferred to the worker. A job cancelled
+// at shutdown or past its timeout is left to the worker.
+func (s *Service) ProcessRPCJob(ctx context.Context, job *db.Job) ([]byte, error) {
     var rpcReq RPCRequest
-    if err := json.Unmarshal(payload, &rpcReq); err != nil {
-        HandleRPCError(jobID, "job_processing", "validation", err.Error(), false)
-        return err
+    if err := jobs.Decode(job, &rpcReq); err != nil {
+        s.HandleRPCError(ctx, job.ID, "job_processing", "validation", err.Error(), false)
+        return nil, fmt.Errorf("%w: %v", jobs.ErrDeferred, err)
     }
 
-    rpcReq.JobID = jobID
+    rpcReq.JobID = job.ID
+    if rpcReq.Timeout <= 0 {
+        rpcReq.Timeout = defaultRPCTimeout
+    }
 
-    broadcastRPCStatus(jobID, "calling", rpcReq.Service, rpcReq.Method)
+    s.notifyRPCStatus(job.UserID, job.ID, "calling", rpcReq.Service, rpcReq.Method)
 
-    ctx, cancel := context.WithTimeout(context.Background(), rpcReq.Timeout)
+    callCtx, cancel := context.WithTimeout(ctx, rpcReq.Timeout)
     defer cancel()
 
-    if err := callExternalService(ctx, rpcReq); err != nil {
+    response, err := s.callExternalService(callCtx, rpcReq)
+    if err != nil {
+        if ctx.Err() != nil {
+            // the worker is shutting down or the job timed out: it releases
+            // or retries the job itself, and ctx is no good for writes
+            return nil, ctx.Err()
+        }
         errorType := determineErrorType(err)
-        retryable := errorType == "network" || errorType == "timeout"
-        HandleRPCError(jobID, "service_call", errorType, err.Error(), retryable)
-        return err
+        retryable := errorType == "network" || errorType == "timeout" || errorType == "cancelled"
+        s.HandleRPCError(ctx, job.ID, "service_call", errorType, err.Error(), retryable)
+        return nil, fmt.Errorf("%w: %v", jobs.ErrDeferred, err)
     }
 
-    broadcastRPCStatus(jobID, "processing", rpcReq.Service, rpcReq.Method)
-    return nil
+    if response == nil {
+        s.notifyRPCStatus(job.UserID, job.ID, "processing", rpcReq.Service, rpcReq.Method)
+        return nil, jobs.ErrDeferred
+    }
+
+    if !response.Success {
+        s.HandleRPCError(ctx, job.ID, "service_execution", "service", response.Error, false)
+        return nil, jobs.ErrDeferred
+    }
+
+    s.notifyRPCStatus(job.UserID, job.ID, "completed", rpcReq.Service, rpcReq.Method)
+    return response.Result, nil
 }
 
-func callExternalService(ctx context.Context, req RPCRequest) error {
-    switch req.Service {
-    case "python":
-        return callPythonService(ctx, req)
-    case "rust":
-        return callRustService(ctx, req)
-    case "c":
-        return callCService(ctx, req)
+func (s *Service) callExternalService(ctx context.Context, req RPCRequest) (*RPCResponse, error) {
+    transport := s.transport(req.Service)
+    if transport == nil {
+        return nil, fmt.Errorf("%w: %s", ErrUnknownService, req.Service)
+    }
+    return transport.Call(ctx, req)
+}
+
+func determineErrorType(err error) string {
+    var netErr interface{ Timeout() bool }
+    switch {
+    case errors.Is(err, context.Canceled):
+        return "cancelled"
+    case errors.Is(err, context.DeadlineExceeded):
+        return "timeout"
+    case errors.Is(err, errWorkerExited), errors.Is(err, io.ErrUnexpectedEOF):
+        return "network"
+    case errors.As(err, &netErr) && netErr.Timeout():
+        return "timeout"
+    case errors.As(err, &netErr):
+        return "network"
     default:
-        return fmt.Errorf("unknown service: %s", req.Service)
+        return "service"
     }
 }
 
-func RPCCallbackHandler(ctx *appcontext.AppContext) {
+// RPCCallbackHandler receives results from services that answered a call
+// asynchronously. The body must be signed with the shared callback secret.
+func (s *Service) RPCCallbackHandler(ctx *appcontext.AppContext) {
+    body, err := io.ReadAll(ctx.Request.Body)
+    if err != nil {
+        http.Error(ctx.Writer, "Invalid callback data", http.StatusBadRequest)
+        return
+    }
+
+    if !s.verifySignature(body, ctx.Request.Header.Get(signatureHeader)) {
+        http.Error(ctx.Writer, "Invalid signature", http.StatusUnauthorized)
+        return
+    }
+
     var response RPCResponse
-    if err := json.NewDecoder(ctx.Request.Body).Decode(&response); err != nil {
-        HandleRPCError(0, "callback", "validation", err.Error(), false)
+    if err := json.Unmarshal(body, &response); err != nil {
+        s.HandleRPCError(ctx.Context, 0, "callback", "validation", err.Error(), false)
         http.Error(ctx.Writer, "Invalid callback data", http.StatusBadRequest)
         return
     }
 
-    if response.Success {
-        // Store results and mark job complete
-        _, err := ctx.Pool.PgxPool.Exec(ctx.Context,
-            "UPDATE job_queue SET status = 'completed' WHERE id = $1", response.JobID)
-        if err != nil {
-            HandleRPCError(response.JobID, "callback", "database", err.Error(), true)
+    if response.Stage == stageProgress {
+        s.reportProgress(ctx, response)
+        return
+    }
+
+    if !response.Success {
+        s.HandleRPCError(ctx.Context, response.JobID, "service_execution", "service", response.Error, false)
+        ctx.Writer.WriteHeader(http.StatusOK)
+        return
+    }
+
+    err = db.CompleteJob(s.Pool, ctx.Context, response.JobID, response.Result)
+    if err != nil {
+        if errors.Is(err, db.ErrJobNotRunning) {
+            http.Error(ctx.Writer, "Job is not running", http.StatusConflict)
             return
         }
+        s.HandleRPCError(ctx.Context, response.JobID, "callback", "database", err.Error(), true)
+        http.Error(ctx.Writer, "Failed to store result", http.StatusInternalServerError)
+        return
+    }
 
-        // Store results in history table
-        _, err = ctx.Pool.PgxPool.Exec(ctx.Context,
-            "UPDATE job_history SET result = $1 WHERE id = $2", 
-            response.Result, response.JobID)
+    s.notifyRPCStatus(s.jobOwner(ctx.Context, response.JobID), response.JobID, "completed", "", "")
+    ctx.Writer.WriteHeader(http.StatusOK)
+}
 
-        // Success notification
-        broadcastRPCStatus(response.JobID, "completed", "", "")
-    } else {
-        HandleRPCError(response.JobID, "service_execution", "service", response.Error, false)
+// reportProgress handles a progress callback from a service that is still
+// working on an asynchronous call, and streams it to the job's owner.
+func (s *Service) reportProgress(ctx *appcontext.AppContext, response RPCResponse) {
+    progress := max(0, min(response.Progress, 100))
+
+    job, err := db.UpdateJobProgress(s.Pool, ctx.Context, response.JobID, progress, response.Message)
+    if err != nil {
+        if errors.Is(err, db.ErrJobNotRunning) {
+            http.Error(ctx.Writer, "Job is not running", http.StatusConflict)
+            return
+        }
+        s.Logger.Printf("Failed to update progress of RPC job %d: %v", response.JobID, err)
+        http.Error(ctx.Writer, "Failed to store progress", http.StatusInternalServerError)
+        return
     }
 
+    if s.Hub != nil {
+        s.Hub.SendJobProgress(job.UserID, job.ID, job.Type, progress, response.Message)
+    }
     ctx.Writer.WriteHeader(http.StatusOK)
 }
 
-func broadcastRPCStatus(jobID int, status, service, method string) {
+// jobOwner looks up who enqueued a job, for notifications sent from places
+// that only know the job id. Returns "" if the job is gone.
+func (s *Service) jobOwner(ctx context.Context, jobID int) string {
+    job, err := db.GetJob(s.Pool, ctx, jobID)
+    if err != nil {
+        return ""
+    }
+    return job.UserID
+}
+
+// Sign returns the signature header value for a body, in the same
+// "sha256=<hex>" form used for webhooks.
+func Sign(secret string, body []byte) string {
+    mac := hmac.New(sha256.New, []byte(secret))
+    mac.Write(body)
+    return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func (s *Service) verifySignature(body []byte, signature string) bool {
+    if s.CallbackSecret == "" {
+        s.Logger.Println("Rejecting RPC callback: no callback secret configured")
+        return false
+    }
+    return hmac.Equal([]byte(signature), []byte(Sign(s.CallbackSecret, body)))
+}
+
+func (s *Service) notifyRPCStatus(userID string, jobID int, status, service, method string) {
+    if s.Hub == nil {
+        return
+    }
+
     notification := map[string]any{
         "type":    "rpc_status",
         "job_id":  jobID,
@@ -123,15 +385,19 @@ func broadcastRPCStatus(jobID int, status, service, method string) {
     }
 
     data, _ := json.Marshal(notification)
-    wsHub.broadcast <- data
+    s.Hub.SendToUser(userID, data)
 }
 
-func broadcastRPCError(rpcError RPCError) {
+func (s *Service) notifyRPCError(userID string, rpcError RPCError) {
+    if s.Hub == nil {
+        return
+    }
+
     notification := map[string]any{
         "type":  "rpc_error",
         "error": rpcError,
     }
 
     data, _ := json.Marshal(notification)
-    wsHub.broadcast <- data
+    s.Hub.SendToUser(userID, data)
 }
@@ -0,0 +1,66 @@
+package rpc
+
+import (
+    "context"
+    "fmt"
+
+    "gooner/db"
+)
+
+func storeRPCError(pool *db.DBPool, ctx context.Context, rpcError RPCError) error {
+    switch pool.Type {
+    case "postgres":
+        return storeRPCErrorPostgres(pool, ctx, rpcError)
+    case "sqlite3":
+        return storeRPCErrorSQLite(pool, ctx, rpcError)
+    default:
+        return fmt.Errorf("unsupported database type: %s", pool.Type)
+    }
+}
+
+func storeRPCErrorPostgres(pool *db.DBPool, ctx context.Context, rpcError RPCError) error {
+    query := `INSERT INTO rpc_errors (job_id, stage, error_type, message, retryable, created_at)
+              VALUES ($1, $2, $3, $4, $5, $6)`
+
+    _, err := pool.PgxPool.Exec(ctx, query,
+        nullableJobID(rpcError.JobID),
+        rpcError.Stage,
+        rpcError.ErrorType,
+        rpcError.Message,
+        rpcError.Retryable,
+        rpcError.Timestamp,
+    )
+    return err
+}
+
+func storeRPCErrorSQLite(pool *db.DBPool, ctx context.Context, rpcError RPCError) error {
+    writeTx, err := pool.GetWriteTx(ctx)
+    if err != nil {
+        return fmt.Errorf("failed to begin transaction: %w", err)
+    }
+    defer writeTx.Rollback()
+
+    query := `INSERT INTO rpc_errors (job_id, stage, error_type, message, retryable, created_at)
+              VALUES (?, ?, ?, ?, ?, ?)`
+
+    _, err = writeTx.ExecContext(ctx, query,
+        nullableJobID(rpcError.JobID),
+        rpcError.Stage,
+        rpcError.ErrorType,
+        rpcError.Message,
+        rpcError.Retryable,
+        rpcError.Timestamp.UTC(),
+    )
+    if err != nil {
+        return err
+    }
+
+    return writeTx.Commit()
+}
+
+func nullableJobID(jobID int) any {
+    if jobID == 0 {
+        return nil
+    }
+    return jobID
+}
@@ -0,0 +1,46 @@
+package rpc
+
+import (
+    "encoding/binary"
+    "fmt"
+    "io"
+)
+
+// Stdio and unix socket workers exchange frames: a 4-byte big-endian length
+// followed by that many bytes of JSON (an RPCRequest going out, an
+// RPCResponse coming back).
+
+const maxFrameSize = 16 << 20 // 16MB
+
+func WriteFrame(w io.Writer, data []byte) error {
+    if len(data) > maxFrameSize {
+        return fmt.Errorf("frame too large: %d bytes", len(data))
+    }
+
+    var header [4]byte
+    binary.BigEndian.PutUint32(header[:], uint32(len(data)))
+
+    if _, err := w.Write(header[:]); err != nil {
+        return err
+    }
+    _, err := w.Write(data)
+    return err
+}
+
+func ReadFrame(r io.Reader) ([]byte, error) {
+    var header [4]byte
+    if _, err := io.ReadFull(r, header[:]); err != nil {
+        return nil, err
+    }
+
+    size := binary.BigEndian.Uint32(header[:])
+    if size > maxFrameSize {
+        return nil, fmt.Errorf("frame too large: %d bytes", size)
+    }
+
+    data := make([]byte, size)
+    if _, err := io.ReadFull(r, data); err != nil {
+        return nil, err
+    }
+    return data, nil
+}
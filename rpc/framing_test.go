@@ -0,0 +1,73 @@
+package rpc
+
+import (
+    "bytes"
+    "encoding/binary"
+    "io"
+    "strings"
+    "testing"
+)
+
+func TestFrameRoundTrip(t *testing.T) {
+    var buf bytes.Buffer
+    frames := [][]byte{
+        []byte(`{"job_id":1}`),
+        {},
+        []byte(strings.Repeat("x", 1<<16)),
+    }
+
+    for _, frame := range frames {
+        if err := WriteFrame(&buf, frame); err != nil {
+            t.Fatal(err)
+        }
+    }
+    for _, want := range frames {
+        got, err := ReadFrame(&buf)
+        if err != nil {
+            t.Fatal(err)
+        }
+        if !bytes.Equal(got, want) {
+            t.Fatalf("got %d bytes, want %d", len(got), len(want))
+        }
+    }
+
+    if _, err := ReadFrame(&buf); err != io.EOF {
+        t.Fatalf("expected io.EOF after the last frame, got %v", err)
+    }
+}
+
+func TestWriteFrameTooLarge(t *testing.T) {
+    var buf bytes.Buffer
+    if err := WriteFrame(&buf, make([]byte, maxFrameSize+1)); err == nil {
+        t.Fatal("expected an error for an oversized frame")
+    }
+    if buf.Len() != 0 {
+        t.Fatalf("%d bytes written for a rejected frame", buf.Len())
+    }
+}
+
+func TestReadFrameTooLarge(t *testing.T) {
+    var header [4]byte
+    binary.BigEndian.PutUint32(header[:], maxFrameSize+1)
+
+    if _, err := ReadFrame(bytes.NewReader(header[:])); err == nil {
+        t.Fatal("expected an error for an oversized frame")
+    }
+}
+
+func TestReadFrameTruncated(t *testing.T) {
+    var buf bytes.Buffer
+    if err := WriteFrame(&buf, []byte(`{"job_id":1}`)); err != nil {
+        t.Fatal(err)
+    }
+
+    tests := map[string][]byte{
+        "header": buf.Bytes()[:2],
+        "body":   buf.Bytes()[:buf.Len()-1],
+    }
+    for name, data := range tests {
+        if _, err := ReadFrame(bytes.NewReader(data)); err != io.ErrUnexpectedEOF {
+            t.Errorf("%s: expected io.ErrUnexpectedEOF, got %v", name, err)
+        }
+    }
+}
@@ -1,5 +1,13 @@
 package rpc
 
+import (
+    "context"
+    "time"
+
+    "gooner/db"
+    "gooner/jobs"
+)
+
 type RPCError struct {
     JobID     int       `json:"job_id"`
     Stage     string    `json:"stage"`        // "job_creation", "service_call", "callback", "timeout"
@@ -9,7 +17,7 @@ type RPCError struct {
     Retryable bool      `json:"retryable"`
 }
 
-func HandleRPCError(jobID int, stage, errorType, message string, retryable bool) {
+func (s *Service) HandleRPCError(ctx context.Context, jobID int, stage, errorType, message string, retryable bool) {
     rpcError := RPCError{
         JobID:     jobID,
         Stage:     stage,
@@ -19,13 +27,58 @@ func HandleRPCError(jobID int, stage, errorType, message string, retryable bool)
         Retryable: retryable,
     }
 
-    logRPCError(rpcError)                    // Structured logging
-    storeRPCError(rpcError)                  // Database for audit
-    broadcastRPCError(rpcError)              // WebSocket for real-time UI
+    // before a job exists the caller is the one to tell
+    userID, _ := ctx.Value("userID").(string)
+    if jobID != 0 {
+        userID = s.jobOwner(ctx, jobID)
+    }
+
+    s.logRPCError(rpcError)                    // Structured logging
+    s.storeRPCError(ctx, rpcError)             // Database for audit
+    s.notifyRPCError(userID, rpcError)         // WebSocket for real-time UI
+
+    // errors before a job exists (or with an unknown job) have nothing to update
+    if jobID == 0 {
+        return
+    }
 
     if retryable {
-        scheduleRPCRetry(jobID)
+        s.scheduleRPCRetry(ctx, userID, jobID, message)
     } else {
-        markJobFailed(jobID, message)
+        s.markJobFailed(ctx, userID, jobID, message)
+    }
+}
+
+func (s *Service) logRPCError(rpcError RPCError) {
+    s.Logger.Printf("RPC error: job=%d stage=%s type=%s retryable=%t message=%q",
+        rpcError.JobID, rpcError.Stage, rpcError.ErrorType, rpcError.Retryable, rpcError.Message)
+}
+
+func (s *Service) storeRPCError(ctx context.Context, rpcError RPCError) {
+    if err := storeRPCError(s.Pool, ctx, rpcError); err != nil {
+        s.Logger.Printf("Failed to store RPC error for job %d: %v", rpcError.JobID, err)
     }
 }
+
+func (s *Service) scheduleRPCRetry(ctx context.Context, userID string, jobID int, message string) {
+    retried, err := jobs.Retry(s.Pool, ctx, jobID, message)
+    if err != nil {
+        s.Logger.Printf("Failed to schedule retry for RPC job %d: %v", jobID, err)
+        return
+    }
+
+    if retried {
+        s.notifyRPCStatus(userID, jobID, "retrying", "", "")
+    } else {
+        s.notifyRPCStatus(userID, jobID, db.JobStatusDeadLetter, "", "")
+    }
+}
+
+func (s *Service) markJobFailed(ctx context.Context, userID string, jobID int, message string) {
+    if err := db.FailJob(s.Pool, ctx, jobID, message); err != nil {
+        s.Logger.Printf("Failed to mark RPC job %d failed: %v", jobID, err)
+        return
+    }
+
+    s.notifyRPCStatus(userID, jobID, "failed", "", "")
+}
@@ -0,0 +1,248 @@
+package rpc
+
+import (
+    "bufio"
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "log"
+    "os"
+    "os/exec"
+    "sync"
+    "time"
+)
+
+var errWorkerExited = errors.New("stdio worker exited")
+
+const stdioStopTimeout = 5 * time.Second
+
+// StdioTransport keeps one long-lived subprocess and talks to it over
+// stdin/stdout frames. Responses are matched to calls by job_id, so several
+// calls can be in flight. The process is restarted on the next call if it dies.
+type StdioTransport struct {
+    Command []string
+    Logger  *log.Logger
+
+    mu   sync.Mutex
+    proc *stdioProcess
+}
+
+type stdioProcess struct {
+    cmd   *exec.Cmd
+    stdin io.WriteCloser
+
+    writeMu sync.Mutex
+    mu      sync.Mutex
+    pending map[int]chan *RPCResponse
+    exited  bool
+    done    chan struct{}
+}
+
+func NewStdioTransport(command []string, logger *log.Logger) *StdioTransport {
+    return &StdioTransport{Command: command, Logger: logger}
+}
+
+func newStdioTransportFromConfig(cfg TransportConfig) (Transport, error) {
+    if len(cfg.Command) == 0 {
+        return nil, fmt.Errorf("service %s: stdio transport requires command", cfg.Name)
+    }
+    return NewStdioTransport(cfg.Command, cfg.Logger), nil
+}
+
+func (t *StdioTransport) Call(ctx context.Context, req RPCRequest) (*RPCResponse, error) {
+    proc, err := t.process()
+    if err != nil {
+        return nil, err
+    }
+
+    body, err := json.Marshal(req)
+    if err != nil {
+        return nil, fmt.Errorf("failed to encode RPC request: %w", err)
+    }
+
+    ch, err := proc.expect(req.JobID)
+    if err != nil {
+        return nil, err
+    }
+    defer proc.forget(req.JobID)
+
+    if err := proc.write(ctx, body); err != nil {
+        return nil, err
+    }
+
+    select {
+    case response := <-ch:
+        if response == nil {
+            return nil, errWorkerExited
+        }
+        return response, nil
+    case <-ctx.Done():
+        return nil, ctx.Err()
+    }
+}
+
+// Close asks the subprocess to stop by closing its stdin, and kills it if
+// it has not exited after a grace period.
+func (t *StdioTransport) Close() error {
+    t.mu.Lock()
+    proc := t.proc
+    t.proc = nil
+    t.mu.Unlock()
+
+    if proc == nil {
+        return nil
+    }
+    proc.stdin.Close()
+
+    select {
+    case <-proc.done:
+        return nil
+    case <-time.After(stdioStopTimeout):
+        proc.cmd.Process.Kill()
+        <-proc.done
+        return fmt.Errorf("stdio worker %v killed after %s", t.Command, stdioStopTimeout)
+    }
+}
+
+func (t *StdioTransport) process() (*stdioProcess, error) {
+    t.mu.Lock()
+    defer t.mu.Unlock()
+
+    if t.proc != nil && !t.proc.isExited() {
+        return t.proc, nil
+    }
+
+    cmd := exec.Command(t.Command[0], t.Command[1:]...)
+    cmd.Stderr = os.Stderr
+
+    stdin, err := cmd.StdinPipe()
+    if err != nil {
+        return nil, err
+    }
+    stdout, err := cmd.StdoutPipe()
+    if err != nil {
+        return nil, err
+    }
+
+    if err := cmd.Start(); err != nil {
+        return nil, fmt.Errorf("failed to start stdio worker %v: %w", t.Command, err)
+    }
+
+    proc := &stdioProcess{
+        cmd:     cmd,
+        stdin:   stdin,
+        pending: make(map[int]chan *RPCResponse),
+        done:    make(chan struct{}),
+    }
+    go proc.readLoop(bufio.NewReader(stdout), t.Logger)
+
+    t.proc = proc
+    return proc, nil
+}
+
+func (p *stdioProcess) readLoop(stdout io.Reader, logger *log.Logger) {
+    var readErr error
+    for {
+        frame, err := ReadFrame(stdout)
+        if err != nil {
+            if err != io.EOF {
+                readErr = err
+                if logger != nil {
+                    logger.Printf("stdio worker read failed: %v", err)
+                }
+            }
+            break
+        }
+
+        var response RPCResponse
+        if err := json.Unmarshal(frame, &response); err != nil {
+            if logger != nil {
+                logger.Printf("stdio worker sent invalid response: %v", err)
+            }
+            continue
+        }
+
+        p.mu.Lock()
+        ch, ok := p.pending[response.JobID]
+        p.mu.Unlock()
+        if ok {
+            select {
+            case ch <- &response:
+            default: // duplicate response for the same call
+            }
+        }
+    }
+
+    p.mu.Lock()
+    p.exited = true
+    for jobID, ch := range p.pending {
+        close(ch)
+        delete(p.pending, jobID)
+    }
+    p.mu.Unlock()
+
+    // nothing reads stdout anymore, so a worker that is still running would
+    // block on its next write and never exit
+    if readErr != nil {
+        p.cmd.Process.Kill()
+    }
+    p.cmd.Wait()
+    close(p.done)
+}
+
+// write sends one frame. A worker that stops reading stdin would block the
+// write, and every call queued behind it, forever, so it is killed once ctx
+// expires; the next call starts a fresh process.
+func (p *stdioProcess) write(ctx context.Context, body []byte) error {
+    written := make(chan error, 1)
+    go func() {
+        p.writeMu.Lock()
+        defer p.writeMu.Unlock()
+        written <- WriteFrame(p.stdin, body)
+    }()
+
+    select {
+    case err := <-written:
+        if err != nil {
+            return fmt.Errorf("failed to write to stdio worker: %w", err)
+        }
+        return nil
+    case <-ctx.Done():
+        select {
+        case <-written: // the frame went out as ctx expired
+        default:
+            p.cmd.Process.Kill()
+        }
+        return ctx.Err()
+    }
+}
+
+func (p *stdioProcess) expect(jobID int) (chan *RPCResponse, error) {
+    p.mu.Lock()
+    defer p.mu.Unlock()
+
+    if p.exited {
+        return nil, errWorkerExited
+    }
+    if _, busy := p.pending[jobID]; busy {
+        return nil, fmt.Errorf("job %d already has a call in flight", jobID)
+    }
+
+    ch := make(chan *RPCResponse, 1)
+    p.pending[jobID] = ch
+    return ch, nil
+}
+
+func (p *stdioProcess) forget(jobID int) {
+    p.mu.Lock()
+    defer p.mu.Unlock()
+    delete(p.pending, jobID)
+}
+
+func (p *stdioProcess) isExited() bool {
+    p.mu.Lock()
+    defer p.mu.Unlock()
+    return p.exited
+}
@@ -0,0 +1,135 @@
+package rpc
+
+import (
+    "bytes"
+    "context"
+    "encoding/json"
+    "fmt"
+    "io"
+    "log"
+    "net/http"
+    "sort"
+    "sync"
+)
+
+// Transport delivers a request to an external service. A nil response with
+// a nil error means the service accepted the call and will answer through
+// the callback URL.
+type Transport interface {
+    Call(ctx context.Context, req RPCRequest) (*RPCResponse, error)
+}
+
+// TransportConfig describes one service entry from config.yaml. Secret,
+// Client and Logger are filled in by the Service, not read from YAML.
+type TransportConfig struct {
+    Name      string
+    Transport string   // "http", "stdio", "unix"
+    URL       string   // http
+    Command   []string // stdio
+    Socket    string   // unix
+
+    Secret string
+    Client *http.Client
+    Logger *log.Logger
+}
+
+type TransportFactory func(cfg TransportConfig) (Transport, error)
+
+var (
+    factoriesMu sync.RWMutex
+    factories   = map[string]TransportFactory{
+        "http":  newHTTPTransportFromConfig,
+        "stdio": newStdioTransportFromConfig,
+        "unix":  newUnixTransportFromConfig,
+    }
+)
+
+// RegisterTransportKind makes a transport kind available to config.yaml.
+func RegisterTransportKind(kind string, factory TransportFactory) {
+    factoriesMu.Lock()
+    defer factoriesMu.Unlock()
+    factories[kind] = factory
+}
+
+func TransportKinds() []string {
+    factoriesMu.RLock()
+    defer factoriesMu.RUnlock()
+
+    kinds := make([]string, 0, len(factories))
+    for kind := range factories {
+        kinds = append(kinds, kind)
+    }
+    sort.Strings(kinds)
+    return kinds
+}
+
+func NewTransport(cfg TransportConfig) (Transport, error) {
+    factoriesMu.RLock()
+    factory, ok := factories[cfg.Transport]
+    factoriesMu.RUnlock()
+
+    if !ok {
+        return nil, fmt.Errorf("service %s: unknown transport %q (available: %v)", cfg.Name, cfg.Transport, TransportKinds())
+    }
+    return factory(cfg)
+}
+
+// HTTPTransport POSTs the request as JSON. A 200 response carries an
+// RPCResponse; 202 Accepted means the result arrives via callback.
+type HTTPTransport struct {
+    URL    string
+    Secret string
+    Client *http.Client
+}
+
+func NewHTTPTransport(url, secret string, client *http.Client) *HTTPTransport {
+    if client == nil {
+        client = http.DefaultClient
+    }
+    return &HTTPTransport{URL: url, Secret: secret, Client: client}
+}
+
+func newHTTPTransportFromConfig(cfg TransportConfig) (Transport, error) {
+    if cfg.URL == "" {
+        return nil, fmt.Errorf("service %s: http transport requires url", cfg.Name)
+    }
+    return NewHTTPTransport(cfg.URL, cfg.Secret, cfg.Client), nil
+}
+
+func (t *HTTPTransport) Call(ctx context.Context, req RPCRequest) (*RPCResponse, error) {
+    body, err := json.Marshal(req)
+    if err != nil {
+        return nil, fmt.Errorf("failed to encode RPC request: %w", err)
+    }
+
+    httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, t.URL, bytes.NewReader(body))
+    if err != nil {
+        return nil, err
+    }
+    httpReq.Header.Set("Content-Type", "application/json")
+    if t.Secret != "" {
+        httpReq.Header.Set(signatureHeader, Sign(t.Secret, body))
+    }
+
+    resp, err := t.Client.Do(httpReq)
+    if err != nil {
+        return nil, err
+    }
+    defer resp.Body.Close()
+
+    switch resp.StatusCode {
+    case http.StatusAccepted:
+        io.Copy(io.Discard, resp.Body)
+        return nil, nil
+    case http.StatusOK:
+        var response RPCResponse
+        if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+            return nil, fmt.Errorf("invalid RPC response: %w", err)
+        }
+        response.JobID = req.JobID
+        return &response, nil
+    default:
+        msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+        return nil, fmt.Errorf("service returned %s: %s", resp.Status, bytes.TrimSpace(msg))
+    }
+}
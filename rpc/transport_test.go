@@ -0,0 +1,139 @@
+package rpc
+
+import (
+    "bytes"
+    "context"
+    "errors"
+    "fmt"
+    "os"
+    "os/exec"
+    "path/filepath"
+    "strings"
+    "testing"
+    "time"
+)
+
+// rpcecho is built once per test run; the transports are exercised against
+// the same binary that developers use by hand.
+var rpcecho string
+
+func TestMain(m *testing.M) {
+    dir, err := os.MkdirTemp("", "rpcecho")
+    if err != nil {
+        fmt.Fprintln(os.Stderr, err)
+        os.Exit(1)
+    }
+
+    rpcecho = filepath.Join(dir, "rpcecho")
+    build := exec.Command("go", "build", "-o", rpcecho, "gooner/cmd/rpcecho")
+    build.Stderr = os.Stderr
+    if err := build.Run(); err != nil {
+        fmt.Fprintf(os.Stderr, "failed to build rpcecho: %v\n", err)
+        os.RemoveAll(dir)
+        os.Exit(1)
+    }
+
+    code := m.Run()
+    os.RemoveAll(dir)
+    os.Exit(code)
+}
+
+func callEcho(t *testing.T, transport Transport, jobID int, payload []byte) {
+    t.Helper()
+
+    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    defer cancel()
+
+    response, err := transport.Call(ctx, RPCRequest{JobID: jobID, Service: "echo", Method: "echo", Payload: payload})
+    if err != nil {
+        t.Fatal(err)
+    }
+    if response.JobID != jobID || !response.Success || !bytes.Equal(response.Result, payload) {
+        t.Fatalf("unexpected response for job %d: %+v", jobID, response)
+    }
+}
+
+func TestStdioTransport(t *testing.T) {
+    transport := NewStdioTransport([]string{rpcecho, "-mode", "stdio"}, nil)
+    defer transport.Close()
+
+    // concurrent calls share the process and are matched by job_id
+    errs := make(chan error, 10)
+    for i := 1; i <= cap(errs); i++ {
+        go func(jobID int) {
+            payload := []byte(fmt.Sprintf(`{"n":%d}`, jobID))
+            response, err := transport.Call(context.Background(), RPCRequest{JobID: jobID, Payload: payload})
+            if err == nil && !bytes.Equal(response.Result, payload) {
+                err = fmt.Errorf("job %d got result %s", jobID, response.Result)
+            }
+            errs <- err
+        }(i)
+    }
+    for i := 0; i < cap(errs); i++ {
+        if err := <-errs; err != nil {
+            t.Fatal(err)
+        }
+    }
+
+    // a worker that died is restarted by the next call
+    transport.mu.Lock()
+    transport.proc.cmd.Process.Kill()
+    <-transport.proc.done
+    transport.mu.Unlock()
+
+    callEcho(t, transport, 100, []byte(`{"after":"restart"}`))
+}
+
+func TestStdioTransportStuckWorker(t *testing.T) {
+    // sleep never reads stdin, so a request larger than the pipe buffer
+    // blocks the write until the call gives up
+    transport := NewStdioTransport([]string{"sleep", "60"}, nil)
+    defer transport.Close()
+
+    ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+    defer cancel()
+
+    start := time.Now()
+    payload := []byte(`"` + strings.Repeat("x", 1<<20) + `"`)
+    _, err := transport.Call(ctx, RPCRequest{JobID: 1, Payload: payload})
+    if !errors.Is(err, context.DeadlineExceeded) {
+        t.Fatalf("expected context.DeadlineExceeded, got %v", err)
+    }
+    if elapsed := time.Since(start); elapsed > 5*time.Second {
+        t.Fatalf("call took %s to give up", elapsed)
+    }
+
+    select {
+    case <-transport.proc.done:
+    case <-time.After(5 * time.Second):
+        t.Fatal("stuck worker was not killed")
+    }
+}
+
+func TestUnixTransport(t *testing.T) {
+    socket := filepath.Join(t.TempDir(), "worker.sock")
+
+    worker := exec.Command(rpcecho, "-mode", "unix", "-socket", socket)
+    if err := worker.Start(); err != nil {
+        t.Fatal(err)
+    }
+    defer func() {
+        worker.Process.Kill()
+        worker.Wait()
+    }()
+
+    deadline := time.Now().Add(10 * time.Second)
+    for {
+        if _, err := os.Stat(socket); err == nil {
+            break
+        }
+        if time.Now().After(deadline) {
+            t.Fatal("rpcecho did not create its socket")
+        }
+        time.Sleep(10 * time.Millisecond)
+    }
+
+    transport := NewUnixTransport(socket)
+    callEcho(t, transport, 1, []byte(`{"hello":"world"}`))
+    callEcho(t, transport, 2, []byte(`"`+strings.Repeat("x", 1<<20)+`"`))
+}
@@ -0,0 +1,59 @@
+package rpc
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+    "net"
+)
+
+// UnixTransport dials the worker's socket for every call and exchanges a
+// single request/response frame pair on the connection.
+type UnixTransport struct {
+    Socket string
+}
+
+func NewUnixTransport(socket string) *UnixTransport {
+    return &UnixTransport{Socket: socket}
+}
+
+func newUnixTransportFromConfig(cfg TransportConfig) (Transport, error) {
+    if cfg.Socket == "" {
+        return nil, fmt.Errorf("service %s: unix transport requires socket", cfg.Name)
+    }
+    return NewUnixTransport(cfg.Socket), nil
+}
+
+func (t *UnixTransport) Call(ctx context.Context, req RPCRequest) (*RPCResponse, error) {
+    body, err := json.Marshal(req)
+    if err != nil {
+        return nil, fmt.Errorf("failed to encode RPC request: %w", err)
+    }
+
+    var dialer net.Dialer
+    conn, err := dialer.DialContext(ctx, "unix", t.Socket)
+    if err != nil {
+        return nil, err
+    }
+    defer conn.Close()
+
+    if deadline, ok := ctx.Deadline(); ok {
+        conn.SetDeadline(deadline)
+    }
+
+    if err := WriteFrame(conn, body); err != nil {
+        return nil, err
+    }
+
+    frame, err := ReadFrame(conn)
+    if err != nil {
+        return nil, err
+    }
+
+    var response RPCResponse
+    if err := json.Unmarshal(frame, &response); err != nil {
+        return nil, fmt.Errorf("invalid RPC response: %w", err)
+    }
+    response.JobID = req.JobID
+    return &response, nil
+}
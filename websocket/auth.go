@@ -0,0 +1,194 @@
+package websocket
+
+import (
+    "encoding/json"
+    "errors"
+    "net/http"
+    "net/url"
+    "strings"
+    "sync"
+    "time"
+
+    "gooner/appcontext"
+    "gooner/auth"
+)
+
+const (
+    defaultTicketTTL      = 30 * time.Second
+    defaultSendBuffer     = 256
+    defaultMaxMessageSize = 64 * 1024
+    defaultWriteWait      = 10 * time.Second
+    defaultPongWait       = 60 * time.Second
+)
+
+// HandlerConfig controls who may open a socket and how connections are
+// kept. Connections authenticate with the AuthToken cookie or with a ticket
+// from TicketHandler passed as ?ticket=. Browsers may only connect from
+// AllowedOrigins; with none configured the Origin must match the Host. "*"
+// allows any origin.
+//
+// The server pings every PingInterval (9/10 of PongWait by default) and
+// drops connections that have not answered within PongWait. Zero values
+// use the defaults.
+type HandlerConfig struct {
+    JWTSecret      string
+    AllowedOrigins []string
+    TicketTTL      time.Duration
+
+    SendBuffer     int                // messages queued per connection
+    SlowConsumer   SlowConsumerPolicy // what to do when the queue is full
+    MaxMessageSize int64              // largest message a client may send
+    WriteWait      time.Duration
+    PongWait       time.Duration
+    PingInterval   time.Duration
+}
+
+func (c HandlerConfig) sendBuffer() int {
+    if c.SendBuffer <= 0 {
+        return defaultSendBuffer
+    }
+    return c.SendBuffer
+}
+
+func (c HandlerConfig) maxMessageSize() int64 {
+    if c.MaxMessageSize <= 0 {
+        return defaultMaxMessageSize
+    }
+    return c.MaxMessageSize
+}
+
+func (c HandlerConfig) writeWait() time.Duration {
+    if c.WriteWait <= 0 {
+        return defaultWriteWait
+    }
+    return c.WriteWait
+}
+
+func (c HandlerConfig) pongWait() time.Duration {
+    if c.PongWait <= 0 {
+        return defaultPongWait
+    }
+    return c.PongWait
+}
+
+// pingInterval has to be shorter than pongWait, or every connection would
+// time out between two pings.
+func (c HandlerConfig) pingInterval() time.Duration {
+    if c.PingInterval <= 0 || c.PingInterval >= c.pongWait() {
+        return c.pongWait() * 9 / 10
+    }
+    return c.PingInterval
+}
+
+var errNoCredentials = errors.New("no credentials")
+
+func (c HandlerConfig) checkOrigin(r *http.Request) bool {
+    origin := r.Header.Get("Origin")
+    if origin == "" {
+        return true // not a browser
+    }
+
+    if len(c.AllowedOrigins) == 0 {
+        u, err := url.Parse(origin)
+        return err == nil && strings.EqualFold(u.Host, r.Host)
+    }
+
+    for _, allowed := range c.AllowedOrigins {
+        if allowed == "*" || strings.EqualFold(strings.TrimSuffix(allowed, "/"), origin) {
+            return true
+        }
+    }
+    return false
+}
+
+// authenticate returns the user a connection belongs to. A ticket wins over
+// the cookie, since it was asked for explicitly.
+func (c HandlerConfig) authenticate(r *http.Request, used *ticketCache) (string, error) {
+    if token := r.URL.Query().Get("ticket"); token != "" {
+        ticket, err := auth.VerifyTicket(token)
+        if err != nil {
+            return "", err
+        }
+        if !used.consume(ticket.Nonce, time.Unix(ticket.Exp, 0)) {
+            return "", errors.New("ticket already used")
+        }
+        return ticket.Sub, nil
+    }
+
+    cookie, err := r.Cookie("AuthToken")
+    if err != nil || cookie.Value == "" {
+        return "", errNoCredentials
+    }
+
+    payload, err := auth.VerifyPayload(c.JWTSecret, cookie.Value)
+    if err != nil {
+        return "", err
+    }
+    return payload.Sub, nil
+}
+
+// ticketCache remembers the nonces of tickets already traded in until they
+// expire. It is per process, so with several instances behind a load
+// balancer a ticket could be replayed once per instance within its TTL.
+type ticketCache struct {
+    mu     sync.Mutex
+    nonces map[string]time.Time
+}
+
+func newTicketCache() *ticketCache {
+    return &ticketCache{nonces: make(map[string]time.Time)}
+}
+
+func (t *ticketCache) consume(nonce string, expires time.Time) bool {
+    t.mu.Lock()
+    defer t.mu.Unlock()
+
+    now := time.Now()
+    for n, exp := range t.nonces {
+        if now.After(exp) {
+            delete(t.nonces, n)
+        }
+    }
+
+    if _, used := t.nonces[nonce]; used {
+        return false
+    }
+    t.nonces[nonce] = expires
+    return true
+}
+
+type TicketResponse struct {
+    Ticket    string    `json:"ticket"`
+    ExpiresAt time.Time `json:"expires_at"`
+}
+
+// TicketHandler issues a single-use ticket for opening a socket to the
+// signed in user.
+func TicketHandler(config HandlerConfig) func(*appcontext.AppContext) {
+    ttl := config.TicketTTL
+    if ttl <= 0 {
+        ttl = defaultTicketTTL
+    }
+
+    return func(ctx *appcontext.AppContext) {
+        userID, ok := ctx.Context.Value("userID").(string)
+        if !ok {
+            http.Error(ctx.Writer, "Unauthorized", http.StatusUnauthorized)
+            return
+        }
+
+        token, ticket, err := auth.NewTicket(userID, ttl)
+        if err != nil {
+            ctx.Logger.Printf("Failed to issue WebSocket ticket: %v", err)
+            http.Error(ctx.Writer, "Failed to issue ticket", http.StatusInternalServerError)
+            return
+        }
+
+        ctx.Writer.Header().Set("Content-Type", "application/json")
+        ctx.Writer.Header().Set("Cache-Control", "no-store")
+        json.NewEncoder(ctx.Writer).Encode(TicketResponse{
+            Ticket:    token,
+            ExpiresAt: time.Unix(ticket.Exp, 0).UTC(),
+        })
+    }
+}
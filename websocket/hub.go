@@ -2,45 +2,83 @@ package websocket
 
 import (
     "encoding/json"
+    "errors"
     "log"
     "net/http"
+    "time"
+
     "github.com/gorilla/websocket"
     "gooner/appcontext"
 )
 
-var upgrader = websocket.Upgrader{
-    ReadBufferSize:  1024,
-    WriteBufferSize: 1024,
-    CheckOrigin: func(r *http.Request) bool {
-        return true // Configure properly for production
-    },
-}
-
+// Hub owns all connections. Its state is only touched by Run, everything
+// else talks to it through channels.
 type Hub struct {
     clients    map[*Client]bool
-    broadcast  chan []byte
+    users      map[string]map[*Client]bool
+    topics     map[string]map[*Client]bool
+    direct     chan envelope
     register   chan *Client
     unregister chan *Client
+    requests   chan clientRequest
+
+    authorizers map[string]TopicAuthorizer
+    actions     map[string]ActionHandler
+    relay       *Relay
+
+    presence        map[string]PresenceHandler
+    presenceChanges chan presenceChange
 }
 
 type Client struct {
-    hub  *Hub
-    conn *websocket.Conn
-    send chan []byte
+    hub    *Hub
+    conn   *websocket.Conn
+    send   *outbox
+    userID string
+    topics map[string]bool // only used by Run
+
+    writeWait    time.Duration
+    pongWait     time.Duration
+    pingInterval time.Duration
+}
+
+// envelope is a message for everyone, or for one user's connections
+// and/or the subscribers of one topic. Each client gets it at most once.
+// Messages with the same key supersede each other under the Coalesce
+// policy. With unsubscribe set, the user's connections are taken off the
+// topic and told so with data instead.
+type envelope struct {
+    all         bool
+    unsubscribe bool
+    userID      string
+    topic       string
+    key         string
+    data        []byte
 }
 
+// JobNotification tells a job's owner about a status change ("job_status")
+// or progress reported by its handler ("job_progress").
 type JobNotification struct {
-    JobID  int    `json:"job_id"`
-    Status string `json:"status"`
-    Type   string `json:"type"`
+    Type     string `json:"type"`
+    JobID    int    `json:"job_id"`
+    JobType  string `json:"job_type"`
+    Status   string `json:"status,omitempty"`
+    Progress *int   `json:"progress,omitempty"`
+    Message  string `json:"message,omitempty"`
 }
 
 func NewHub() *Hub {
     return &Hub{
-        clients:    make(map[*Client]bool),
-        broadcast:  make(chan []byte),
-        register:   make(chan *Client),
-        unregister: make(chan *Client),
+        clients:     make(map[*Client]bool),
+        users:       make(map[string]map[*Client]bool),
+        topics:      make(map[string]map[*Client]bool),
+        direct:      make(chan envelope),
+        register:    make(chan *Client),
+        unregister:  make(chan *Client),
+        requests:    make(chan clientRequest),
+        authorizers: make(map[string]TopicAuthorizer),
+        actions:     make(map[string]ActionHandler),
+        presence:    make(map[string]PresenceHandler),
     }
 }
 
@@ -49,41 +87,167 @@ func (h *Hub) Run() {
         select {
         case client := <-h.register:
             h.clients[client] = true
+            if client.userID != "" {
+                if h.users[client.userID] == nil {
+                    h.users[client.userID] = make(map[*Client]bool)
+                }
+                h.users[client.userID][client] = true
+            }
             log.Printf("Client connected. Total: %d", len(h.clients))
 
         case client := <-h.unregister:
             if _, ok := h.clients[client]; ok {
-                delete(h.clients, client)
-                close(client.send)
+                h.remove(client)
                 log.Printf("Client disconnected. Total: %d", len(h.clients))
             }
 
-        case message := <-h.broadcast:
-            for client := range h.clients {
-                select {
-                case client.send <- message:
-                default:
-                    close(client.send)
-                    delete(h.clients, client)
+        case message := <-h.direct:
+            out := outMessage{key: message.key, data: message.data}
+            if message.unsubscribe {
+                for client := range h.users[message.userID] {
+                    if client.topics[message.topic] {
+                        h.leave(client, message.topic)
+                        h.deliver(client, out)
+                    }
                 }
+                continue
             }
+            if message.all {
+                for client := range h.clients {
+                    h.deliver(client, out)
+                }
+                continue
+            }
+            for client := range h.users[message.userID] {
+                h.deliver(client, out)
+            }
+            for client := range h.topics[message.topic] {
+                if message.userID == "" || client.userID != message.userID {
+                    h.deliver(client, out)
+                }
+            }
+
+        case req := <-h.requests:
+            h.handleRequest(req)
         }
     }
 }
 
-func (h *Hub) BroadcastJobCompletion(jobID int, status, jobType string) {
-    notification := JobNotification{
-        JobID:  jobID,
-        Status: status,
-        Type:   jobType,
+// deliver queues a message for a client. What happens when the client's
+// outbox is full depends on its SlowConsumerPolicy; clients that have to
+// go are removed here and disconnected by their write goroutine.
+func (h *Hub) deliver(client *Client, message outMessage) {
+    if !client.send.push(message) {
+        log.Printf("Disconnecting slow WebSocket client of user %q", client.userID)
+        h.remove(client)
+    }
+}
+
+func (h *Hub) remove(client *Client) {
+    if !h.clients[client] {
+        return
+    }
+    delete(h.clients, client)
+    if conns := h.users[client.userID]; conns != nil {
+        delete(conns, client)
+        if len(conns) == 0 {
+            delete(h.users, client.userID)
+        }
+    }
+    for topic := range client.topics {
+        h.leave(client, topic)
+    }
+    client.send.close()
+}
+
+// send delivers a message to the clients of this instance and, with a
+// Relay, to those of every other instance.
+func (h *Hub) send(message envelope) {
+    h.direct <- message
+    if h.relay != nil {
+        h.relay.publish(message)
+    }
+}
+
+// Broadcast sends a raw message to every connected client.
+func (h *Hub) Broadcast(data []byte) {
+    h.send(envelope{all: true, data: data})
+}
+
+// Publish sends a raw message to the subscribers of a topic.
+func (h *Hub) Publish(topic string, data []byte) {
+    h.send(envelope{topic: topic, data: data})
+}
+
+// SendToUser sends a raw message to every connection of one user.
+func (h *Hub) SendToUser(userID string, data []byte) {
+    if userID == "" {
+        return
+    }
+    h.send(envelope{userID: userID, data: data})
+}
+
+// Unsubscribe takes all connections of a user off a topic, e.g. when they
+// lose access to it, and sends them {"type": "unsubscribed", "topic": ...}.
+func (h *Hub) Unsubscribe(userID, topic string) {
+    if userID == "" {
+        return
     }
+    data, _ := json.Marshal(ServerReply{Type: "unsubscribed", Topic: topic})
+    h.send(envelope{unsubscribe: true, userID: userID, topic: topic, data: data})
+}
+
+// SendJobStatus notifies the owner of a job, and anyone subscribed to its
+// JobTopic, that its status changed.
+func (h *Hub) SendJobStatus(userID string, jobID int, jobType, status string) {
+    data, _ := json.Marshal(JobNotification{
+        Type:    "job_status",
+        JobID:   jobID,
+        JobType: jobType,
+        Status:  status,
+    })
+    h.send(envelope{userID: userID, topic: JobTopic(jobID), data: data})
+}
 
-    data, _ := json.Marshal(notification)
-    h.broadcast <- data
+// SendJobProgress notifies the owner of a running job, and subscribers of
+// its JobTopic, of its progress.
+func (h *Hub) SendJobProgress(userID string, jobID int, jobType string, progress int, message string) {
+    data, _ := json.Marshal(JobNotification{
+        Type:     "job_progress",
+        JobID:    jobID,
+        JobType:  jobType,
+        Progress: &progress,
+        Message:  message,
+    })
+    h.send(envelope{userID: userID, topic: JobTopic(jobID), key: "job_progress:" + JobTopic(jobID), data: data})
 }
 
-func WebSocketHandler(hub *Hub) func(*appcontext.AppContext) {
+// WebSocketHandler upgrades authenticated requests from allowed origins.
+// The route must be public in the session middleware, since tickets are
+// checked here rather than there.
+func WebSocketHandler(hub *Hub, config HandlerConfig) func(*appcontext.AppContext) {
+    upgrader := websocket.Upgrader{
+        ReadBufferSize:  1024,
+        WriteBufferSize: 1024,
+        CheckOrigin:     config.checkOrigin,
+    }
+    usedTickets := newTicketCache()
+
     return func(ctx *appcontext.AppContext) {
+        if !config.checkOrigin(ctx.Request) {
+            http.Error(ctx.Writer, "Origin not allowed", http.StatusForbidden)
+            return
+        }
+
+        userID, err := config.authenticate(ctx.Request, usedTickets)
+        if err != nil {
+            if !errors.Is(err, errNoCredentials) {
+                ctx.Logger.Printf("Rejected WebSocket connection: %v", err)
+            }
+            http.Error(ctx.Writer, "Authentication required", http.StatusUnauthorized)
+            return
+        }
+
         conn, err := upgrader.Upgrade(ctx.Writer, ctx.Request, nil)
         if err != nil {
             ctx.Logger.Printf("WebSocket upgrade failed: %v", err)
@@ -91,10 +255,16 @@ func WebSocketHandler(hub *Hub) func(*appcontext.AppContext) {
         }
 
         client := &Client{
-            hub:  hub,
-            conn: conn,
-            send: make(chan []byte, 256),
+            hub:          hub,
+            conn:         conn,
+            send:         newOutbox(config.sendBuffer(), config.SlowConsumer),
+            userID:       userID,
+            topics:       make(map[string]bool),
+            writeWait:    config.writeWait(),
+            pongWait:     config.pongWait(),
+            pingInterval: config.pingInterval(),
         }
+        conn.SetReadLimit(config.maxMessageSize())
 
         client.hub.register <- client
 
@@ -103,36 +273,59 @@ func WebSocketHandler(hub *Hub) func(*appcontext.AppContext) {
     }
 }
 
+// readPump reads until the peer goes away or stops answering pings: every
+// pong pushes the read deadline out by pongWait.
 func (c *Client) readPump() {
     defer func() {
         c.hub.unregister <- c
         c.conn.Close()
     }()
 
+    c.conn.SetReadDeadline(time.Now().Add(c.pongWait))
+    c.conn.SetPongHandler(func(string) error {
+        return c.conn.SetReadDeadline(time.Now().Add(c.pongWait))
+    })
+
     for {
-        _, _, err := c.conn.ReadMessage()
+        _, message, err := c.conn.ReadMessage()
         if err != nil {
             if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
                 log.Printf("WebSocket error: %v", err)
             }
             break
         }
-        // Handle incoming messages if needed
+        c.handleMessage(message)
     }
 }
 
+// writePump writes queued messages and pings. Each write has to finish
+// within writeWait, so a peer that stopped reading cannot block it forever.
 func (c *Client) writePump() {
-    defer c.conn.Close()
+    ticker := time.NewTicker(c.pingInterval)
+    defer func() {
+        ticker.Stop()
+        c.conn.Close()
+    }()
 
     for {
         select {
-        case message, ok := <-c.send:
-            if !ok {
+        case <-c.send.ready:
+            messages, closed := c.send.take()
+            for _, message := range messages {
+                c.conn.SetWriteDeadline(time.Now().Add(c.writeWait))
+                if err := c.conn.WriteMessage(websocket.TextMessage, message.data); err != nil {
+                    return
+                }
+            }
+            if closed {
+                c.conn.SetWriteDeadline(time.Now().Add(c.writeWait))
                 c.conn.WriteMessage(websocket.CloseMessage, []byte{})
                 return
             }
 
-            if err := c.conn.WriteMessage(websocket.TextMessage, message); err != nil {
+        case <-ticker.C:
+            c.conn.SetWriteDeadline(time.Now().Add(c.writeWait))
+            if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
                 return
             }
         }
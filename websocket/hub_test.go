@@ -0,0 +1,386 @@
+package websocket
+
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "log"
+    "net"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+    "time"
+
+    "github.com/gorilla/websocket"
+    "gooner/appcontext"
+    "gooner/auth"
+)
+
+const testSecret = "test-secret"
+
+// newTestServer serves WebSocketHandler for hub on an httptest server.
+func newTestServer(t *testing.T, hub *Hub, config HandlerConfig) *httptest.Server {
+    t.Helper()
+
+    config.JWTSecret = testSecret
+    handler := WebSocketHandler(hub, config)
+    logger := log.New(io.Discard, "", 0)
+
+    server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        handler(&appcontext.AppContext{Context: r.Context(), Writer: w, Request: r, Logger: logger})
+    }))
+    t.Cleanup(server.Close)
+    return server
+}
+
+func newTestHub() *Hub {
+    hub := NewHub()
+    go hub.Run()
+    return hub
+}
+
+// dial opens a socket signed in as userID.
+func dial(t *testing.T, server *httptest.Server, userID string) *websocket.Conn {
+    t.Helper()
+
+    token, err := auth.SignPayload(testSecret, auth.Payload{
+        Sub: userID,
+        Iat: time.Now().Unix(),
+        Exp: time.Now().Add(time.Hour).Unix(),
+    })
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    header := http.Header{}
+    header.Set("Cookie", "AuthToken="+token)
+
+    conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), header)
+    if err != nil {
+        t.Fatalf("dial: %v", err)
+    }
+    t.Cleanup(func() { conn.Close() })
+    return conn
+}
+
+func readJSON(t *testing.T, conn *websocket.Conn, v any) {
+    t.Helper()
+
+    conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+    if err := conn.ReadJSON(v); err != nil {
+        t.Fatalf("read: %v", err)
+    }
+}
+
+// readUntilError reads until the server drops the connection and returns
+// the error, failing the test if that takes longer than within.
+func readUntilError(t *testing.T, conn *websocket.Conn, within time.Duration) error {
+    t.Helper()
+
+    conn.SetReadDeadline(time.Now().Add(within))
+    for {
+        if _, _, err := conn.ReadMessage(); err != nil {
+            if isTimeout(err) {
+                t.Fatalf("connection still open after %s", within)
+            }
+            return err
+        }
+    }
+}
+
+func isTimeout(err error) bool {
+    var netErr net.Error
+    return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+func TestRejectsUnauthenticated(t *testing.T) {
+    server := newTestServer(t, newTestHub(), HandlerConfig{})
+
+    _, resp, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+    if err == nil {
+        t.Fatal("expected dial without credentials to fail")
+    }
+    if resp == nil || resp.StatusCode != http.StatusUnauthorized {
+        t.Fatalf("expected 401, got %v", resp)
+    }
+}
+
+func TestSubscribeAndPublish(t *testing.T) {
+    hub := newTestHub()
+    hub.Authorize("room", func(ctx context.Context, userID, name string) error {
+        return nil
+    })
+    server := newTestServer(t, hub, HandlerConfig{})
+
+    conn := dial(t, server, "alice")
+    if err := conn.WriteJSON(ClientMessage{Action: ActionSubscribe, Topic: "room:1", ID: "1"}); err != nil {
+        t.Fatal(err)
+    }
+
+    var reply ServerReply
+    readJSON(t, conn, &reply)
+    if reply.Type != "ack" || reply.ID != "1" || reply.Topic != "room:1" {
+        t.Fatalf("unexpected reply %+v", reply)
+    }
+
+    hub.Publish("room:2", []byte(`{"n":2}`))
+    hub.Publish("room:1", []byte(`{"n":1}`))
+
+    var msg struct{ N int }
+    readJSON(t, conn, &msg)
+    if msg.N != 1 {
+        t.Fatalf("got message for topic %d, want only room:1", msg.N)
+    }
+}
+
+func TestPingKeepsConnectionAlive(t *testing.T) {
+    hub := newTestHub()
+    server := newTestServer(t, hub, HandlerConfig{
+        PongWait:     300 * time.Millisecond,
+        PingInterval: 100 * time.Millisecond,
+    })
+
+    conn := dial(t, server, "alice")
+    pings := make(chan struct{}, 100)
+    conn.SetPingHandler(func(data string) error {
+        pings <- struct{}{}
+        return conn.WriteControl(websocket.PongMessage, []byte(data), time.Now().Add(time.Second))
+    })
+
+    messages := make(chan []byte, 1)
+    go func() {
+        for {
+            _, data, err := conn.ReadMessage()
+            if err != nil {
+                close(messages)
+                return
+            }
+            messages <- data
+        }
+    }()
+
+    // well past pongWait; only the pongs keep the connection open
+    time.Sleep(time.Second)
+    hub.SendToUser("alice", []byte("still here"))
+
+    select {
+    case data, ok := <-messages:
+        if !ok {
+            t.Fatal("connection closed although pings were answered")
+        }
+        if string(data) != "still here" {
+            t.Fatalf("unexpected message %q", data)
+        }
+    case <-time.After(2 * time.Second):
+        t.Fatal("no message received")
+    }
+
+    if len(pings) < 3 {
+        t.Fatalf("expected regular pings, got %d", len(pings))
+    }
+}
+
+func TestPongTimeoutDisconnects(t *testing.T) {
+    server := newTestServer(t, newTestHub(), HandlerConfig{
+        PongWait:     200 * time.Millisecond,
+        PingInterval: 50 * time.Millisecond,
+    })
+
+    conn := dial(t, server, "alice")
+    conn.SetPingHandler(func(string) error { return nil }) // never answer
+
+    readUntilError(t, conn, 2*time.Second)
+}
+
+func TestReadLimit(t *testing.T) {
+    server := newTestServer(t, newTestHub(), HandlerConfig{MaxMessageSize: 128})
+
+    conn := dial(t, server, "alice")
+    if err := conn.WriteMessage(websocket.TextMessage, []byte(strings.Repeat("x", 1024))); err != nil {
+        t.Fatal(err)
+    }
+
+    err := readUntilError(t, conn, 2*time.Second)
+    if !websocket.IsCloseError(err, websocket.CloseMessageTooBig) {
+        t.Fatalf("expected close 1009, got %v", err)
+    }
+}
+
+func TestSlowConsumerIsDisconnected(t *testing.T) {
+    hub := newTestHub()
+    server := newTestServer(t, hub, HandlerConfig{
+        SendBuffer:   4,
+        SlowConsumer: Disconnect,
+        WriteWait:    200 * time.Millisecond,
+    })
+
+    conn := dial(t, server, "alice")
+
+    // far more than the socket buffers hold while the client is not reading
+    const sent = 500
+    payload := []byte(strings.Repeat("x", 64*1024))
+    for i := 0; i < sent; i++ {
+        hub.SendToUser("alice", payload)
+    }
+
+    received := 0
+    conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+    for {
+        if _, _, err := conn.ReadMessage(); err != nil {
+            if isTimeout(err) {
+                t.Fatal("slow consumer was not disconnected")
+            }
+            break
+        }
+        received++
+    }
+    if received >= sent {
+        t.Fatalf("received all %d messages, expected the connection to be dropped", received)
+    }
+}
+
+func TestOutboxPolicies(t *testing.T) {
+    progress := func(key, data string) outMessage {
+        return outMessage{key: key, data: []byte(data)}
+    }
+
+    tests := []struct {
+        policy SlowConsumerPolicy
+        push   []outMessage
+        want   []string
+        ok     bool
+    }{
+        {Disconnect, []outMessage{progress("", "a"), progress("", "b"), progress("", "c")}, []string{"a", "b"}, false},
+        {DropOldest, []outMessage{progress("", "a"), progress("", "b"), progress("", "c")}, []string{"b", "c"}, true},
+        {Coalesce, []outMessage{progress("j1", "10%"), progress("", "b"), progress("j1", "20%")}, []string{"20%", "b"}, true},
+        {Coalesce, []outMessage{progress("j1", "10%"), progress("j2", "10%"), progress("", "c")}, []string{"10%", "10%"}, false},
+    }
+
+    for _, tt := range tests {
+        t.Run(string(tt.policy), func(t *testing.T) {
+            o := newOutbox(2, tt.policy)
+            ok := true
+            for _, msg := range tt.push {
+                ok = o.push(msg) && ok
+            }
+            if ok != tt.ok {
+                t.Fatalf("push reported %v, want %v", ok, tt.ok)
+            }
+
+            queued, _ := o.take()
+            var got []string
+            for _, msg := range queued {
+                got = append(got, string(msg.data))
+            }
+            if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+                t.Fatalf("queued %v, want %v", got, tt.want)
+            }
+        })
+    }
+}
+
+// A client can be removed by deliver and then unregistered by its read
+// goroutine; neither that nor later deliveries may panic.
+func TestRemoveIsIdempotent(t *testing.T) {
+    hub := NewHub()
+    client := &Client{hub: hub, send: newOutbox(1, Disconnect), userID: "alice", topics: map[string]bool{}}
+    hub.clients[client] = true
+    hub.users["alice"] = map[*Client]bool{client: true}
+    hub.join(client, "room:1")
+
+    hub.deliver(client, outMessage{data: []byte("a")})
+    hub.deliver(client, outMessage{data: []byte("b")}) // full, removes the client
+    hub.remove(client)
+    hub.deliver(client, outMessage{data: []byte("c")})
+
+    if len(hub.clients) != 0 || len(hub.users) != 0 || len(hub.topics) != 0 {
+        t.Fatal("client still indexed after removal")
+    }
+    if _, closed := client.send.take(); !closed {
+        t.Fatal("outbox not closed")
+    }
+}
+
+func TestParseSlowConsumerPolicy(t *testing.T) {
+    for _, s := range []string{"", "disconnect", "drop_oldest", "coalesce"} {
+        if _, err := ParseSlowConsumerPolicy(s); err != nil {
+            t.Errorf("%q: %v", s, err)
+        }
+    }
+    if _, err := ParseSlowConsumerPolicy("block"); err == nil {
+        t.Error("expected an error for an unknown policy")
+    }
+}
+
+func TestJobProgressIsCoalesced(t *testing.T) {
+    hub := NewHub()
+    client := &Client{hub: hub, send: newOutbox(3, Coalesce), userID: "alice", topics: map[string]bool{}}
+    hub.clients[client] = true
+    hub.users["alice"] = map[*Client]bool{client: true}
+
+    go hub.Run()
+    for i := 1; i <= 10; i++ {
+        hub.SendJobProgress("alice", 7, "export", i*10, "")
+    }
+    hub.SendJobStatus("alice", 7, "export", "completed")
+    hub.SendToUser("alice", []byte(`{}`)) // returns once Run has queued the status
+
+    queued, _ := client.send.take()
+    if len(queued) < 2 || !strings.Contains(string(queued[1].data), `"completed"`) {
+        t.Fatalf("expected one progress update followed by the status, got %d messages", len(queued))
+    }
+
+    var progress JobNotification
+    if err := json.Unmarshal(queued[0].data, &progress); err != nil {
+        t.Fatal(err)
+    }
+    if progress.Type != "job_progress" || progress.Progress == nil || *progress.Progress != 100 {
+        t.Fatalf("expected latest progress, got %+v", progress)
+    }
+}
+
+func TestPresenceReportsFirstJoinAndLastLeave(t *testing.T) {
+    hub := newTestHub()
+    hub.Authorize("room", func(ctx context.Context, userID, name string) error {
+        return nil
+    })
+
+    changes := make(chan string, 10)
+    hub.OnPresence("room", func(userID, topic string, online bool) {
+        changes <- fmt.Sprintf("%s %s %v", userID, topic, online)
+    })
+    server := newTestServer(t, hub, HandlerConfig{})
+
+    first, second := dial(t, server, "alice"), dial(t, server, "alice")
+    for _, conn := range []*websocket.Conn{first, second} {
+        conn.WriteJSON(ClientMessage{Action: ActionSubscribe, Topic: "room:1"})
+        var reply ServerReply
+        readJSON(t, conn, &reply)
+    }
+
+    first.WriteJSON(ClientMessage{Action: ActionUnsubscribe, Topic: "room:1"})
+    var reply ServerReply
+    readJSON(t, first, &reply)
+    second.Close()
+
+    want := []string{"alice room:1 true", "alice room:1 false"}
+    for _, w := range want {
+        select {
+        case got := <-changes:
+            if got != w {
+                t.Fatalf("got presence change %q, want %q", got, w)
+            }
+        case <-time.After(2 * time.Second):
+            t.Fatalf("missing presence change %q", w)
+        }
+    }
+
+    select {
+    case got := <-changes:
+        t.Fatalf("unexpected presence change %q", got)
+    case <-time.After(100 * time.Millisecond):
+    }
+}
@@ -0,0 +1,121 @@
+package websocket
+
+import (
+    "fmt"
+    "sync"
+)
+
+// SlowConsumerPolicy decides what happens when a client does not read
+// fast enough and its outbox is full.
+type SlowConsumerPolicy string
+
+const (
+    // Disconnect closes the connection; the client reconnects and resyncs.
+    Disconnect SlowConsumerPolicy = "disconnect"
+    // DropOldest discards the oldest queued message to make room.
+    DropOldest SlowConsumerPolicy = "drop_oldest"
+    // Coalesce replaces a queued message that has the same key (e.g. an
+    // older progress update of the same job) with the new one. Messages
+    // without a match fall back to Disconnect when the outbox is full.
+    Coalesce SlowConsumerPolicy = "coalesce"
+)
+
+func ParseSlowConsumerPolicy(s string) (SlowConsumerPolicy, error) {
+    switch policy := SlowConsumerPolicy(s); policy {
+    case Disconnect, DropOldest, Coalesce:
+        return policy, nil
+    case "":
+        return Disconnect, nil
+    default:
+        return "", fmt.Errorf("unknown slow consumer policy %q", s)
+    }
+}
+
+// outMessage is a queued frame. Messages with a key can be coalesced.
+type outMessage struct {
+    key  string
+    data []byte
+}
+
+// outbox is the queue between the hub and a client's write goroutine.
+// Unlike a channel it can drop or replace queued messages, and closing it
+// twice is harmless.
+type outbox struct {
+    mu     sync.Mutex
+    queue  []outMessage
+    limit  int
+    policy SlowConsumerPolicy
+    closed bool
+    ready  chan struct{} // signalled when there is something to write or the outbox closed
+}
+
+func newOutbox(limit int, policy SlowConsumerPolicy) *outbox {
+    if limit <= 0 {
+        limit = 1
+    }
+    return &outbox{
+        limit:  limit,
+        policy: policy,
+        ready:  make(chan struct{}, 1),
+    }
+}
+
+// push queues a message and reports false if the client has to be
+// disconnected because it cannot keep up.
+func (o *outbox) push(msg outMessage) bool {
+    o.mu.Lock()
+    defer o.mu.Unlock()
+
+    if o.closed {
+        return true
+    }
+
+    if o.policy == Coalesce && msg.key != "" {
+        for i := range o.queue {
+            if o.queue[i].key == msg.key {
+                o.queue[i] = msg
+                return true
+            }
+        }
+    }
+
+    if len(o.queue) >= o.limit {
+        if o.policy != DropOldest {
+            return false
+        }
+        o.queue[0] = outMessage{}
+        o.queue = o.queue[1:]
+    }
+
+    o.queue = append(o.queue, msg)
+    o.signal()
+    return true
+}
+
+// take returns everything queued, and whether the outbox was closed.
+func (o *outbox) take() ([]outMessage, bool) {
+    o.mu.Lock()
+    defer o.mu.Unlock()
+
+    queued := o.queue
+    o.queue = nil
+    return queued, o.closed
+}
+
+func (o *outbox) close() {
+    o.mu.Lock()
+    defer o.mu.Unlock()
+
+    if o.closed {
+        return
+    }
+    o.closed = true
+    o.signal()
+}
+
+func (o *outbox) signal() {
+    select {
+    case o.ready <- struct{}{}:
+    default:
+    }
+}
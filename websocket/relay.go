@@ -0,0 +1,297 @@
+package websocket
+
+import (
+    "context"
+    "encoding/base64"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "log"
+    "strconv"
+    "strings"
+    "sync/atomic"
+    "time"
+
+    "gooner/db"
+)
+
+const (
+    defaultRelayChannel = "gooner_hub"
+    relayQueueSize      = 1024
+    relayBatchSize      = 64
+    relayPartialTTL     = 30 * time.Second
+    relayMaxBackoff     = 30 * time.Second
+    // leaves room for the header in front of every chunk
+    relayChunkSize = db.MaxNotifyPayload - 200
+)
+
+// Relay fans the messages of a Hub out to the hubs of other instances
+// through Postgres LISTEN/NOTIFY, so clients get chat messages and job
+// notifications no matter which instance they are connected to.
+//
+// Every instance delivers its own messages directly and ignores their
+// echo. Messages larger than a notification are split into chunks that are
+// sent in one transaction and put back together by the listeners. Delivery
+// is best effort: messages sent while the listener reconnects are lost.
+type Relay struct {
+    Pool    *db.DBPool
+    Logger  *log.Logger
+    Channel string
+
+    hub      *Hub
+    instance string
+    seq      atomic.Uint64
+    out      chan envelope
+
+    stop context.CancelFunc
+    done chan struct{}
+}
+
+// relayEvent is an envelope on the wire.
+type relayEvent struct {
+    All         bool   `json:"a,omitempty"`
+    Unsubscribe bool   `json:"x,omitempty"`
+    UserID      string `json:"u,omitempty"`
+    Topic       string `json:"t,omitempty"`
+    Key         string `json:"k,omitempty"`
+    Data        []byte `json:"d"`
+}
+
+// NewRelay attaches a relay to hub. Call it before the hub is used.
+func NewRelay(hub *Hub, pool *db.DBPool, logger *log.Logger) *Relay {
+    instance, err := db.GenUUID()
+    if err != nil {
+        instance = strconv.FormatInt(time.Now().UnixNano(), 36)
+    }
+
+    r := &Relay{
+        Pool:     pool,
+        Logger:   logger,
+        Channel:  defaultRelayChannel,
+        hub:      hub,
+        instance: instance,
+        out:      make(chan envelope, relayQueueSize),
+    }
+    hub.relay = r
+    return r
+}
+
+func (r *Relay) Start() {
+    ctx, stop := context.WithCancel(context.Background())
+    r.stop = stop
+    r.done = make(chan struct{})
+
+    listening := make(chan struct{})
+    go func() {
+        defer close(listening)
+        r.listen(ctx)
+    }()
+
+    go func() {
+        defer close(r.done)
+        r.notify(ctx)
+        <-listening
+    }()
+}
+
+func (r *Relay) Stop() {
+    if r.stop == nil {
+        return
+    }
+    r.stop()
+    <-r.done
+}
+
+// publish queues a message for the other instances without waiting for
+// the database.
+func (r *Relay) publish(message envelope) {
+    select {
+    case r.out <- message:
+    default:
+        r.Logger.Printf("WebSocket relay queue full, dropping message for other instances")
+    }
+}
+
+// notify sends queued messages, batching whatever piled up while the
+// previous batch was being sent.
+func (r *Relay) notify(ctx context.Context) {
+    for {
+        var batch []envelope
+        select {
+        case <-ctx.Done():
+            return
+        case message := <-r.out:
+            batch = append(batch, message)
+        }
+
+    DRAIN:
+        for len(batch) < relayBatchSize {
+            select {
+            case message := <-r.out:
+                batch = append(batch, message)
+            default:
+                break DRAIN
+            }
+        }
+
+        var payloads []string
+        for _, message := range batch {
+            chunks, err := r.encode(message)
+            if err != nil {
+                r.Logger.Printf("Failed to encode relayed message: %v", err)
+                continue
+            }
+            payloads = append(payloads, chunks...)
+        }
+
+        if err := db.Notify(r.Pool, ctx, r.Channel, payloads...); err != nil && ctx.Err() == nil {
+            r.Logger.Printf("Failed to relay %d messages: %v", len(batch), err)
+        }
+    }
+}
+
+// listen delivers messages from other instances to local clients and
+// reconnects with backoff when the connection is lost.
+func (r *Relay) listen(ctx context.Context) {
+    decoder := newRelayDecoder(r.instance)
+    backoff := time.Second
+
+    for {
+        started := time.Now()
+        err := db.Listen(r.Pool, ctx, r.Channel, func(payload string) {
+            message, err := decoder.add(payload, time.Now())
+            if err != nil {
+                r.Logger.Printf("Dropping relayed message: %v", err)
+                return
+            }
+            if message != nil {
+                r.hub.direct <- *message
+            }
+        })
+        if ctx.Err() != nil {
+            return
+        }
+
+        if time.Since(started) > relayMaxBackoff {
+            backoff = time.Second
+        }
+        r.Logger.Printf("WebSocket relay stopped listening, retrying in %s: %v", backoff, err)
+
+        select {
+        case <-ctx.Done():
+            return
+        case <-time.After(backoff):
+        }
+        backoff = min(backoff*2, relayMaxBackoff)
+    }
+}
+
+// encode turns a message into notification payloads of the form
+// "<instance> <message> <chunk> <chunks> <base64 data>".
+func (r *Relay) encode(message envelope) ([]string, error) {
+    data, err := json.Marshal(relayEvent{
+        All:         message.all,
+        Unsubscribe: message.unsubscribe,
+        UserID:      message.userID,
+        Topic:       message.topic,
+        Key:         message.key,
+        Data:        message.data,
+    })
+    if err != nil {
+        return nil, err
+    }
+    encoded := base64.RawStdEncoding.EncodeToString(data)
+
+    id := r.seq.Add(1)
+    total := (len(encoded) + relayChunkSize - 1) / relayChunkSize
+    payloads := make([]string, 0, total)
+    for i := 0; i < total; i++ {
+        end := min((i+1)*relayChunkSize, len(encoded))
+        payloads = append(payloads, fmt.Sprintf("%s %d %d %d %s", r.instance, id, i, total, encoded[i*relayChunkSize:end]))
+    }
+    return payloads, nil
+}
+
+// relayDecoder puts chunked messages back together. It is only used by
+// the listener goroutine.
+type relayDecoder struct {
+    instance string
+    partials map[string]*relayPartial
+}
+
+type relayPartial struct {
+    chunks   []string
+    received int
+    started  time.Time
+}
+
+func newRelayDecoder(instance string) *relayDecoder {
+    return &relayDecoder{instance: instance, partials: make(map[string]*relayPartial)}
+}
+
+// add takes one notification payload and returns the message once all of
+// its chunks arrived. Messages of this instance are skipped.
+func (d *relayDecoder) add(payload string, now time.Time) (*envelope, error) {
+    fields := strings.SplitN(payload, " ", 5)
+    if len(fields) != 5 {
+        return nil, errors.New("malformed relay payload")
+    }
+    if fields[0] == d.instance {
+        return nil, nil
+    }
+
+    index, err1 := strconv.Atoi(fields[2])
+    total, err2 := strconv.Atoi(fields[3])
+    if err1 != nil || err2 != nil || total < 1 || index < 0 || index >= total {
+        return nil, errors.New("malformed relay chunk header")
+    }
+
+    encoded := fields[4]
+    if total > 1 {
+        for id, partial := range d.partials {
+            if now.Sub(partial.started) > relayPartialTTL {
+                delete(d.partials, id)
+            }
+        }
+
+        id := fields[0] + " " + fields[1]
+        partial := d.partials[id]
+        if partial == nil {
+            partial = &relayPartial{chunks: make([]string, total), started: now}
+            d.partials[id] = partial
+        }
+        if len(partial.chunks) != total {
+            delete(d.partials, id)
+            return nil, errors.New("inconsistent relay chunk count")
+        }
+        if partial.chunks[index] == "" {
+            partial.received++
+        }
+        partial.chunks[index] = encoded
+
+        if partial.received < total {
+            return nil, nil
+        }
+        delete(d.partials, id)
+        encoded = strings.Join(partial.chunks, "")
+    }
+
+    data, err := base64.RawStdEncoding.DecodeString(encoded)
+    if err != nil {
+        return nil, fmt.Errorf("failed to decode relay payload: %w", err)
+    }
+
+    var event relayEvent
+    if err := json.Unmarshal(data, &event); err != nil {
+        return nil, fmt.Errorf("failed to decode relay payload: %w", err)
+    }
+
+    return &envelope{
+        all:         event.All,
+        unsubscribe: event.Unsubscribe,
+        userID:      event.UserID,
+        topic:       event.Topic,
+        key:         event.Key,
+        data:        event.Data,
+    }, nil
+}
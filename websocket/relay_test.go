@@ -0,0 +1,108 @@
+package websocket
+
+import (
+    "bytes"
+    "strings"
+    "testing"
+    "time"
+
+    "gooner/db"
+)
+
+func TestRelayRoundTrip(t *testing.T) {
+    sender := &Relay{instance: "a"}
+    receiver := newRelayDecoder("b")
+    now := time.Now()
+
+    large := []byte(`{"content":"` + strings.Repeat("ü", 3*relayChunkSize) + `"}`)
+    tests := []envelope{
+        {all: true, data: []byte(`{"type":"hello"}`)},
+        {userID: "alice", topic: "job:7", key: "job_progress:job:7", data: []byte(`{"progress":50}`)},
+        {unsubscribe: true, userID: "bob", topic: "chat:secret", data: []byte(`{"type":"unsubscribed"}`)},
+        {topic: "chat:1", data: large},
+    }
+
+    for _, want := range tests {
+        payloads, err := sender.encode(want)
+        if err != nil {
+            t.Fatal(err)
+        }
+        for _, payload := range payloads {
+            if len(payload) > db.MaxNotifyPayload {
+                t.Fatalf("payload of %d bytes does not fit a notification", len(payload))
+            }
+        }
+
+        // chunks of one message can only be reordered by a bug, but the
+        // decoder should not care
+        var got *envelope
+        for i := len(payloads) - 1; i >= 0; i-- {
+            message, err := receiver.add(payloads[i], now)
+            if err != nil {
+                t.Fatal(err)
+            }
+            if message != nil {
+                if i != 0 {
+                    t.Fatalf("message complete after %d of %d chunks", len(payloads)-i, len(payloads))
+                }
+                got = message
+            }
+        }
+
+        if got == nil {
+            t.Fatal("message never completed")
+        }
+        if got.all != want.all || got.unsubscribe != want.unsubscribe || got.userID != want.userID || got.topic != want.topic || got.key != want.key || !bytes.Equal(got.data, want.data) {
+            t.Fatalf("got %+v, want %+v", got, want)
+        }
+    }
+
+    if len(receiver.partials) != 0 {
+        t.Fatalf("%d partial messages left behind", len(receiver.partials))
+    }
+}
+
+func TestRelaySkipsOwnMessages(t *testing.T) {
+    relay := &Relay{instance: "a"}
+    payloads, err := relay.encode(envelope{all: true, data: []byte(`{}`)})
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    message, err := newRelayDecoder("a").add(payloads[0], time.Now())
+    if err != nil || message != nil {
+        t.Fatalf("expected own message to be skipped, got %v, %v", message, err)
+    }
+}
+
+func TestRelayDropsStalePartials(t *testing.T) {
+    sender := &Relay{instance: "a"}
+    receiver := newRelayDecoder("b")
+    now := time.Now()
+
+    payloads, err := sender.encode(envelope{all: true, data: bytes.Repeat([]byte("x"), 2*relayChunkSize)})
+    if err != nil {
+        t.Fatal(err)
+    }
+    if _, err := receiver.add(payloads[0], now); err != nil {
+        t.Fatal(err)
+    }
+
+    other, _ := sender.encode(envelope{all: true, data: bytes.Repeat([]byte("y"), 2*relayChunkSize)})
+    if _, err := receiver.add(other[0], now.Add(relayPartialTTL+time.Second)); err != nil {
+        t.Fatal(err)
+    }
+
+    if len(receiver.partials) != 1 {
+        t.Fatalf("expected only the fresh partial message, got %d", len(receiver.partials))
+    }
+}
+
+func TestRelayRejectsMalformedPayloads(t *testing.T) {
+    decoder := newRelayDecoder("b")
+    for _, payload := range []string{"", "a 1 0", "a 1 2 1 xx", "a 1 0 1 !!!"} {
+        if _, err := decoder.add(payload, time.Now()); err == nil {
+            t.Errorf("%q: expected an error", payload)
+        }
+    }
+}
@@ -0,0 +1,260 @@
+package websocket
+
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "log"
+    "strings"
+    "time"
+)
+
+// Clients talk to the hub with JSON messages like
+//
+//	{"action": "subscribe", "topic": "chat:general", "id": "1"}
+//	{"action": "unsubscribe", "topic": "chat:general", "id": "2"}
+//
+// and get {"type": "ack", ...} or {"type": "error", ...} back, echoing id.
+// The server may also end a subscription itself with
+// {"type": "unsubscribed", "topic": ...}.
+// A topic is "<kind>:<name>"; each kind needs a TopicAuthorizer. Other
+// actions, such as "send", are passed to the ActionHandler registered for
+// them, after the topic they name has been authorized.
+const (
+    ActionSubscribe   = "subscribe"
+    ActionUnsubscribe = "unsubscribe"
+
+    maxSubscriptions = 100
+    authorizeTimeout = 5 * time.Second
+    actionTimeout    = 10 * time.Second
+)
+
+var (
+    ErrUnknownTopic    = errors.New("unknown topic")
+    ErrForbidden       = errors.New("forbidden")
+    ErrTooManyTopics   = fmt.Errorf("subscribed to more than %d topics", maxSubscriptions)
+    errUnauthenticated = errors.New("not authenticated")
+)
+
+// TopicAuthorizer decides whether userID may subscribe to the topic
+// "<kind>:<name>". It gets the name part only.
+type TopicAuthorizer func(ctx context.Context, userID, name string) error
+
+// PresenceHandler is told when a user's first connection on this instance
+// subscribes to a topic (online) and when their last one leaves it, by
+// unsubscribing or disconnecting. Calls for one hub are made in order from
+// a single goroutine.
+type PresenceHandler func(userID, topic string, online bool)
+
+type presenceChange struct {
+    handler PresenceHandler
+    userID  string
+    topic   string
+    online  bool
+}
+
+const presenceQueueSize = 1024
+
+// ActionHandler runs a client action on behalf of userID. Its result is
+// returned in the ack. The text of a returned error is sent to the client,
+// so handlers should log internal errors and return something generic.
+type ActionHandler func(ctx context.Context, userID string, msg ClientMessage) (any, error)
+
+type ClientMessage struct {
+    Action string          `json:"action"`
+    Topic  string          `json:"topic"`
+    ID     string          `json:"id,omitempty"`
+    Data   json.RawMessage `json:"data,omitempty"`
+}
+
+type ServerReply struct {
+    Type   string `json:"type"` // "ack", "error" or "unsubscribed"
+    ID     string `json:"id,omitempty"`
+    Action string `json:"action,omitempty"`
+    Topic  string `json:"topic,omitempty"`
+    Error  string `json:"error,omitempty"`
+    Data   any    `json:"data,omitempty"`
+}
+
+type clientRequest struct {
+    client *Client
+    msg    ClientMessage
+    result any
+    err    error
+}
+
+func JobTopic(jobID int) string {
+    return fmt.Sprintf("job:%d", jobID)
+}
+
+func RoomTopic(roomID string) string {
+    return "chat:" + roomID
+}
+
+// Authorize registers the authorizer for topics of one kind, e.g. "chat"
+// for "chat:<room>". Call it before the hub serves connections.
+func (h *Hub) Authorize(kind string, authorize TopicAuthorizer) {
+    h.authorizers[kind] = authorize
+}
+
+// OnPresence registers the presence handler for topics of one kind. Call
+// it before the hub serves connections.
+func (h *Hub) OnPresence(kind string, handler PresenceHandler) {
+    if h.presenceChanges == nil {
+        h.presenceChanges = make(chan presenceChange, presenceQueueSize)
+        go func() {
+            for change := range h.presenceChanges {
+                change.handler(change.userID, change.topic, change.online)
+            }
+        }()
+    }
+    h.presence[kind] = handler
+}
+
+// Handle registers the handler for a client action other than subscribe
+// and unsubscribe. Call it before the hub serves connections.
+func (h *Hub) Handle(action string, handler ActionHandler) {
+    h.actions[action] = handler
+}
+
+func (h *Hub) authorize(userID, topic string) error {
+    kind, name, ok := strings.Cut(topic, ":")
+    authorize := h.authorizers[kind]
+    if !ok || name == "" || authorize == nil {
+        return ErrUnknownTopic
+    }
+    if userID == "" {
+        return errUnauthenticated
+    }
+
+    ctx, cancel := context.WithTimeout(context.Background(), authorizeTimeout)
+    defer cancel()
+
+    err := authorize(ctx, userID, name)
+    if err != nil && !errors.Is(err, ErrUnknownTopic) && !errors.Is(err, ErrForbidden) {
+        log.Printf("Failed to authorize %s for user %s: %v", topic, userID, err)
+        return errors.New("subscription failed")
+    }
+    return err
+}
+
+// handleMessage runs on the client's read goroutine. Authorization may hit
+// the database, so it happens here and only the result goes to Run.
+func (c *Client) handleMessage(data []byte) {
+    var msg ClientMessage
+    if err := json.Unmarshal(data, &msg); err != nil {
+        c.hub.requests <- clientRequest{client: c, err: errors.New("invalid message")}
+        return
+    }
+
+    var result any
+    var err error
+    switch msg.Action {
+    case ActionSubscribe:
+        err = c.hub.authorize(c.userID, msg.Topic)
+    case ActionUnsubscribe:
+    default:
+        result, err = c.runAction(msg)
+    }
+
+    c.hub.requests <- clientRequest{client: c, msg: msg, result: result, err: err}
+}
+
+func (c *Client) runAction(msg ClientMessage) (any, error) {
+    handler := c.hub.actions[msg.Action]
+    if handler == nil {
+        return nil, fmt.Errorf("unknown action %q", msg.Action)
+    }
+    if err := c.hub.authorize(c.userID, msg.Topic); err != nil {
+        return nil, err
+    }
+
+    ctx, cancel := context.WithTimeout(context.Background(), actionTimeout)
+    defer cancel()
+    return handler(ctx, c.userID, msg)
+}
+
+func (h *Hub) handleRequest(req clientRequest) {
+    client := req.client
+    if !h.clients[client] {
+        return
+    }
+
+    err := req.err
+    if err == nil {
+        switch req.msg.Action {
+        case ActionSubscribe:
+            err = h.join(client, req.msg.Topic)
+        case ActionUnsubscribe:
+            h.leave(client, req.msg.Topic)
+        }
+    }
+
+    reply := ServerReply{Type: "ack", ID: req.msg.ID, Action: req.msg.Action, Topic: req.msg.Topic, Data: req.result}
+    if err != nil {
+        reply.Data = nil
+        reply.Type = "error"
+        reply.Error = err.Error()
+    }
+
+    data, _ := json.Marshal(reply)
+    h.deliver(client, outMessage{data: data})
+}
+
+func (h *Hub) join(client *Client, topic string) error {
+    if client.topics[topic] {
+        return nil
+    }
+    if len(client.topics) >= maxSubscriptions {
+        return ErrTooManyTopics
+    }
+
+    if h.topics[topic] == nil {
+        h.topics[topic] = make(map[*Client]bool)
+    }
+    h.topics[topic][client] = true
+    client.topics[topic] = true
+    h.presenceChanged(client.userID, topic, true)
+    return nil
+}
+
+func (h *Hub) leave(client *Client, topic string) {
+    if !client.topics[topic] {
+        return
+    }
+    delete(client.topics, topic)
+    if subscribers := h.topics[topic]; subscribers != nil {
+        delete(subscribers, client)
+        if len(subscribers) == 0 {
+            delete(h.topics, topic)
+        }
+    }
+    h.presenceChanged(client.userID, topic, false)
+}
+
+// presenceChanged reports a join or leave to the presence handler of the
+// topic's kind, unless the user has other connections subscribed to it.
+func (h *Hub) presenceChanged(userID, topic string, online bool) {
+    kind, _, _ := strings.Cut(topic, ":")
+    handler := h.presence[kind]
+    if handler == nil || userID == "" {
+        return
+    }
+
+    connections := 0
+    for other := range h.topics[topic] {
+        if other.userID == userID {
+            connections++
+        }
+    }
+    if (online && connections != 1) || (!online && connections != 0) {
+        return
+    }
+
+    select {
+    case h.presenceChanges <- presenceChange{handler: handler, userID: userID, topic: topic, online: online}:
+    default:
+        log.Printf("Presence queue full, dropping %s change for user %s", topic, userID)
+    }
+}